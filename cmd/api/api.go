@@ -1,16 +1,29 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/HollyEllmo/go_rest_tut/cmd/config"
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/address"
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/cart"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/currency"
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/inventory"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/invoice"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/notify"
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/order"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/payment"
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/product"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/purchasing"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/returns"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/shipping"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/tax"
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/user"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/warehouse"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 	"github.com/gorilla/mux"
 )
 
@@ -34,27 +47,98 @@ func (s *APIServer) Run() error {
 	userHandler := user.NewHandler(userStore)
 	userHandler.RegisterRoutes(subrouter)
 
+	currencyStore := currency.NewStore(s.db)
+	currencyConverter := currency.NewConverter(currencyStore, config.Envs.SupportedCurrencies)
+
 	productStore := product.NewStore(s.db)
-	productHandler := product.NewHandler(productStore)
+	productHandler := product.NewHandler(productStore, currencyConverter, userStore)
 	productHandler.RegisterRoutes(subrouter)
 
 	orderStore := order.NewStore(s.db)
 	inventoryStore := inventory.NewStore(s.db)
+	inventoryStore.SetHoldTTL(time.Duration(config.Envs.StockHoldTTLInSeconds) * time.Second)
+	if err := inventoryStore.SetReservationStrategy(types.ReservationStrategy(config.Envs.ReservationStrategy)); err != nil {
+		return err
+	}
+	if err := inventoryStore.SetValuationMethod(types.ValuationMethod(config.Envs.ValuationMethod)); err != nil {
+		return err
+	}
+	inventoryStore.SetNotifier(newStockNotifier())
 	addressStore := address.NewStore(s.db)
+	taxStore := tax.NewStore(s.db)
+	taxCalculator := tax.NewCalculator(taxStore)
+	shippingStore := shipping.NewStore(s.db)
+	shippingCalculator := shipping.NewCalculator(shippingStore)
 	
-	cartHandler := cart.NewHandler(orderStore, productStore, userStore, inventoryStore, addressStore)
+	cartHandler := cart.NewHandler(orderStore, productStore, userStore, inventoryStore, addressStore, taxCalculator, shippingCalculator, currencyConverter)
 	cartHandler.RegisterRoutes(subrouter)
 
-	orderHandler := order.NewHandler(orderStore, userStore)
+	orderHandler := order.NewHandler(orderStore, orderStore, orderStore, orderStore, inventoryStore, userStore)
+	orderHandler.SetExportDir(config.Envs.ExportDir)
+	orderHandler.SetCarrierWebhookSecret(config.Envs.CarrierWebhookSecret)
 	orderHandler.RegisterRoutes(subrouter)
 
 	addressHandler := address.NewHandler(addressStore, userStore)
 	addressHandler.RegisterRoutes(subrouter)
 
-	inventoryHandler := inventory.NewHandler(inventoryStore, userStore)
+	inventoryHandler := inventory.NewHandler(inventoryStore, inventoryStore, inventoryStore, inventoryStore, inventoryStore, inventoryStore, userStore)
 	inventoryHandler.RegisterRoutes(subrouter)
 
+	warehouseStore := warehouse.NewStore(s.db)
+	warehouseHandler := warehouse.NewHandler(warehouseStore, userStore)
+	warehouseHandler.RegisterRoutes(subrouter)
+
+	purchasingStore := purchasing.NewStore(s.db)
+	purchasingHandler := purchasing.NewHandler(purchasingStore, inventoryStore, userStore)
+	purchasingHandler.RegisterRoutes(subrouter)
+
+	taxHandler := tax.NewHandler(taxStore, userStore)
+	taxHandler.RegisterRoutes(subrouter)
+
+	shippingHandler := shipping.NewHandler(shippingStore, userStore)
+	shippingHandler.RegisterRoutes(subrouter)
+
+	currencyHandler := currency.NewHandler(currencyStore, userStore)
+	currencyHandler.RegisterRoutes(subrouter)
+
+	paymentStore := payment.NewStore(s.db)
+	paymentProvider := payment.NewFakeProvider(config.Envs.PaymentWebhookSecret)
+	paymentHandler := payment.NewHandler(paymentStore, orderStore, inventoryStore, userStore, paymentProvider)
+	paymentHandler.RegisterRoutes(subrouter)
+
+	returnStore := returns.NewStore(s.db)
+	returnHandler := returns.NewHandler(returnStore, orderStore, inventoryStore, paymentStore, paymentProvider, userStore)
+	returnHandler.RegisterRoutes(subrouter)
+
+	invoiceStore := invoice.NewStore(s.db)
+	invoiceStore.SetNumberPrefix(config.Envs.InvoiceNumberPrefix)
+	invoiceHandler := invoice.NewHandler(invoiceStore, orderStore, userStore)
+	invoiceHandler.SetSeller(types.InvoiceSeller{
+		Name:    config.Envs.InvoiceSellerName,
+		Address: config.Envs.InvoiceSellerAddress,
+		TaxID:   config.Envs.InvoiceSellerTaxID,
+		Email:   config.Envs.InvoiceSellerEmail,
+	})
+	invoiceHandler.RegisterRoutes(subrouter)
+
+	holdSweeper := inventory.NewHoldSweeper(inventoryStore, orderStore, time.Duration(config.Envs.StockHoldSweepIntervalInSeconds)*time.Second)
+	go holdSweeper.Run(context.Background())
+
 	log.Println("Listening on", s.addr)
 
 	return http.ListenAndServe(s.addr, router)
 }
+
+// newStockNotifier always logs stock events and also sends them to the
+// webhook and by email when those are configured
+func newStockNotifier() types.Notifier {
+	notifiers := []types.Notifier{notify.NewLogNotifier()}
+	if config.Envs.NotifyWebhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhookNotifier(config.Envs.NotifyWebhookURL, config.Envs.NotifyWebhookSecret))
+	}
+	if config.Envs.SMTPHost != "" {
+		sender := notify.NewSMTPSender(config.Envs.SMTPHost, config.Envs.SMTPPort, config.Envs.SMTPUser, config.Envs.SMTPPassword, config.Envs.SMTPFrom)
+		notifiers = append(notifiers, notify.NewEmailNotifier(sender, config.Envs.StockAlertEmail))
+	}
+	return notify.NewMultiNotifier(notifiers...)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -18,6 +19,34 @@ type Config struct {
 	DBName                 string
 	JWTExpirationInSeconds int64
 	JWTSecret              string
+
+	SupportedCurrencies []string
+
+	PaymentWebhookSecret string // payment webhooks are rejected while it is not set
+	CarrierWebhookSecret string // carrier webhooks are rejected while it is not set
+
+	StockHoldTTLInSeconds           int64
+	StockHoldSweepIntervalInSeconds int64
+
+	ReservationStrategy string
+	ValuationMethod     string
+
+	NotifyWebhookURL    string
+	NotifyWebhookSecret string
+	StockAlertEmail     string
+	SMTPHost            string
+	SMTPPort            string
+	SMTPUser            string
+	SMTPPassword        string
+	SMTPFrom            string
+
+	ExportDir string
+
+	InvoiceNumberPrefix  string
+	InvoiceSellerName    string
+	InvoiceSellerAddress string
+	InvoiceSellerTaxID   string
+	InvoiceSellerEmail   string
 }
 
 var Envs = initConfig()
@@ -33,6 +62,32 @@ func initConfig() Config {
 		DBName:                 getEnv("DB_NAME", "ecom"),
 		JWTSecret:              getEnv("JWT_SECRET", "secret"),
 		JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", 3600*24*7),
+		SupportedCurrencies:    getEnvAsList("SUPPORTED_CURRENCIES", []string{"USD", "EUR"}),
+		PaymentWebhookSecret:   getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+		CarrierWebhookSecret:   getEnv("CARRIER_WEBHOOK_SECRET", ""),
+
+		StockHoldTTLInSeconds:           getEnvAsInt("STOCK_HOLD_TTL", 15*60),
+		StockHoldSweepIntervalInSeconds: getEnvAsInt("STOCK_HOLD_SWEEP_INTERVAL", 60),
+
+		ReservationStrategy: getEnv("RESERVATION_STRATEGY", "priority"),
+		ValuationMethod:     getEnv("VALUATION_METHOD", "fifo"),
+
+		NotifyWebhookURL:    getEnv("NOTIFY_WEBHOOK_URL", ""),
+		NotifyWebhookSecret: getEnv("NOTIFY_WEBHOOK_SECRET", ""),
+		StockAlertEmail:     getEnv("STOCK_ALERT_EMAIL", ""),
+		SMTPHost:            getEnv("SMTP_HOST", ""),
+		SMTPPort:            getEnv("SMTP_PORT", "587"),
+		SMTPUser:            getEnv("SMTP_USER", ""),
+		SMTPPassword:        getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:            getEnv("SMTP_FROM", "shop@localhost"),
+
+		ExportDir: getEnv("EXPORT_DIR", "exports"),
+
+		InvoiceNumberPrefix:  getEnv("INVOICE_NUMBER_PREFIX", "INV"),
+		InvoiceSellerName:    getEnv("INVOICE_SELLER_NAME", "Go REST Shop"),
+		InvoiceSellerAddress: getEnv("INVOICE_SELLER_ADDRESS", ""),
+		InvoiceSellerTaxID:   getEnv("INVOICE_SELLER_TAX_ID", ""),
+		InvoiceSellerEmail:   getEnv("INVOICE_SELLER_EMAIL", ""),
 	}
 }
 
@@ -55,3 +110,18 @@ func getEnvAsInt(key string, fallback int) int64 {
 	}
 	return int64(fallback)
 }
+
+func getEnvAsList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
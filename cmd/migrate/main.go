@@ -21,6 +21,7 @@ func main() {
 		Net:                  "tcp",
 		AllowNativePasswords: true,
 		ParseTime:            true,
+		MultiStatements:      true,
 	})
 
 	if err != nil {
@@ -81,6 +82,58 @@ func main() {
 				v = 20250726103947
 			case "20250726103948":
 				v = 20250726103948
+			case "20250728070940":
+				v = 20250728070940
+			case "20261018100000":
+				v = 20261018100000
+			case "20261018100100":
+				v = 20261018100100
+			case "20261018100200":
+				v = 20261018100200
+			case "20261018100300":
+				v = 20261018100300
+			case "20261018100400":
+				v = 20261018100400
+			case "20261018100500":
+				v = 20261018100500
+			case "20261018100600":
+				v = 20261018100600
+			case "20261018100700":
+				v = 20261018100700
+			case "20261018100800":
+				v = 20261018100800
+			case "20261018100900":
+				v = 20261018100900
+			case "20261018101000":
+				v = 20261018101000
+			case "20261018101100":
+				v = 20261018101100
+			case "20261018101200":
+				v = 20261018101200
+			case "20261018101300":
+				v = 20261018101300
+			case "20261018101400":
+				v = 20261018101400
+			case "20261018101500":
+				v = 20261018101500
+			case "20261018101600":
+				v = 20261018101600
+			case "20261018101700":
+				v = 20261018101700
+			case "20261018101800":
+				v = 20261018101800
+			case "20261018101900":
+				v = 20261018101900
+			case "20261018102000":
+				v = 20261018102000
+			case "20261018102100":
+				v = 20261018102100
+			case "20261018102200":
+				v = 20261018102200
+			case "20261018102300":
+				v = 20261018102300
+			case "20261018102400":
+				v = 20261018102400
 			default:
 				log.Fatal("Unknown version:", version)
 			}
@@ -0,0 +1,15 @@
+ALTER TABLE order_items
+  DROP COLUMN `total`,
+  DROP COLUMN `tax`,
+  DROP COLUMN `subtotal`,
+  DROP COLUMN `tax_rate`;
+
+ALTER TABLE orders
+  DROP COLUMN `tax`,
+  DROP COLUMN `subtotal`;
+
+ALTER TABLE products DROP COLUMN `tax_class`;
+
+DROP TABLE tax_rates;
+
+ALTER TABLE users DROP COLUMN `role`;
@@ -0,0 +1,32 @@
+-- admins manage tax rates and the rest of the store configuration
+ALTER TABLE users ADD COLUMN `role` ENUM('customer', 'admin') NOT NULL DEFAULT 'customer' AFTER `password`;
+
+CREATE TABLE tax_rates (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(100) NOT NULL, -- e.g., "VAT", "CA Sales Tax"
+  `country` VARCHAR(100) NOT NULL,
+  `state_province` VARCHAR(100) NULL, -- NULL applies to the whole country
+  `tax_class` VARCHAR(50) NOT NULL DEFAULT 'standard',
+  `rate` DECIMAL(6, 4) NOT NULL, -- 0.2000 = 20%
+  `inclusive` BOOLEAN NOT NULL DEFAULT FALSE, -- prices already include this tax
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_region (country, state_province),
+  UNIQUE KEY uniq_region_class (country, state_province, tax_class)
+);
+
+ALTER TABLE products ADD COLUMN `tax_class` VARCHAR(50) NOT NULL DEFAULT 'standard' AFTER `price`;
+
+ALTER TABLE orders
+  ADD COLUMN `subtotal` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `userId`,
+  ADD COLUMN `tax` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `subtotal`;
+
+UPDATE orders SET subtotal = total WHERE subtotal = 0;
+
+ALTER TABLE order_items
+  ADD COLUMN `tax_rate` DECIMAL(6, 4) NOT NULL DEFAULT 0 AFTER `price`,
+  ADD COLUMN `subtotal` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `tax_rate`,
+  ADD COLUMN `tax` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `subtotal`,
+  ADD COLUMN `total` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `tax`;
+
+UPDATE order_items SET subtotal = price * quantity, total = price * quantity WHERE total = 0;
@@ -0,0 +1,10 @@
+ALTER TABLE orders
+  DROP FOREIGN KEY fk_orders_shipping_method,
+  DROP COLUMN `shipping_cost`,
+  DROP COLUMN `shipping_method_id`;
+
+DROP TABLE shipping_methods;
+DROP TABLE shipping_zone_regions;
+DROP TABLE shipping_zones;
+
+ALTER TABLE products DROP COLUMN `weight_grams`;
@@ -0,0 +1,38 @@
+ALTER TABLE products ADD COLUMN `weight_grams` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `tax_class`;
+
+CREATE TABLE shipping_zones (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(100) NOT NULL, -- e.g., "Domestic", "EU"
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE shipping_zone_regions (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `zone_id` INT UNSIGNED NOT NULL,
+  `country` VARCHAR(100) NOT NULL,
+  `state_province` VARCHAR(100) NULL, -- NULL covers the whole country
+  PRIMARY KEY (id),
+  INDEX idx_region (country, state_province),
+  FOREIGN KEY (zone_id) REFERENCES shipping_zones(id) ON DELETE CASCADE
+);
+
+CREATE TABLE shipping_methods (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `zone_id` INT UNSIGNED NOT NULL,
+  `name` VARCHAR(100) NOT NULL, -- e.g., "Standard", "Express"
+  `rate_type` ENUM('FLAT', 'WEIGHT', 'FREE_OVER') NOT NULL,
+  `base_rate` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  `per_kg_rate` DECIMAL(10, 2) NOT NULL DEFAULT 0, -- WEIGHT only
+  `free_threshold` DECIMAL(10, 2) NULL, -- FREE_OVER only
+  `is_active` BOOLEAN NOT NULL DEFAULT TRUE,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_zone_id (zone_id),
+  FOREIGN KEY (zone_id) REFERENCES shipping_zones(id) ON DELETE CASCADE
+);
+
+ALTER TABLE orders
+  ADD COLUMN `shipping_method_id` INT UNSIGNED NULL AFTER `tax`,
+  ADD COLUMN `shipping_cost` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `shipping_method_id`,
+  ADD CONSTRAINT fk_orders_shipping_method FOREIGN KEY (shipping_method_id) REFERENCES shipping_methods(id) ON DELETE SET NULL;
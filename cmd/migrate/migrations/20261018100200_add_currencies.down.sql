@@ -0,0 +1,8 @@
+ALTER TABLE orders
+  DROP COLUMN `exchange_rate`,
+  DROP COLUMN `currency`;
+
+DROP TABLE exchange_rates;
+DROP TABLE product_prices;
+
+ALTER TABLE products DROP COLUMN `currency`;
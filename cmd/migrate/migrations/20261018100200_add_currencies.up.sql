@@ -0,0 +1,22 @@
+ALTER TABLE products ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'USD' AFTER `price`;
+
+CREATE TABLE product_prices (
+  `product_id` INT UNSIGNED NOT NULL,
+  `currency` CHAR(3) NOT NULL,
+  `price` DECIMAL(10, 2) NOT NULL, -- overrides the converted base price
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (product_id, currency),
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE TABLE exchange_rates (
+  `base_currency` CHAR(3) NOT NULL,
+  `quote_currency` CHAR(3) NOT NULL,
+  `rate` DECIMAL(18, 8) NOT NULL, -- 1 base = rate quote
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (base_currency, quote_currency)
+);
+
+ALTER TABLE orders
+  ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'USD' AFTER `total`,
+  ADD COLUMN `exchange_rate` DECIMAL(18, 8) NOT NULL DEFAULT 1 AFTER `currency`; -- base currency to order currency at checkout
@@ -0,0 +1,4 @@
+DROP TABLE payments;
+
+UPDATE orders SET status = 'pending' WHERE status = 'paid';
+ALTER TABLE orders MODIFY COLUMN `status` ENUM('pending', 'completed', 'cancelled') NOT NULL DEFAULT 'pending';
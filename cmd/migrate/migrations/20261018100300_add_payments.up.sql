@@ -0,0 +1,18 @@
+ALTER TABLE orders MODIFY COLUMN `status` ENUM('pending', 'paid', 'completed', 'cancelled') NOT NULL DEFAULT 'pending';
+
+CREATE TABLE payments (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `provider` VARCHAR(50) NOT NULL,
+  `provider_payment_id` VARCHAR(255) NOT NULL, -- the intent ID at the provider
+  `amount` DECIMAL(10, 2) NOT NULL,
+  `currency` CHAR(3) NOT NULL,
+  `status` ENUM('pending', 'succeeded', 'failed', 'expired') NOT NULL DEFAULT 'pending',
+  `failure_reason` VARCHAR(255) NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uq_provider_payment (provider, provider_payment_id),
+  INDEX idx_order_id (order_id),
+  FOREIGN KEY (order_id) REFERENCES orders(id)
+);
@@ -0,0 +1,8 @@
+DROP TABLE refunds;
+DROP TABLE return_items;
+DROP TABLE returns;
+
+UPDATE orders SET status = 'completed' WHERE status = 'refunded';
+ALTER TABLE orders
+  DROP COLUMN `refunded_amount`,
+  MODIFY COLUMN `status` ENUM('pending', 'paid', 'completed', 'cancelled') NOT NULL DEFAULT 'pending';
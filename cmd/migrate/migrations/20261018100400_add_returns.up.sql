@@ -0,0 +1,49 @@
+ALTER TABLE orders
+  MODIFY COLUMN `status` ENUM('pending', 'paid', 'completed', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending',
+  ADD COLUMN `refunded_amount` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `total`;
+
+CREATE TABLE returns (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `status` ENUM('requested', 'approved', 'rejected', 'received', 'refunded') NOT NULL DEFAULT 'requested',
+  `reason` TEXT NOT NULL,
+  `currency` CHAR(3) NOT NULL, -- currency of the order
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_order_id (order_id),
+  INDEX idx_status (status),
+  FOREIGN KEY (order_id) REFERENCES orders(id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE return_items (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `return_id` INT UNSIGNED NOT NULL,
+  `order_item_id` INT UNSIGNED NOT NULL,
+  `product_id` INT UNSIGNED NOT NULL,
+  `quantity` INT NOT NULL,
+  `restockable` BOOLEAN NOT NULL DEFAULT TRUE, -- set when the goods are received
+  `refund_amount` DECIMAL(10, 2) NOT NULL,
+  PRIMARY KEY (id),
+  INDEX idx_order_item_id (order_item_id),
+  FOREIGN KEY (return_id) REFERENCES returns(id) ON DELETE CASCADE,
+  FOREIGN KEY (order_item_id) REFERENCES order_items(id)
+);
+
+CREATE TABLE refunds (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `return_id` INT UNSIGNED NULL,
+  `payment_id` INT UNSIGNED NULL,
+  `amount` DECIMAL(10, 2) NOT NULL,
+  `currency` CHAR(3) NOT NULL,
+  `provider_refund_id` VARCHAR(255) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_order_id (order_id),
+  FOREIGN KEY (order_id) REFERENCES orders(id),
+  FOREIGN KEY (return_id) REFERENCES returns(id),
+  FOREIGN KEY (payment_id) REFERENCES payments(id)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE stock_levels (
+  `product_id` INT UNSIGNED NOT NULL,
+  `on_hand` INT NOT NULL DEFAULT 0,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (product_id),
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+INSERT INTO stock_levels (product_id, on_hand)
+SELECT product_id, SUM(CASE WHEN movement_type = 'IN' THEN quantity ELSE -quantity END)
+FROM inventory_movements
+GROUP BY product_id;
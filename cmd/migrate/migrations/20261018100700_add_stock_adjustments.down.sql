@@ -0,0 +1,4 @@
+DROP TABLE stock_take_lines;
+DROP TABLE stock_takes;
+
+ALTER TABLE inventory_movements DROP COLUMN `reason_code`;
@@ -0,0 +1,25 @@
+ALTER TABLE inventory_movements
+  ADD COLUMN `reason_code` ENUM('DAMAGED', 'LOST', 'THEFT', 'EXPIRED', 'FOUND', 'COUNT_CORRECTION', 'OTHER') NULL AFTER `reason`;
+
+CREATE TABLE stock_takes (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `status` ENUM('OPEN', 'POSTED', 'CANCELLED') NOT NULL DEFAULT 'OPEN',
+  `note` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_by` INT UNSIGNED NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `posted_at` TIMESTAMP NULL,
+  PRIMARY KEY (id),
+  INDEX idx_status (status),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE TABLE stock_take_lines (
+  `stock_take_id` INT UNSIGNED NOT NULL,
+  `product_id` INT UNSIGNED NOT NULL,
+  `counted_quantity` INT UNSIGNED NOT NULL,
+  `expected_quantity` INT NULL, -- frozen when the stock take is posted
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (stock_take_id, product_id),
+  FOREIGN KEY (stock_take_id) REFERENCES stock_takes(id) ON DELETE CASCADE,
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
@@ -0,0 +1,25 @@
+DROP TABLE stock_transfers;
+
+-- stock of all warehouses is merged back into a single balance per product
+DELETE FROM stock_levels;
+ALTER TABLE stock_levels DROP FOREIGN KEY fk_stock_levels_warehouse;
+ALTER TABLE stock_levels DROP PRIMARY KEY, DROP COLUMN `warehouse_id`, ADD PRIMARY KEY (product_id);
+INSERT INTO stock_levels (product_id, on_hand)
+SELECT product_id, SUM(CASE WHEN movement_type = 'IN' THEN quantity ELSE -quantity END)
+FROM inventory_movements
+GROUP BY product_id;
+
+ALTER TABLE stock_takes DROP FOREIGN KEY fk_stock_takes_warehouse;
+ALTER TABLE stock_takes DROP COLUMN `warehouse_id`;
+
+ALTER TABLE stock_holds DROP FOREIGN KEY fk_stock_holds_warehouse;
+ALTER TABLE stock_holds DROP COLUMN `warehouse_id`;
+
+DELETE FROM inventory_movements WHERE reference_type = 'TRANSFER';
+ALTER TABLE inventory_movements DROP FOREIGN KEY fk_movements_warehouse;
+ALTER TABLE inventory_movements
+  DROP INDEX idx_product_warehouse,
+  DROP COLUMN `warehouse_id`,
+  MODIFY COLUMN `reference_type` ENUM('ORDER', 'RESTOCK', 'ADJUSTMENT', 'RETURN') NULL;
+
+DROP TABLE warehouses;
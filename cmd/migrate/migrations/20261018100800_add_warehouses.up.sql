@@ -0,0 +1,60 @@
+CREATE TABLE warehouses (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `code` VARCHAR(20) NOT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  `country` VARCHAR(100) NOT NULL,
+  `state_province` VARCHAR(100) NULL,
+  `priority` INT NOT NULL DEFAULT 0, -- lower ships first
+  `is_default` BOOLEAN NOT NULL DEFAULT FALSE,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uk_code (code)
+);
+
+-- all existing stock lives in the default warehouse
+INSERT INTO warehouses (code, name, country, priority, is_default) VALUES ('MAIN', 'Main warehouse', 'United States', 0, TRUE);
+SET @default_warehouse = LAST_INSERT_ID();
+
+ALTER TABLE inventory_movements
+  ADD COLUMN `warehouse_id` INT UNSIGNED NULL AFTER `product_id`,
+  MODIFY COLUMN `reference_type` ENUM('ORDER', 'RESTOCK', 'ADJUSTMENT', 'RETURN', 'TRANSFER') NULL;
+UPDATE inventory_movements SET warehouse_id = @default_warehouse;
+ALTER TABLE inventory_movements
+  MODIFY COLUMN `warehouse_id` INT UNSIGNED NOT NULL,
+  ADD INDEX idx_product_warehouse (product_id, warehouse_id),
+  ADD CONSTRAINT fk_movements_warehouse FOREIGN KEY (warehouse_id) REFERENCES warehouses(id);
+
+ALTER TABLE stock_levels ADD COLUMN `warehouse_id` INT UNSIGNED NULL AFTER `product_id`;
+UPDATE stock_levels SET warehouse_id = @default_warehouse;
+ALTER TABLE stock_levels
+  MODIFY COLUMN `warehouse_id` INT UNSIGNED NOT NULL,
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (product_id, warehouse_id),
+  ADD CONSTRAINT fk_stock_levels_warehouse FOREIGN KEY (warehouse_id) REFERENCES warehouses(id);
+
+ALTER TABLE stock_holds ADD COLUMN `warehouse_id` INT UNSIGNED NULL AFTER `product_id`;
+UPDATE stock_holds SET warehouse_id = @default_warehouse;
+ALTER TABLE stock_holds
+  MODIFY COLUMN `warehouse_id` INT UNSIGNED NOT NULL,
+  ADD CONSTRAINT fk_stock_holds_warehouse FOREIGN KEY (warehouse_id) REFERENCES warehouses(id);
+
+ALTER TABLE stock_takes ADD COLUMN `warehouse_id` INT UNSIGNED NULL AFTER `id`;
+UPDATE stock_takes SET warehouse_id = @default_warehouse;
+ALTER TABLE stock_takes
+  MODIFY COLUMN `warehouse_id` INT UNSIGNED NOT NULL,
+  ADD CONSTRAINT fk_stock_takes_warehouse FOREIGN KEY (warehouse_id) REFERENCES warehouses(id);
+
+CREATE TABLE stock_transfers (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `product_id` INT UNSIGNED NOT NULL,
+  `from_warehouse_id` INT UNSIGNED NOT NULL,
+  `to_warehouse_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+  `note` VARCHAR(100) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_product_id (product_id),
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+  FOREIGN KEY (from_warehouse_id) REFERENCES warehouses(id),
+  FOREIGN KEY (to_warehouse_id) REFERENCES warehouses(id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE stock_subscriptions;
+DROP TABLE stock_thresholds;
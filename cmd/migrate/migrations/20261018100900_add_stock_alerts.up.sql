@@ -0,0 +1,23 @@
+CREATE TABLE stock_thresholds (
+  `product_id` INT UNSIGNED NOT NULL,
+  `reorder_level` INT UNSIGNED NOT NULL DEFAULT 0, -- 0 alerts only when the product runs out
+  `alert_state` ENUM('OK', 'LOW_STOCK', 'OUT_OF_STOCK') NOT NULL DEFAULT 'OK',
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (product_id),
+  INDEX idx_alert_state (alert_state),
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE TABLE stock_subscriptions (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `product_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `status` ENUM('ACTIVE', 'NOTIFIED', 'CANCELLED') NOT NULL DEFAULT 'ACTIVE',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `notified_at` TIMESTAMP NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY uk_product_user (product_id, user_id),
+  INDEX idx_product_status (product_id, status),
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+UPDATE inventory_movements SET reference_type = 'RESTOCK' WHERE reference_type = 'PURCHASE_ORDER';
+ALTER TABLE inventory_movements
+  MODIFY COLUMN `reference_type` ENUM('ORDER', 'RESTOCK', 'ADJUSTMENT', 'RETURN', 'TRANSFER') NULL;
+
+DROP TABLE purchase_order_lines;
+DROP TABLE purchase_orders;
+DROP TABLE suppliers;
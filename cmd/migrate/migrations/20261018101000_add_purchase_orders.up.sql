@@ -0,0 +1,44 @@
+CREATE TABLE suppliers (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(255) NOT NULL,
+  `email` VARCHAR(255) NOT NULL DEFAULT '',
+  `phone` VARCHAR(50) NOT NULL DEFAULT '',
+  `lead_time_days` INT UNSIGNED NOT NULL DEFAULT 7,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE purchase_orders (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `supplier_id` INT UNSIGNED NOT NULL,
+  `warehouse_id` INT UNSIGNED NOT NULL,
+  `status` ENUM('OPEN', 'PARTIALLY_RECEIVED', 'RECEIVED', 'CANCELLED') NOT NULL DEFAULT 'OPEN',
+  `expected_at` DATE NULL,
+  `note` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_by` INT UNSIGNED NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_status (status),
+  CONSTRAINT fk_purchase_orders_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+  CONSTRAINT fk_purchase_orders_warehouse FOREIGN KEY (warehouse_id) REFERENCES warehouses(id),
+  CONSTRAINT fk_purchase_orders_user FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE TABLE purchase_order_lines (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `purchase_order_id` INT UNSIGNED NOT NULL,
+  `product_id` INT UNSIGNED NOT NULL,
+  `quantity_ordered` INT UNSIGNED NOT NULL,
+  `quantity_received` INT UNSIGNED NOT NULL DEFAULT 0,
+  `unit_cost` DECIMAL(10,2) NOT NULL DEFAULT 0,
+  `expected_at` DATE NULL, -- overrides the date of the purchase order
+  PRIMARY KEY (id),
+  UNIQUE KEY uk_order_product (purchase_order_id, product_id),
+  INDEX idx_product_id (product_id),
+  FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders(id) ON DELETE CASCADE,
+  FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+ALTER TABLE inventory_movements
+  MODIFY COLUMN `reference_type` ENUM('ORDER', 'RESTOCK', 'ADJUSTMENT', 'RETURN', 'TRANSFER', 'PURCHASE_ORDER') NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE inventory_movements
+  DROP INDEX idx_product_id_id,
+  DROP COLUMN `balance_after`;
@@ -0,0 +1,12 @@
+ALTER TABLE inventory_movements
+  ADD COLUMN `balance_after` INT NULL AFTER `quantity`, -- on hand in the warehouse after the movement
+  ADD INDEX idx_product_id_id (product_id, id);
+
+-- replay the ledger of every product in every warehouse
+UPDATE inventory_movements m
+JOIN (
+  SELECT id, SUM(CASE WHEN movement_type = 'IN' THEN quantity ELSE -quantity END)
+    OVER (PARTITION BY product_id, warehouse_id ORDER BY id) AS balance
+  FROM inventory_movements
+) b ON b.id = m.id
+SET m.balance_after = b.balance;
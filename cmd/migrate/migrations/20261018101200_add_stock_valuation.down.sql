@@ -0,0 +1,7 @@
+ALTER TABLE order_items DROP COLUMN `unit_cost`;
+ALTER TABLE stock_holds DROP COLUMN `unit_cost`;
+
+DROP TABLE product_costs;
+DROP TABLE cost_layers;
+
+ALTER TABLE inventory_movements DROP COLUMN `unit_cost`;
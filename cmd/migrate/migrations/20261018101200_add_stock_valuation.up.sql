@@ -0,0 +1,43 @@
+ALTER TABLE inventory_movements
+  ADD COLUMN `unit_cost` DECIMAL(10,2) NULL AFTER `balance_after`; -- cost per unit of IN movements, in the base currency
+
+-- FIFO cost layers: every IN movement opens a layer, OUT movements consume the oldest first
+CREATE TABLE cost_layers (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `product_id` INT UNSIGNED NOT NULL,
+  `movement_id` INT UNSIGNED NULL, -- NULL for the opening layer of stock received before costs were tracked
+  `unit_cost` DECIMAL(10,2) NOT NULL,
+  `quantity_remaining` INT UNSIGNED NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  INDEX idx_product_remaining (product_id, quantity_remaining),
+  FOREIGN KEY (product_id) REFERENCES products(id),
+  FOREIGN KEY (movement_id) REFERENCES inventory_movements(id)
+);
+
+-- Weighted average cost of all units of a product; the row also serialises cost updates of the product
+CREATE TABLE product_costs (
+  `product_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL DEFAULT 0,
+  `average_cost` DECIMAL(10,2) NOT NULL DEFAULT 0,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (product_id),
+  FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+-- cost of goods sold, estimated when the stock is reserved
+ALTER TABLE stock_holds
+  ADD COLUMN `unit_cost` DECIMAL(10,2) NULL AFTER `quantity`;
+ALTER TABLE order_items
+  ADD COLUMN `unit_cost` DECIMAL(10,2) NULL AFTER `price`;
+
+-- stock on hand today has no known cost: open it at zero so FIFO and the average cover every unit
+INSERT INTO product_costs (product_id, quantity, average_cost)
+SELECT product_id, SUM(on_hand), 0
+FROM stock_levels
+GROUP BY product_id
+HAVING SUM(on_hand) > 0;
+
+INSERT INTO cost_layers (product_id, movement_id, unit_cost, quantity_remaining)
+SELECT product_id, NULL, 0, quantity
+FROM product_costs;
@@ -0,0 +1,9 @@
+ALTER TABLE stock_holds
+  DROP FOREIGN KEY fk_stock_holds_lot,
+  DROP COLUMN `lot_id`;
+
+ALTER TABLE inventory_movements
+  DROP FOREIGN KEY fk_movements_lot,
+  DROP COLUMN `lot_id`;
+
+DROP TABLE stock_lots;
@@ -0,0 +1,23 @@
+-- lots (batches) of a product in a warehouse; stock received without a lot number stays untracked
+CREATE TABLE stock_lots (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `product_id` INT UNSIGNED NOT NULL,
+  `warehouse_id` INT UNSIGNED NOT NULL,
+  `lot_number` VARCHAR(64) NOT NULL,
+  `expires_at` DATE NULL,
+  `quantity_on_hand` INT UNSIGNED NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uk_product_warehouse_lot (product_id, warehouse_id, lot_number),
+  INDEX idx_expires_at (expires_at),
+  FOREIGN KEY (product_id) REFERENCES products(id),
+  FOREIGN KEY (warehouse_id) REFERENCES warehouses(id)
+);
+
+ALTER TABLE inventory_movements
+  ADD COLUMN `lot_id` INT UNSIGNED NULL AFTER `warehouse_id`,
+  ADD CONSTRAINT fk_movements_lot FOREIGN KEY (lot_id) REFERENCES stock_lots(id);
+
+ALTER TABLE stock_holds
+  ADD COLUMN `lot_id` INT UNSIGNED NULL AFTER `warehouse_id`,
+  ADD CONSTRAINT fk_stock_holds_lot FOREIGN KEY (lot_id) REFERENCES stock_lots(id);
@@ -0,0 +1,3 @@
+DROP TABLE order_item_components;
+
+DROP TABLE bundle_components;
@@ -0,0 +1,22 @@
+-- products a bundle (gift set, kit) is made of; bundles hold no stock of their own
+CREATE TABLE bundle_components (
+  `bundle_id` INT UNSIGNED NOT NULL,
+  `component_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+  PRIMARY KEY (bundle_id, component_id),
+  INDEX idx_component_id (component_id),
+  FOREIGN KEY (bundle_id) REFERENCES products(id) ON DELETE CASCADE,
+  FOREIGN KEY (component_id) REFERENCES products(id)
+);
+
+-- component breakdown of the bundle lines of an order, quantity is for the whole line
+CREATE TABLE order_item_components (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_item_id` INT UNSIGNED NOT NULL,
+  `product_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+  `unit_cost` DECIMAL(10,2) NULL,
+  PRIMARY KEY (id),
+  FOREIGN KEY (order_item_id) REFERENCES order_items(id) ON DELETE CASCADE,
+  FOREIGN KEY (product_id) REFERENCES products(id)
+);
@@ -0,0 +1,6 @@
+DROP TABLE backorders;
+
+ALTER TABLE stock_holds
+  DROP COLUMN `backordered`;
+
+DROP TABLE stock_policies;
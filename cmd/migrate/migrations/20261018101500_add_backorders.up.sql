@@ -0,0 +1,32 @@
+-- whether a product can be ordered beyond its available stock; products without a row are deny
+CREATE TABLE stock_policies (
+  `product_id` INT UNSIGNED NOT NULL,
+  `policy` ENUM('deny', 'backorder', 'preorder') NOT NULL DEFAULT 'deny',
+  `backorder_limit` INT UNSIGNED NULL,
+  `release_date` DATE NULL,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (product_id),
+  FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+-- holds for units ordered beyond stock; committing them takes the ledger below zero
+ALTER TABLE stock_holds
+  ADD COLUMN `backordered` BOOLEAN NOT NULL DEFAULT FALSE AFTER `quantity`;
+
+-- paid units still owed to an order, filled from incoming stock oldest first
+CREATE TABLE backorders (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `product_id` INT UNSIGNED NOT NULL,
+  `warehouse_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+  `allocated` INT UNSIGNED NOT NULL DEFAULT 0,
+  `status` ENUM('OPEN', 'ALLOCATED') NOT NULL DEFAULT 'OPEN',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `allocated_at` TIMESTAMP NULL,
+  PRIMARY KEY (id),
+  INDEX idx_product_warehouse_status (product_id, warehouse_id, status),
+  FOREIGN KEY (order_id) REFERENCES orders(id),
+  FOREIGN KEY (product_id) REFERENCES products(id),
+  FOREIGN KEY (warehouse_id) REFERENCES warehouses(id)
+);
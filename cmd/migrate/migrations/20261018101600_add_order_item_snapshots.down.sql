@@ -0,0 +1,12 @@
+ALTER TABLE order_item_components
+  DROP COLUMN `product_sku`,
+  DROP COLUMN `product_name`;
+
+ALTER TABLE order_items
+  DROP COLUMN `product_image`,
+  DROP COLUMN `product_sku`,
+  DROP COLUMN `product_name`;
+
+ALTER TABLE products
+  DROP INDEX uk_products_sku,
+  DROP COLUMN `sku`;
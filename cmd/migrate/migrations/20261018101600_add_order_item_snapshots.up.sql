@@ -0,0 +1,31 @@
+ALTER TABLE products
+  ADD COLUMN `sku` VARCHAR(64) NULL AFTER `name`,
+  ADD UNIQUE KEY uk_products_sku (sku);
+
+-- the product as it was sold, so renaming or removing it later leaves order history untouched
+ALTER TABLE order_items
+  ADD COLUMN `product_name` VARCHAR(255) NULL AFTER `productId`,
+  ADD COLUMN `product_sku` VARCHAR(64) NULL AFTER `product_name`,
+  ADD COLUMN `product_image` VARCHAR(255) NULL AFTER `product_sku`;
+
+UPDATE order_items oi
+LEFT JOIN products p ON p.id = oi.productId
+SET oi.product_name = COALESCE(p.name, CONCAT('Product #', oi.productId)),
+    oi.product_sku = p.sku,
+    oi.product_image = COALESCE(p.image, '');
+
+ALTER TABLE order_items
+  MODIFY COLUMN `product_name` VARCHAR(255) NOT NULL,
+  MODIFY COLUMN `product_image` VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE order_item_components
+  ADD COLUMN `product_name` VARCHAR(255) NULL AFTER `product_id`,
+  ADD COLUMN `product_sku` VARCHAR(64) NULL AFTER `product_name`;
+
+UPDATE order_item_components c
+LEFT JOIN products p ON p.id = c.product_id
+SET c.product_name = COALESCE(p.name, CONCAT('Product #', c.product_id)),
+    c.product_sku = p.sku;
+
+ALTER TABLE order_item_components
+  MODIFY COLUMN `product_name` VARCHAR(255) NOT NULL;
@@ -0,0 +1,20 @@
+-- the shipping and billing addresses of an order, copied from the user's addresses at checkout.
+-- Orders placed before this keep only their formatted orders.address.
+CREATE TABLE order_addresses (
+  `order_id` INT UNSIGNED NOT NULL,
+  `type` ENUM('shipping', 'billing') NOT NULL,
+  `title` VARCHAR(100) NOT NULL DEFAULT '',
+  `first_name` VARCHAR(100) NOT NULL,
+  `last_name` VARCHAR(100) NOT NULL,
+  `company` VARCHAR(100) NULL,
+  `address_line_1` VARCHAR(255) NOT NULL,
+  `address_line_2` VARCHAR(255) NULL,
+  `city` VARCHAR(100) NOT NULL,
+  `state_province` VARCHAR(100) NOT NULL,
+  `postal_code` VARCHAR(20) NOT NULL,
+  `country` VARCHAR(100) NOT NULL,
+  `phone` VARCHAR(20) NULL,
+  PRIMARY KEY (order_id, type),
+  INDEX idx_type_country (type, country),
+  FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE orders
+  DROP INDEX idx_orders_user_created;
@@ -0,0 +1,3 @@
+-- serves the order list, newest first, and its (createdAt, id) cursors
+ALTER TABLE orders
+  ADD INDEX idx_orders_user_created (userId, createdAt, id);
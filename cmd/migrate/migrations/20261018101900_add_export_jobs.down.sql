@@ -0,0 +1,4 @@
+ALTER TABLE orders
+  DROP INDEX idx_orders_created;
+
+DROP TABLE IF EXISTS export_jobs;
@@ -0,0 +1,20 @@
+-- background order exports, written to a file for download
+CREATE TABLE IF NOT EXISTS export_jobs (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` INT UNSIGNED NOT NULL,
+  `format` ENUM('csv', 'ndjson', 'xlsx') NOT NULL,
+  `filters` JSON NOT NULL,
+  `status` ENUM('PENDING', 'RUNNING', 'DONE', 'FAILED') NOT NULL DEFAULT 'PENDING',
+  `file_path` VARCHAR(255) NULL,
+  `row_count` INT UNSIGNED NOT NULL DEFAULT 0,
+  `error` TEXT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `finished_at` TIMESTAMP NULL,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+);
+
+-- exports read all orders oldest first, past the last (createdAt, id) seen
+ALTER TABLE orders
+  ADD INDEX idx_orders_created (createdAt, id);
@@ -0,0 +1,28 @@
+-- the last invoice number of each year. Issuing an invoice locks its year's row
+-- until the invoice is stored, so numbers are handed out in order and a failed
+-- invoice gives its number back.
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+  `series` SMALLINT UNSIGNED NOT NULL,
+  `last_number` INT UNSIGNED NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (`series`)
+);
+
+-- invoices as issued, never updated
+CREATE TABLE IF NOT EXISTS invoices (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `number` VARCHAR(32) NOT NULL,
+  `currency` CHAR(3) NOT NULL,
+  `subtotal` DECIMAL(10, 2) NOT NULL,
+  `tax` DECIMAL(10, 2) NOT NULL,
+  `shipping_cost` DECIMAL(10, 2) NOT NULL,
+  `total` DECIMAL(10, 2) NOT NULL,
+  `issued_at` TIMESTAMP NOT NULL,
+  `pdf` MEDIUMBLOB NOT NULL,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_invoices_order` (`order_id`),
+  UNIQUE KEY `uk_invoices_number` (`number`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`)
+);
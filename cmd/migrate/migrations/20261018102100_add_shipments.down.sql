@@ -0,0 +1,7 @@
+DROP TABLE shipment_events;
+DROP TABLE shipment_items;
+DROP TABLE shipments;
+
+UPDATE orders SET status = 'paid' WHERE status = 'partially_shipped';
+ALTER TABLE orders
+  MODIFY COLUMN `status` ENUM('pending', 'paid', 'completed', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending';
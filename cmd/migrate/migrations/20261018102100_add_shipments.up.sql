@@ -0,0 +1,45 @@
+ALTER TABLE orders
+  MODIFY COLUMN `status` ENUM('pending', 'paid', 'partially_shipped', 'completed', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending';
+
+-- parcels sent for an order; carriers report on them by tracking number
+CREATE TABLE shipments (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `carrier` VARCHAR(50) NOT NULL,
+  `tracking_number` VARCHAR(100) NOT NULL,
+  `status` ENUM('shipped', 'in_transit', 'out_for_delivery', 'delivered', 'exception') NOT NULL DEFAULT 'shipped',
+  `shipped_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `delivered_at` TIMESTAMP NULL,
+  `last_event_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- when the current status happened
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_shipments_tracking` (`carrier`, `tracking_number`),
+  INDEX `idx_shipments_order` (`order_id`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`)
+);
+
+CREATE TABLE shipment_items (
+  `shipment_id` INT UNSIGNED NOT NULL,
+  `order_item_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+
+  PRIMARY KEY (`shipment_id`, `order_item_id`),
+  INDEX `idx_shipment_items_order_item` (`order_item_id`),
+  FOREIGN KEY (`shipment_id`) REFERENCES shipments(`id`) ON DELETE CASCADE,
+  FOREIGN KEY (`order_item_id`) REFERENCES order_items(`id`)
+);
+
+-- tracking history; a carrier resending an update does not add it twice
+CREATE TABLE shipment_events (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `shipment_id` INT UNSIGNED NOT NULL,
+  `status` ENUM('shipped', 'in_transit', 'out_for_delivery', 'delivered', 'exception') NOT NULL,
+  `description` VARCHAR(255) NOT NULL DEFAULT '',
+  `location` VARCHAR(100) NOT NULL DEFAULT '',
+  `occurred_at` TIMESTAMP NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_shipment_events` (`shipment_id`, `status`, `occurred_at`),
+  FOREIGN KEY (`shipment_id`) REFERENCES shipments(`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+DELETE FROM backorders WHERE status = 'CANCELLED';
+
+ALTER TABLE backorders
+  MODIFY COLUMN `status` ENUM('OPEN', 'ALLOCATED') NOT NULL DEFAULT 'OPEN';
+
+ALTER TABLE stock_holds
+  DROP COLUMN `returned`;
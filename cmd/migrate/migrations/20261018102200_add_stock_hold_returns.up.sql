@@ -0,0 +1,7 @@
+-- units of a committed hold that went back into stock, so they are never put back twice
+ALTER TABLE stock_holds
+  ADD COLUMN `returned` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `backordered`;
+
+-- a backorder of an order cancelled after payment no longer waits for stock
+ALTER TABLE backorders
+  MODIFY COLUMN `status` ENUM('OPEN', 'ALLOCATED', 'CANCELLED') NOT NULL DEFAULT 'OPEN';
@@ -0,0 +1,14 @@
+-- fails while there are order lines of deleted products
+ALTER TABLE order_item_components
+  DROP FOREIGN KEY fk_order_item_components_product;
+
+ALTER TABLE order_item_components
+  MODIFY COLUMN `product_id` INT UNSIGNED NOT NULL,
+  ADD FOREIGN KEY (product_id) REFERENCES products(id);
+
+ALTER TABLE order_items
+  DROP FOREIGN KEY fk_order_items_product;
+
+ALTER TABLE order_items
+  MODIFY COLUMN `productId` INT UNSIGNED NOT NULL,
+  ADD FOREIGN KEY (`productId`) REFERENCES products(`id`);
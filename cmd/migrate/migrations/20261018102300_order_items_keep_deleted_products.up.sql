@@ -0,0 +1,14 @@
+-- order lines outlive the products they sold, the snapshot columns keep what was bought
+ALTER TABLE order_items
+  DROP FOREIGN KEY order_items_ibfk_2;
+
+ALTER TABLE order_items
+  MODIFY COLUMN `productId` INT UNSIGNED NULL,
+  ADD CONSTRAINT fk_order_items_product FOREIGN KEY (`productId`) REFERENCES products(`id`) ON DELETE SET NULL;
+
+ALTER TABLE order_item_components
+  DROP FOREIGN KEY order_item_components_ibfk_2;
+
+ALTER TABLE order_item_components
+  MODIFY COLUMN `product_id` INT UNSIGNED NULL,
+  ADD CONSTRAINT fk_order_item_components_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL;
@@ -0,0 +1,4 @@
+UPDATE returns SET status = 'received' WHERE status = 'refunding';
+
+ALTER TABLE returns
+  MODIFY COLUMN `status` ENUM('requested', 'approved', 'rejected', 'received', 'refunded') NOT NULL DEFAULT 'requested';
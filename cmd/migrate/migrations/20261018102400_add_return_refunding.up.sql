@@ -0,0 +1,3 @@
+-- a return being refunded at the provider, so a second request cannot refund it again
+ALTER TABLE returns
+  MODIFY COLUMN `status` ENUM('requested', 'approved', 'rejected', 'received', 'refunding', 'refunded') NOT NULL DEFAULT 'requested';
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/config"
+	"github.com/HollyEllmo/go_rest_tut/cmd/db"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/inventory"
+	mysqlCfg "github.com/go-sql-driver/mysql"
+)
+
+// reconcile compares the materialized stock levels with the movement ledger,
+// which stays the source of truth, and with -fix rebuilds the ones that drifted
+func main() {
+	fix := flag.Bool("fix", false, "rebuild drifted stock levels from the ledger")
+	flag.Parse()
+
+	db, err := db.NewMySQLStorage(mysqlCfg.Config{
+		User:                 config.Envs.DBUser,
+		Passwd:               config.Envs.DBPassword,
+		Addr:                 config.Envs.DBAddress,
+		DBName:               config.Envs.DBName,
+		Net:                  "tcp",
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	})
+
+	if err != nil {
+		log.Fatal("Failed to connect to the database:", err)
+	}
+	defer db.Close()
+
+	store := inventory.NewStore(db)
+	drifts, err := store.ReconcileStockLevels(*fix)
+	if err != nil {
+		log.Fatal("Failed to reconcile stock levels:", err)
+	}
+
+	for _, drift := range drifts {
+		log.Printf("product %d in warehouse %d: ledger %d, stock level %d, drift %d",
+			drift.ProductID, drift.WarehouseID, drift.Ledger, drift.StockLevel, drift.StockLevel-drift.Ledger)
+	}
+
+	switch {
+	case len(drifts) == 0:
+		log.Println("Stock levels match the ledger")
+	case *fix:
+		log.Printf("Rebuilt %d stock levels from the ledger", len(drifts))
+	default:
+		log.Fatalf("%d stock levels drifted from the ledger, run with -fix to rebuild them", len(drifts))
+	}
+}
@@ -18,6 +18,7 @@ import (
 type contextKey string
 
 const UserKey contextKey = "userID"
+const RoleKey contextKey = "role"
 
 func CreateJWT(secret []byte, userID int) (string, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
@@ -72,6 +73,7 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 		// and set it to the request context
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, UserKey, u.ID)
+		ctx = context.WithValue(ctx, RoleKey, u.Role)
 		r = r.WithContext(ctx)
 
 		handlerFunc(w, r)
@@ -79,6 +81,19 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 
 }
 
+// WithAdminAuth works like WithJWTAuth but only lets admins through
+func WithAdminAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.HandlerFunc {
+	return WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+		if GetUserRoleFromContext(r.Context()) != types.RoleAdmin {
+			log.Println("User is not an admin:", GetUserIDFromContext(r.Context()))
+			permissionDenied(w)
+			return
+		}
+
+		handlerFunc(w, r)
+	}, store)
+}
+
 func getTokenFromRequest(r *http.Request) string {
 	tokenAuth := r.Header.Get("Authorization")
 
@@ -115,3 +130,12 @@ func GetUserIDFromContext(ctx context.Context) int {
 
 	return userID
 }
+
+func GetUserRoleFromContext(ctx context.Context) string {
+	role, ok := ctx.Value(RoleKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return role
+}
@@ -11,19 +11,23 @@ import (
 )
 
 type Handler struct {
-	store          types.OrderStore
-	productStore   types.ProductStore
-	userStore      types.UserStore
-	inventoryStore types.InventoryStore
-	addressStore   types.AddressStore
+	store              types.OrderStore
+	productStore       types.ProductStore
+	userStore          types.UserStore
+	inventoryStore     types.InventoryStore
+	addressStore       types.AddressStore
+	taxCalculator      types.TaxCalculator
+	shippingCalculator types.ShippingCalculator
+	currencyConverter  types.CurrencyConverter
 }
 
-func NewHandler(store types.OrderStore, productStore types.ProductStore, userStore types.UserStore, inventoryStore types.InventoryStore, addressStore types.AddressStore) *Handler {
-	return &Handler{store: store, productStore: productStore, userStore: userStore, inventoryStore: inventoryStore, addressStore: addressStore}
+func NewHandler(store types.OrderStore, productStore types.ProductStore, userStore types.UserStore, inventoryStore types.InventoryStore, addressStore types.AddressStore, taxCalculator types.TaxCalculator, shippingCalculator types.ShippingCalculator, currencyConverter types.CurrencyConverter) *Handler {
+	return &Handler{store: store, productStore: productStore, userStore: userStore, inventoryStore: inventoryStore, addressStore: addressStore, taxCalculator: taxCalculator, shippingCalculator: shippingCalculator, currencyConverter: currencyConverter}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/cart/checkout", auth.WithJWTAuth(h.handleCheckout, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/cart/quote", auth.WithJWTAuth(h.handleQuote, h.userStore)).Methods(http.MethodPost)
 }
 
 func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
@@ -54,14 +58,71 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderID, totalPrice, err := h.createOrder(ps, cart.Items, userID, cart.AddressID)
+	orderID, quote, err := h.createOrder(ps, cart, userID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusCreated, map[string]any{
-		"total_price": totalPrice,
+		"subtotal":    quote.breakdown.Subtotal,
+		"tax":         quote.breakdown.Tax,
+		"shipping":    quote.shipping,
+		"total_price": quote.total,
+		"currency":    quote.currency,
 		"order_id":    orderID,
 	})
 }
+
+// POST /api/v1/cart/quote - price the cart, including taxes and shipping, without placing an order
+func (h *Handler) handleQuote(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var cart types.CartCheckoutPayload
+	if err := utils.ParseJSON(r, &cart); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(cart); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	productIDs, err := getCartItemsIDs(cart.Items)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ps, err := h.productStore.GetProductsByIDs(productIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	address, err := h.getOrderAddress(userID, cart.AddressID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	quote, err := h.quoteCart(ps, cart, address)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"lines":            quote.breakdown.Lines,
+		"subtotal":         quote.breakdown.Subtotal,
+		"tax":              quote.breakdown.Tax,
+		"shipping":         quote.shipping,
+		"shipping_options": quote.shippingOptions,
+		"total_price":      quote.total,
+		"currency":         quote.currency,
+		"exchange_rate":    quote.exchangeRate,
+		"address_id":       address.ID,
+	})
+}
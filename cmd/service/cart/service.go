@@ -2,6 +2,9 @@ package cart
 
 import (
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 )
@@ -17,7 +20,39 @@ func getCartItemsIDs(items []types.CartItem) ([]int, error) {
 	return productIDs, nil
 }
 
-func (h *Handler) createOrder(ps []types.Product, items []types.CartItem, userID int, addressID *int) (int, float64, error) {
+// cartQuote is a cart priced for a shipping address
+type cartQuote struct {
+	address         *types.UserAddress
+	products        map[int]types.Product // the cart products, priced in the quote currency
+	breakdown       *types.TaxBreakdown
+	shippingOptions []types.ShippingQuote
+	shipping        *types.ShippingQuote
+	total           types.Money
+	currency        string
+	exchangeRate    types.Rate // base currency to the quote currency
+}
+
+// quoteCart checks the cart against the inventory and prices it in the
+// requested currency, including taxes and shipping for the given address
+func (h *Handler) quoteCart(ps []types.Product, cart types.CartCheckoutPayload, address *types.UserAddress) (*cartQuote, error) {
+	items := cart.Items
+	currency := cart.Currency
+	if currency == "" {
+		currency = types.DefaultCurrency
+	}
+	currency = strings.ToUpper(currency)
+
+	// lock the exchange rate used for the whole quote
+	exchangeRate, err := h.currencyConverter.GetRate(types.DefaultCurrency, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	ps, err = h.currencyConverter.PriceProducts(ps, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to price products: %w", err)
+	}
+
 	productMap := make(map[int]types.Product)
 	for _, product := range ps {
 		productMap[product.ID] = product
@@ -25,51 +60,137 @@ func (h *Handler) createOrder(ps []types.Product, items []types.CartItem, userID
 
 	// check if all products are actually in stock
 	if err := h.checkIfCartIsInStock(items, productMap); err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	// calculate the total price
-	totalPrice := calculateTotalPrice(items, productMap)
+	// calculate the taxes for the shipping address
+	breakdown, err := h.taxCalculator.Calculate(address, buildTaxableLines(items, productMap))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate tax: %w", err)
+	}
 
-	// get the address to use for this order
-	addressString, err := h.getOrderAddress(userID, addressID)
+	// shipping rates and free shipping thresholds are kept in the base currency
+	baseTotal, err := h.currencyConverter.Convert(breakdown.Total, types.DefaultCurrency)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to get order address: %w", err)
+		return nil, err
 	}
 
-	// create order first
-	orderID, err := h.store.CreateOrder(types.Order{
-		UserID:  userID,
-		Total:   totalPrice,
-		Status:  "pending",
-		Address: addressString,
-	})
+	// price the shipping methods available for the address
+	options, err := h.shippingCalculator.Quote(address, calculateCartWeight(items, productMap), baseTotal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate shipping: %w", err)
+	}
+	for i := range options {
+		options[i].Cost = options[i].Cost.Convert(exchangeRate, currency)
+	}
 
+	shipping, err := selectShippingMethod(options, cart.ShippingMethodID)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to create order: %w", err)
+		return nil, err
+	}
+
+	quote := &cartQuote{
+		address:         address,
+		products:        productMap,
+		breakdown:       breakdown,
+		shippingOptions: options,
+		shipping:        shipping,
+		total:           breakdown.Total,
+		currency:        currency,
+		exchangeRate:    exchangeRate,
 	}
+	if shipping != nil {
+		quote.total = breakdown.Total.Add(shipping.Cost)
+	}
+
+	return quote, nil
+}
 
-	// atomically reserve stock for all items
-	for _, item := range items {
-		err := h.inventoryStore.ReserveStock(item.ProductID, item.Quantity, orderID)
+func (h *Handler) createOrder(ps []types.Product, cart types.CartCheckoutPayload, userID int) (int, *cartQuote, error) {
+	// get the address to use for this order
+	address, err := h.getOrderAddress(userID, cart.AddressID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get order address: %w", err)
+	}
+
+	// bill the shipping address unless another one was chosen
+	billingAddress := address
+	if cart.BillingAddressID != nil {
+		billingAddress, err = h.addressStore.GetAddressByID(*cart.BillingAddressID, userID)
 		if err != nil {
-			// If any reservation fails, we need to rollback previous reservations
-			// and cancel the order (in a real system you'd want proper saga pattern)
-			return 0, 0, fmt.Errorf("failed to reserve stock for product %d: %w", item.ProductID, err)
+			return 0, nil, fmt.Errorf("failed to get billing address: %w", err)
 		}
 	}
 
+	quote, err := h.quoteCart(ps, cart, address)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	order := types.Order{
+		UserID:          userID,
+		Subtotal:        quote.breakdown.Subtotal,
+		Tax:             quote.breakdown.Tax,
+		Total:           quote.total,
+		Currency:        quote.currency,
+		ExchangeRate:    quote.exchangeRate,
+		Status:          types.OrderStatusPending,
+		ShippingAddress: types.NewOrderAddress(address),
+		BillingAddress:  types.NewOrderAddress(billingAddress),
+	}
+	if quote.shipping != nil {
+		order.ShippingMethodID = &quote.shipping.MethodID
+		order.ShippingCost = quote.shipping.Cost
+	}
+
+	// create order first
+	orderID, err := h.store.CreateOrder(order)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	// atomically reserve stock for all items, bundles reserve their components
+	if err := h.inventoryStore.ReserveStockLines(orderID, stockLines(cart.Items, quote.products), address); err != nil {
+		h.abandonOrder(orderID)
+		return 0, nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+
 	// create order items
-	for _, item := range items {
-		h.store.CreateOrderItem(types.OrderItem{
-			OrderID:   orderID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     productMap[item.ProductID].Price,
+	// order items snapshot the product, so later catalog changes don't rewrite the order
+	for _, line := range quote.breakdown.Lines {
+		product := quote.products[line.ProductID]
+		err := h.store.CreateOrderItem(types.OrderItem{
+			OrderID:      orderID,
+			ProductID:    line.ProductID,
+			ProductName:  product.Name,
+			ProductSKU:   product.SKU,
+			ProductImage: product.Image,
+			Quantity:     line.Quantity,
+			Price:        line.UnitPrice,
+			TaxRate:      line.TaxRate,
+			Subtotal:     line.Subtotal,
+			Tax:          line.Tax,
+			Total:        line.Total,
+			Components:   orderItemComponents(product.Components, line.Quantity),
 		})
+		if err != nil {
+			h.abandonOrder(orderID)
+			return 0, nil, fmt.Errorf("failed to create order item for product %d: %w", line.ProductID, err)
+		}
 	}
 
-	return orderID, totalPrice, nil
+	return orderID, quote, nil
+}
+
+// abandonOrder cancels an order that could not be placed and releases
+// whatever stock it holds, so nothing stays reserved for it
+func (h *Handler) abandonOrder(orderID int) {
+	if err := h.inventoryStore.ReleaseReservation(orderID); err != nil {
+		log.Printf("failed to release stock reservation of order %d: %v", orderID, err)
+	}
+	if err := h.store.UpdateOrderStatus(orderID, types.OrderStatusPending, types.OrderStatusCancelled); err != nil {
+		log.Printf("failed to cancel order %d: %v", orderID, err)
+	}
 }
 
 func (h *Handler) checkIfCartIsInStock(cartItems []types.CartItem, productMap map[int]types.Product) error {
@@ -77,10 +198,20 @@ func (h *Handler) checkIfCartIsInStock(cartItems []types.CartItem, productMap ma
 		return fmt.Errorf("cart is empty")
 	}
 
-	// Get product IDs for stock check
-	productIDs := make([]int, len(cartItems))
-	for i, item := range cartItems {
-		productIDs[i] = item.ProductID
+	for _, item := range cartItems {
+		if _, ok := productMap[item.ProductID]; !ok {
+			return fmt.Errorf("product with ID %d not found", item.ProductID)
+		}
+	}
+
+	// Get product IDs for stock check, bundles are checked through their components
+	demand := make(map[int]int)
+	var productIDs []int
+	for _, line := range stockLines(cartItems, productMap) {
+		if _, ok := demand[line.ProductID]; !ok {
+			productIDs = append(productIDs, line.ProductID)
+		}
+		demand[line.ProductID] += line.Quantity
 	}
 
 	// Get current stock levels from inventory
@@ -89,33 +220,139 @@ func (h *Handler) checkIfCartIsInStock(cartItems []types.CartItem, productMap ma
 		return fmt.Errorf("failed to check inventory: %w", err)
 	}
 
+	// backorder and pre-order products can be ordered beyond their stock
+	policies, err := h.inventoryStore.GetStockPolicies(productIDs)
+	if err != nil {
+		return fmt.Errorf("failed to check inventory: %w", err)
+	}
+	stockMap = orderableStock(stockMap, policies, time.Now())
+
 	for _, item := range cartItems {
-		product, ok := productMap[item.ProductID]
-		if !ok {
-			return fmt.Errorf("product with ID %d not found", item.ProductID)
-		}
-		
+		product := productMap[item.ProductID]
+
 		availableStock := stockMap[item.ProductID]
+		if len(product.Components) > 0 {
+			availableStock = bundleAvailability(product.Components, stockMap)
+		}
 		if availableStock < item.Quantity {
 			return fmt.Errorf("not enough stock for product %s (ID: %d), requested: %d, available: %d",
 				product.Name, product.ID, item.Quantity, availableStock)
 		}
 	}
+
+	// a product may be needed by several lines, e.g. on its own and inside a bundle
+	for _, productID := range productIDs {
+		if stockMap[productID] < demand[productID] {
+			return fmt.Errorf("not enough stock for product %d, requested: %d, available: %d",
+				productID, demand[productID], stockMap[productID])
+		}
+	}
 	return nil
 }
 
-func calculateTotalPrice(cartItems []types.CartItem, products map[int]types.Product) float64 {
-	var total float64
+// orderableStock is how many units of each product can be ordered, given its
+// available stock (negative once ordered beyond stock) and its stock policy
+func orderableStock(available map[int]int, policies map[int]types.StockPolicy, now time.Time) map[int]int {
+	orderable := make(map[int]int, len(available))
+	for productID, stock := range available {
+		orderable[productID] = policies[productID].Orderable(max(stock, 0), max(-stock, 0), now)
+	}
+	return orderable
+}
 
+// stockLines lists the products the cart takes from stock: a bundle is
+// replaced by its components, in the quantities needed for the whole line
+func stockLines(cartItems []types.CartItem, products map[int]types.Product) []types.CartItem {
+	lines := make([]types.CartItem, 0, len(cartItems))
+	for _, item := range cartItems {
+		components := products[item.ProductID].Components
+		if len(components) == 0 {
+			lines = append(lines, item)
+			continue
+		}
+		for _, component := range components {
+			lines = append(lines, types.CartItem{
+				ProductID: component.ProductID,
+				Quantity:  component.Quantity * item.Quantity,
+			})
+		}
+	}
+	return lines
+}
+
+// bundleAvailability is how many bundles the available stock of their components can make
+func bundleAvailability(components []types.BundleComponent, stock map[int]int) int {
+	available := -1
+	for _, component := range components {
+		bundles := max(stock[component.ProductID], 0) / component.Quantity
+		if available < 0 || bundles < available {
+			available = bundles
+		}
+	}
+	return max(available, 0)
+}
+
+// orderItemComponents is the component breakdown of a bundle line of quantity bundles
+func orderItemComponents(components []types.BundleComponent, quantity int) []types.OrderItemComponent {
+	if len(components) == 0 {
+		return nil
+	}
+
+	breakdown := make([]types.OrderItemComponent, len(components))
+	for i, component := range components {
+		breakdown[i] = types.OrderItemComponent{
+			ProductID: component.ProductID,
+			Quantity:  component.Quantity * quantity,
+		}
+	}
+	return breakdown
+}
+
+// buildTaxableLines turns the cart items into lines for the tax calculator
+func buildTaxableLines(cartItems []types.CartItem, products map[int]types.Product) []types.TaxableLine {
+	lines := make([]types.TaxableLine, 0, len(cartItems))
 	for _, item := range cartItems {
 		product := products[item.ProductID]
-		total += product.Price * float64(item.Quantity)
+		lines = append(lines, types.TaxableLine{
+			ProductID: item.ProductID,
+			TaxClass:  product.TaxClass,
+			UnitPrice: product.Price,
+			Quantity:  item.Quantity,
+		})
+	}
+	return lines
+}
+
+// calculateCartWeight sums the shipping weight of the cart in grams
+func calculateCartWeight(cartItems []types.CartItem, products map[int]types.Product) int {
+	weight := 0
+	for _, item := range cartItems {
+		weight += products[item.ProductID].WeightGrams * item.Quantity
+	}
+	return weight
+}
+
+// selectShippingMethod picks the requested shipping method, or the cheapest one
+// when none was requested. Without any methods for the address nothing is charged.
+func selectShippingMethod(options []types.ShippingQuote, shippingMethodID *int) (*types.ShippingQuote, error) {
+	if shippingMethodID == nil {
+		if len(options) == 0 {
+			return nil, nil
+		}
+		return &options[0], nil
 	}
-	return total
+
+	for i := range options {
+		if options[i].MethodID == *shippingMethodID {
+			return &options[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("shipping method %d is not available for this address", *shippingMethodID)
 }
 
-// getOrderAddress gets the address string to use for the order
-func (h *Handler) getOrderAddress(userID int, addressID *int) (string, error) {
+// getOrderAddress gets the address to use for the order
+func (h *Handler) getOrderAddress(userID int, addressID *int) (*types.UserAddress, error) {
 	var address *types.UserAddress
 	var err error
 
@@ -123,41 +360,15 @@ func (h *Handler) getOrderAddress(userID int, addressID *int) (string, error) {
 		// Use specific address
 		address, err = h.addressStore.GetAddressByID(*addressID, userID)
 		if err != nil {
-			return "", fmt.Errorf("failed to get specified address: %w", err)
+			return nil, fmt.Errorf("failed to get specified address: %w", err)
 		}
 	} else {
 		// Use default address
 		address, err = h.addressStore.GetDefaultAddress(userID)
 		if err != nil {
-			return "", fmt.Errorf("failed to get default address: %w", err)
+			return nil, fmt.Errorf("failed to get default address: %w", err)
 		}
 	}
 
-	// Format address as a string
-	addressString := formatAddressForOrder(address)
-	return addressString, nil
-}
-
-// formatAddressForOrder formats a UserAddress into a string for order storage
-func formatAddressForOrder(addr *types.UserAddress) string {
-	addressString := fmt.Sprintf("%s %s", addr.FirstName, addr.LastName)
-	
-	if addr.Company != nil && *addr.Company != "" {
-		addressString += fmt.Sprintf("\n%s", *addr.Company)
-	}
-	
-	addressString += fmt.Sprintf("\n%s", addr.AddressLine1)
-	
-	if addr.AddressLine2 != nil && *addr.AddressLine2 != "" {
-		addressString += fmt.Sprintf("\n%s", *addr.AddressLine2)
-	}
-	
-	addressString += fmt.Sprintf("\n%s, %s %s", addr.City, addr.StateProvince, addr.PostalCode)
-	addressString += fmt.Sprintf("\n%s", addr.Country)
-	
-	if addr.Phone != nil && *addr.Phone != "" {
-		addressString += fmt.Sprintf("\nPhone: %s", *addr.Phone)
-	}
-	
-	return addressString
+	return address, nil
 }
@@ -0,0 +1,83 @@
+package cart
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+var giftSet = types.Product{
+	ID: 10,
+	Components: []types.BundleComponent{
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 1},
+	},
+}
+
+func TestStockLines(t *testing.T) {
+	products := map[int]types.Product{1: {ID: 1}, 10: giftSet}
+
+	lines := stockLines([]types.CartItem{
+		{ProductID: 1, Quantity: 1},
+		{ProductID: 10, Quantity: 3},
+	}, products)
+
+	expected := []types.CartItem{
+		{ProductID: 1, Quantity: 1},
+		{ProductID: 1, Quantity: 6},
+		{ProductID: 2, Quantity: 3},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d stock lines, got %+v", len(expected), lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected line %d to be %+v, got %+v", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestBundleAvailability(t *testing.T) {
+	tests := []struct {
+		name     string
+		stock    map[int]int
+		expected int
+	}{
+		{"limited by the scarcest component", map[int]int{1: 7, 2: 5}, 3},
+		{"limited by the single component", map[int]int{1: 20, 2: 4}, 4},
+		{"missing component", map[int]int{1: 7}, 0},
+		{"oversold component", map[int]int{1: -2, 2: 5}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := bundleAvailability(giftSet.Components, test.stock); got != test.expected {
+				t.Errorf("Expected %d bundles, got %d", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestOrderItemComponents(t *testing.T) {
+	breakdown := orderItemComponents(giftSet.Components, 2)
+	if len(breakdown) != 2 || breakdown[0].ProductID != 1 || breakdown[0].Quantity != 4 || breakdown[1].Quantity != 2 {
+		t.Errorf("Expected 4 of product 1 and 2 of product 2, got %+v", breakdown)
+	}
+
+	if breakdown := orderItemComponents(nil, 2); breakdown != nil {
+		t.Errorf("Expected no breakdown for a plain product, got %+v", breakdown)
+	}
+}
+
+func TestOrderableStock(t *testing.T) {
+	limit := 5
+	policies := map[int]types.StockPolicy{
+		2: {ProductID: 2, Policy: types.StockPolicyBackorder, Limit: &limit},
+	}
+
+	orderable := orderableStock(map[int]int{1: 4, 2: -2, 3: -1}, policies, time.Now())
+	if orderable[1] != 4 || orderable[2] != 3 || orderable[3] != 0 {
+		t.Errorf("Expected 4, 3 and 0 orderable units, got %v", orderable)
+	}
+}
@@ -0,0 +1,124 @@
+package currency
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// Converter converts prices between the supported currencies using the
+// admin-managed exchange rates. Explicit price list entries win over
+// converted prices. The base currency is types.DefaultCurrency, the one
+// shipping rates and unlabelled amounts are kept in.
+type Converter struct {
+	store     types.CurrencyStore
+	supported map[string]bool
+}
+
+func NewConverter(store types.CurrencyStore, supported []string) *Converter {
+	c := &Converter{
+		store:     store,
+		supported: map[string]bool{types.DefaultCurrency: true},
+	}
+	for _, currency := range supported {
+		c.supported[strings.ToUpper(currency)] = true
+	}
+	return c
+}
+
+// GetRate returns how many units of "to" one unit of "from" is worth. A pair
+// without a direct rate falls back to the inverse of the opposite pair.
+func (c *Converter) GetRate(from, to string) (types.Rate, error) {
+	from, to = c.normalize(from), c.normalize(to)
+	if !c.supported[to] {
+		return 0, fmt.Errorf("unsupported currency %s", to)
+	}
+	if from == to {
+		return types.RateOne, nil
+	}
+
+	rate, err := c.store.GetExchangeRate(from, to)
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if err.Error() != "exchange rate not found" {
+		return 0, err
+	}
+
+	inverse, err := c.store.GetExchangeRate(to, from)
+	if err == nil {
+		return inverse.Rate.Inverse(), nil
+	}
+	if err.Error() != "exchange rate not found" {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("no exchange rate from %s to %s", from, to)
+}
+
+// Convert converts an amount into another currency
+func (c *Converter) Convert(amount types.Money, to string) (types.Money, error) {
+	from, to := c.normalize(amount.Currency), c.normalize(to)
+	if from == to {
+		amount.Currency = to
+		return amount, nil
+	}
+
+	rate, err := c.GetRate(from, to)
+	if err != nil {
+		return types.Money{}, err
+	}
+
+	return amount.Convert(rate, to), nil
+}
+
+// PriceProducts returns copies of the products priced in the given currency,
+// from the price list when available and converted from their own price otherwise
+func (c *Converter) PriceProducts(products []types.Product, currency string) ([]types.Product, error) {
+	currency = c.normalize(currency)
+	if !c.supported[currency] {
+		return nil, fmt.Errorf("unsupported currency %s", currency)
+	}
+
+	productIDs := make([]int, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+
+	prices, err := c.store.GetProductPrices(productIDs, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// one rate lookup per source currency
+	rates := make(map[string]types.Rate)
+	priced := make([]types.Product, len(products))
+	for i, product := range products {
+		if price, ok := prices[product.ID]; ok {
+			product.Price = price
+		} else {
+			from := c.normalize(product.Price.Currency)
+			rate, ok := rates[from]
+			if !ok {
+				rate, err = c.GetRate(from, currency)
+				if err != nil {
+					return nil, err
+				}
+				rates[from] = rate
+			}
+			product.Price = product.Price.Convert(rate, currency)
+		}
+		product.Currency = currency
+		priced[i] = product
+	}
+
+	return priced, nil
+}
+
+func (c *Converter) normalize(currency string) string {
+	if currency == "" {
+		return types.DefaultCurrency
+	}
+	return strings.ToUpper(currency)
+}
@@ -0,0 +1,121 @@
+package currency
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestConverter_GetRate(t *testing.T) {
+	store := &mockCurrencyStore{rates: map[string]types.Rate{
+		"USD/EUR": types.MustParseRate("0.8"),
+	}}
+	converter := NewConverter(store, []string{"usd", "eur", "gbp"})
+
+	tests := []struct {
+		name     string
+		from, to string
+		expected types.Rate
+		valid    bool
+	}{
+		{"same currency", "EUR", "eur", types.RateOne, true},
+		{"direct rate", "USD", "EUR", types.MustParseRate("0.8"), true},
+		{"inverse rate", "EUR", "USD", types.MustParseRate("1.25"), true},
+		{"missing rate", "USD", "GBP", 0, false},
+		{"unsupported currency", "USD", "JPY", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := converter.GetRate(tt.from, tt.to)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("Expected an error, got rate %s", rate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to get rate: %v", err)
+			}
+			if rate != tt.expected {
+				t.Errorf("Expected rate %s, got %s", tt.expected, rate)
+			}
+		})
+	}
+}
+
+func TestConverter_PriceProducts(t *testing.T) {
+	store := &mockCurrencyStore{
+		rates: map[string]types.Rate{"USD/EUR": types.MustParseRate("0.92")},
+		prices: map[string]map[int]types.Money{
+			"EUR": {2: types.MustParseMoney("9.00", "EUR")},
+		},
+	}
+	converter := NewConverter(store, []string{"USD", "EUR"})
+
+	products := []types.Product{
+		{ID: 1, Price: types.MustParseMoney("19.99", "USD"), Currency: "USD"},
+		{ID: 2, Price: types.MustParseMoney("10.00", "USD"), Currency: "USD"},
+	}
+
+	priced, err := converter.PriceProducts(products, "eur")
+	if err != nil {
+		t.Fatalf("Failed to price products: %v", err)
+	}
+
+	expected := []types.Money{
+		types.MustParseMoney("18.39", "EUR"), // converted
+		types.MustParseMoney("9.00", "EUR"),  // price list
+	}
+	for i := range expected {
+		if priced[i].Price != expected[i] || priced[i].Currency != "EUR" {
+			t.Errorf("Expected product %d to cost %s EUR, got %s %s", priced[i].ID, expected[i], priced[i].Price, priced[i].Price.Currency)
+		}
+	}
+
+	if products[0].Currency != "USD" {
+		t.Error("Expected the original products to be left untouched")
+	}
+}
+
+type mockCurrencyStore struct {
+	rates  map[string]types.Rate
+	prices map[string]map[int]types.Money
+}
+
+func (m *mockCurrencyStore) GetExchangeRates() ([]types.ExchangeRate, error) {
+	return nil, nil
+}
+
+func (m *mockCurrencyStore) GetExchangeRate(baseCurrency, quoteCurrency string) (*types.ExchangeRate, error) {
+	rate, ok := m.rates[baseCurrency+"/"+quoteCurrency]
+	if !ok {
+		return nil, fmt.Errorf("exchange rate not found")
+	}
+	return &types.ExchangeRate{BaseCurrency: baseCurrency, QuoteCurrency: quoteCurrency, Rate: rate}, nil
+}
+
+func (m *mockCurrencyStore) SetExchangeRate(payload types.SetExchangeRatePayload) (*types.ExchangeRate, error) {
+	return nil, nil
+}
+
+func (m *mockCurrencyStore) DeleteExchangeRate(baseCurrency, quoteCurrency string) error {
+	return nil
+}
+
+func (m *mockCurrencyStore) GetProductPrices(productIDs []int, currency string) (map[int]types.Money, error) {
+	prices := make(map[int]types.Money)
+	for id, price := range m.prices[currency] {
+		prices[id] = price
+	}
+	return prices, nil
+}
+
+func (m *mockCurrencyStore) SetProductPrice(productID int, price types.Money) error {
+	return nil
+}
+
+func (m *mockCurrencyStore) DeleteProductPrice(productID int, currency string) error {
+	return nil
+}
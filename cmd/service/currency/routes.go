@@ -0,0 +1,150 @@
+package currency
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.CurrencyStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.CurrencyStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes for exchange rates and price lists
+	router.HandleFunc("/currencies/rates", auth.WithAdminAuth(h.handleGetExchangeRates, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/currencies/rates", auth.WithAdminAuth(h.handleSetExchangeRate, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/currencies/rates/{base}/{quote}", auth.WithAdminAuth(h.handleDeleteExchangeRate, h.userStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/products/{id}/prices/{currency}", auth.WithAdminAuth(h.handleSetProductPrice, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{id}/prices/{currency}", auth.WithAdminAuth(h.handleDeleteProductPrice, h.userStore)).Methods(http.MethodDelete)
+}
+
+// GET /api/v1/currencies/rates - list all exchange rates
+func (h *Handler) handleGetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.store.GetExchangeRates()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"rates": rates,
+		"count": len(rates),
+	})
+}
+
+// PUT /api/v1/currencies/rates - create or replace the rate of a currency pair
+func (h *Handler) handleSetExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var payload types.SetExchangeRatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	rate, err := h.store.SetExchangeRate(payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rate)
+}
+
+// DELETE /api/v1/currencies/rates/{base}/{quote} - delete the rate of a currency pair
+func (h *Handler) handleDeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.store.DeleteExchangeRate(vars["base"], vars["quote"]); err != nil {
+		if err.Error() == "exchange rate not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Exchange rate deleted successfully",
+	})
+}
+
+// PUT /api/v1/products/{id}/prices/{currency} - set an explicit product price in a currency
+func (h *Handler) handleSetProductPrice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	currency := strings.ToUpper(vars["currency"])
+	if len(currency) != 3 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid currency %s", vars["currency"]))
+		return
+	}
+
+	var payload types.SetProductPricePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	price := types.NewMoney(payload.Price.Amount, currency)
+	if err := h.store.SetProductPrice(productID, price); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"productId": productID,
+		"currency":  currency,
+		"price":     price,
+	})
+}
+
+// DELETE /api/v1/products/{id}/prices/{currency} - fall back to the converted base price
+func (h *Handler) handleDeleteProductPrice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	if err := h.store.DeleteProductPrice(productID, vars["currency"]); err != nil {
+		if err.Error() == "product price not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Product price deleted successfully",
+	})
+}
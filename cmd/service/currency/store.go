@@ -0,0 +1,190 @@
+package currency
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetExchangeRates retrieves all configured exchange rates
+func (s *Store) GetExchangeRates() ([]types.ExchangeRate, error) {
+	rows, err := s.db.Query(`
+		SELECT base_currency, quote_currency, rate, updated_at
+		FROM exchange_rates
+		ORDER BY base_currency, quote_currency
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []types.ExchangeRate{}
+	for rows.Next() {
+		rate, err := scanRowIntoExchangeRate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate row: %w", err)
+		}
+		rates = append(rates, *rate)
+	}
+
+	return rates, nil
+}
+
+// GetExchangeRate retrieves the rate for converting baseCurrency into quoteCurrency
+func (s *Store) GetExchangeRate(baseCurrency, quoteCurrency string) (*types.ExchangeRate, error) {
+	row := s.db.QueryRow(`
+		SELECT base_currency, quote_currency, rate, updated_at
+		FROM exchange_rates
+		WHERE base_currency = ? AND quote_currency = ?
+	`, strings.ToUpper(baseCurrency), strings.ToUpper(quoteCurrency))
+
+	return scanRowIntoExchangeRate(row)
+}
+
+// SetExchangeRate creates or replaces the rate for a currency pair
+func (s *Store) SetExchangeRate(payload types.SetExchangeRatePayload) (*types.ExchangeRate, error) {
+	baseCurrency := strings.ToUpper(payload.BaseCurrency)
+	quoteCurrency := strings.ToUpper(payload.QuoteCurrency)
+
+	_, err := s.db.Exec(`
+		INSERT INTO exchange_rates (base_currency, quote_currency, rate)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE rate = VALUES(rate)
+	`, baseCurrency, quoteCurrency, payload.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set exchange rate: %w", err)
+	}
+
+	return s.GetExchangeRate(baseCurrency, quoteCurrency)
+}
+
+// DeleteExchangeRate deletes the rate for a currency pair
+func (s *Store) DeleteExchangeRate(baseCurrency, quoteCurrency string) error {
+	result, err := s.db.Exec(
+		"DELETE FROM exchange_rates WHERE base_currency = ? AND quote_currency = ?",
+		strings.ToUpper(baseCurrency), strings.ToUpper(quoteCurrency),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete exchange rate: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("exchange rate not found")
+	}
+
+	return nil
+}
+
+// GetProductPrices retrieves the price list entries of the given products in a currency.
+// Products without an explicit price in that currency are absent from the map.
+func (s *Store) GetProductPrices(productIDs []int, currency string) (map[int]types.Money, error) {
+	prices := make(map[int]types.Money)
+	if len(productIDs) == 0 {
+		return prices, nil
+	}
+
+	currency = strings.ToUpper(currency)
+	placeholders := strings.Repeat(",?", len(productIDs)-1)
+	query := fmt.Sprintf(`
+		SELECT product_id, price
+		FROM product_prices
+		WHERE currency = ? AND product_id IN (?%s)
+	`, placeholders)
+
+	args := make([]any, 0, len(productIDs)+1)
+	args = append(args, currency)
+	for _, id := range productIDs {
+		args = append(args, id)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product prices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var price types.Money
+		if err := rows.Scan(&productID, &price); err != nil {
+			return nil, fmt.Errorf("failed to scan product price row: %w", err)
+		}
+		price.Currency = currency
+		prices[productID] = price
+	}
+
+	return prices, nil
+}
+
+// SetProductPrice creates or replaces the price of a product in the currency of price
+func (s *Store) SetProductPrice(productID int, price types.Money) error {
+	_, err := s.db.Exec(`
+		INSERT INTO product_prices (product_id, currency, price)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE price = VALUES(price)
+	`, productID, strings.ToUpper(price.Currency), price)
+	if err != nil {
+		return fmt.Errorf("failed to set product price: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteProductPrice removes a price list entry, the product falls back to the converted base price
+func (s *Store) DeleteProductPrice(productID int, currency string) error {
+	result, err := s.db.Exec(
+		"DELETE FROM product_prices WHERE product_id = ? AND currency = ?",
+		productID, strings.ToUpper(currency),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete product price: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("product price not found")
+	}
+
+	return nil
+}
+
+// Helper function to scan database row into ExchangeRate struct
+func scanRowIntoExchangeRate(scanner interface {
+	Scan(dest ...any) error
+}) (*types.ExchangeRate, error) {
+	var rate types.ExchangeRate
+
+	err := scanner.Scan(
+		&rate.BaseCurrency,
+		&rate.QuoteCurrency,
+		&rate.Rate,
+		&rate.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("exchange rate not found")
+		}
+		return nil, err
+	}
+
+	return &rate, nil
+}
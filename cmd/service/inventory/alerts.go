@@ -0,0 +1,336 @@
+package inventory
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// availableQuery считает доступный остаток товара по всем складам
+const availableQuery = `
+	SELECT
+		COALESCE((SELECT SUM(on_hand) FROM stock_levels WHERE product_id = ?), 0) -
+		COALESCE((
+			SELECT SUM(quantity)
+			FROM stock_holds
+			WHERE product_id = ? AND status = 'ACTIVE' AND expires_at > NOW()
+		), 0) -
+		COALESCE((
+			SELECT SUM(quantity_on_hand)
+			FROM stock_lots
+			WHERE product_id = ? AND quantity_on_hand > 0 AND expires_at < CURDATE()
+		), 0)
+`
+
+// SetNotifier задаёт, куда отправляются события об остатках (nil — никуда)
+func (s *Store) SetNotifier(notifier types.Notifier) {
+	s.notifier = notifier
+}
+
+// SetReorderThreshold задаёт порог дозаказа товара. При пороге 0 предупреждение
+// приходит, только когда товар закончился.
+func (s *Store) SetReorderThreshold(productID, reorderLevel int) error {
+	if err := checkProductExists(s.db, productID); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO stock_thresholds (product_id, reorder_level)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE reorder_level = VALUES(reorder_level)
+	`, productID, reorderLevel)
+	if err != nil {
+		return fmt.Errorf("failed to set reorder threshold: %w", err)
+	}
+
+	// новый порог может сразу перевести товар в «мало на складе»
+	s.evaluateAlerts(productID)
+	return nil
+}
+
+// GetStockAlerts возвращает товары, которые сейчас ниже порога или закончились
+func (s *Store) GetStockAlerts() ([]types.StockAlert, error) {
+	rows, err := s.db.Query(`
+		SELECT t.product_id, p.name, t.alert_state, t.reorder_level, t.updated_at
+		FROM stock_thresholds t
+		JOIN products p ON p.id = t.product_id
+		WHERE t.alert_state <> 'OK'
+		ORDER BY t.updated_at DESC, t.product_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []types.StockAlert{}
+	var productIDs []int
+	for rows.Next() {
+		var alert types.StockAlert
+		if err := rows.Scan(&alert.ProductID, &alert.ProductName, &alert.State, &alert.ReorderLevel, &alert.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan stock alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+		productIDs = append(productIDs, alert.ProductID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	available, err := s.GetProductsWithStock(productIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range alerts {
+		alerts[i].Available = available[alerts[i].ProductID]
+	}
+
+	return alerts, nil
+}
+
+// Subscribe подписывает покупателя на появление товара. Подписаться можно только
+// на закончившийся товар; повторная подписка после уведомления снова активна.
+func (s *Store) Subscribe(productID, userID int) (*types.StockSubscription, error) {
+	if err := checkProductExists(s.db, productID); err != nil {
+		return nil, err
+	}
+
+	var available int
+	if err := s.db.QueryRow(availableQuery, productID, productID, productID).Scan(&available); err != nil {
+		return nil, fmt.Errorf("failed to get current stock for product %d: %w", productID, err)
+	}
+	if available > 0 {
+		return nil, fmt.Errorf("product %d is in stock", productID)
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO stock_subscriptions (product_id, user_id, status)
+		VALUES (?, ?, 'ACTIVE')
+		ON DUPLICATE KEY UPDATE status = 'ACTIVE', created_at = NOW(), notified_at = NULL
+	`, productID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to product %d: %w", productID, err)
+	}
+
+	var subscription types.StockSubscription
+	var notifiedAt sql.NullTime
+	err = s.db.QueryRow(`
+		SELECT id, product_id, user_id, status, created_at, notified_at
+		FROM stock_subscriptions
+		WHERE product_id = ? AND user_id = ?
+	`, productID, userID).Scan(&subscription.ID, &subscription.ProductID, &subscription.UserID,
+		&subscription.Status, &subscription.CreatedAt, &notifiedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if notifiedAt.Valid {
+		subscription.NotifiedAt = &notifiedAt.Time
+	}
+
+	return &subscription, nil
+}
+
+// Unsubscribe отменяет активную подписку покупателя
+func (s *Store) Unsubscribe(productID, userID int) error {
+	result, err := s.db.Exec(`
+		UPDATE stock_subscriptions SET status = 'CANCELLED'
+		WHERE product_id = ? AND user_id = ? AND status = 'ACTIVE'
+	`, productID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("subscription not found")
+	}
+
+	return nil
+}
+
+// evaluateAlerts пересчитывает состояние товара относительно порога после
+// изменения остатка и отправляет событие, если состояние ухудшилось. Ошибки
+// только логируются: предупреждения не должны ломать складские операции.
+func (s *Store) evaluateAlerts(productID int) {
+	event, err := s.updateAlertState(productID)
+	if err != nil {
+		log.Printf("failed to evaluate stock alerts for product %d: %v", productID, err)
+		return
+	}
+	if event != nil {
+		s.notify(*event)
+	}
+}
+
+// updateAlertState сохраняет новое состояние товара под блокировкой его порога,
+// так что об одном переходе сообщается ровно один раз
+func (s *Store) updateAlertState(productID int) (*types.StockEvent, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// товары без настроенного порога получают порог 0
+	if _, err := tx.Exec("INSERT IGNORE INTO stock_thresholds (product_id) VALUES (?)", productID); err != nil {
+		return nil, fmt.Errorf("failed to create reorder threshold: %w", err)
+	}
+
+	var reorderLevel int
+	var current types.StockAlertState
+	var productName string
+	err = tx.QueryRow(`
+		SELECT t.reorder_level, t.alert_state, p.name
+		FROM stock_thresholds t
+		JOIN products p ON p.id = t.product_id
+		WHERE t.product_id = ?
+		FOR UPDATE
+	`, productID).Scan(&reorderLevel, &current, &productName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("product %d not found", productID)
+		}
+		return nil, fmt.Errorf("failed to lock reorder threshold: %w", err)
+	}
+
+	var available int
+	if err := tx.QueryRow(availableQuery, productID, productID, productID).Scan(&available); err != nil {
+		return nil, fmt.Errorf("failed to get current stock for product %d: %w", productID, err)
+	}
+
+	state := alertState(available, reorderLevel)
+	if state == current {
+		return nil, tx.Commit()
+	}
+
+	_, err = tx.Exec("UPDATE stock_thresholds SET alert_state = ? WHERE product_id = ?", state, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert state: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if state == types.StockAlertOK {
+		return nil, nil
+	}
+
+	return &types.StockEvent{
+		Type:         types.StockEventType(state),
+		ProductID:    productID,
+		ProductName:  productName,
+		Available:    available,
+		ReorderLevel: reorderLevel,
+		OccurredAt:   time.Now(),
+	}, nil
+}
+
+// notifySubscribers сообщает подписчикам, что товар снова в наличии. Каждая
+// подписка срабатывает один раз: после уведомления её нужно оформить заново.
+func (s *Store) notifySubscribers(productID int) {
+	events, err := s.claimSubscriptions(productID)
+	if err != nil {
+		log.Printf("failed to notify subscribers of product %d: %v", productID, err)
+		return
+	}
+	for _, event := range events {
+		s.notify(event)
+	}
+}
+
+// claimSubscriptions помечает активные подписки товара уведомлёнными, если он в наличии
+func (s *Store) claimSubscriptions(productID int) ([]types.StockEvent, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT s.id, s.user_id, u.email, p.name
+		FROM stock_subscriptions s
+		JOIN users u ON u.id = s.user_id
+		JOIN products p ON p.id = s.product_id
+		WHERE s.product_id = ? AND s.status = 'ACTIVE'
+		FOR UPDATE
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscriptions: %w", err)
+	}
+
+	var ids []any
+	var events []types.StockEvent
+	for rows.Next() {
+		var id int
+		event := types.StockEvent{Type: types.StockEventBackInStock, ProductID: productID}
+		if err := rows.Scan(&id, &event.UserID, &event.Email, &event.ProductName); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		ids = append(ids, id)
+		events = append(events, event)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// остаток читаем уже под блокировкой подписок
+	var available int
+	if err := tx.QueryRow(availableQuery, productID, productID, productID).Scan(&available); err != nil {
+		return nil, fmt.Errorf("failed to get current stock for product %d: %w", productID, err)
+	}
+	if available <= 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(ids))[1:]
+	_, err = tx.Exec(fmt.Sprintf(
+		"UPDATE stock_subscriptions SET status = 'NOTIFIED', notified_at = NOW() WHERE id IN (%s)", placeholders,
+	), ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark subscriptions notified: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range events {
+		events[i].Available = available
+		events[i].OccurredAt = now
+	}
+
+	return events, nil
+}
+
+func (s *Store) notify(event types.StockEvent) {
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.Notify(event); err != nil {
+		log.Printf("failed to deliver stock event %s for product %d: %v", event.Type, event.ProductID, err)
+	}
+}
+
+// checkProductExists проверяет, что товар есть в каталоге
+func checkProductExists(q queryRower, productID int) error {
+	var id int
+	err := q.QueryRow("SELECT id FROM products WHERE id = ?", productID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("product %d not found", productID)
+		}
+		return fmt.Errorf("failed to get product: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package inventory
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// backorderColumns — колонки backorders, которые читает scanRowIntoBackorder
+const backorderColumns = "id, order_id, product_id, warehouse_id, quantity, allocated, status, created_at, allocated_at"
+
+// getStockPolicy читает политику товара; товары без настроенной политики — deny
+func getStockPolicy(q queryRower, productID int) (types.StockPolicy, error) {
+	policy := types.StockPolicy{ProductID: productID, Policy: types.StockPolicyDeny}
+
+	var limit sql.NullInt64
+	var releaseDate sql.NullTime
+	err := q.QueryRow(
+		"SELECT policy, backorder_limit, release_date FROM stock_policies WHERE product_id = ?",
+		productID,
+	).Scan(&policy.Policy, &limit, &releaseDate)
+	if err != nil && err != sql.ErrNoRows {
+		return policy, fmt.Errorf("failed to get stock policy: %w", err)
+	}
+
+	if limit.Valid {
+		value := int(limit.Int64)
+		policy.Limit = &value
+	}
+	if releaseDate.Valid {
+		policy.ReleaseDate = &releaseDate.Time
+	}
+
+	return policy, nil
+}
+
+// GetStockPolicy возвращает политику заказа товара сверх остатка
+func (s *Store) GetStockPolicy(productID int) (*types.StockPolicy, error) {
+	if err := checkProductExists(s.db, productID); err != nil {
+		return nil, err
+	}
+
+	policy, err := getStockPolicy(s.db, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// GetStockPolicies возвращает политики товаров (deny для товаров без настроенной политики)
+func (s *Store) GetStockPolicies(productIDs []int) (map[int]types.StockPolicy, error) {
+	policies := make(map[int]types.StockPolicy, len(productIDs))
+	if len(productIDs) == 0 {
+		return policies, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(productIDs))[1:]
+	args := make([]any, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+		policies[id] = types.StockPolicy{ProductID: id, Policy: types.StockPolicyDeny}
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT product_id, policy, backorder_limit, release_date
+		FROM stock_policies
+		WHERE product_id IN (%s)
+	`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock policies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var policy types.StockPolicy
+		var limit sql.NullInt64
+		var releaseDate sql.NullTime
+		if err := rows.Scan(&policy.ProductID, &policy.Policy, &limit, &releaseDate); err != nil {
+			return nil, fmt.Errorf("failed to scan stock policy: %w", err)
+		}
+		if limit.Valid {
+			value := int(limit.Int64)
+			policy.Limit = &value
+		}
+		if releaseDate.Valid {
+			policy.ReleaseDate = &releaseDate.Time
+		}
+		policies[policy.ProductID] = policy
+	}
+
+	return policies, rows.Err()
+}
+
+// SetStockPolicy задаёт политику товара. Уже принятые сверх остатка заказы
+// остаются в силе, новая политика действует только на новые резервирования.
+func (s *Store) SetStockPolicy(policy types.StockPolicy) error {
+	if err := checkProductExists(s.db, policy.ProductID); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO stock_policies (product_id, policy, backorder_limit, release_date)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE policy = VALUES(policy), backorder_limit = VALUES(backorder_limit), release_date = VALUES(release_date)
+	`, policy.ProductID, policy.Policy, policy.Limit, policy.ReleaseDate)
+	if err != nil {
+		return fmt.Errorf("failed to set stock policy: %w", err)
+	}
+
+	return nil
+}
+
+// createBackorder записывает оплаченный сверх остатка товар, который ещё должен прийти.
+// Вызывается при коммите холда, под блокировкой баланса товара на складе.
+func createBackorder(tx *sql.Tx, orderID, productID, warehouseID, quantity int) error {
+	_, err := tx.Exec(
+		"INSERT INTO backorders (order_id, product_id, warehouse_id, quantity) VALUES (?, ?, ?, ?)",
+		orderID, productID, warehouseID, quantity,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create backorder: %w", err)
+	}
+
+	return nil
+}
+
+// cancelBackorders отменяет бэкордеры заказа по товару на складе, когда заказ
+// отменён после оплаты: ждать товар для него больше не нужно
+func cancelBackorders(tx *sql.Tx, orderID, productID, warehouseID int) error {
+	_, err := tx.Exec(`
+		UPDATE backorders
+		SET status = 'CANCELLED'
+		WHERE order_id = ? AND product_id = ? AND warehouse_id = ? AND status <> 'CANCELLED'
+	`, orderID, productID, warehouseID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel backorder: %w", err)
+	}
+
+	return nil
+}
+
+// GetBackorders возвращает бэкордеры, старые первыми (при status — только в этом статусе)
+func (s *Store) GetBackorders(status *types.BackorderStatus) ([]types.Backorder, error) {
+	query := "SELECT " + backorderColumns + " FROM backorders"
+	args := []any{}
+	if status != nil {
+		query += " WHERE status = ?"
+		args = append(args, *status)
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backorders: %w", err)
+	}
+	defer rows.Close()
+
+	backorders := []types.Backorder{}
+	for rows.Next() {
+		backorder, err := scanRowIntoBackorder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan backorder: %w", err)
+		}
+		backorders = append(backorders, *backorder)
+	}
+
+	return backorders, rows.Err()
+}
+
+// AllocateBackorders распределяет пришедший товар по открытым бэкордерам, начиная
+// с самых старых (при productID — только этого товара), и возвращает бэкордеры,
+// которым что-то досталось. Каждый товар на складе обрабатывается в своей транзакции.
+func (s *Store) AllocateBackorders(productID *int) ([]types.Backorder, error) {
+	query := "SELECT DISTINCT product_id, warehouse_id FROM backorders WHERE status = 'OPEN'"
+	args := []any{}
+	if productID != nil {
+		query += " AND product_id = ?"
+		args = append(args, *productID)
+	}
+	query += " ORDER BY product_id, warehouse_id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open backorders: %w", err)
+	}
+
+	type stockKey struct{ productID, warehouseID int }
+	var keys []stockKey
+	for rows.Next() {
+		var key stockKey
+		if err := rows.Scan(&key.productID, &key.warehouseID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan open backorder: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	allocated := []types.Backorder{}
+	for _, key := range keys {
+		backorders, err := s.allocateWarehouseBackorders(key.productID, key.warehouseID)
+		if err != nil {
+			return allocated, err
+		}
+		allocated = append(allocated, backorders...)
+	}
+
+	return allocated, nil
+}
+
+// allocateBackorders распределяет товар по бэкордерам после прихода; ошибка не
+// отменяет приход, бэкордеры распределит следующий запуск
+func (s *Store) allocateBackorders(productID int) {
+	if _, err := s.AllocateBackorders(&productID); err != nil {
+		log.Printf("failed to allocate backorders of product %d: %v", productID, err)
+	}
+}
+
+// allocateWarehouseBackorders распределяет товар по бэкордерам одного склада.
+// Коммит бэкордера уже списал его единицы, поэтому пришедшим товаром покрыто
+// всё нераспределённое, кроме того, что баланс всё ещё должен (его минус).
+func (s *Store) allocateWarehouseBackorders(productID, warehouseID int) ([]types.Backorder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	onHand, err := lockStockLevel(tx, productID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT `+backorderColumns+`
+		FROM backorders
+		WHERE product_id = ? AND warehouse_id = ? AND status = 'OPEN'
+		ORDER BY id
+		FOR UPDATE
+	`, productID, warehouseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open backorders: %w", err)
+	}
+	var open []types.Backorder
+	for rows.Next() {
+		backorder, err := scanRowIntoBackorder(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan backorder: %w", err)
+		}
+		open = append(open, *backorder)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	remaining := make([]int, len(open))
+	unallocated := 0
+	for i, backorder := range open {
+		remaining[i] = backorder.Quantity - backorder.Allocated
+		unallocated += remaining[i]
+	}
+
+	allocated := []types.Backorder{}
+	for i, quantity := range fillBackorders(remaining, unallocated-max(-onHand, 0)) {
+		if quantity == 0 {
+			continue
+		}
+
+		backorder := open[i]
+		backorder.Allocated += quantity
+		if backorder.Allocated == backorder.Quantity {
+			now := time.Now()
+			backorder.Status = types.BackorderStatusAllocated
+			backorder.AllocatedAt = &now
+		}
+		_, err := tx.Exec(`
+			UPDATE backorders
+			SET allocated = ?, status = ?, allocated_at = IF(? = 'ALLOCATED', NOW(), NULL)
+			WHERE id = ?
+		`, backorder.Allocated, backorder.Status, backorder.Status, backorder.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate backorder %d: %w", backorder.ID, err)
+		}
+		allocated = append(allocated, backorder)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return allocated, nil
+}
+
+func scanRowIntoBackorder(scanner interface{ Scan(dest ...any) error }) (*types.Backorder, error) {
+	var backorder types.Backorder
+	var allocatedAt sql.NullTime
+
+	err := scanner.Scan(
+		&backorder.ID,
+		&backorder.OrderID,
+		&backorder.ProductID,
+		&backorder.WarehouseID,
+		&backorder.Quantity,
+		&backorder.Allocated,
+		&backorder.Status,
+		&backorder.CreatedAt,
+		&allocatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if allocatedAt.Valid {
+		backorder.AllocatedAt = &allocatedAt.Time
+	}
+
+	return &backorder, nil
+}
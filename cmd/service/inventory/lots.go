@@ -0,0 +1,313 @@
+package inventory
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// lotColumns — колонки stock_lots, которые читает scanRowIntoLot. Партия считается
+// просроченной со дня, следующего за сроком годности.
+const lotColumns = `
+	id, product_id, warehouse_id, lot_number, expires_at, quantity_on_hand,
+	expires_at IS NOT NULL AND expires_at < CURDATE(), created_at
+`
+
+// ensureLot возвращает партию товара на складе, создавая её при первом приходе.
+// Один номер партии не может прийти с разными сроками годности.
+func ensureLot(tx *sql.Tx, productID, warehouseID int, lot types.LotInfo) (int, error) {
+	result, err := tx.Exec(`
+		INSERT INTO stock_lots (product_id, warehouse_id, lot_number, expires_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)
+	`, productID, warehouseID, lot.LotNumber, lot.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create lot: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get lot ID: %w", err)
+	}
+
+	var expiresAt sql.NullTime
+	if err := tx.QueryRow("SELECT expires_at FROM stock_lots WHERE id = ?", id).Scan(&expiresAt); err != nil {
+		return 0, fmt.Errorf("failed to get lot: %w", err)
+	}
+	if !sameDate(expiresAt, lot.ExpiresAt) {
+		return 0, fmt.Errorf("lot %s of product %d already exists with another expiry date", lot.LotNumber, productID)
+	}
+
+	return int(id), nil
+}
+
+// applyLotMovement двигает остаток партий вслед за движением. Движение с партией
+// меняет только её; расход без партии берётся сначала из товара без партии,
+// затем из партий по FEFO, просроченные — в последнюю очередь. balance — остаток
+// на складе уже после движения.
+func applyLotMovement(tx *sql.Tx, movement types.InventoryMovement, balance int) error {
+	if movement.LotID != nil {
+		query := "UPDATE stock_lots SET quantity_on_hand = quantity_on_hand + ? WHERE id = ? AND product_id = ? AND warehouse_id = ?"
+		if movement.MovementType == types.MovementTypeOut {
+			query = "UPDATE stock_lots SET quantity_on_hand = quantity_on_hand - ? WHERE id = ? AND product_id = ? AND warehouse_id = ? AND quantity_on_hand >= ?"
+		}
+
+		result, err := tx.Exec(query, movement.Quantity, *movement.LotID, movement.ProductID, movement.WarehouseID, movement.Quantity)
+		if err != nil {
+			return fmt.Errorf("failed to update lot: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("insufficient stock in lot %d of product %d", *movement.LotID, movement.ProductID)
+		}
+		return nil
+	}
+
+	if movement.MovementType == types.MovementTypeIn {
+		return nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, lot_number, expires_at, quantity_on_hand
+		FROM stock_lots
+		WHERE product_id = ? AND warehouse_id = ? AND quantity_on_hand > 0
+		ORDER BY expires_at < CURDATE(), expires_at IS NULL, expires_at, id
+		FOR UPDATE
+	`, movement.ProductID, movement.WarehouseID)
+	if err != nil {
+		return fmt.Errorf("failed to get lots: %w", err)
+	}
+	lots, err := scanLotStock(rows)
+	if err != nil {
+		return err
+	}
+
+	untracked := balance + movement.Quantity
+	for _, lot := range lots {
+		untracked -= lot.available
+	}
+	if movement.Quantity <= untracked {
+		return nil
+	}
+
+	for _, pick := range planLots(lots, movement.Quantity-max(untracked, 0)) {
+		if pick.lot == nil {
+			continue
+		}
+		_, err := tx.Exec("UPDATE stock_lots SET quantity_on_hand = quantity_on_hand - ? WHERE id = ?", pick.quantity, pick.lot.id)
+		if err != nil {
+			return fmt.Errorf("failed to update lot: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// pickLots решает, из каких партий склада взять quantity единиц по FEFO: сначала
+// партии с ближайшим сроком, затем партии без срока, затем товар без партии.
+// Просроченные партии и удержанное холдами не берутся. Вызывается под
+// блокировкой баланса товара на складе, после проверки доступного остатка.
+func pickLots(tx *sql.Tx, productID, warehouseID, quantity int) ([]lotPick, error) {
+	rows, err := tx.Query(`
+		SELECT l.id, l.lot_number, l.expires_at, l.quantity_on_hand - COALESCE(h.held, 0)
+		FROM stock_lots l
+		LEFT JOIN (
+			SELECT lot_id, SUM(quantity) AS held
+			FROM stock_holds
+			WHERE product_id = ? AND warehouse_id = ? AND lot_id IS NOT NULL
+			  AND status = 'ACTIVE' AND expires_at > NOW()
+			GROUP BY lot_id
+		) h ON h.lot_id = l.id
+		WHERE l.product_id = ? AND l.warehouse_id = ? AND l.quantity_on_hand > 0
+		  AND (l.expires_at IS NULL OR l.expires_at >= CURDATE())
+		ORDER BY l.expires_at IS NULL, l.expires_at, l.id
+	`, productID, warehouseID, productID, warehouseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lots: %w", err)
+	}
+	lots, err := scanLotStock(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return planLots(lots, quantity), nil
+}
+
+func scanLotStock(rows *sql.Rows) ([]lotStock, error) {
+	defer rows.Close()
+
+	var lots []lotStock
+	for rows.Next() {
+		var lot lotStock
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&lot.id, &lot.lotNumber, &expiresAt, &lot.available); err != nil {
+			return nil, fmt.Errorf("failed to scan lot: %w", err)
+		}
+		if expiresAt.Valid {
+			lot.expiresAt = &expiresAt.Time
+		}
+		lots = append(lots, lot)
+	}
+
+	return lots, rows.Err()
+}
+
+// GetProductLots возвращает партии товара с остатком на всех складах
+func (s *Store) GetProductLots(productID int) ([]types.StockLot, error) {
+	return s.queryLots(`
+		SELECT `+lotColumns+`
+		FROM stock_lots
+		WHERE product_id = ? AND quantity_on_hand > 0
+		ORDER BY expires_at IS NULL, expires_at, id
+	`, productID)
+}
+
+// GetExpiringLots возвращает партии с остатком, срок годности которых истекает в
+// ближайшие days дней, вместе с уже просроченными (при warehouseID — только на этом складе)
+func (s *Store) GetExpiringLots(days int, warehouseID *int) ([]types.StockLot, error) {
+	query := `
+		SELECT ` + lotColumns + `
+		FROM stock_lots
+		WHERE quantity_on_hand > 0 AND expires_at <= DATE_ADD(CURDATE(), INTERVAL ? DAY)
+	`
+	args := []any{days}
+	if warehouseID != nil {
+		if _, err := resolveWarehouse(s.db, warehouseID); err != nil {
+			return nil, err
+		}
+		query += " AND warehouse_id = ?"
+		args = append(args, *warehouseID)
+	}
+	query += " ORDER BY expires_at, id"
+
+	return s.queryLots(query, args...)
+}
+
+// WriteOffExpiredLots списывает остаток всех просроченных партий корректировкой
+// с причиной EXPIRED и возвращает списанные партии. Балансы блокируются в
+// порядке товаров и складов, как и в остальных операциях.
+func (s *Store) WriteOffExpiredLots(warehouseID *int) ([]types.StockLot, error) {
+	if warehouseID != nil {
+		if _, err := resolveWarehouse(s.db, warehouseID); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + lotColumns + " FROM stock_lots WHERE quantity_on_hand > 0 AND expires_at < CURDATE()"
+	args := []any{}
+	if warehouseID != nil {
+		query += " AND warehouse_id = ?"
+		args = append(args, *warehouseID)
+	}
+	query += " ORDER BY product_id, warehouse_id, id"
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired lots: %w", err)
+	}
+	var expired []types.StockLot
+	for rows.Next() {
+		lot, err := scanRowIntoLot(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan lot: %w", err)
+		}
+		expired = append(expired, *lot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	writtenOff := []types.StockLot{}
+	for _, lot := range expired {
+		if _, err := lockStockLevel(tx, lot.ProductID, lot.WarehouseID); err != nil {
+			return nil, err
+		}
+
+		// Остаток перечитываем под блокировкой: партию могли списать до неё
+		if err := tx.QueryRow("SELECT quantity_on_hand FROM stock_lots WHERE id = ? FOR UPDATE", lot.ID).Scan(&lot.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to lock lot: %w", err)
+		}
+		if lot.Quantity == 0 {
+			continue
+		}
+
+		note := fmt.Sprintf("Lot %s expired on %s", lot.LotNumber, lot.ExpiresAt.Format("2006-01-02"))
+		movement := adjustmentMovement(lot.ProductID, lot.WarehouseID, -lot.Quantity, types.AdjustmentExpired, note, nil)
+		movement.LotID = &lot.ID
+		if err := insertMovement(tx, movement); err != nil {
+			return nil, fmt.Errorf("failed to write off lot %s of product %d: %w", lot.LotNumber, lot.ProductID, err)
+		}
+		writtenOff = append(writtenOff, lot)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return writtenOff, nil
+}
+
+func (s *Store) queryLots(query string, args ...any) ([]types.StockLot, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lots: %w", err)
+	}
+	defer rows.Close()
+
+	lots := []types.StockLot{}
+	for rows.Next() {
+		lot, err := scanRowIntoLot(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan lot: %w", err)
+		}
+		lots = append(lots, *lot)
+	}
+
+	return lots, rows.Err()
+}
+
+func scanRowIntoLot(scanner interface{ Scan(dest ...any) error }) (*types.StockLot, error) {
+	var lot types.StockLot
+	var expiresAt sql.NullTime
+
+	err := scanner.Scan(
+		&lot.ID,
+		&lot.ProductID,
+		&lot.WarehouseID,
+		&lot.LotNumber,
+		&expiresAt,
+		&lot.Quantity,
+		&lot.Expired,
+		&lot.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		lot.ExpiresAt = &expiresAt.Time
+	}
+
+	return &lot, nil
+}
+
+// sameDate сравнивает сроки годности с точностью до дня
+func sameDate(stored sql.NullTime, expiresAt *time.Time) bool {
+	if !stored.Valid || expiresAt == nil {
+		return !stored.Valid && expiresAt == nil
+	}
+	return stored.Time.Format("2006-01-02") == expiresAt.Format("2006-01-02")
+}
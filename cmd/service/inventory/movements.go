@@ -0,0 +1,155 @@
+package inventory
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+const movementColumns = `
+	id, product_id, warehouse_id, lot_id, movement_type, quantity, balance_after, unit_cost, reason, reason_code,
+	reference_id, reference_type, created_at
+`
+
+// GetStockHistory возвращает последние движения товара
+func (s *Store) GetStockHistory(productID int, limit int) ([]types.InventoryMovement, error) {
+	return s.GetMovements(types.MovementFilter{ProductID: &productID, Limit: limit})
+}
+
+// GetMovements возвращает движения журнала по фильтру, новые первыми.
+// Порядок по ID стабилен, даже когда у движений совпадает created_at.
+func (s *Store) GetMovements(filter types.MovementFilter) ([]types.InventoryMovement, error) {
+	movements := []types.InventoryMovement{}
+	err := s.StreamMovements(filter, func(movement types.InventoryMovement) error {
+		movements = append(movements, movement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return movements, nil
+}
+
+// StreamMovements передаёт движения по фильтру в fn по одному, не собирая их в памяти
+// (для выгрузки всего журнала). Ошибка fn останавливает чтение.
+func (s *Store) StreamMovements(filter types.MovementFilter, fn func(types.InventoryMovement) error) error {
+	query, args := buildMovementQuery(filter)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get stock history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		movement, err := scanRowIntoMovement(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan movement row: %w", err)
+		}
+		if err := fn(*movement); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// buildMovementQuery собирает запрос к журналу по фильтру
+func buildMovementQuery(filter types.MovementFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.ProductID != nil {
+		conditions = append(conditions, "product_id = ?")
+		args = append(args, *filter.ProductID)
+	}
+	if filter.WarehouseID != nil {
+		conditions = append(conditions, "warehouse_id = ?")
+		args = append(args, *filter.WarehouseID)
+	}
+	if filter.MovementType != nil {
+		conditions = append(conditions, "movement_type = ?")
+		args = append(args, *filter.MovementType)
+	}
+	if filter.ReferenceType != nil {
+		conditions = append(conditions, "reference_type = ?")
+		args = append(args, *filter.ReferenceType)
+	}
+	if filter.ReferenceID != nil {
+		conditions = append(conditions, "reference_id = ?")
+		args = append(args, *filter.ReferenceID)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, *filter.To)
+	}
+	if filter.BeforeID != nil {
+		conditions = append(conditions, "id < ?")
+		args = append(args, *filter.BeforeID)
+	}
+
+	query := "SELECT " + movementColumns + " FROM inventory_movements"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	return query, args
+}
+
+func scanRowIntoMovement(scanner interface{ Scan(dest ...any) error }) (*types.InventoryMovement, error) {
+	var movement types.InventoryMovement
+	var balance sql.NullInt64
+	var refID sql.NullInt64
+	var refType sql.NullString
+	var reasonCode sql.NullString
+
+	err := scanner.Scan(
+		&movement.ID,
+		&movement.ProductID,
+		&movement.WarehouseID,
+		&movement.LotID,
+		&movement.MovementType,
+		&movement.Quantity,
+		&balance,
+		&movement.UnitCost,
+		&movement.Reason,
+		&reasonCode,
+		&refID,
+		&refType,
+		&movement.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if balance.Valid {
+		b := int(balance.Int64)
+		movement.BalanceAfter = &b
+	}
+	if refID.Valid {
+		id := int(refID.Int64)
+		movement.ReferenceID = &id
+	}
+	if refType.Valid {
+		rt := types.InventoryRefType(refType.String)
+		movement.ReferenceType = &rt
+	}
+	if reasonCode.Valid {
+		rc := types.AdjustmentReason(reasonCode.String)
+		movement.ReasonCode = &rc
+	}
+
+	return &movement, nil
+}
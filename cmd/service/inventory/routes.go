@@ -1,8 +1,15 @@
 package inventory
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
 	"github.com/HollyEllmo/go_rest_tut/cmd/types"
@@ -12,19 +19,63 @@ import (
 )
 
 type Handler struct {
-	store     types.InventoryStore
-	userStore types.UserStore
+	store          types.InventoryStore
+	stockTakeStore types.StockTakeStore
+	alertStore     types.StockAlertStore
+	valuationStore types.ValuationStore
+	lotStore       types.StockLotStore
+	backorderStore types.BackorderStore
+	userStore      types.UserStore
 }
 
-func NewHandler(store types.InventoryStore, userStore types.UserStore) *Handler {
-	return &Handler{store: store, userStore: userStore}
+func NewHandler(store types.InventoryStore, stockTakeStore types.StockTakeStore, alertStore types.StockAlertStore, valuationStore types.ValuationStore, lotStore types.StockLotStore, backorderStore types.BackorderStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, stockTakeStore: stockTakeStore, alertStore: alertStore, valuationStore: valuationStore, lotStore: lotStore, backorderStore: backorderStore, userStore: userStore}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	// Admin only routes for inventory management
 	router.HandleFunc("/inventory/{productId}/stock", auth.WithJWTAuth(h.handleGetStock, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/inventory/{productId}/history", auth.WithJWTAuth(h.handleGetHistory, h.userStore)).Methods(http.MethodGet)
-	router.HandleFunc("/inventory/{productId}/add", auth.WithJWTAuth(h.handleAddStock, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/inventory/{productId}/history/export", auth.WithAdminAuth(h.handleExportHistory, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/{productId}/add", auth.WithAdminAuth(h.handleAddStock, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/inventory/{productId}/adjust", auth.WithAdminAuth(h.handleAdjustStock, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/inventory/{productId}/transfer", auth.WithAdminAuth(h.handleTransferStock, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/inventory/warehouses/{warehouseId}/stock", auth.WithAdminAuth(h.handleGetWarehouseStock, h.userStore)).Methods(http.MethodGet)
+
+	// Admin only routes for the movement ledger across all products
+	router.HandleFunc("/inventory/movements", auth.WithAdminAuth(h.handleGetMovements, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/movements/export", auth.WithAdminAuth(h.handleExportMovements, h.userStore)).Methods(http.MethodGet)
+
+	// Admin only routes for lots and expiry dates
+	router.HandleFunc("/inventory/{productId}/lots", auth.WithAdminAuth(h.handleGetProductLots, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/lots/expiring", auth.WithAdminAuth(h.handleGetExpiringLots, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/lots/write-off-expired", auth.WithAdminAuth(h.handleWriteOffExpiredLots, h.userStore)).Methods(http.MethodPost)
+
+	// Admin only routes for stock valuation and margin reports
+	router.HandleFunc("/inventory/valuation", auth.WithAdminAuth(h.handleGetStockValuation, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/reports/gross-margin", auth.WithAdminAuth(h.handleGetGrossMargin, h.userStore)).Methods(http.MethodGet)
+
+	// Admin only routes for low-stock alerts
+	router.HandleFunc("/inventory/{productId}/threshold", auth.WithAdminAuth(h.handleSetReorderThreshold, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/inventory/alerts", auth.WithAdminAuth(h.handleGetStockAlerts, h.userStore)).Methods(http.MethodGet)
+
+	// Admin only routes for backorders and pre-orders
+	router.HandleFunc("/inventory/{productId}/policy", auth.WithAdminAuth(h.handleGetStockPolicy, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/{productId}/policy", auth.WithAdminAuth(h.handleSetStockPolicy, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/inventory/backorders", auth.WithAdminAuth(h.handleGetBackorders, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/backorders/allocate", auth.WithAdminAuth(h.handleAllocateBackorders, h.userStore)).Methods(http.MethodPost)
+
+	// Customer routes for back-in-stock notifications
+	router.HandleFunc("/products/{productId}/notify-me", auth.WithJWTAuth(h.handleSubscribe, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products/{productId}/notify-me", auth.WithJWTAuth(h.handleUnsubscribe, h.userStore)).Methods(http.MethodDelete)
+
+	// Admin only routes for stock takes (physical counts)
+	router.HandleFunc("/inventory/stock-takes", auth.WithAdminAuth(h.handleCreateStockTake, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/inventory/stock-takes", auth.WithAdminAuth(h.handleGetStockTakes, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/stock-takes/{id}", auth.WithAdminAuth(h.handleGetStockTake, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/inventory/stock-takes/{id}/counts", auth.WithAdminAuth(h.handleSubmitStockCounts, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/inventory/stock-takes/{id}/post", auth.WithAdminAuth(h.handlePostStockTake, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/inventory/stock-takes/{id}/cancel", auth.WithAdminAuth(h.handleCancelStockTake, h.userStore)).Methods(http.MethodPost)
 }
 
 func (h *Handler) handleGetStock(w http.ResponseWriter, r *http.Request) {
@@ -35,7 +86,7 @@ func (h *Handler) handleGetStock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stock, err := h.store.GetCurrentStock(productID)
+	level, err := h.store.GetStockLevel(productID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -43,10 +94,14 @@ func (h *Handler) handleGetStock(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSON(w, http.StatusOK, map[string]any{
 		"product_id":    productID,
-		"current_stock": stock,
+		"current_stock": level.Available,
+		"on_hand":       level.OnHand,
+		"held":          level.Held,
+		"warehouses":    level.Warehouses,
 	})
 }
 
+// GET /api/v1/inventory/{productId}/history - movements of one product, newest first
 func (h *Handler) handleGetHistory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID, err := strconv.Atoi(vars["productId"])
@@ -55,28 +110,269 @@ func (h *Handler) handleGetHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 50 // default limit
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
+	filter, err := parseMovementFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
 	}
+	filter.ProductID = &productID
 
-	history, err := h.store.GetStockHistory(productID, limit)
+	page, err := h.getMovementPage(filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, map[string]any{
-		"product_id": productID,
-		"history":    history,
+		"product_id":  productID,
+		"history":     page.Movements,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.HasMore,
+		"count":       len(page.Movements),
+	})
+}
+
+// GET /api/v1/inventory/movements - movements of all products, newest first
+func (h *Handler) handleGetMovements(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseMovementFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if productIDStr := r.URL.Query().Get("productId"); productIDStr != "" {
+		productID, err := strconv.Atoi(productIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid productId"))
+			return
+		}
+		filter.ProductID = &productID
+	}
+
+	page, err := h.getMovementPage(filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, page)
+}
+
+// GET /api/v1/inventory/{productId}/history/export?format=csv|ndjson - full history of one product
+func (h *Handler) handleExportHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filter, err := parseMovementFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.ProductID = &productID
+
+	h.exportMovements(w, r, filter, fmt.Sprintf("product-%d-movements", productID))
+}
+
+// GET /api/v1/inventory/movements/export?format=csv|ndjson - full ledger for audits
+func (h *Handler) handleExportMovements(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseMovementFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if productIDStr := r.URL.Query().Get("productId"); productIDStr != "" {
+		productID, err := strconv.Atoi(productIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid productId"))
+			return
+		}
+		filter.ProductID = &productID
+	}
+
+	h.exportMovements(w, r, filter, "movements")
+}
+
+// getMovementPage fetches one more movement than asked for to tell whether
+// there is a next page
+func (h *Handler) getMovementPage(filter types.MovementFilter) (*types.MovementPage, error) {
+	limit := filter.Limit
+	filter.Limit = limit + 1
+
+	movements, err := h.store.GetMovements(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &types.MovementPage{Movements: movements}
+	if len(movements) > limit {
+		page.Movements = movements[:limit]
+		page.HasMore = true
+		page.NextCursor = encodeMovementCursor(page.Movements[limit-1].ID)
+	}
+
+	return page, nil
+}
+
+// exportMovements streams every movement matching the filter, ignoring limit.
+// Rows are flushed as they go, so a large export never sits in memory.
+func (h *Handler) exportMovements(w http.ResponseWriter, r *http.Request, filter types.MovementFilter, filename string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid format. Must be csv or ndjson"))
+		return
+	}
+	filter.Limit = 0
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var write func(types.InventoryMovement) error
+	var csvWriter *csv.Writer
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		csvWriter = csv.NewWriter(w)
+		write = func(movement types.InventoryMovement) error {
+			return csvWriter.Write(movementCSVRecord(movement))
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		write = func(movement types.InventoryMovement) error {
+			return encoder.Encode(movement)
+		}
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+	w.WriteHeader(http.StatusOK)
+
+	if csvWriter != nil {
+		if err := csvWriter.Write(movementCSVHeader); err != nil {
+			log.Printf("failed to export movements: %v", err)
+			return
+		}
+	}
+
+	rows := 0
+	err := h.store.StreamMovements(filter, func(movement types.InventoryMovement) error {
+		if err := write(movement); err != nil {
+			return err
+		}
+		rows++
+		if rows%500 == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			flush()
+		}
+		return nil
 	})
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	flush()
+
+	// The status is already sent, so a failure can only cut the file short
+	if err != nil {
+		log.Printf("failed to export movements: %v", err)
+	}
+}
+
+// parseMovementFilter reads the ledger filters shared by the history, ledger and
+// export endpoints
+func parseMovementFilter(r *http.Request) (types.MovementFilter, error) {
+	query := r.URL.Query()
+	filter := types.MovementFilter{Limit: 50}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 500 {
+			return filter, fmt.Errorf("invalid limit. Must be between 1 and 500")
+		}
+		filter.Limit = limit
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		beforeID, err := decodeMovementCursor(cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.BeforeID = &beforeID
+	}
+
+	if warehouseIDStr := query.Get("warehouseId"); warehouseIDStr != "" {
+		warehouseID, err := strconv.Atoi(warehouseIDStr)
+		if err != nil {
+			return filter, fmt.Errorf("invalid warehouseId")
+		}
+		filter.WarehouseID = &warehouseID
+	}
+
+	if typeStr := query.Get("movementType"); typeStr != "" {
+		movementType := types.InventoryMovementType(strings.ToUpper(typeStr))
+		if movementType != types.MovementTypeIn && movementType != types.MovementTypeOut {
+			return filter, fmt.Errorf("invalid movementType. Must be IN or OUT")
+		}
+		filter.MovementType = &movementType
+	}
+
+	if refTypeStr := query.Get("referenceType"); refTypeStr != "" {
+		refType := types.InventoryRefType(strings.ToUpper(refTypeStr))
+		switch refType {
+		case types.RefTypeOrder, types.RefTypeRestock, types.RefTypeAdjustment, types.RefTypeReturn,
+			types.RefTypeTransfer, types.RefTypePurchase:
+		default:
+			return filter, fmt.Errorf("invalid referenceType %s", refTypeStr)
+		}
+		filter.ReferenceType = &refType
+	}
+
+	if refIDStr := query.Get("referenceId"); refIDStr != "" {
+		refID, err := strconv.Atoi(refIDStr)
+		if err != nil {
+			return filter, fmt.Errorf("invalid referenceId")
+		}
+		filter.ReferenceID = &refID
+	}
+
+	if fromDateStr := query.Get("fromDate"); fromDateStr != "" {
+		fromDate, err := time.Parse("2006-01-02", fromDateStr)
+		if err != nil {
+			return filter, fmt.Errorf("invalid fromDate format. Use YYYY-MM-DD")
+		}
+		filter.From = &fromDate
+	}
+
+	if toDateStr := query.Get("toDate"); toDateStr != "" {
+		toDate, err := time.Parse("2006-01-02", toDateStr)
+		if err != nil {
+			return filter, fmt.Errorf("invalid toDate format. Use YYYY-MM-DD")
+		}
+		// Include the whole day
+		toDate = toDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		filter.To = &toDate
+	}
+
+	return filter, nil
 }
 
 type AddStockPayload struct {
-	Quantity int    `json:"quantity" validate:"required,gt=0"`
-	Reason   string `json:"reason" validate:"required"`
+	WarehouseID *int         `json:"warehouseId"`
+	Quantity    int          `json:"quantity" validate:"required,gt=0"`
+	UnitCost    *types.Money `json:"unitCost"`                    // Optional: purchase cost per unit in the base currency
+	LotNumber   string       `json:"lotNumber" validate:"max=64"` // Optional: for stock tracked by lot
+	ExpiresAt   string       `json:"expiresAt"`                   // Optional: YYYY-MM-DD, requires a lot number
+	Reason      string       `json:"reason" validate:"required"`
 }
 
 func (h *Handler) handleAddStock(w http.ResponseWriter, r *http.Request) {
@@ -99,8 +395,27 @@ func (h *Handler) handleAddStock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.AddStock(productID, payload.Quantity, payload.Reason, types.RefTypeRestock, nil)
+	if payload.UnitCost != nil && payload.UnitCost.IsNegative() {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unit cost cannot be negative"))
+		return
+	}
+
+	lot, err := lotFromPayload(payload.LotNumber, payload.ExpiresAt)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.store.AddStock(productID, payload.WarehouseID, payload.Quantity, payload.UnitCost, lot, payload.Reason, types.RefTypeRestock, nil)
 	if err != nil {
+		if payload.WarehouseID != nil && strings.HasSuffix(err.Error(), fmt.Sprintf("warehouse %d not found", *payload.WarehouseID)) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if strings.HasSuffix(err.Error(), "already exists with another expiry date") {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -117,4 +432,671 @@ func (h *Handler) handleAddStock(w http.ResponseWriter, r *http.Request) {
 		"current_stock": newStock,
 		"reason":        payload.Reason,
 	})
-}
\ No newline at end of file
+}
+
+// POST /api/v1/inventory/{productId}/adjust - write stock off or correct it, with a reason code
+func (h *Handler) handleAdjustStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.AdjustStockPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	if err := checkAdjustmentReason(payload.Quantity, payload.ReasonCode); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.store.AdjustStock(productID, payload.WarehouseID, payload.Quantity, payload.ReasonCode, payload.Note)
+	if err != nil {
+		switch {
+		case err.Error() == fmt.Sprintf("product %d not found", productID),
+			payload.WarehouseID != nil && err.Error() == fmt.Sprintf("warehouse %d not found", *payload.WarehouseID):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case strings.HasPrefix(err.Error(), "insufficient stock"):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	level, err := h.store.GetStockLevel(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"product_id":    productID,
+		"adjusted":      payload.Quantity,
+		"reason_code":   payload.ReasonCode,
+		"on_hand":       level.OnHand,
+		"current_stock": level.Available,
+	})
+}
+
+// POST /api/v1/inventory/{productId}/transfer - move available stock between warehouses
+func (h *Handler) handleTransferStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.TransferStockPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	transfer, err := h.store.TransferStock(productID, payload.FromWarehouseID, payload.ToWarehouseID, payload.Quantity, payload.Note)
+	if err != nil {
+		switch {
+		case err.Error() == fmt.Sprintf("product %d not found", productID),
+			err.Error() == fmt.Sprintf("warehouse %d not found", payload.FromWarehouseID),
+			err.Error() == fmt.Sprintf("warehouse %d not found", payload.ToWarehouseID):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case strings.HasPrefix(err.Error(), "insufficient stock"):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, transfer)
+}
+
+// GET /api/v1/inventory/warehouses/{warehouseId}/stock - stock of every product in one warehouse
+func (h *Handler) handleGetWarehouseStock(w http.ResponseWriter, r *http.Request) {
+	warehouseID, err := strconv.Atoi(mux.Vars(r)["warehouseId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid warehouse ID"))
+		return
+	}
+
+	stock, err := h.store.GetWarehouseStock(warehouseID)
+	if err != nil {
+		if err.Error() == fmt.Sprintf("warehouse %d not found", warehouseID) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"warehouse_id": warehouseID,
+		"stock":        stock,
+		"count":        len(stock),
+	})
+}
+
+// PUT /api/v1/inventory/{productId}/threshold - set the stock level at or below which the product raises a low-stock alert
+func (h *Handler) handleSetReorderThreshold(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.SetReorderThresholdPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	if err := h.alertStore.SetReorderThreshold(productID, *payload.ReorderLevel); err != nil {
+		if err.Error() == fmt.Sprintf("product %d not found", productID) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"product_id":    productID,
+		"reorder_level": *payload.ReorderLevel,
+	})
+}
+
+// GET /api/v1/inventory/{productId}/lots - lots of a product with stock left, soonest expiry first
+func (h *Handler) handleGetProductLots(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	lots, err := h.lotStore.GetProductLots(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"product_id": productID,
+		"lots":       lots,
+		"count":      len(lots),
+	})
+}
+
+// GET /api/v1/inventory/lots/expiring?days=30&warehouseId= - lots expiring soon, and those already expired
+func (h *Handler) handleGetExpiringLots(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		parsedDays, err := strconv.Atoi(daysStr)
+		if err != nil || parsedDays < 0 || parsedDays > 365 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid days. Must be between 0 and 365"))
+			return
+		}
+		days = parsedDays
+	}
+
+	var warehouseID *int
+	if warehouseIDStr := r.URL.Query().Get("warehouseId"); warehouseIDStr != "" {
+		id, err := strconv.Atoi(warehouseIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid warehouseId"))
+			return
+		}
+		warehouseID = &id
+	}
+
+	lots, err := h.lotStore.GetExpiringLots(days, warehouseID)
+	if err != nil {
+		if warehouseID != nil && err.Error() == fmt.Sprintf("warehouse %d not found", *warehouseID) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"days":  days,
+		"lots":  lots,
+		"count": len(lots),
+	})
+}
+
+type WriteOffExpiredLotsPayload struct {
+	WarehouseID *int `json:"warehouseId,omitempty"` // all warehouses when omitted
+}
+
+// POST /api/v1/inventory/lots/write-off-expired - write off the stock of every expired lot
+func (h *Handler) handleWriteOffExpiredLots(w http.ResponseWriter, r *http.Request) {
+	var payload WriteOffExpiredLotsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	lots, err := h.lotStore.WriteOffExpiredLots(payload.WarehouseID)
+	if err != nil {
+		if payload.WarehouseID != nil && err.Error() == fmt.Sprintf("warehouse %d not found", *payload.WarehouseID) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writtenOff := 0
+	for _, lot := range lots {
+		writtenOff += lot.Quantity
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"lots":        lots,
+		"written_off": writtenOff,
+		"count":       len(lots),
+	})
+}
+
+// GET /api/v1/inventory/valuation?method=fifo|average - value of the stock on hand per product
+func (h *Handler) handleGetStockValuation(w http.ResponseWriter, r *http.Request) {
+	method := h.valuationStore.ValuationMethod()
+	if methodStr := r.URL.Query().Get("method"); methodStr != "" {
+		method = types.ValuationMethod(strings.ToLower(methodStr))
+		if method != types.ValuationFIFO && method != types.ValuationAverage {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid method. Must be fifo or average"))
+			return
+		}
+	}
+
+	valuations, err := h.valuationStore.GetStockValuation(method)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	total := types.NewMoney(0, types.DefaultCurrency)
+	for _, valuation := range valuations {
+		total = total.Add(valuation.Value)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"method":      method,
+		"products":    valuations,
+		"total_value": total,
+		"currency":    types.DefaultCurrency,
+		"count":       len(valuations),
+	})
+}
+
+// GET /api/v1/inventory/reports/gross-margin?fromDate=&toDate= - margin of paid and completed orders
+func (h *Handler) handleGetGrossMargin(w http.ResponseWriter, r *http.Request) {
+	var from, to *time.Time
+	if fromDateStr := r.URL.Query().Get("fromDate"); fromDateStr != "" {
+		fromDate, err := time.Parse("2006-01-02", fromDateStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid fromDate format. Use YYYY-MM-DD"))
+			return
+		}
+		from = &fromDate
+	}
+
+	if toDateStr := r.URL.Query().Get("toDate"); toDateStr != "" {
+		toDate, err := time.Parse("2006-01-02", toDateStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid toDate format. Use YYYY-MM-DD"))
+			return
+		}
+		// Include the whole day
+		toDate = toDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		to = &toDate
+	}
+
+	margins, err := h.valuationStore.GetOrderMargins(from, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	revenue := types.NewMoney(0, types.DefaultCurrency)
+	cost := types.NewMoney(0, types.DefaultCurrency)
+	for _, margin := range margins {
+		revenue = revenue.Add(margin.Revenue)
+		cost = cost.Add(margin.Cost)
+	}
+	margin, marginPercent := grossMargin(revenue, cost)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"orders":         margins,
+		"revenue":        revenue,
+		"cost":           cost,
+		"margin":         margin,
+		"margin_percent": marginPercent,
+		"currency":       types.DefaultCurrency,
+		"count":          len(margins),
+	})
+}
+
+// GET /api/v1/inventory/alerts - products that are low or out of stock right now
+func (h *Handler) handleGetStockAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := h.alertStore.GetStockAlerts()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// GET /api/v1/inventory/{productId}/policy - whether the product can be ordered beyond its stock
+func (h *Handler) handleGetStockPolicy(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	policy, err := h.backorderStore.GetStockPolicy(productID)
+	if err != nil {
+		if err.Error() == fmt.Sprintf("product %d not found", productID) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, policy)
+}
+
+// PUT /api/v1/inventory/{productId}/policy - deny, backorder up to a limit, or pre-order until a release date
+func (h *Handler) handleSetStockPolicy(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.SetStockPolicyPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	policy, err := stockPolicyFromPayload(productID, payload, time.Now())
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.backorderStore.SetStockPolicy(policy); err != nil {
+		if err.Error() == fmt.Sprintf("product %d not found", productID) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, policy)
+}
+
+// GET /api/v1/inventory/backorders?status=OPEN|ALLOCATED|CANCELLED - units sold beyond stock, oldest first
+func (h *Handler) handleGetBackorders(w http.ResponseWriter, r *http.Request) {
+	var status *types.BackorderStatus
+	if statusStr := r.URL.Query().Get("status"); statusStr != "" {
+		s := types.BackorderStatus(strings.ToUpper(statusStr))
+		if s != types.BackorderStatusOpen && s != types.BackorderStatusAllocated && s != types.BackorderStatusCancelled {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid status. Must be OPEN, ALLOCATED or CANCELLED"))
+			return
+		}
+		status = &s
+	}
+
+	backorders, err := h.backorderStore.GetBackorders(status)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"backorders": backorders,
+		"count":      len(backorders),
+	})
+}
+
+// POST /api/v1/inventory/backorders/allocate - assign stock on hand to the oldest open backorders
+func (h *Handler) handleAllocateBackorders(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, by default the backorders of all products are allocated
+	var payload types.AllocateBackordersPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	backorders, err := h.backorderStore.AllocateBackorders(payload.ProductID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"backorders": backorders,
+		"count":      len(backorders),
+	})
+}
+
+// POST /api/v1/products/{productId}/notify-me - get an email when an out-of-stock product is back
+func (h *Handler) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	subscription, err := h.alertStore.Subscribe(productID, userID)
+	if err != nil {
+		switch err.Error() {
+		case fmt.Sprintf("product %d not found", productID):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case fmt.Sprintf("product %d is in stock", productID):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, subscription)
+}
+
+// DELETE /api/v1/products/{productId}/notify-me - cancel a back-in-stock notification
+func (h *Handler) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.alertStore.Unsubscribe(productID, userID); err != nil {
+		if err.Error() == "subscription not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"product_id":   productID,
+		"unsubscribed": true,
+	})
+}
+
+// POST /api/v1/inventory/stock-takes - open a count session
+func (h *Handler) handleCreateStockTake(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.CreateStockTakePayload
+	if err := utils.ParseJSON(r, &payload); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	stockTakeID, err := h.stockTakeStore.CreateStockTake(payload.WarehouseID, payload.Note, userID)
+	if err != nil {
+		if payload.WarehouseID != nil && err.Error() == fmt.Sprintf("warehouse %d not found", *payload.WarehouseID) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	stockTake, err := h.stockTakeStore.GetStockTake(stockTakeID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, stockTake)
+}
+
+// GET /api/v1/inventory/stock-takes - list stock takes, optionally filtered by status
+func (h *Handler) handleGetStockTakes(w http.ResponseWriter, r *http.Request) {
+	var status *types.StockTakeStatus
+	if s := r.URL.Query().Get("status"); s != "" {
+		stockTakeStatus := types.StockTakeStatus(s)
+		switch stockTakeStatus {
+		case types.StockTakeOpen, types.StockTakePosted, types.StockTakeCancelled:
+			status = &stockTakeStatus
+		default:
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid status. Must be one of: OPEN, POSTED, CANCELLED"))
+			return
+		}
+	}
+
+	stockTakes, err := h.stockTakeStore.GetStockTakes(status)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"stock_takes": stockTakes,
+		"count":       len(stockTakes),
+	})
+}
+
+// GET /api/v1/inventory/stock-takes/{id} - review the counts and their variances
+func (h *Handler) handleGetStockTake(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, ok := parseStockTakeID(w, r)
+	if !ok {
+		return
+	}
+
+	stockTake, err := h.stockTakeStore.GetStockTake(stockTakeID)
+	if err != nil {
+		if err.Error() == "stock take not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, stockTake)
+}
+
+// PUT /api/v1/inventory/stock-takes/{id}/counts - submit counted quantities, recounts replace earlier ones
+func (h *Handler) handleSubmitStockCounts(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, ok := parseStockTakeID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.SubmitStockCountsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	if err := h.stockTakeStore.SetStockCounts(stockTakeID, payload.Counts); err != nil {
+		h.writeStockTakeError(w, err)
+		return
+	}
+
+	h.writeStockTake(w, stockTakeID)
+}
+
+// POST /api/v1/inventory/stock-takes/{id}/post - post the variances as adjustments, all or nothing
+func (h *Handler) handlePostStockTake(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, ok := parseStockTakeID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.stockTakeStore.PostStockTake(stockTakeID); err != nil {
+		if err.Error() == fmt.Sprintf("stock take %d has no counts", stockTakeID) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		h.writeStockTakeError(w, err)
+		return
+	}
+
+	h.writeStockTake(w, stockTakeID)
+}
+
+// POST /api/v1/inventory/stock-takes/{id}/cancel - drop an open stock take without adjusting stock
+func (h *Handler) handleCancelStockTake(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, ok := parseStockTakeID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.stockTakeStore.CancelStockTake(stockTakeID); err != nil {
+		h.writeStockTakeError(w, err)
+		return
+	}
+
+	h.writeStockTake(w, stockTakeID)
+}
+
+func parseStockTakeID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	stockTakeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid stock take ID"))
+		return 0, false
+	}
+	return stockTakeID, true
+}
+
+func (h *Handler) writeStockTakeError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == fmt.Sprintf("stock take not found or not in status %s", types.StockTakeOpen):
+		utils.WriteError(w, http.StatusConflict, err)
+	case strings.HasPrefix(err.Error(), "product ") && strings.HasSuffix(err.Error(), " not found"):
+		utils.WriteError(w, http.StatusBadRequest, err)
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (h *Handler) writeStockTake(w http.ResponseWriter, stockTakeID int) {
+	stockTake, err := h.stockTakeStore.GetStockTake(stockTakeID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, stockTake)
+}
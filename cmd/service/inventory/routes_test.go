@@ -0,0 +1,85 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/config"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/gorilla/mux"
+)
+
+func TestAddStockRequiresAdmin(t *testing.T) {
+	config.Envs.JWTSecret = "test-secret"
+	config.Envs.JWTExpirationInSeconds = 60
+
+	userStore := &mockUserStore{users: map[int]types.User{
+		1: {ID: 1, Role: types.RoleCustomer},
+		2: {ID: 2, Role: types.RoleAdmin},
+	}}
+	router := mux.NewRouter()
+	NewHandler(nil, nil, nil, nil, nil, nil, userStore).RegisterRoutes(router)
+
+	addStock := func(t *testing.T, userID int, payload AddStockPayload) *httptest.ResponseRecorder {
+		token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID)
+		if err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+
+		marshalled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPost, "/inventory/1/add", bytes.NewBuffer(marshalled))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// a lot with an early expiry date would be the first one reservations take
+	payload := AddStockPayload{Quantity: 5, LotNumber: "L1", ExpiresAt: "2026-10-19", Reason: "Delivery"}
+
+	t.Run("should reject customers receiving stock into a lot", func(t *testing.T) {
+		rr := addStock(t, 1, payload)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should let admins through to the payload checks", func(t *testing.T) {
+		invalid := payload
+		invalid.ExpiresAt = "tomorrow"
+
+		rr := addStock(t, 2, invalid)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body)
+		}
+	})
+}
+
+type mockUserStore struct {
+	users map[int]types.User
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user with email %s not found", email)
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	return &user, nil
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
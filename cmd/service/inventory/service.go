@@ -0,0 +1,352 @@
+package inventory
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// checkAdjustmentReason makes sure the reason code fits the direction of the
+// adjustment: write-offs take stock away, found goods add it back
+func checkAdjustmentReason(quantity int, reasonCode types.AdjustmentReason) error {
+	switch reasonCode {
+	case types.AdjustmentDamaged, types.AdjustmentLost, types.AdjustmentTheft, types.AdjustmentExpired:
+		if quantity > 0 {
+			return fmt.Errorf("reason code %s requires a negative quantity", reasonCode)
+		}
+	case types.AdjustmentFound:
+		if quantity < 0 {
+			return fmt.Errorf("reason code %s requires a positive quantity", reasonCode)
+		}
+	}
+
+	return nil
+}
+
+// warehouseCandidate is a warehouse a reservation can take stock from
+type warehouseCandidate struct {
+	warehouse types.Warehouse
+	available int
+}
+
+// planAllocation decides which warehouses hold quantity units of a product.
+// Priority and nearest try to ship the whole quantity from one warehouse, in
+// their order, and only split it when no single warehouse has enough. Split
+// takes what it can from each warehouse in priority order. The candidates are
+// expected to hold at least quantity units in total.
+func planAllocation(strategy types.ReservationStrategy, candidates []warehouseCandidate, quantity int, destination *types.UserAddress) []types.StockAllocation {
+	ordered := make([]warehouseCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.available > 0 {
+			ordered = append(ordered, candidate)
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i].warehouse, ordered[j].warehouse
+		if strategy == types.ReserveNearest {
+			if da, db := distanceRank(a, destination), distanceRank(b, destination); da != db {
+				return da < db
+			}
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.ID < b.ID
+	})
+
+	if strategy != types.ReserveSplit {
+		for _, candidate := range ordered {
+			if candidate.available >= quantity {
+				return []types.StockAllocation{allocate(candidate.warehouse, quantity)}
+			}
+		}
+	}
+
+	var allocations []types.StockAllocation
+	remaining := quantity
+	for _, candidate := range ordered {
+		if remaining == 0 {
+			break
+		}
+		take := min(candidate.available, remaining)
+		allocations = append(allocations, allocate(candidate.warehouse, take))
+		remaining -= take
+	}
+
+	return allocations
+}
+
+// distanceRank approximates how far a warehouse is from the shipping address:
+// same state, then same country, then anywhere else
+func distanceRank(warehouse types.Warehouse, destination *types.UserAddress) int {
+	if destination == nil || !strings.EqualFold(strings.TrimSpace(warehouse.Country), strings.TrimSpace(destination.Country)) {
+		return 2
+	}
+	if warehouse.StateProvince != nil && strings.EqualFold(strings.TrimSpace(*warehouse.StateProvince), strings.TrimSpace(destination.StateProvince)) {
+		return 0
+	}
+	return 1
+}
+
+func allocate(warehouse types.Warehouse, quantity int) types.StockAllocation {
+	return types.StockAllocation{WarehouseID: warehouse.ID, WarehouseCode: warehouse.Code, Quantity: quantity}
+}
+
+// alertState places available stock against a reorder level: out of stock at
+// zero or below, low at or below the level, fine above it
+func alertState(available, reorderLevel int) types.StockAlertState {
+	switch {
+	case available <= 0:
+		return types.StockAlertOutOfStock
+	case available <= reorderLevel:
+		return types.StockAlertLowStock
+	default:
+		return types.StockAlertOK
+	}
+}
+
+// encodeMovementCursor makes the ID of the last movement on a page into an
+// opaque cursor for the next page
+func encodeMovementCursor(movementID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("movement:" + strconv.Itoa(movementID)))
+}
+
+func decodeMovementCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		if id, ok := strings.CutPrefix(string(raw), "movement:"); ok {
+			if movementID, err := strconv.Atoi(id); err == nil && movementID > 0 {
+				return movementID, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor")
+}
+
+// movementCSVHeader is the header row of a movement export
+var movementCSVHeader = []string{
+	"id", "created_at", "product_id", "warehouse_id", "lot_id", "movement_type", "quantity", "balance_after", "unit_cost",
+	"reason", "reason_code", "reference_type", "reference_id",
+}
+
+// movementCSVRecord formats a movement as a row of a CSV export
+func movementCSVRecord(movement types.InventoryMovement) []string {
+	optionalInt := func(v *int) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+
+	var unitCost, reasonCode, refType string
+	if movement.UnitCost != nil {
+		unitCost = movement.UnitCost.String()
+	}
+	if movement.ReasonCode != nil {
+		reasonCode = string(*movement.ReasonCode)
+	}
+	if movement.ReferenceType != nil {
+		refType = string(*movement.ReferenceType)
+	}
+
+	return []string{
+		strconv.Itoa(movement.ID),
+		movement.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.Itoa(movement.ProductID),
+		strconv.Itoa(movement.WarehouseID),
+		optionalInt(movement.LotID),
+		string(movement.MovementType),
+		strconv.Itoa(movement.Quantity),
+		optionalInt(movement.BalanceAfter),
+		unitCost,
+		movement.Reason,
+		reasonCode,
+		refType,
+		optionalInt(movement.ReferenceID),
+	}
+}
+
+// costLayer is a FIFO layer of stock received at one unit cost
+type costLayer struct {
+	id        int
+	unitCost  types.Money
+	remaining int
+}
+
+// weightedAverage blends quantity units received at unitCost into the
+// average cost of the onHand units already valued
+func weightedAverage(average types.Money, onHand int, unitCost types.Money, quantity int) types.Money {
+	if onHand+quantity <= 0 {
+		return unitCost
+	}
+	total := average.Mul(onHand).Add(unitCost.Mul(quantity))
+	return total.MulDiv(1, int64(onHand+quantity))
+}
+
+// fifoUnitCost is the unit cost of quantity units taken from the layers
+// (oldest first) after the first skip units. Units the layers do not cover
+// are costed at the fallback.
+func fifoUnitCost(layers []costLayer, skip, quantity int, fallback types.Money) types.Money {
+	if quantity <= 0 {
+		return fallback
+	}
+
+	total := types.NewMoney(0, fallback.Currency)
+	needed := quantity
+	for _, layer := range layers {
+		if needed == 0 {
+			break
+		}
+		available := layer.remaining
+		if skip > 0 {
+			skipped := min(skip, available)
+			skip -= skipped
+			available -= skipped
+		}
+		take := min(available, needed)
+		total = total.Add(layer.unitCost.Mul(take))
+		needed -= take
+	}
+	total = total.Add(fallback.Mul(needed))
+
+	return total.MulDiv(1, int64(quantity))
+}
+
+// stockValue values onHand units of a product. Under FIFO these are the units
+// of the open layers, any units not in a layer are valued at the average cost.
+func stockValue(method types.ValuationMethod, onHand int, average types.Money, layered int, layeredValue types.Money) types.Money {
+	if method == types.ValuationAverage {
+		return average.Mul(onHand)
+	}
+	return layeredValue.Add(average.Mul(max(onHand-layered, 0)))
+}
+
+// toBaseCurrency converts an order amount back to the base currency at the
+// exchange rate locked on the order
+func toBaseCurrency(amount types.Money, exchangeRate types.Rate) types.Money {
+	if exchangeRate > 0 {
+		amount = amount.DivRate(exchangeRate)
+	}
+	amount.Currency = types.DefaultCurrency
+	return amount
+}
+
+// grossMargin is revenue less cost, in money and as a percentage of revenue
+func grossMargin(revenue, cost types.Money) (types.Money, float64) {
+	margin := revenue.Sub(cost)
+	if revenue.IsZero() {
+		return margin, 0
+	}
+	percent := float64(margin.Amount) * 100 / float64(revenue.Amount)
+	return margin, math.Round(percent*100) / 100
+}
+
+// lotStock is what can be taken from a lot
+type lotStock struct {
+	id        int
+	lotNumber string
+	expiresAt *time.Time
+	available int
+}
+
+// lotPick is the part of a quantity taken from one lot, or from stock
+// without a lot when lot is nil
+type lotPick struct {
+	lot      *lotStock
+	quantity int
+}
+
+// planLots takes quantity units from the lots in the order given; whatever
+// they do not cover comes from stock without a lot
+func planLots(lots []lotStock, quantity int) []lotPick {
+	var picks []lotPick
+	for i := range lots {
+		if quantity == 0 {
+			break
+		}
+		take := min(lots[i].available, quantity)
+		if take <= 0 {
+			continue
+		}
+		picks = append(picks, lotPick{lot: &lots[i], quantity: take})
+		quantity -= take
+	}
+	if quantity > 0 {
+		picks = append(picks, lotPick{quantity: quantity})
+	}
+	return picks
+}
+
+// lotFromPayload reads the optional lot of a stock receipt. An expiry date
+// without a lot number is rejected: expiry is tracked per lot.
+func lotFromPayload(lotNumber, expiresAt string) (*types.LotInfo, error) {
+	lotNumber = strings.TrimSpace(lotNumber)
+	if lotNumber == "" {
+		if expiresAt != "" {
+			return nil, fmt.Errorf("expiresAt requires a lotNumber")
+		}
+		return nil, nil
+	}
+
+	lot := &types.LotInfo{LotNumber: lotNumber}
+	if expiresAt != "" {
+		date, err := time.Parse("2006-01-02", expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresAt format. Use YYYY-MM-DD")
+		}
+		lot.ExpiresAt = &date
+	}
+
+	return lot, nil
+}
+
+// fillBackorders hands covered units to the backorders in the order given, each
+// taking what it still misses, and returns the units given to each
+func fillBackorders(remaining []int, covered int) []int {
+	filled := make([]int, len(remaining))
+	for i, missing := range remaining {
+		if covered <= 0 {
+			break
+		}
+		filled[i] = min(missing, covered)
+		covered -= filled[i]
+	}
+	return filled
+}
+
+// stockPolicyFromPayload checks a stock policy against what its type needs:
+// backorders need a limit, pre-orders a release date still ahead of now.
+// Settings the policy does not use are dropped.
+func stockPolicyFromPayload(productID int, payload types.SetStockPolicyPayload, now time.Time) (types.StockPolicy, error) {
+	policy := types.StockPolicy{ProductID: productID, Policy: payload.Policy}
+
+	switch payload.Policy {
+	case types.StockPolicyBackorder:
+		if payload.Limit == nil {
+			return policy, fmt.Errorf("backorder policy requires a limit")
+		}
+		policy.Limit = payload.Limit
+	case types.StockPolicyPreorder:
+		if payload.ReleaseDate == "" {
+			return policy, fmt.Errorf("preorder policy requires a releaseDate")
+		}
+		releaseDate, err := time.Parse("2006-01-02", payload.ReleaseDate)
+		if err != nil {
+			return policy, fmt.Errorf("invalid releaseDate format. Use YYYY-MM-DD")
+		}
+		if !now.Before(releaseDate) {
+			return policy, fmt.Errorf("releaseDate must be in the future")
+		}
+		policy.Limit = payload.Limit
+		policy.ReleaseDate = &releaseDate
+	}
+
+	return policy, nil
+}
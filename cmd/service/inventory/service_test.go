@@ -0,0 +1,313 @@
+package inventory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestCheckAdjustmentReason(t *testing.T) {
+	tests := []struct {
+		quantity   int
+		reasonCode types.AdjustmentReason
+		valid      bool
+	}{
+		{-2, types.AdjustmentDamaged, true},
+		{3, types.AdjustmentDamaged, false},
+		{-1, types.AdjustmentTheft, true},
+		{1, types.AdjustmentFound, true},
+		{-1, types.AdjustmentFound, false},
+		{-5, types.AdjustmentCountCorrection, true},
+		{5, types.AdjustmentCountCorrection, true},
+		{4, types.AdjustmentOther, true},
+	}
+
+	for _, tt := range tests {
+		err := checkAdjustmentReason(tt.quantity, tt.reasonCode)
+		if (err == nil) != tt.valid {
+			t.Errorf("checkAdjustmentReason(%d, %s) = %v, expected valid %v", tt.quantity, tt.reasonCode, err, tt.valid)
+		}
+	}
+}
+
+func TestAdjustmentMovement(t *testing.T) {
+	movement := adjustmentMovement(1, 1, -3, types.AdjustmentDamaged, "", nil)
+	if movement.MovementType != types.MovementTypeOut || movement.Quantity != 3 {
+		t.Errorf("Expected a write-off of 3 to go out, got %s %d", movement.MovementType, movement.Quantity)
+	}
+	if movement.Reason != "DAMAGED" || *movement.ReasonCode != types.AdjustmentDamaged {
+		t.Errorf("Expected the reason code to name the movement, got %q", movement.Reason)
+	}
+	if *movement.ReferenceType != types.RefTypeAdjustment {
+		t.Errorf("Expected an adjustment reference, got %s", *movement.ReferenceType)
+	}
+
+	movement = adjustmentMovement(1, 1, 2, types.AdjustmentFound, "Found behind shelf", nil)
+	if movement.MovementType != types.MovementTypeIn || movement.Quantity != 2 || movement.Reason != "Found behind shelf" {
+		t.Errorf("Expected 2 found units to come in with the note, got %+v", movement)
+	}
+}
+
+func TestPlanAllocation(t *testing.T) {
+	texas := "TX"
+	candidates := []warehouseCandidate{
+		{warehouse: types.Warehouse{ID: 1, Code: "MAIN", Country: "US", Priority: 0}, available: 4},
+		{warehouse: types.Warehouse{ID: 2, Code: "TX", Country: "US", StateProvince: &texas, Priority: 10}, available: 10},
+		{warehouse: types.Warehouse{ID: 3, Code: "EU", Country: "DE", Priority: 5}, available: 0},
+	}
+	destination := &types.UserAddress{Country: "US", StateProvince: "tx"}
+
+	tests := []struct {
+		name     string
+		strategy types.ReservationStrategy
+		quantity int
+		expected []types.StockAllocation
+	}{
+		{"priority fits in the first warehouse", types.ReservePriority, 3,
+			[]types.StockAllocation{{WarehouseID: 1, WarehouseCode: "MAIN", Quantity: 3}}},
+		{"priority skips a warehouse that is too small", types.ReservePriority, 6,
+			[]types.StockAllocation{{WarehouseID: 2, WarehouseCode: "TX", Quantity: 6}}},
+		{"priority splits when no warehouse has enough", types.ReservePriority, 12,
+			[]types.StockAllocation{{WarehouseID: 1, WarehouseCode: "MAIN", Quantity: 4}, {WarehouseID: 2, WarehouseCode: "TX", Quantity: 8}}},
+		{"nearest prefers the same state", types.ReserveNearest, 3,
+			[]types.StockAllocation{{WarehouseID: 2, WarehouseCode: "TX", Quantity: 3}}},
+		{"split drains warehouses in priority order", types.ReserveSplit, 6,
+			[]types.StockAllocation{{WarehouseID: 1, WarehouseCode: "MAIN", Quantity: 4}, {WarehouseID: 2, WarehouseCode: "TX", Quantity: 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocations := planAllocation(tt.strategy, candidates, tt.quantity, destination)
+			if !reflect.DeepEqual(allocations, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, allocations)
+			}
+		})
+	}
+}
+
+func TestAlertState(t *testing.T) {
+	tests := []struct {
+		available    int
+		reorderLevel int
+		expected     types.StockAlertState
+	}{
+		{10, 5, types.StockAlertOK},
+		{5, 5, types.StockAlertLowStock},
+		{1, 5, types.StockAlertLowStock},
+		{0, 5, types.StockAlertOutOfStock},
+		{-1, 0, types.StockAlertOutOfStock},
+		{1, 0, types.StockAlertOK},
+	}
+
+	for _, tt := range tests {
+		if state := alertState(tt.available, tt.reorderLevel); state != tt.expected {
+			t.Errorf("alertState(%d, %d) = %s, expected %s", tt.available, tt.reorderLevel, state, tt.expected)
+		}
+	}
+}
+
+func TestMovementCursor(t *testing.T) {
+	cursor := encodeMovementCursor(1234)
+	movementID, err := decodeMovementCursor(cursor)
+	if err != nil || movementID != 1234 {
+		t.Errorf("Expected cursor %q to decode to 1234, got %d (%v)", cursor, movementID, err)
+	}
+
+	for _, cursor := range []string{"", "1234", "!!!", encodeMovementCursor(0)} {
+		if _, err := decodeMovementCursor(cursor); err == nil {
+			t.Errorf("Expected cursor %q to be rejected", cursor)
+		}
+	}
+}
+
+func TestBuildMovementQuery(t *testing.T) {
+	productID, beforeID := 7, 100
+	movementType := types.MovementTypeOut
+	query, args := buildMovementQuery(types.MovementFilter{
+		ProductID:    &productID,
+		MovementType: &movementType,
+		BeforeID:     &beforeID,
+		Limit:        51,
+	})
+
+	if !strings.Contains(query, "WHERE product_id = ? AND movement_type = ? AND id < ?") {
+		t.Errorf("Expected the filters in the WHERE clause, got %s", query)
+	}
+	if !strings.HasSuffix(query, "ORDER BY id DESC LIMIT ?") {
+		t.Errorf("Expected newest first with a limit, got %s", query)
+	}
+	if !reflect.DeepEqual(args, []any{7, types.MovementTypeOut, 100, 51}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	query, args = buildMovementQuery(types.MovementFilter{})
+	if strings.Contains(query, "WHERE") || strings.Contains(query, "LIMIT") || len(args) != 0 {
+		t.Errorf("Expected an export query without filters or limit, got %s %v", query, args)
+	}
+}
+
+func TestWeightedAverage(t *testing.T) {
+	usd := func(s string) types.Money { return types.MustParseMoney(s, types.DefaultCurrency) }
+
+	tests := []struct {
+		average  types.Money
+		onHand   int
+		unitCost types.Money
+		quantity int
+		expected string
+	}{
+		{usd("0"), 0, usd("2.00"), 10, "2.00"},
+		{usd("2.00"), 10, usd("4.00"), 10, "3.00"},
+		{usd("2.00"), 2, usd("1.00"), 1, "1.67"},
+		{usd("5.00"), 0, usd("1.50"), 4, "1.50"},
+	}
+
+	for _, tt := range tests {
+		if average := weightedAverage(tt.average, tt.onHand, tt.unitCost, tt.quantity); average.String() != tt.expected {
+			t.Errorf("weightedAverage(%s, %d, %s, %d) = %s, expected %s", tt.average, tt.onHand, tt.unitCost, tt.quantity, average, tt.expected)
+		}
+	}
+}
+
+func TestFIFOUnitCost(t *testing.T) {
+	usd := func(s string) types.Money { return types.MustParseMoney(s, types.DefaultCurrency) }
+	layers := []costLayer{
+		{id: 1, unitCost: usd("2.00"), remaining: 10},
+		{id: 2, unitCost: usd("4.00"), remaining: 10},
+	}
+
+	tests := []struct {
+		skip, quantity int
+		expected       string
+	}{
+		{0, 5, "2.00"},
+		{0, 12, "2.33"}, // 10 at 2.00 and 2 at 4.00
+		{8, 4, "3.00"},  // units held by other orders come out of the first layer
+		{18, 4, "3.00"}, // 2 at 4.00 and 2 not covered by a layer, at the 2.00 fallback
+		{25, 1, "2.00"},
+	}
+
+	for _, tt := range tests {
+		if cost := fifoUnitCost(layers, tt.skip, tt.quantity, usd("2.00")); cost.String() != tt.expected {
+			t.Errorf("fifoUnitCost(skip %d, quantity %d) = %s, expected %s", tt.skip, tt.quantity, cost, tt.expected)
+		}
+	}
+}
+
+func TestStockValue(t *testing.T) {
+	usd := func(s string) types.Money { return types.MustParseMoney(s, types.DefaultCurrency) }
+
+	if value := stockValue(types.ValuationFIFO, 8, usd("3.00"), 8, usd("32.00")); value.String() != "32.00" {
+		t.Errorf("Expected FIFO to value the open layers at 32.00, got %s", value)
+	}
+	if value := stockValue(types.ValuationAverage, 8, usd("3.00"), 8, usd("32.00")); value.String() != "24.00" {
+		t.Errorf("Expected the average method to value 8 units at 24.00, got %s", value)
+	}
+	if value := stockValue(types.ValuationFIFO, 10, usd("3.00"), 8, usd("32.00")); value.String() != "38.00" {
+		t.Errorf("Expected units outside the layers to be valued at the average, got %s", value)
+	}
+}
+
+func TestGrossMargin(t *testing.T) {
+	revenue := toBaseCurrency(types.MustParseMoney("92.00", "EUR"), types.MustParseRate("0.92"))
+	if revenue.String() != "100.00" || revenue.Currency != types.DefaultCurrency {
+		t.Errorf("Expected 92.00 EUR at 0.92 to be 100.00 %s, got %s %s", types.DefaultCurrency, revenue, revenue.Currency)
+	}
+
+	margin, percent := grossMargin(revenue, types.MustParseMoney("60.00", types.DefaultCurrency))
+	if margin.String() != "40.00" || percent != 40 {
+		t.Errorf("Expected a margin of 40.00 (40%%), got %s (%v%%)", margin, percent)
+	}
+
+	_, percent = grossMargin(types.NewMoney(0, types.DefaultCurrency), types.NewMoney(0, types.DefaultCurrency))
+	if percent != 0 {
+		t.Errorf("Expected no margin percent without revenue, got %v", percent)
+	}
+}
+
+func TestPlanLots(t *testing.T) {
+	lots := []lotStock{
+		{id: 1, lotNumber: "A", available: 3},
+		{id: 2, lotNumber: "B", available: 0},
+		{id: 3, lotNumber: "C", available: 5},
+	}
+
+	picks := planLots(lots, 6)
+	if len(picks) != 2 || picks[0].lot.id != 1 || picks[0].quantity != 3 || picks[1].lot.id != 3 || picks[1].quantity != 3 {
+		t.Errorf("Expected 3 from lot A and 3 from lot C, got %+v", picks)
+	}
+
+	picks = planLots(lots, 10)
+	if len(picks) != 3 || picks[2].lot != nil || picks[2].quantity != 2 {
+		t.Errorf("Expected the 2 units the lots do not cover to come from stock without a lot, got %+v", picks)
+	}
+
+	picks = planLots(nil, 4)
+	if len(picks) != 1 || picks[0].lot != nil || picks[0].quantity != 4 {
+		t.Errorf("Expected stock without lots to be taken as is, got %+v", picks)
+	}
+}
+
+func TestLotFromPayload(t *testing.T) {
+	lot, err := lotFromPayload(" L-42 ", "2026-12-31")
+	if err != nil || lot.LotNumber != "L-42" || lot.ExpiresAt.Format("2006-01-02") != "2026-12-31" {
+		t.Errorf("Expected lot L-42 expiring on 2026-12-31, got %+v (%v)", lot, err)
+	}
+
+	if lot, err := lotFromPayload("", ""); lot != nil || err != nil {
+		t.Errorf("Expected no lot, got %+v (%v)", lot, err)
+	}
+	if _, err := lotFromPayload("", "2026-12-31"); err == nil {
+		t.Error("Expected an expiry date without a lot number to be rejected")
+	}
+	if _, err := lotFromPayload("L-42", "31.12.2026"); err == nil {
+		t.Error("Expected an invalid expiry date to be rejected")
+	}
+}
+
+func TestFillBackorders(t *testing.T) {
+	filled := fillBackorders([]int{2, 3, 1}, 4)
+	if filled[0] != 2 || filled[1] != 2 || filled[2] != 0 {
+		t.Errorf("Expected the oldest backorders to be filled first, got %v", filled)
+	}
+
+	filled = fillBackorders([]int{2, 3}, -1)
+	if filled[0] != 0 || filled[1] != 0 {
+		t.Errorf("Expected nothing to be filled while the ledger still owes units, got %v", filled)
+	}
+}
+
+func TestStockPolicyFromPayload(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	limit := 5
+
+	policy, err := stockPolicyFromPayload(1, types.SetStockPolicyPayload{Policy: types.StockPolicyBackorder, Limit: &limit, ReleaseDate: "2026-12-01"}, now)
+	if err != nil || *policy.Limit != 5 || policy.ReleaseDate != nil {
+		t.Errorf("Expected a backorder limit of 5 without a release date, got %+v (%v)", policy, err)
+	}
+
+	policy, err = stockPolicyFromPayload(1, types.SetStockPolicyPayload{Policy: types.StockPolicyPreorder, ReleaseDate: "2026-12-01"}, now)
+	if err != nil || policy.Limit != nil || policy.ReleaseDate.Format("2006-01-02") != "2026-12-01" {
+		t.Errorf("Expected unlimited pre-orders until 2026-12-01, got %+v (%v)", policy, err)
+	}
+
+	policy, err = stockPolicyFromPayload(1, types.SetStockPolicyPayload{Policy: types.StockPolicyDeny, Limit: &limit}, now)
+	if err != nil || policy.Limit != nil {
+		t.Errorf("Expected deny to drop the limit, got %+v (%v)", policy, err)
+	}
+
+	invalid := []types.SetStockPolicyPayload{
+		{Policy: types.StockPolicyBackorder},
+		{Policy: types.StockPolicyPreorder},
+		{Policy: types.StockPolicyPreorder, ReleaseDate: "01.12.2026"},
+		{Policy: types.StockPolicyPreorder, ReleaseDate: "2026-10-01"},
+	}
+	for _, payload := range invalid {
+		if _, err := stockPolicyFromPayload(1, payload, now); err == nil {
+			t.Errorf("Expected %+v to be rejected", payload)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package inventory
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// CreateStockTake открывает сессию инвентаризации склада (nil — склад по умолчанию)
+func (s *Store) CreateStockTake(warehouseID *int, note string, createdBy int) (int, error) {
+	warehouse, err := resolveWarehouse(s.db, warehouseID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.Exec(
+		"INSERT INTO stock_takes (warehouse_id, status, note, created_by) VALUES (?, 'OPEN', ?, ?)",
+		warehouse, note, createdBy,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create stock take: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stock take ID: %w", err)
+	}
+
+	return int(id), nil
+}
+
+// GetStockTakes возвращает инвентаризации без строк, при необходимости по статусу
+func (s *Store) GetStockTakes(status *types.StockTakeStatus) ([]types.StockTake, error) {
+	query := "SELECT id, warehouse_id, status, note, created_by, created_at, posted_at FROM stock_takes"
+	args := []any{}
+	if status != nil {
+		query += " WHERE status = ?"
+		args = append(args, *status)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock takes: %w", err)
+	}
+	defer rows.Close()
+
+	stockTakes := []types.StockTake{}
+	for rows.Next() {
+		stockTake, err := scanRowIntoStockTake(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stock take: %w", err)
+		}
+		stockTakes = append(stockTakes, *stockTake)
+	}
+
+	return stockTakes, rows.Err()
+}
+
+// GetStockTake возвращает инвентаризацию со строками и расхождениями. Пока она
+// открыта, ожидаемое количество — текущий остаток на складе; при проведении
+// оно фиксируется.
+func (s *Store) GetStockTake(stockTakeID int) (*types.StockTake, error) {
+	row := s.db.QueryRow("SELECT id, warehouse_id, status, note, created_by, created_at, posted_at FROM stock_takes WHERE id = ?", stockTakeID)
+	stockTake, err := scanRowIntoStockTake(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("stock take not found")
+		}
+		return nil, fmt.Errorf("failed to get stock take: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT l.product_id, l.counted_quantity, COALESCE(l.expected_quantity, sl.on_hand, 0)
+		FROM stock_take_lines l
+		LEFT JOIN stock_levels sl ON sl.product_id = l.product_id AND sl.warehouse_id = ?
+		WHERE l.stock_take_id = ?
+		ORDER BY l.product_id
+	`, stockTake.WarehouseID, stockTakeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock take lines: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line types.StockTakeLine
+		if err := rows.Scan(&line.ProductID, &line.CountedQuantity, &line.ExpectedQuantity); err != nil {
+			return nil, fmt.Errorf("failed to scan stock take line: %w", err)
+		}
+		line.Variance = line.CountedQuantity - line.ExpectedQuantity
+		stockTake.Lines = append(stockTake.Lines, line)
+	}
+
+	return stockTake, rows.Err()
+}
+
+// SetStockCounts записывает посчитанные количества; повторный подсчёт товара
+// заменяет предыдущий
+func (s *Store) SetStockCounts(stockTakeID int, counts []types.StockCountPayload) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockOpenStockTake(tx, stockTakeID); err != nil {
+		return err
+	}
+
+	if err := checkProductsExist(tx, counts); err != nil {
+		return err
+	}
+
+	for _, count := range counts {
+		_, err := tx.Exec(`
+			INSERT INTO stock_take_lines (stock_take_id, product_id, counted_quantity)
+			VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE counted_quantity = VALUES(counted_quantity)
+		`, stockTakeID, count.ProductID, count.CountedQuantity)
+		if err != nil {
+			return fmt.Errorf("failed to save count for product %d: %w", count.ProductID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PostStockTake атомарно проводит инвентаризацию: для каждого посчитанного товара
+// фиксирует ожидаемый остаток и создаёт корректировку на величину расхождения.
+// Остатки блокируются в порядке ID товаров, как и в остальных операциях.
+// Излишки после проведения покрывают бэкордеры.
+func (s *Store) PostStockTake(stockTakeID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	warehouseID, err := lockOpenStockTake(tx, stockTakeID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT product_id, counted_quantity
+		FROM stock_take_lines
+		WHERE stock_take_id = ?
+		ORDER BY product_id
+	`, stockTakeID)
+	if err != nil {
+		return fmt.Errorf("failed to get stock take lines: %w", err)
+	}
+
+	var lines []types.StockTakeLine
+	for rows.Next() {
+		var line types.StockTakeLine
+		if err := rows.Scan(&line.ProductID, &line.CountedQuantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stock take line: %w", err)
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+
+	if len(lines) == 0 {
+		return fmt.Errorf("stock take %d has no counts", stockTakeID)
+	}
+
+	note := fmt.Sprintf("Stock take #%d", stockTakeID)
+	var gained []int
+	for _, line := range lines {
+		onHand, err := lockStockLevel(tx, line.ProductID, warehouseID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			"UPDATE stock_take_lines SET expected_quantity = ? WHERE stock_take_id = ? AND product_id = ?",
+			onHand, stockTakeID, line.ProductID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save expected quantity: %w", err)
+		}
+
+		variance := line.CountedQuantity - onHand
+		if variance == 0 {
+			continue
+		}
+
+		movement := adjustmentMovement(line.ProductID, warehouseID, variance, types.AdjustmentCountCorrection, note, &stockTakeID)
+		if err := insertMovement(tx, movement); err != nil {
+			return fmt.Errorf("failed to adjust stock for product %d: %w", line.ProductID, err)
+		}
+		if variance > 0 {
+			gained = append(gained, line.ProductID)
+		}
+	}
+
+	_, err = tx.Exec("UPDATE stock_takes SET status = 'POSTED', posted_at = NOW() WHERE id = ?", stockTakeID)
+	if err != nil {
+		return fmt.Errorf("failed to post stock take: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, productID := range gained {
+		s.allocateBackorders(productID)
+	}
+	for _, line := range lines {
+		s.evaluateAlerts(line.ProductID)
+	}
+	return nil
+}
+
+// CancelStockTake закрывает открытую инвентаризацию без корректировок
+func (s *Store) CancelStockTake(stockTakeID int) error {
+	result, err := s.db.Exec("UPDATE stock_takes SET status = 'CANCELLED' WHERE id = ? AND status = 'OPEN'", stockTakeID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel stock take: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("stock take not found or not in status %s", types.StockTakeOpen)
+	}
+
+	return nil
+}
+
+// lockOpenStockTake блокирует инвентаризацию до конца транзакции, если она открыта,
+// и возвращает её склад
+func lockOpenStockTake(tx *sql.Tx, stockTakeID int) (int, error) {
+	var warehouseID int
+	var status types.StockTakeStatus
+	err := tx.QueryRow("SELECT warehouse_id, status FROM stock_takes WHERE id = ? FOR UPDATE", stockTakeID).Scan(&warehouseID, &status)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to lock stock take: %w", err)
+	}
+	if err == sql.ErrNoRows || status != types.StockTakeOpen {
+		return 0, fmt.Errorf("stock take not found or not in status %s", types.StockTakeOpen)
+	}
+
+	return warehouseID, nil
+}
+
+// checkProductsExist проверяет, что все посчитанные товары есть в каталоге
+func checkProductsExist(tx *sql.Tx, counts []types.StockCountPayload) error {
+	ids := make([]any, len(counts))
+	for i, count := range counts {
+		ids[i] = count.ProductID
+	}
+
+	placeholders := strings.Repeat(",?", len(ids))[1:]
+	rows, err := tx.Query(fmt.Sprintf("SELECT id FROM products WHERE id IN (%s)", placeholders), ids...)
+	if err != nil {
+		return fmt.Errorf("failed to check products: %w", err)
+	}
+	defer rows.Close()
+
+	found := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan product: %w", err)
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, count := range counts {
+		if !found[count.ProductID] {
+			return fmt.Errorf("product %d not found", count.ProductID)
+		}
+	}
+
+	return nil
+}
+
+func scanRowIntoStockTake(scanner interface{ Scan(dest ...any) error }) (*types.StockTake, error) {
+	var stockTake types.StockTake
+	var postedAt sql.NullTime
+
+	err := scanner.Scan(
+		&stockTake.ID,
+		&stockTake.WarehouseID,
+		&stockTake.Status,
+		&stockTake.Note,
+		&stockTake.CreatedBy,
+		&stockTake.CreatedAt,
+		&postedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if postedAt.Valid {
+		stockTake.PostedAt = &postedAt.Time
+	}
+	stockTake.Lines = []types.StockTakeLine{}
+
+	return &stockTake, nil
+}
@@ -3,82 +3,221 @@ package inventory
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 )
 
+// DefaultHoldTTL время жизни холда, если не задано иное
+const DefaultHoldTTL = 15 * time.Minute
+
+// stockByWarehouseQuery читает остатки товара по складам из материализованных
+// балансов, удержанное активными неистёкшими холдами и лежащее в просроченных
+// партиях. Журнал движений остаётся источником истины, баланс обновляется в той
+// же транзакции, что и каждое движение (см. insertMovement).
+const stockByWarehouseQuery = `
+	SELECT w.id, w.code, COALESCE(sl.on_hand, 0), COALESCE(h.held, 0), COALESCE(e.expired, 0)
+	FROM warehouses w
+	LEFT JOIN stock_levels sl ON sl.warehouse_id = w.id AND sl.product_id = ?
+	LEFT JOIN (
+		SELECT warehouse_id, SUM(quantity) AS held
+		FROM stock_holds
+		WHERE product_id = ? AND status = 'ACTIVE' AND expires_at > NOW()
+		GROUP BY warehouse_id
+	) h ON h.warehouse_id = w.id
+	LEFT JOIN (
+		SELECT warehouse_id, SUM(quantity_on_hand) AS expired
+		FROM stock_lots
+		WHERE product_id = ? AND quantity_on_hand > 0 AND expires_at < CURDATE()
+		GROUP BY warehouse_id
+	) e ON e.warehouse_id = w.id
+	ORDER BY w.priority, w.id
+`
+
+// ledgerQuery считает остаток товара на складе по всему журналу движений
+const ledgerQuery = `
+	SELECT COALESCE(SUM(
+		CASE WHEN movement_type = 'IN' THEN quantity
+		     ELSE -quantity
+		END
+	), 0)
+	FROM inventory_movements
+	WHERE product_id = ? AND warehouse_id = ?
+`
+
 type Store struct {
-	db *sql.DB
+	db        *sql.DB
+	holdTTL   time.Duration
+	strategy  types.ReservationStrategy
+	valuation types.ValuationMethod
+	notifier  types.Notifier
 }
 
 func NewStore(db *sql.DB) *Store {
-	return &Store{db: db}
+	return &Store{db: db, holdTTL: DefaultHoldTTL, strategy: types.ReservePriority, valuation: types.ValuationFIFO}
+}
+
+// SetHoldTTL задаёт время жизни новых холдов
+func (s *Store) SetHoldTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.holdTTL = ttl
+	}
 }
 
-// GetCurrentStock вычисляет текущий остаток товара на основе всех движений
+// SetReservationStrategy задаёт, с каких складов резервируется товар при оформлении заказа
+func (s *Store) SetReservationStrategy(strategy types.ReservationStrategy) error {
+	switch strategy {
+	case types.ReservePriority, types.ReserveNearest, types.ReserveSplit:
+		s.strategy = strategy
+		return nil
+	default:
+		return fmt.Errorf("unknown reservation strategy %q, must be one of: priority, nearest, split", strategy)
+	}
+}
+
+// GetCurrentStock вычисляет доступный остаток товара: все движения минус активные холды
 func (s *Store) GetCurrentStock(productID int) (int, error) {
-	query := `
-		SELECT COALESCE(SUM(
-			CASE WHEN movement_type = 'IN' THEN quantity 
-			     ELSE -quantity 
-			END
-		), 0) as current_stock
-		FROM inventory_movements 
-		WHERE product_id = ?
-	`
-	
-	var stock int
-	err := s.db.QueryRow(query, productID).Scan(&stock)
+	level, err := s.GetStockLevel(productID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get current stock for product %d: %w", productID, err)
+		return 0, err
 	}
-	
-	return stock, nil
+
+	return level.Available, nil
 }
 
-// GetProductsWithStock получает остатки для нескольких товаров одним запросом
+// GetStockLevel возвращает остаток на складе, удержанное и просроченное количество
+// и доступный остаток товара, всего и по каждому складу
+func (s *Store) GetStockLevel(productID int) (*types.StockLevel, error) {
+	rows, err := s.db.Query(stockByWarehouseQuery, productID, productID, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current stock for product %d: %w", productID, err)
+	}
+	defer rows.Close()
+
+	level := types.StockLevel{ProductID: productID, Warehouses: []types.WarehouseStock{}}
+	for rows.Next() {
+		stock := types.WarehouseStock{ProductID: productID}
+		if err := rows.Scan(&stock.WarehouseID, &stock.WarehouseCode, &stock.OnHand, &stock.Held, &stock.Expired); err != nil {
+			return nil, fmt.Errorf("failed to scan stock level: %w", err)
+		}
+		stock.Available = stock.OnHand - stock.Held - stock.Expired
+
+		level.OnHand += stock.OnHand
+		level.Held += stock.Held
+		level.Expired += stock.Expired
+		level.Warehouses = append(level.Warehouses, stock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	level.Available = level.OnHand - level.Held - level.Expired
+	return &level, nil
+}
+
+// GetWarehouseStock возвращает остатки всех товаров на складе
+func (s *Store) GetWarehouseStock(warehouseID int) ([]types.WarehouseStock, error) {
+	if _, err := resolveWarehouse(s.db, &warehouseID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT sl.product_id, w.code, sl.on_hand, COALESCE(h.held, 0), COALESCE(e.expired, 0)
+		FROM stock_levels sl
+		JOIN warehouses w ON w.id = sl.warehouse_id
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity) AS held
+			FROM stock_holds
+			WHERE warehouse_id = ? AND status = 'ACTIVE' AND expires_at > NOW()
+			GROUP BY product_id
+		) h ON h.product_id = sl.product_id
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity_on_hand) AS expired
+			FROM stock_lots
+			WHERE warehouse_id = ? AND quantity_on_hand > 0 AND expires_at < CURDATE()
+			GROUP BY product_id
+		) e ON e.product_id = sl.product_id
+		WHERE sl.warehouse_id = ?
+		ORDER BY sl.product_id
+	`, warehouseID, warehouseID, warehouseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warehouse stock: %w", err)
+	}
+	defer rows.Close()
+
+	stock := []types.WarehouseStock{}
+	for rows.Next() {
+		item := types.WarehouseStock{WarehouseID: warehouseID}
+		if err := rows.Scan(&item.ProductID, &item.WarehouseCode, &item.OnHand, &item.Held, &item.Expired); err != nil {
+			return nil, fmt.Errorf("failed to scan warehouse stock: %w", err)
+		}
+		item.Available = item.OnHand - item.Held - item.Expired
+		stock = append(stock, item)
+	}
+
+	return stock, rows.Err()
+}
+
+// GetProductsWithStock получает доступные остатки для нескольких товаров одним запросом
 func (s *Store) GetProductsWithStock(productIDs []int) (map[int]int, error) {
 	if len(productIDs) == 0 {
 		return make(map[int]int), nil
 	}
-	
+
 	// Создаём плейсхолдеры для IN clause
-	placeholders := ""
-	args := make([]any, len(productIDs))
+	placeholders := strings.Repeat(",?", len(productIDs))[1:]
+	ids := make([]any, len(productIDs))
 	for i, id := range productIDs {
-		if i > 0 {
-			placeholders += ","
-		}
-		placeholders += "?"
-		args[i] = id
+		ids[i] = id
 	}
-	
+
 	query := fmt.Sprintf(`
-		SELECT 
-			product_id,
-			COALESCE(SUM(
-				CASE WHEN movement_type = 'IN' THEN quantity 
-				     ELSE -quantity 
-				END
-			), 0) as current_stock
-		FROM inventory_movements 
-		WHERE product_id IN (%s)
-		GROUP BY product_id
+		SELECT
+			p.id,
+			COALESCE(sl.on_hand, 0) - COALESCE(h.held, 0) - COALESCE(e.expired, 0) AS available
+		FROM products p
+		LEFT JOIN (
+			SELECT product_id, SUM(on_hand) AS on_hand
+			FROM stock_levels
+			WHERE product_id IN (%[1]s)
+			GROUP BY product_id
+		) sl ON sl.product_id = p.id
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity) AS held
+			FROM stock_holds
+			WHERE product_id IN (%[1]s) AND status = 'ACTIVE' AND expires_at > NOW()
+			GROUP BY product_id
+		) h ON h.product_id = p.id
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity_on_hand) AS expired
+			FROM stock_lots
+			WHERE product_id IN (%[1]s) AND quantity_on_hand > 0 AND expires_at < CURDATE()
+			GROUP BY product_id
+		) e ON e.product_id = p.id
+		WHERE p.id IN (%[1]s)
 	`, placeholders)
-	
+
+	args := make([]any, 0, len(ids)*4)
+	args = append(args, ids...)
+	args = append(args, ids...)
+	args = append(args, ids...)
+	args = append(args, ids...)
+
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get stock for products: %w", err)
 	}
 	defer rows.Close()
-	
+
 	stockMap := make(map[int]int)
-	
+
 	// Инициализируем все продукты нулевым остатком
 	for _, id := range productIDs {
 		stockMap[id] = 0
 	}
-	
+
 	// Обновляем фактическими остатками
 	for rows.Next() {
 		var productID, stock int
@@ -87,133 +226,1112 @@ func (s *Store) GetProductsWithStock(productIDs []int) (map[int]int, error) {
 		}
 		stockMap[productID] = stock
 	}
-	
+
 	return stockMap, nil
 }
 
-// ReserveStock резервирует товар для заказа (атомарная операция)
-func (s *Store) ReserveStock(productID, quantity int, orderID int) error {
+// ReserveStock удерживает товар для заказа на время holdTTL (атомарная операция).
+// Это ReserveStockLines для одной строки.
+func (s *Store) ReserveStock(productID, quantity int, orderID int, destination *types.UserAddress) error {
+	return s.ReserveStockLines(orderID, []types.CartItem{{ProductID: productID, Quantity: quantity}}, destination)
+}
+
+// ReserveStockLines удерживает товар по всем строкам заказа одной транзакцией:
+// либо резервируется всё, либо ничего (например, все компоненты комплекта).
+// Строки одного товара складываются, товары резервируются в порядке ID — в том
+// же порядке CommitReservation блокирует их балансы, поэтому взаимоблокировок нет.
+func (s *Store) ReserveStockLines(orderID int, lines []types.CartItem, destination *types.UserAddress) error {
+	quantities := make(map[int]int)
+	var productIDs []int
+	for _, line := range lines {
+		if _, ok := quantities[line.ProductID]; !ok {
+			productIDs = append(productIDs, line.ProductID)
+		}
+		quantities[line.ProductID] += line.Quantity
+	}
+	sort.Ints(productIDs)
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
-	
-	// Получаем текущий остаток с блокировкой
-	var currentStock int
-	err = tx.QueryRow(`
-		SELECT COALESCE(SUM(
-			CASE WHEN movement_type = 'IN' THEN quantity 
-			     ELSE -quantity 
-			END
-		), 0)
-		FROM inventory_movements 
-		WHERE product_id = ?
-		FOR UPDATE
-	`, productID).Scan(&currentStock)
-	
+
+	for _, productID := range productIDs {
+		if err := s.reserveProduct(tx, productID, quantities[productID], orderID, destination); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, productID := range productIDs {
+		s.evaluateAlerts(productID)
+	}
+	return nil
+}
+
+// reserveProduct создаёт холды на quantity единиц товара в транзакции резервирования.
+// Склады выбираются по стратегии резервирования (см. planAllocation), на каждый
+// склад создаётся отдельный холд. Холд не списывает товар: списание происходит
+// в CommitReservation после оплаты, а неоплаченный холд освобождается или истекает.
+// Сверх доступного остатка товар резервируется, только если это разрешает его
+// политика: такой холд помечается backordered и ставится на склад по умолчанию.
+func (s *Store) reserveProduct(tx *sql.Tx, productID, quantity int, orderID int, destination *types.UserAddress) error {
+	policy, err := getStockPolicy(tx, productID)
+	if err != nil {
+		return err
+	}
+
+	// Бэкордеры ждут товар на складе по умолчанию: его баланс должен быть среди блокируемых
+	backorderWarehouse := 0
+	if policy.Policy != types.StockPolicyDeny {
+		if backorderWarehouse, err = resolveWarehouse(tx, nil); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT IGNORE INTO stock_levels (product_id, warehouse_id, on_hand) VALUES (?, ?, 0)", productID, backorderWarehouse)
+		if err != nil {
+			return fmt.Errorf("failed to create stock level: %w", err)
+		}
+	}
+
+	// Блокируем балансы товара на всех складах, чтобы резервирования одного товара шли по очереди
+	if err := lockProductLevels(tx, productID); err != nil {
+		return err
+	}
+
+	// Остатки и холды читаем уже после получения блокировки
+	rows, err := tx.Query(`
+		SELECT w.id, w.code, w.country, w.state_province, w.priority,
+		       COALESCE(sl.on_hand, 0) - COALESCE(h.held, 0) - COALESCE(e.expired, 0)
+		FROM warehouses w
+		LEFT JOIN stock_levels sl ON sl.warehouse_id = w.id AND sl.product_id = ?
+		LEFT JOIN (
+			SELECT warehouse_id, SUM(quantity) AS held
+			FROM stock_holds
+			WHERE product_id = ? AND status = 'ACTIVE' AND expires_at > NOW()
+			GROUP BY warehouse_id
+		) h ON h.warehouse_id = w.id
+		LEFT JOIN (
+			SELECT warehouse_id, SUM(quantity_on_hand) AS expired
+			FROM stock_lots
+			WHERE product_id = ? AND quantity_on_hand > 0 AND expires_at < CURDATE()
+			GROUP BY warehouse_id
+		) e ON e.warehouse_id = w.id
+	`, productID, productID, productID)
 	if err != nil {
 		return fmt.Errorf("failed to get current stock: %w", err)
 	}
-	
-	// Проверяем достаточность товара
-	if currentStock < quantity {
-		return fmt.Errorf("insufficient stock for product %d: available %d, requested %d", 
+
+	var candidates []warehouseCandidate
+	currentStock, backlog := 0, 0
+	for rows.Next() {
+		var candidate warehouseCandidate
+		var stateProvince sql.NullString
+		err := rows.Scan(&candidate.warehouse.ID, &candidate.warehouse.Code, &candidate.warehouse.Country,
+			&stateProvince, &candidate.warehouse.Priority, &candidate.available)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan warehouse stock: %w", err)
+		}
+		if stateProvince.Valid {
+			candidate.warehouse.StateProvince = &stateProvince.String
+		}
+		candidates = append(candidates, candidate)
+		currentStock += max(candidate.available, 0)
+		backlog += max(-candidate.available, 0)
+	}
+	rows.Close()
+
+	// Проверяем достаточность товара с учётом того, что уже заказано сверх остатка
+	if policy.Orderable(currentStock, backlog, time.Now()) < quantity {
+		return fmt.Errorf("insufficient stock for product %d: available %d, requested %d",
 			productID, currentStock, quantity)
 	}
-	
-	// Создаём запись о резервировании
-	_, err = tx.Exec(`
-		INSERT INTO inventory_movements 
-		(product_id, movement_type, quantity, reason, reference_id, reference_type)
-		VALUES (?, 'OUT', ?, 'Reserved for order', ?, 'ORDER')
-	`, productID, quantity, orderID)
-	
+	inStock := min(quantity, currentStock)
+
+	// Себестоимость фиксируем в момент резервирования, до создания новых холдов
+	unitCost, err := s.reservationUnitCost(tx, productID, quantity)
 	if err != nil {
-		return fmt.Errorf("failed to reserve stock: %w", err)
+		return err
 	}
-	
-	return tx.Commit()
+
+	// Создаём холды с ограниченным сроком жизни: на каждом складе партии
+	// выбираются по FEFO, на каждую партию отдельный холд
+	for _, allocation := range planAllocation(s.strategy, candidates, inStock, destination) {
+		picks, err := pickLots(tx, productID, allocation.WarehouseID, allocation.Quantity)
+		if err != nil {
+			return err
+		}
+
+		for _, pick := range picks {
+			var lotID *int
+			if pick.lot != nil {
+				lotID = &pick.lot.id
+			}
+			_, err = tx.Exec(`
+				INSERT INTO stock_holds (product_id, warehouse_id, lot_id, order_id, quantity, unit_cost, status, expires_at)
+				VALUES (?, ?, ?, ?, ?, ?, 'ACTIVE', DATE_ADD(NOW(), INTERVAL ? SECOND))
+			`, productID, allocation.WarehouseID, lotID, orderID, pick.quantity, unitCost, int64(s.holdTTL/time.Second))
+			if err != nil {
+				return fmt.Errorf("failed to reserve stock: %w", err)
+			}
+		}
+	}
+
+	if backordered := quantity - inStock; backordered > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO stock_holds (product_id, warehouse_id, order_id, quantity, backordered, unit_cost, status, expires_at)
+			VALUES (?, ?, ?, ?, TRUE, ?, 'ACTIVE', DATE_ADD(NOW(), INTERVAL ? SECOND))
+		`, productID, backorderWarehouse, orderID, backordered, unitCost, int64(s.holdTTL/time.Second))
+		if err != nil {
+			return fmt.Errorf("failed to reserve stock: %w", err)
+		}
+	}
+
+	return nil
 }
 
-// ReleaseStock освобождает зарезервированный товар
+// CommitReservation списывает товар по активным холдам заказа (после оплаты).
+// Истёкший холд уже не считается резервом, поэтому закоммитить его нельзя.
+func (s *Store) CommitReservation(orderID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Сначала блокируем балансы товаров заказа (в порядке ID), затем холды:
+	// ReserveStock берёт блокировки в том же порядке, поэтому взаимоблокировок нет
+	productIDs, err := holdProductIDs(tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, productID := range productIDs {
+		if err := lockProductLevels(tx, productID); err != nil {
+			return err
+		}
+	}
+
+	// Блокируем холды заказа: свипер и коммит не могут обработать их одновременно
+	rows, err := tx.Query(`
+		SELECT id, product_id, warehouse_id, lot_id, quantity, backordered, status, expires_at > NOW()
+		FROM stock_holds
+		WHERE order_id = ?
+		FOR UPDATE
+	`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get stock holds: %w", err)
+	}
+
+	type hold struct {
+		id, productID, warehouseID, quantity int
+		lotID                                *int
+		backordered                          bool
+		status                               types.StockHoldStatus
+		live                                 bool
+	}
+	var holds []hold
+	for rows.Next() {
+		var h hold
+		if err := rows.Scan(&h.id, &h.productID, &h.warehouseID, &h.lotID, &h.quantity, &h.backordered, &h.status, &h.live); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stock hold: %w", err)
+		}
+		holds = append(holds, h)
+	}
+	rows.Close()
+
+	if len(holds) == 0 {
+		return fmt.Errorf("no stock reservation for order %d", orderID)
+	}
+
+	backordered := false
+	for _, h := range holds {
+		switch {
+		case h.status == types.HoldStatusCommitted:
+			continue
+		case h.status != types.HoldStatusActive || !h.live:
+			return fmt.Errorf("stock reservation for order %d has expired", orderID)
+		}
+
+		// Товар сверх остатка списывается в минус и ждёт прихода как бэкордер
+		if h.backordered {
+			if err := createBackorder(tx, orderID, h.productID, h.warehouseID, h.quantity); err != nil {
+				return err
+			}
+			backordered = true
+		}
+
+		// Создаём запись о списании со склада и из партии холда
+		refType := types.RefTypeOrder
+		err = insertMovement(tx, types.InventoryMovement{
+			ProductID:     h.productID,
+			WarehouseID:   h.warehouseID,
+			LotID:         h.lotID,
+			MovementType:  types.MovementTypeOut,
+			Quantity:      h.quantity,
+			Reason:        "Reserved for order",
+			ReferenceID:   &orderID,
+			ReferenceType: &refType,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to commit stock: %w", err)
+		}
+
+		_, err = tx.Exec("UPDATE stock_holds SET status = 'COMMITTED' WHERE id = ?", h.id)
+		if err != nil {
+			return fmt.Errorf("failed to commit stock hold: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Товар мог прийти, пока заказ ждал оплаты
+	if backordered {
+		for _, productID := range productIDs {
+			s.allocateBackorders(productID)
+		}
+	}
+
+	return nil
+}
+
+// ReleaseReservation освобождает активные холды заказа (например, при отмене)
+func (s *Store) ReleaseReservation(orderID int) error {
+	_, err := s.db.Exec(
+		"UPDATE stock_holds SET status = 'RELEASED' WHERE order_id = ? AND status = 'ACTIVE'",
+		orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release stock reservation: %w", err)
+	}
+
+	return nil
+}
+
+// ReverseCommittedReservation возвращает товар, уже списанный по холдам заказа,
+// когда заказ отменён после оплаты. Каждый холд (у комплекта — по компонентам)
+// возвращается на свой склад и в свою партию по своей себестоимости, а бэкордеры
+// заказа отменяются: их товар со склада не уходил, поэтому и стоимость запасов
+// его возврат не меняет. Уже возвращённое повторно не возвращается.
+func (s *Store) ReverseCommittedReservation(orderID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	productIDs, err := holdProductIDs(tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, productID := range productIDs {
+		if err := lockProductLevels(tx, productID); err != nil {
+			return err
+		}
+	}
+
+	holds, err := committedHolds(tx, orderID, nil)
+	if err != nil {
+		return err
+	}
+
+	refType := types.RefTypeOrder
+	for _, h := range holds {
+		movement := types.InventoryMovement{
+			ProductID:     h.productID,
+			WarehouseID:   h.warehouseID,
+			LotID:         h.lotID,
+			MovementType:  types.MovementTypeIn,
+			Quantity:      h.remaining,
+			UnitCost:      h.unitCost,
+			Reason:        "Order cancelled after payment",
+			ReferenceID:   &orderID,
+			ReferenceType: &refType,
+		}
+
+		if h.backordered {
+			if err := cancelBackorders(tx, orderID, h.productID, h.warehouseID); err != nil {
+				return err
+			}
+			_, err = insertUncostedMovement(tx, movement)
+		} else {
+			err = insertMovement(tx, movement)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reverse stock: %w", err)
+		}
+
+		if err := markHoldReturned(tx, h.id, h.remaining); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Вернувшийся товар может покрыть чужие бэкордеры
+	for _, productID := range productIDs {
+		s.allocateBackorders(productID)
+		s.evaluateAlerts(productID)
+		s.notifySubscribers(productID)
+	}
+
+	return nil
+}
+
+// RestockReturn возвращает на склад quantity единиц товара, которые покупатель
+// вернул по заказу: на те склады и в те партии, откуда их списали закоммиченные
+// холды заказа. Холды помечаются вернувшимися, поэтому повторный возврат не
+// зачислит товар туда же дважды; остаток сверх холдов (заказы без холдов)
+// приходует основной склад без партии. unitCost — себестоимость строки заказа,
+// у холда с известной себестоимостью берётся она.
+//
+// quantity — всё количество товара в возврате returnID: уже оприходованное по
+// этому возврату не зачисляется снова, поэтому прерванное оприходование
+// возврата можно просто повторить.
+func (s *Store) RestockReturn(orderID, productID, quantity int, unitCost *types.Money, reason string, returnID int) error {
+	if unitCost != nil {
+		if unitCost.IsNegative() {
+			return fmt.Errorf("unit cost cannot be negative")
+		}
+		cost := types.NewMoney(unitCost.Amount, types.DefaultCurrency)
+		unitCost = &cost
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockProductLevels(tx, productID); err != nil {
+		return err
+	}
+
+	var restocked int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM inventory_movements
+		WHERE product_id = ? AND movement_type = 'IN' AND reference_type = ? AND reference_id = ?
+	`, productID, types.RefTypeReturn, returnID).Scan(&restocked)
+	if err != nil {
+		return fmt.Errorf("failed to get restocked quantity: %w", err)
+	}
+	if restocked >= quantity {
+		return nil
+	}
+
+	holds, err := committedHolds(tx, orderID, &productID)
+	if err != nil {
+		return err
+	}
+	// Бэкордерные холды — последними: их единицы могли так и не уйти покупателю
+	sort.SliceStable(holds, func(i, j int) bool {
+		return !holds[i].backordered && holds[j].backordered
+	})
+
+	refType := types.RefTypeReturn
+	remaining := quantity - restocked
+	for _, h := range holds {
+		if remaining == 0 {
+			break
+		}
+
+		returned := min(h.remaining, remaining)
+		movement := types.InventoryMovement{
+			ProductID:     productID,
+			WarehouseID:   h.warehouseID,
+			LotID:         h.lotID,
+			MovementType:  types.MovementTypeIn,
+			Quantity:      returned,
+			UnitCost:      unitCost,
+			Reason:        reason,
+			ReferenceID:   &returnID,
+			ReferenceType: &refType,
+		}
+		if h.unitCost != nil {
+			movement.UnitCost = h.unitCost
+		}
+
+		// Списание бэкордера не забрало слоёв FIFO, их добавил приход под него
+		if h.backordered {
+			_, err = insertUncostedMovement(tx, movement)
+		} else {
+			err = insertMovement(tx, movement)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restock product %d: %w", productID, err)
+		}
+
+		if err := markHoldReturned(tx, h.id, returned); err != nil {
+			return err
+		}
+		remaining -= returned
+	}
+
+	if remaining > 0 {
+		warehouseID, err := resolveWarehouse(tx, nil)
+		if err != nil {
+			return err
+		}
+		err = insertMovement(tx, types.InventoryMovement{
+			ProductID:     productID,
+			WarehouseID:   warehouseID,
+			MovementType:  types.MovementTypeIn,
+			Quantity:      remaining,
+			UnitCost:      unitCost,
+			Reason:        reason,
+			ReferenceID:   &returnID,
+			ReferenceType: &refType,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restock product %d: %w", productID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.allocateBackorders(productID)
+	s.evaluateAlerts(productID)
+	s.notifySubscribers(productID)
+	return nil
+}
+
+// committedHold — закоммиченный холд, часть товара которого ещё не вернулась на склад
+type committedHold struct {
+	id, productID, warehouseID int
+	lotID                      *int
+	remaining                  int
+	backordered                bool
+	unitCost                   *types.Money
+}
+
+// committedHolds блокирует и возвращает закоммиченные холды заказа с невозвращённым
+// товаром (при productID — только этого товара), в порядке создания.
+// Вызывается под блокировкой балансов товаров заказа.
+func committedHolds(tx *sql.Tx, orderID int, productID *int) ([]committedHold, error) {
+	query := `
+		SELECT id, product_id, warehouse_id, lot_id, quantity - returned, backordered, unit_cost
+		FROM stock_holds
+		WHERE order_id = ? AND status = 'COMMITTED' AND quantity > returned`
+	args := []any{orderID}
+	if productID != nil {
+		query += " AND product_id = ?"
+		args = append(args, *productID)
+	}
+	query += " ORDER BY id FOR UPDATE"
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock holds: %w", err)
+	}
+	defer rows.Close()
+
+	var holds []committedHold
+	for rows.Next() {
+		var h committedHold
+		if err := rows.Scan(&h.id, &h.productID, &h.warehouseID, &h.lotID, &h.remaining, &h.backordered, &h.unitCost); err != nil {
+			return nil, fmt.Errorf("failed to scan stock hold: %w", err)
+		}
+		holds = append(holds, h)
+	}
+
+	return holds, rows.Err()
+}
+
+// markHoldReturned отмечает, что quantity единиц холда вернулись на склад
+func markHoldReturned(tx *sql.Tx, holdID, quantity int) error {
+	_, err := tx.Exec("UPDATE stock_holds SET returned = returned + ? WHERE id = ?", quantity, holdID)
+	if err != nil {
+		return fmt.Errorf("failed to update stock hold: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireHolds помечает истёкшие холды и возвращает ID их заказов (не больше limit холдов за раз).
+// Остальные холды этих заказов освобождает вызывающий через ReleaseReservation при отмене заказа.
+func (s *Store) ExpireHolds(limit int) ([]int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Холды, заблокированные коммитом, пропускаем: их судьбу решит коммит
+	rows, err := tx.Query(`
+		SELECT id, order_id
+		FROM stock_holds
+		WHERE status = 'ACTIVE' AND expires_at <= NOW()
+		ORDER BY expires_at
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired stock holds: %w", err)
+	}
+
+	var holdIDs []any
+	seen := make(map[int]bool)
+	orderIDs := []int{}
+	for rows.Next() {
+		var holdID, orderID int
+		if err := rows.Scan(&holdID, &orderID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan stock hold: %w", err)
+		}
+		holdIDs = append(holdIDs, holdID)
+		if !seen[orderID] {
+			seen[orderID] = true
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	rows.Close()
+
+	if len(holdIDs) == 0 {
+		return orderIDs, nil
+	}
+
+	placeholders := strings.Repeat(",?", len(holdIDs))[1:]
+	_, err = tx.Exec(fmt.Sprintf("UPDATE stock_holds SET status = 'EXPIRED' WHERE id IN (%s)", placeholders), holdIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire stock holds: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return orderIDs, nil
+}
+
+// ReleaseStock возвращает товар на склад по умолчанию
 func (s *Store) ReleaseStock(productID, quantity int, reason string) error {
-	_, err := s.db.Exec(`
-		INSERT INTO inventory_movements 
-		(product_id, movement_type, quantity, reason)
-		VALUES (?, 'IN', ?, ?)
-	`, productID, quantity, reason)
-	
+	err := s.recordMovement(nil, nil, types.InventoryMovement{
+		ProductID:    productID,
+		MovementType: types.MovementTypeIn,
+		Quantity:     quantity,
+		Reason:       reason,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to release stock: %w", err)
 	}
-	
+
 	return nil
 }
 
-// AddStock добавляет товар на склад
-func (s *Store) AddStock(productID, quantity int, reason string, refType types.InventoryRefType, refID *int) error {
-	_, err := s.db.Exec(`
-		INSERT INTO inventory_movements 
-		(product_id, movement_type, quantity, reason, reference_id, reference_type)
-		VALUES (?, 'IN', ?, ?, ?, ?)
-	`, productID, quantity, reason, refID, refType)
-	
+// AddStock добавляет товар на склад (nil — склад по умолчанию). Себестоимость
+// единицы в базовой валюте необязательна: без неё приход оценивается по средней.
+// С партией товар приходит в неё, без партии — учитывается без партии.
+func (s *Store) AddStock(productID int, warehouseID *int, quantity int, unitCost *types.Money, lot *types.LotInfo, reason string, refType types.InventoryRefType, refID *int) error {
+	if unitCost != nil {
+		if unitCost.IsNegative() {
+			return fmt.Errorf("unit cost cannot be negative")
+		}
+		cost := types.NewMoney(unitCost.Amount, types.DefaultCurrency)
+		unitCost = &cost
+	}
+
+	err := s.recordMovement(warehouseID, lot, types.InventoryMovement{
+		ProductID:     productID,
+		MovementType:  types.MovementTypeIn,
+		Quantity:      quantity,
+		UnitCost:      unitCost,
+		Reason:        reason,
+		ReferenceID:   refID,
+		ReferenceType: &refType,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to add stock: %w", err)
 	}
-	
+
+	// Пришедший товар сначала покрывает самые старые бэкордеры
+	s.allocateBackorders(productID)
+	s.evaluateAlerts(productID)
+	s.notifySubscribers(productID)
 	return nil
 }
 
-// GetStockHistory возвращает историю движений товара
-func (s *Store) GetStockHistory(productID int, limit int) ([]types.InventoryMovement, error) {
-	query := `
-		SELECT id, product_id, movement_type, quantity, reason, 
-		       reference_id, reference_type, created_at
-		FROM inventory_movements 
-		WHERE product_id = ?
-		ORDER BY created_at DESC
-		LIMIT ?
-	`
-	
-	rows, err := s.db.Query(query, productID, limit)
+// AdjustStock корректирует остаток на складе со знаком: отрицательное количество
+// списывает товар (порча, потеря), положительное оприходует найденный и, как
+// приход, покрывает бэкордеры. Списание не может увести остаток в минус.
+func (s *Store) AdjustStock(productID int, warehouseID *int, quantity int, reasonCode types.AdjustmentReason, note string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	warehouse, err := resolveWarehouse(tx, warehouseID)
+	if err != nil {
+		return err
+	}
+
+	onHand, err := lockStockLevel(tx, productID, warehouse)
+	if err != nil {
+		return err
+	}
+
+	if quantity < 0 && onHand+quantity < 0 {
+		return fmt.Errorf("insufficient stock for product %d: on hand %d, adjustment %d", productID, onHand, quantity)
+	}
+
+	if err := insertMovement(tx, adjustmentMovement(productID, warehouse, quantity, reasonCode, note, nil)); err != nil {
+		return fmt.Errorf("failed to adjust stock: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if quantity > 0 {
+		s.allocateBackorders(productID)
+	}
+	s.evaluateAlerts(productID)
+	return nil
+}
+
+// adjustmentMovement превращает корректировку со знаком в движение журнала
+func adjustmentMovement(productID, warehouseID, quantity int, reasonCode types.AdjustmentReason, note string, refID *int) types.InventoryMovement {
+	movementType := types.MovementTypeIn
+	if quantity < 0 {
+		movementType = types.MovementTypeOut
+		quantity = -quantity
+	}
+
+	reason := string(reasonCode)
+	if note != "" {
+		reason = note
+	}
+
+	refType := types.RefTypeAdjustment
+	return types.InventoryMovement{
+		ProductID:     productID,
+		WarehouseID:   warehouseID,
+		MovementType:  movementType,
+		Quantity:      quantity,
+		Reason:        reason,
+		ReasonCode:    &reasonCode,
+		ReferenceID:   refID,
+		ReferenceType: &refType,
+	}
+}
+
+// TransferStock перемещает товар между складами: списание с одного и
+// оприходование на другом проводятся одной транзакцией. Перемещать можно
+// только доступный остаток, удержанный холдами товар остаётся на месте.
+func (s *Store) TransferStock(productID, fromWarehouseID, toWarehouseID, quantity int, note string) (*types.StockTransfer, error) {
+	if fromWarehouseID == toWarehouseID {
+		return nil, fmt.Errorf("cannot transfer stock to the same warehouse")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, warehouseID := range []int{fromWarehouseID, toWarehouseID} {
+		if _, err := resolveWarehouse(tx, &warehouseID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Балансы блокируются в порядке ID складов, как в остальных операциях
+	onHand := make(map[int]int)
+	for _, warehouseID := range []int{min(fromWarehouseID, toWarehouseID), max(fromWarehouseID, toWarehouseID)} {
+		level, err := lockStockLevel(tx, productID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		onHand[warehouseID] = level
+	}
+
+	var held int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM stock_holds
+		WHERE product_id = ? AND warehouse_id = ? AND status = 'ACTIVE' AND expires_at > NOW()
+	`, productID, fromWarehouseID).Scan(&held)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get held stock: %w", err)
+	}
+
+	expired, err := expiredQuantity(tx, productID, fromWarehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	available := onHand[fromWarehouseID] - held - expired
+	if available < quantity {
+		return nil, fmt.Errorf("insufficient stock for product %d in warehouse %d: available %d, requested %d",
+			productID, fromWarehouseID, available, quantity)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO stock_transfers (product_id, from_warehouse_id, to_warehouse_id, quantity, note)
+		VALUES (?, ?, ?, ?, ?)
+	`, productID, fromWarehouseID, toWarehouseID, quantity, note)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stock transfer: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock transfer ID: %w", err)
+	}
+	transferID := int(id)
+
+	reason := note
+	if reason == "" {
+		reason = fmt.Sprintf("Transfer #%d", transferID)
+	}
+	// Партии переезжают вместе с товаром (по FEFO), на каждую своя пара движений
+	picks, err := pickLots(tx, productID, fromWarehouseID, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	refType := types.RefTypeTransfer
+	for _, pick := range picks {
+		out := types.InventoryMovement{WarehouseID: fromWarehouseID, MovementType: types.MovementTypeOut}
+		in := types.InventoryMovement{WarehouseID: toWarehouseID, MovementType: types.MovementTypeIn}
+		if pick.lot != nil {
+			toLotID, err := ensureLot(tx, productID, toWarehouseID, types.LotInfo{LotNumber: pick.lot.lotNumber, ExpiresAt: pick.lot.expiresAt})
+			if err != nil {
+				return nil, err
+			}
+			out.LotID = &pick.lot.id
+			in.LotID = &toLotID
+		}
+
+		for _, movement := range []types.InventoryMovement{out, in} {
+			movement.ProductID = productID
+			movement.Quantity = pick.quantity
+			movement.Reason = reason
+			movement.ReferenceID = &transferID
+			movement.ReferenceType = &refType
+			if err := insertMovement(tx, movement); err != nil {
+				return nil, fmt.Errorf("failed to transfer stock: %w", err)
+			}
+		}
+	}
+
+	transfer := types.StockTransfer{
+		ID:              transferID,
+		ProductID:       productID,
+		FromWarehouseID: fromWarehouseID,
+		ToWarehouseID:   toWarehouseID,
+		Quantity:        quantity,
+		Note:            note,
+	}
+	err = tx.QueryRow("SELECT created_at FROM stock_transfers WHERE id = ?", transferID).Scan(&transfer.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock transfer: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+// recordMovement записывает одно движение в собственной транзакции
+// (warehouseID nil — склад по умолчанию, lot nil — без партии)
+func (s *Store) recordMovement(warehouseID *int, lot *types.LotInfo, movement types.InventoryMovement) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	movement.WarehouseID, err = resolveWarehouse(tx, warehouseID)
+	if err != nil {
+		return err
+	}
+
+	if lot != nil {
+		lotID, err := ensureLot(tx, movement.ProductID, movement.WarehouseID, *lot)
+		if err != nil {
+			return err
+		}
+		movement.LotID = &lotID
+	}
+
+	if err := insertMovement(tx, movement); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertMovement добавляет движение в журнал и в той же транзакции сдвигает
+// баланс товара на складе. Все записи в inventory_movements должны идти через
+// неё, иначе баланс разойдётся с журналом (см. ReconcileStockLevels), а
+// стоимость запасов — с остатками (см. applyMovementCost).
+func insertMovement(tx *sql.Tx, movement types.InventoryMovement) error {
+	movementID, err := insertUncostedMovement(tx, movement)
+	if err != nil {
+		return err
+	}
+
+	return applyMovementCost(tx, movement, movementID)
+}
+
+// insertUncostedMovement добавляет движение в журнал и сдвигает баланс, не трогая
+// стоимость запасов. Без insertMovement её вызывает только отмена бэкордера: его
+// списание не забрало слоёв FIFO, поэтому и возврат не должен их добавлять.
+func insertUncostedMovement(tx *sql.Tx, movement types.InventoryMovement) (int64, error) {
+	delta := movement.Quantity
+	if movement.MovementType == types.MovementTypeOut {
+		delta = -movement.Quantity
+	}
+
+	// Сначала сдвигаем баланс: строка остаётся заблокированной до конца транзакции,
+	// поэтому прочитанный остаток и есть баланс после этого движения
+	_, err := tx.Exec(`
+		INSERT INTO stock_levels (product_id, warehouse_id, on_hand)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE on_hand = on_hand + VALUES(on_hand)
+	`, movement.ProductID, movement.WarehouseID, delta)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update stock level: %w", err)
+	}
+
+	var balance int
+	err = tx.QueryRow(
+		"SELECT on_hand FROM stock_levels WHERE product_id = ? AND warehouse_id = ?",
+		movement.ProductID, movement.WarehouseID,
+	).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stock level: %w", err)
+	}
+
+	if err := applyLotMovement(tx, movement, balance); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO inventory_movements
+		(product_id, warehouse_id, lot_id, movement_type, quantity, balance_after, unit_cost, reason, reason_code, reference_id, reference_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, movement.ProductID, movement.WarehouseID, movement.LotID, movement.MovementType, movement.Quantity, balance,
+		movement.UnitCost, movement.Reason, movement.ReasonCode, movement.ReferenceID, movement.ReferenceType)
+	if err != nil {
+		return 0, err
+	}
+
+	movementID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get movement ID: %w", err)
+	}
+
+	return movementID, nil
+}
+
+// expiredQuantity считает товар в просроченных партиях на складе
+func expiredQuantity(q queryRower, productID, warehouseID int) (int, error) {
+	var expired int
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(quantity_on_hand), 0)
+		FROM stock_lots
+		WHERE product_id = ? AND warehouse_id = ? AND quantity_on_hand > 0 AND expires_at < CURDATE()
+	`, productID, warehouseID).Scan(&expired)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired stock: %w", err)
+	}
+
+	return expired, nil
+}
+
+// queryRower — общий интерфейс *sql.DB и *sql.Tx для запросов одной строки
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// resolveWarehouse проверяет, что склад существует; nil означает склад по умолчанию
+func resolveWarehouse(q queryRower, warehouseID *int) (int, error) {
+	var id int
+	if warehouseID == nil {
+		err := q.QueryRow("SELECT id FROM warehouses WHERE is_default = TRUE LIMIT 1").Scan(&id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return 0, fmt.Errorf("no default warehouse configured")
+			}
+			return 0, fmt.Errorf("failed to get default warehouse: %w", err)
+		}
+		return id, nil
+	}
+
+	err := q.QueryRow("SELECT id FROM warehouses WHERE id = ?", *warehouseID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("warehouse %d not found", *warehouseID)
+		}
+		return 0, fmt.Errorf("failed to get warehouse: %w", err)
+	}
+	return id, nil
+}
+
+// lockStockLevel блокирует строку баланса товара на складе до конца транзакции
+// и возвращает фактический остаток. Строка создаётся при первом обращении,
+// склад должен быть уже проверен.
+func lockStockLevel(tx *sql.Tx, productID, warehouseID int) (int, error) {
+	// IGNORE: строка уже есть или товара нет (тогда ниже вернётся not found)
+	_, err := tx.Exec("INSERT IGNORE INTO stock_levels (product_id, warehouse_id, on_hand) VALUES (?, ?, 0)", productID, warehouseID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create stock level: %w", err)
+	}
+
+	var onHand int
+	err = tx.QueryRow(
+		"SELECT on_hand FROM stock_levels WHERE product_id = ? AND warehouse_id = ? FOR UPDATE",
+		productID, warehouseID,
+	).Scan(&onHand)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("product %d not found", productID)
+		}
+		return 0, fmt.Errorf("failed to lock stock level: %w", err)
+	}
+
+	return onHand, nil
+}
+
+// lockProductLevels блокирует балансы товара на всех складах (в порядке ID складов).
+// Склады, где товара ещё не было, не блокируются: резервировать там нечего.
+func lockProductLevels(tx *sql.Tx, productID int) error {
+	rows, err := tx.Query("SELECT warehouse_id FROM stock_levels WHERE product_id = ? ORDER BY warehouse_id FOR UPDATE", productID)
+	if err != nil {
+		return fmt.Errorf("failed to lock stock levels: %w", err)
+	}
+	locked := 0
+	for rows.Next() {
+		locked++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to lock stock levels: %w", err)
+	}
+
+	if locked == 0 {
+		return checkProductExists(tx, productID)
+	}
+
+	return nil
+}
+
+// holdProductIDs возвращает отсортированные ID товаров, по которым у заказа есть холды
+func holdProductIDs(tx *sql.Tx, orderID int) ([]int, error) {
+	rows, err := tx.Query("SELECT DISTINCT product_id FROM stock_holds WHERE order_id = ?", orderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get stock history: %w", err)
+		return nil, fmt.Errorf("failed to get stock holds: %w", err)
 	}
 	defer rows.Close()
-	
-	var movements []types.InventoryMovement
+
+	var productIDs []int
 	for rows.Next() {
-		var movement types.InventoryMovement
-		var refID sql.NullInt64
-		var refType sql.NullString
-		
-		err := rows.Scan(
-			&movement.ID,
-			&movement.ProductID,
-			&movement.MovementType,
-			&movement.Quantity,
-			&movement.Reason,
-			&refID,
-			&refType,
-			&movement.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan movement row: %w", err)
+		var productID int
+		if err := rows.Scan(&productID); err != nil {
+			return nil, fmt.Errorf("failed to scan stock hold: %w", err)
 		}
-		
-		if refID.Valid {
-			id := int(refID.Int64)
-			movement.ReferenceID = &id
+		productIDs = append(productIDs, productID)
+	}
+	sort.Ints(productIDs)
+
+	return productIDs, rows.Err()
+}
+
+// ReconcileStockLevels сверяет балансы складов с журналом движений и возвращает
+// расхождения. С fix=true баланс каждого расходящегося товара на складе
+// пересчитывается по журналу под блокировкой его строки, так что параллельные
+// движения не теряются.
+func (s *Store) ReconcileStockLevels(fix bool) ([]types.StockDrift, error) {
+	rows, err := s.db.Query(`
+		SELECT k.product_id, k.warehouse_id, COALESCE(l.ledger, 0), COALESCE(sl.on_hand, 0)
+		FROM (
+			SELECT product_id, warehouse_id FROM inventory_movements
+			UNION
+			SELECT product_id, warehouse_id FROM stock_levels
+		) k
+		LEFT JOIN (
+			SELECT product_id, warehouse_id, SUM(
+				CASE WHEN movement_type = 'IN' THEN quantity
+				     ELSE -quantity
+				END
+			) AS ledger
+			FROM inventory_movements
+			GROUP BY product_id, warehouse_id
+		) l ON l.product_id = k.product_id AND l.warehouse_id = k.warehouse_id
+		LEFT JOIN stock_levels sl ON sl.product_id = k.product_id AND sl.warehouse_id = k.warehouse_id
+		WHERE COALESCE(l.ledger, 0) <> COALESCE(sl.on_hand, 0)
+		ORDER BY k.product_id, k.warehouse_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare stock levels: %w", err)
+	}
+
+	drifts := []types.StockDrift{}
+	for rows.Next() {
+		var drift types.StockDrift
+		if err := rows.Scan(&drift.ProductID, &drift.WarehouseID, &drift.Ledger, &drift.StockLevel); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan stock drift: %w", err)
 		}
-		if refType.Valid {
-			rt := types.InventoryRefType(refType.String)
-			movement.ReferenceType = &rt
+		drifts = append(drifts, drift)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !fix {
+		return drifts, nil
+	}
+
+	for _, drift := range drifts {
+		if err := s.rebuildStockLevel(drift.ProductID, drift.WarehouseID); err != nil {
+			return drifts, err
 		}
-		
-		movements = append(movements, movement)
 	}
-	
-	return movements, nil
-}
\ No newline at end of file
+
+	return drifts, nil
+}
+
+// rebuildStockLevel пересчитывает баланс товара на складе по журналу движений
+func (s *Store) rebuildStockLevel(productID, warehouseID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockStockLevel(tx, productID, warehouseID); err != nil {
+		return err
+	}
+
+	var ledger int
+	if err := tx.QueryRow(ledgerQuery, productID, warehouseID).Scan(&ledger); err != nil {
+		return fmt.Errorf("failed to sum stock ledger for product %d: %w", productID, err)
+	}
+
+	_, err = tx.Exec(
+		"UPDATE stock_levels SET on_hand = ? WHERE product_id = ? AND warehouse_id = ?",
+		ledger, productID, warehouseID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild stock level for product %d: %w", productID, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,129 @@
+package inventory
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// benchMovements is the size of the ledger the benchmarks run against
+const benchMovements = 1_000_000
+
+var (
+	benchOnce      sync.Once
+	benchDB        *sql.DB
+	benchStore     *Store
+	benchProduct   int
+	benchUser      int
+	benchWarehouse int
+)
+
+// setupBenchLedger seeds one product with benchMovements movements, once per run.
+// The rows are bulk inserted around the store, so the stock level is rebuilt
+// by reconciliation afterwards.
+func setupBenchLedger(b *testing.B) {
+	b.Helper()
+
+	benchOnce.Do(func() {
+		benchDB = setupTestDB(b)
+		store := NewStore(benchDB)
+		benchProduct, benchUser = setupTestData(b, benchDB)
+		benchWarehouse = defaultWarehouseID(b, benchDB)
+
+		const batchSize = 5000
+		values := strings.Repeat(",(?, ?, ?, ?, 'Benchmark movement')", batchSize)[1:]
+		query := "INSERT INTO inventory_movements (product_id, warehouse_id, movement_type, quantity, reason) VALUES " + values
+
+		args := make([]any, 0, batchSize*4)
+		for seeded := 0; seeded < benchMovements; seeded += batchSize {
+			args = args[:0]
+			for i := 0; i < batchSize; i++ {
+				// two units in for every unit out, so the product stays in stock
+				if (seeded+i)%2 == 0 {
+					args = append(args, benchProduct, benchWarehouse, "IN", 2)
+				} else {
+					args = append(args, benchProduct, benchWarehouse, "OUT", 1)
+				}
+			}
+			if _, err := benchDB.Exec(query, args...); err != nil {
+				b.Fatalf("Failed to seed movements: %v", err)
+			}
+		}
+
+		if _, err := store.ReconcileStockLevels(true); err != nil {
+			b.Fatalf("Failed to build stock levels: %v", err)
+		}
+		benchStore = store
+	})
+
+	if benchStore == nil {
+		b.Fatal("Benchmark ledger setup failed")
+	}
+}
+
+// Baseline: summing the whole ledger, as stock was read before stock_levels
+func BenchmarkLedgerSum(b *testing.B) {
+	setupBenchLedger(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var stock int
+		if err := benchDB.QueryRow(ledgerQuery, benchProduct, benchWarehouse).Scan(&stock); err != nil {
+			b.Fatalf("Failed to sum ledger: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetCurrentStock(b *testing.B) {
+	setupBenchLedger(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := benchStore.GetCurrentStock(benchProduct); err != nil {
+			b.Fatalf("Failed to get stock: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetProductsWithStock(b *testing.B) {
+	setupBenchLedger(b)
+	productIDs := []int{benchProduct}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := benchStore.GetProductsWithStock(productIDs); err != nil {
+			b.Fatalf("Failed to get stock: %v", err)
+		}
+	}
+}
+
+func BenchmarkReserveStock(b *testing.B) {
+	setupBenchLedger(b)
+	orderID := createTestOrder(b, benchDB, benchUser, 99.99)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := benchStore.ReserveStock(benchProduct, 1, orderID, nil); err != nil {
+			b.Fatalf("Failed to reserve stock: %v", err)
+		}
+	}
+
+	b.StopTimer()
+	if err := benchStore.ReleaseReservation(orderID); err != nil {
+		b.Fatalf("Failed to release reservation: %v", err)
+	}
+}
+
+func BenchmarkAddStock(b *testing.B) {
+	setupBenchLedger(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := benchStore.AddStock(benchProduct, nil, 1, nil, nil, "Benchmark restock", types.RefTypeRestock, nil); err != nil {
+			b.Fatalf("Failed to add stock: %v", err)
+		}
+	}
+}
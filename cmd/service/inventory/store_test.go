@@ -14,7 +14,7 @@ import (
 )
 
 // Test database setup
-func setupTestDB(t *testing.T) *sql.DB {
+func setupTestDB(t testing.TB) *sql.DB {
 	// Load config
 	config.Envs = config.Config{
 		DBUser:     "root",
@@ -39,19 +39,23 @@ func setupTestDB(t *testing.T) *sql.DB {
 	}
 
 	// Clean up any existing test data
-	tables := []string{"inventory_movements", "order_items", "orders", "products", "users"}
+	tables := []string{"backorders", "stock_policies", "cost_layers", "product_costs", "inventory_movements", "stock_holds", "stock_lots", "stock_levels", "stock_transfers", "stock_take_lines", "stock_takes", "stock_subscriptions", "stock_thresholds", "order_items", "orders", "products", "users"}
 	for _, table := range tables {
 		_, err := testDB.Exec(fmt.Sprintf("DELETE FROM %s", table))
 		if err != nil {
 			t.Logf("Warning: Failed to clean table %s: %v", table, err)
 		}
 	}
+	// keep only the default warehouse seeded by the migrations
+	if _, err := testDB.Exec("DELETE FROM warehouses WHERE is_default = FALSE"); err != nil {
+		t.Logf("Warning: Failed to clean table warehouses: %v", err)
+	}
 
 	return testDB
 }
 
 // Helper function to setup test data
-func setupTestData(t *testing.T, db *sql.DB) (int, int) {
+func setupTestData(t testing.TB, db *sql.DB) (int, int) {
 	// Create a test product with unique name
 	productName := fmt.Sprintf("Test Product %d", time.Now().UnixNano())
 	result, err := db.Exec("INSERT INTO products (name, description, image, price) VALUES (?, ?, ?, ?)",
@@ -81,16 +85,41 @@ func setupTestData(t *testing.T, db *sql.DB) (int, int) {
 	return int(productID), int(userID)
 }
 
+// Helper function to get the default warehouse seeded by the migrations
+func defaultWarehouseID(t testing.TB, db *sql.DB) int {
+	var warehouseID int
+	if err := db.QueryRow("SELECT id FROM warehouses WHERE is_default = TRUE").Scan(&warehouseID); err != nil {
+		t.Fatalf("Failed to get default warehouse: %v", err)
+	}
+	return warehouseID
+}
+
+// Helper function to create a warehouse
+func createTestWarehouse(t testing.TB, db *sql.DB, code, country, stateProvince string, priority int) int {
+	result, err := db.Exec("INSERT INTO warehouses (code, name, country, state_province, priority) VALUES (?, ?, ?, ?, ?)",
+		code, "Warehouse "+code, country, stateProvince, priority)
+	if err != nil {
+		t.Fatalf("Failed to create test warehouse: %v", err)
+	}
+
+	warehouseID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatalf("Failed to get warehouse ID: %v", err)
+	}
+
+	return int(warehouseID)
+}
+
 // Helper function to add initial stock
-func addInitialStock(t *testing.T, store *Store, productID, quantity int) {
-	err := store.AddStock(productID, quantity, "Initial test stock", types.RefTypeRestock, nil)
+func addInitialStock(t testing.TB, store *Store, productID, quantity int) {
+	err := store.AddStock(productID, nil, quantity, nil, nil, "Initial test stock", types.RefTypeRestock, nil)
 	if err != nil {
 		t.Fatalf("Failed to add initial stock: %v", err)
 	}
 }
 
 // Helper function to create an order
-func createTestOrder(t *testing.T, db *sql.DB, userID int, total float64) int {
+func createTestOrder(t testing.TB, db *sql.DB, userID int, total float64) int {
 	result, err := db.Exec("INSERT INTO orders (userID, total, status, address) VALUES (?, ?, ?, ?)",
 		userID, total, "pending", "Test Address")
 	if err != nil {
@@ -147,7 +176,7 @@ func TestConcurrentStockReservation(t *testing.T) {
 			orderID := createTestOrder(t, db, userID, 99.99)
 
 			// Try to reserve stock
-			err := store.ReserveStock(productID, itemsPerReservation, orderID)
+			err := store.ReserveStock(productID, itemsPerReservation, orderID, nil)
 			results[goroutineID] = err
 
 			// Track results thread-safely
@@ -229,7 +258,7 @@ func TestOversellePrevention(t *testing.T) {
 
 	// Try to reserve 6 items (more than available)
 	orderID := createTestOrder(t, db, userID, 599.94)
-	err := store.ReserveStock(productID, 6, orderID)
+	err := store.ReserveStock(productID, 6, orderID, nil)
 
 	// Should fail with insufficient stock error
 	if err == nil {
@@ -308,7 +337,7 @@ func TestHighLoadConcurrentReservations(t *testing.T) {
 			quantity := (goroutineID % 3) + 1 // 1, 2, or 3 items
 
 			orderID := createTestOrder(t, db, userID, float64(quantity)*99.99)
-			err := store.ReserveStock(productID, quantity, orderID)
+			err := store.ReserveStock(productID, quantity, orderID, nil)
 
 			mu.Lock()
 			if err != nil {
@@ -338,4 +367,1054 @@ func TestHighLoadConcurrentReservations(t *testing.T) {
 		}
 		t.Logf("Product %d final stock: %d (started with %d)", productID, stock, products[i].stock)
 	}
-}
\ No newline at end of file
+}
+
+// Helper function to push the holds of an order past their expiry
+func expireTestHolds(t *testing.T, db *sql.DB, orderID int) {
+	_, err := db.Exec("UPDATE stock_holds SET expires_at = NOW() - INTERVAL 1 SECOND WHERE order_id = ?", orderID)
+	if err != nil {
+		t.Fatalf("Failed to expire holds: %v", err)
+	}
+}
+
+// Test that holds reduce availability and that committing and releasing them settle the stock
+func TestStockHoldLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	addInitialStock(t, store, productID, 5)
+
+	paidOrder := createTestOrder(t, db, userID, 199.98)
+	if err := store.ReserveStock(productID, 2, paidOrder, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+	cancelledOrder := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 1, cancelledOrder, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != 5 || level.Held != 3 || level.Available != 2 {
+		t.Errorf("Expected 5 on hand, 3 held, 2 available, got %+v", level)
+	}
+
+	if err := store.CommitReservation(paidOrder); err != nil {
+		t.Fatalf("Failed to commit reservation: %v", err)
+	}
+	if err := store.ReleaseReservation(cancelledOrder); err != nil {
+		t.Fatalf("Failed to release reservation: %v", err)
+	}
+
+	level, err = store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != 3 || level.Held != 0 || level.Available != 3 {
+		t.Errorf("Expected 3 on hand, 0 held, 3 available, got %+v", level)
+	}
+
+	// the hold is gone, committing it again must not take stock twice
+	if err := store.CommitReservation(paidOrder); err == nil {
+		t.Error("Expected committing a settled reservation to fail")
+	}
+}
+
+// Test that the lines of an order, e.g. the components of a bundle, are reserved all or nothing
+func TestReserveStockLines(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	firstProduct, userID := setupTestData(t, db)
+	secondProduct, _ := setupTestData(t, db)
+	addInitialStock(t, store, firstProduct, 5)
+	addInitialStock(t, store, secondProduct, 1)
+
+	failedOrder := createTestOrder(t, db, userID, 99.99)
+	lines := []types.CartItem{{ProductID: firstProduct, Quantity: 2}, {ProductID: secondProduct, Quantity: 2}}
+	expectedError := fmt.Sprintf("insufficient stock for product %d: available 1, requested 2", secondProduct)
+	if err := store.ReserveStockLines(failedOrder, lines, nil); err == nil || err.Error() != expectedError {
+		t.Fatalf("Expected error '%s', got '%v'", expectedError, err)
+	}
+
+	level, err := store.GetStockLevel(firstProduct)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.Held != 0 {
+		t.Errorf("Expected the failed reservation to hold nothing, got %+v", level)
+	}
+
+	// lines of the same product add up
+	orderID := createTestOrder(t, db, userID, 99.99)
+	lines = []types.CartItem{{ProductID: firstProduct, Quantity: 2}, {ProductID: secondProduct, Quantity: 1}, {ProductID: firstProduct, Quantity: 1}}
+	if err := store.ReserveStockLines(orderID, lines, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+
+	level, err = store.GetStockLevel(firstProduct)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.Held != 3 || level.Available != 2 {
+		t.Errorf("Expected 3 held and 2 available, got %+v", level)
+	}
+}
+
+// Test that an expired hold frees its stock and can no longer be committed
+func TestExpiredHoldCannotBeCommitted(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	addInitialStock(t, store, productID, 3)
+
+	orderID := createTestOrder(t, db, userID, 299.97)
+	if err := store.ReserveStock(productID, 3, orderID, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+	expireTestHolds(t, db, orderID)
+
+	// an expired hold no longer counts against availability, even before the sweep
+	stock, err := store.GetCurrentStock(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock: %v", err)
+	}
+	if stock != 3 {
+		t.Errorf("Expected expired hold to free the stock, got %d available", stock)
+	}
+
+	expectedError := fmt.Sprintf("stock reservation for order %d has expired", orderID)
+	if err := store.CommitReservation(orderID); err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+
+	orderIDs, err := store.ExpireHolds(100)
+	if err != nil {
+		t.Fatalf("Failed to expire holds: %v", err)
+	}
+	if len(orderIDs) != 1 || orderIDs[0] != orderID {
+		t.Errorf("Expected order %d to be expired, got %v", orderID, orderIDs)
+	}
+}
+
+// Test that the sweeper and payments racing for the same holds never both win:
+// live holds are committed, expired ones are swept, none of them twice
+func TestConcurrentExpiryAndCommit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+
+	numOrders := 10
+	addInitialStock(t, store, productID, numOrders)
+
+	orderIDs := make([]int, numOrders)
+	for i := range orderIDs {
+		orderIDs[i] = createTestOrder(t, db, userID, 99.99)
+		if err := store.ReserveStock(productID, 1, orderIDs[i], nil); err != nil {
+			t.Fatalf("Failed to reserve stock: %v", err)
+		}
+		// every other customer pays too late
+		if i%2 == 0 {
+			expireTestHolds(t, db, orderIDs[i])
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	committed := 0
+	expired := make(map[int]int)
+
+	sweep := func() {
+		for {
+			ids, err := store.ExpireHolds(2)
+			if err != nil {
+				t.Errorf("Failed to expire holds: %v", err)
+				return
+			}
+			if len(ids) == 0 {
+				return
+			}
+			mu.Lock()
+			for _, id := range ids {
+				expired[id]++
+			}
+			mu.Unlock()
+		}
+	}
+
+	for _, orderID := range orderIDs {
+		wg.Add(1)
+		go func(orderID int) {
+			defer wg.Done()
+			if err := store.CommitReservation(orderID); err == nil {
+				mu.Lock()
+				committed++
+				mu.Unlock()
+			}
+		}(orderID)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sweep()
+	}()
+
+	wg.Wait()
+
+	// holds locked by a failing commit are skipped by the sweep, pick them up now
+	sweep()
+
+	t.Logf("Committed: %d, expired: %d", committed, len(expired))
+
+	if committed != numOrders/2 {
+		t.Errorf("Expected %d live holds to be committed, got %d", numOrders/2, committed)
+	}
+	if len(expired) != numOrders/2 {
+		t.Errorf("Expected %d holds to be expired, got %d", numOrders/2, len(expired))
+	}
+	for i, orderID := range orderIDs {
+		if i%2 == 0 && expired[orderID] != 1 {
+			t.Errorf("Expected order %d to be expired exactly once, got %d", orderID, expired[orderID])
+		}
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != numOrders-committed || level.Held != 0 {
+		t.Errorf("Expected %d on hand and nothing held, got %+v", numOrders-committed, level)
+	}
+}
+
+// Test that the materialized stock levels follow every movement and that reconciliation repairs drift
+func TestReconcileStockLevels(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	addInitialStock(t, store, productID, 10)
+
+	orderID := createTestOrder(t, db, userID, 399.96)
+	if err := store.ReserveStock(productID, 4, orderID, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+	if err := store.CommitReservation(orderID); err != nil {
+		t.Fatalf("Failed to commit reservation: %v", err)
+	}
+	if err := store.ReleaseStock(productID, 1, "Test release"); err != nil {
+		t.Fatalf("Failed to release stock: %v", err)
+	}
+
+	drifts, err := store.ReconcileStockLevels(false)
+	if err != nil {
+		t.Fatalf("Failed to reconcile stock levels: %v", err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("Expected stock levels to match the ledger, got %+v", drifts)
+	}
+
+	// a movement written around the store leaves the balance behind
+	_, err = db.Exec(`
+		INSERT INTO inventory_movements (product_id, warehouse_id, movement_type, quantity, reason)
+		VALUES (?, ?, 'OUT', 2, 'Written around the store')
+	`, productID, defaultWarehouseID(t, db))
+	if err != nil {
+		t.Fatalf("Failed to insert movement: %v", err)
+	}
+
+	drifts, err = store.ReconcileStockLevels(true)
+	if err != nil {
+		t.Fatalf("Failed to reconcile stock levels: %v", err)
+	}
+	if len(drifts) != 1 || drifts[0].ProductID != productID || drifts[0].Ledger != 5 || drifts[0].StockLevel != 7 {
+		t.Errorf("Expected product %d to drift from 5 to 7, got %+v", productID, drifts)
+	}
+
+	stock, err := store.GetCurrentStock(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock: %v", err)
+	}
+	if stock != 5 {
+		t.Errorf("Expected the rebuilt stock to be 5, got %d", stock)
+	}
+}
+
+// Test that signed adjustments move stock with their reason code and never go below zero
+func TestAdjustStock(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, _ := setupTestData(t, db)
+	addInitialStock(t, store, productID, 5)
+
+	if err := store.AdjustStock(productID, nil, -2, types.AdjustmentDamaged, "Dropped pallet"); err != nil {
+		t.Fatalf("Failed to write off stock: %v", err)
+	}
+	if err := store.AdjustStock(productID, nil, 1, types.AdjustmentFound, ""); err != nil {
+		t.Fatalf("Failed to add found stock: %v", err)
+	}
+
+	expectedError := fmt.Sprintf("insufficient stock for product %d: on hand 4, adjustment -5", productID)
+	if err := store.AdjustStock(productID, nil, -5, types.AdjustmentLost, ""); err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+
+	stock, err := store.GetCurrentStock(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock: %v", err)
+	}
+	if stock != 4 {
+		t.Errorf("Expected stock 4 after adjustments, got %d", stock)
+	}
+
+	history, err := store.GetStockHistory(productID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	adjustments := 0
+	for _, movement := range history {
+		if movement.ReferenceType != nil && *movement.ReferenceType == types.RefTypeAdjustment {
+			adjustments++
+			if movement.ReasonCode == nil {
+				t.Errorf("Expected adjustment %d to have a reason code", movement.ID)
+			}
+		}
+	}
+	if adjustments != 2 {
+		t.Errorf("Expected 2 adjustment movements, got %d", adjustments)
+	}
+}
+
+// Test the stock take workflow: counts are reviewed against on-hand stock and posted as adjustments
+func TestStockTakeWorkflow(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	shortProduct, userID := setupTestData(t, db)
+	overProduct, _ := setupTestData(t, db)
+	exactProduct, _ := setupTestData(t, db)
+	addInitialStock(t, store, shortProduct, 10)
+	addInitialStock(t, store, overProduct, 3)
+	addInitialStock(t, store, exactProduct, 7)
+
+	stockTakeID, err := store.CreateStockTake(nil, "Year end", userID)
+	if err != nil {
+		t.Fatalf("Failed to create stock take: %v", err)
+	}
+
+	err = store.SetStockCounts(stockTakeID, []types.StockCountPayload{
+		{ProductID: shortProduct, CountedQuantity: 9},
+		{ProductID: overProduct, CountedQuantity: 1},
+		{ProductID: exactProduct, CountedQuantity: 7},
+	})
+	if err != nil {
+		t.Fatalf("Failed to submit counts: %v", err)
+	}
+	// a recount replaces the first count
+	err = store.SetStockCounts(stockTakeID, []types.StockCountPayload{{ProductID: overProduct, CountedQuantity: 4}})
+	if err != nil {
+		t.Fatalf("Failed to submit recount: %v", err)
+	}
+
+	stockTake, err := store.GetStockTake(stockTakeID)
+	if err != nil {
+		t.Fatalf("Failed to get stock take: %v", err)
+	}
+	variances := make(map[int]int)
+	for _, line := range stockTake.Lines {
+		variances[line.ProductID] = line.Variance
+	}
+	if variances[shortProduct] != -1 || variances[overProduct] != 1 || variances[exactProduct] != 0 {
+		t.Errorf("Expected variances -1, 1 and 0, got %v", variances)
+	}
+
+	if err := store.PostStockTake(stockTakeID); err != nil {
+		t.Fatalf("Failed to post stock take: %v", err)
+	}
+
+	for productID, expected := range map[int]int{shortProduct: 9, overProduct: 4, exactProduct: 7} {
+		stock, err := store.GetCurrentStock(productID)
+		if err != nil {
+			t.Fatalf("Failed to get stock: %v", err)
+		}
+		if stock != expected {
+			t.Errorf("Expected product %d to have %d after posting, got %d", productID, expected, stock)
+		}
+	}
+
+	// posted stock takes are frozen
+	expectedError := "stock take not found or not in status OPEN"
+	if err := store.PostStockTake(stockTakeID); err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+	err = store.SetStockCounts(stockTakeID, []types.StockCountPayload{{ProductID: shortProduct, CountedQuantity: 1}})
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+
+	// the frozen expected quantity no longer follows the stock
+	addInitialStock(t, store, shortProduct, 5)
+	stockTake, err = store.GetStockTake(stockTakeID)
+	if err != nil {
+		t.Fatalf("Failed to get stock take: %v", err)
+	}
+	if stockTake.Status != types.StockTakePosted || stockTake.Lines[0].ExpectedQuantity != 10 {
+		t.Errorf("Expected the posted stock take to keep its expected quantities, got %+v", stockTake)
+	}
+}
+
+// Test that transfers move only available stock and keep both warehouses in line with the ledger
+func TestTransferStock(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	mainWarehouse := defaultWarehouseID(t, db)
+	eastWarehouse := createTestWarehouse(t, db, "EAST", "US", "NY", 10)
+	addInitialStock(t, store, productID, 10)
+
+	// a hold on the main warehouse cannot be moved away
+	orderID := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 4, orderID, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+
+	expectedError := fmt.Sprintf("insufficient stock for product %d in warehouse %d: available 6, requested 7", productID, mainWarehouse)
+	if _, err := store.TransferStock(productID, mainWarehouse, eastWarehouse, 7, ""); err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+
+	transfer, err := store.TransferStock(productID, mainWarehouse, eastWarehouse, 6, "Rebalance")
+	if err != nil {
+		t.Fatalf("Failed to transfer stock: %v", err)
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != 10 || level.Available != 6 {
+		t.Errorf("Expected a transfer to keep 10 on hand and 6 available, got %d and %d", level.OnHand, level.Available)
+	}
+	onHand := make(map[int]int)
+	for _, stock := range level.Warehouses {
+		onHand[stock.WarehouseID] = stock.OnHand
+	}
+	if onHand[mainWarehouse] != 4 || onHand[eastWarehouse] != 6 {
+		t.Errorf("Expected 4 units in the main warehouse and 6 in the east one, got %v", onHand)
+	}
+
+	history, err := store.GetStockHistory(productID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	transferMovements := 0
+	for _, movement := range history {
+		if movement.ReferenceType != nil && *movement.ReferenceType == types.RefTypeTransfer && *movement.ReferenceID == transfer.ID {
+			transferMovements++
+		}
+	}
+	if transferMovements != 2 {
+		t.Errorf("Expected the transfer to write 2 movements, got %d", transferMovements)
+	}
+
+	drifts, err := store.ReconcileStockLevels(false)
+	if err != nil {
+		t.Fatalf("Failed to reconcile stock levels: %v", err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("Expected stock levels to match the ledger, got %+v", drifts)
+	}
+}
+
+// Test that movements carry the running balance and can be filtered and paged
+func TestMovementLedger(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, _ := setupTestData(t, db)
+	mainWarehouse := defaultWarehouseID(t, db)
+	eastWarehouse := createTestWarehouse(t, db, "EAST", "US", "NY", 10)
+	addInitialStock(t, store, productID, 10)
+
+	if err := store.AdjustStock(productID, nil, -3, types.AdjustmentDamaged, ""); err != nil {
+		t.Fatalf("Failed to adjust stock: %v", err)
+	}
+	if _, err := store.TransferStock(productID, mainWarehouse, eastWarehouse, 4, ""); err != nil {
+		t.Fatalf("Failed to transfer stock: %v", err)
+	}
+
+	history, err := store.GetStockHistory(productID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("Expected 4 movements, got %d", len(history))
+	}
+
+	// newest first: transfer in, transfer out, write-off, initial stock
+	expected := []struct {
+		warehouseID int
+		balance     int
+	}{{eastWarehouse, 4}, {mainWarehouse, 3}, {mainWarehouse, 7}, {mainWarehouse, 10}}
+	for i, movement := range history {
+		if movement.WarehouseID != expected[i].warehouseID || movement.BalanceAfter == nil || *movement.BalanceAfter != expected[i].balance {
+			t.Errorf("Movement %d: expected balance %d in warehouse %d, got %+v", i, expected[i].balance, expected[i].warehouseID, movement)
+		}
+	}
+
+	outgoing := types.MovementTypeOut
+	movements, err := store.GetMovements(types.MovementFilter{ProductID: &productID, MovementType: &outgoing})
+	if err != nil {
+		t.Fatalf("Failed to get movements: %v", err)
+	}
+	if len(movements) != 2 {
+		t.Errorf("Expected 2 outgoing movements, got %d", len(movements))
+	}
+
+	firstPage, err := store.GetMovements(types.MovementFilter{ProductID: &productID, Limit: 3})
+	if err != nil {
+		t.Fatalf("Failed to get movements: %v", err)
+	}
+	secondPage, err := store.GetMovements(types.MovementFilter{ProductID: &productID, BeforeID: &firstPage[2].ID, Limit: 3})
+	if err != nil {
+		t.Fatalf("Failed to get movements: %v", err)
+	}
+	if len(firstPage) != 3 || len(secondPage) != 1 || secondPage[0].ID != history[3].ID {
+		t.Errorf("Expected pages of 3 and 1 movements, got %d and %d", len(firstPage), len(secondPage))
+	}
+
+	streamed := 0
+	err = store.StreamMovements(types.MovementFilter{ProductID: &productID, WarehouseID: &eastWarehouse}, func(types.InventoryMovement) error {
+		streamed++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to stream movements: %v", err)
+	}
+	if streamed != 1 {
+		t.Errorf("Expected 1 movement in the east warehouse, got %d", streamed)
+	}
+}
+
+// Test that received stock is costed and sales consume the oldest cost layers first
+func TestStockValuation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+
+	for _, cost := range []string{"2.00", "4.00"} {
+		unitCost := types.MustParseMoney(cost, types.DefaultCurrency)
+		if err := store.AddStock(productID, nil, 10, &unitCost, nil, "Delivery", types.RefTypeRestock, nil); err != nil {
+			t.Fatalf("Failed to add stock: %v", err)
+		}
+	}
+
+	orderID := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 12, orderID, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+
+	var holdCost string
+	if err := db.QueryRow("SELECT unit_cost FROM stock_holds WHERE order_id = ?", orderID).Scan(&holdCost); err != nil {
+		t.Fatalf("Failed to get hold cost: %v", err)
+	}
+	if holdCost != "2.33" {
+		t.Errorf("Expected 10 units at 2.00 and 2 at 4.00 to cost 2.33 each, got %s", holdCost)
+	}
+
+	if err := store.CommitReservation(orderID); err != nil {
+		t.Fatalf("Failed to commit reservation: %v", err)
+	}
+
+	expected := map[types.ValuationMethod]string{types.ValuationFIFO: "32.00", types.ValuationAverage: "24.00"}
+	for method, value := range expected {
+		valuations, err := store.GetStockValuation(method)
+		if err != nil {
+			t.Fatalf("Failed to get stock valuation: %v", err)
+		}
+		if len(valuations) != 1 || valuations[0].OnHand != 8 || valuations[0].Value.String() != value {
+			t.Errorf("Expected 8 units worth %s by %s, got %+v", value, method, valuations)
+		}
+	}
+}
+
+// Test that reservations take the lot that expires first and expired lots are not for sale
+func TestLotsFEFO(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+
+	today := time.Now().Truncate(24 * time.Hour)
+	receipts := []struct {
+		lotNumber string
+		expiresAt time.Time
+		quantity  int
+	}{
+		{"LATE", today.AddDate(0, 0, 20), 5},
+		{"SOON", today.AddDate(0, 0, 5), 5},
+		{"OLD", today.AddDate(0, 0, -1), 3},
+	}
+	for _, receipt := range receipts {
+		lot := &types.LotInfo{LotNumber: receipt.lotNumber, ExpiresAt: &receipt.expiresAt}
+		if err := store.AddStock(productID, nil, receipt.quantity, nil, lot, "Delivery", types.RefTypeRestock, nil); err != nil {
+			t.Fatalf("Failed to add lot %s: %v", receipt.lotNumber, err)
+		}
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != 13 || level.Expired != 3 || level.Available != 10 {
+		t.Errorf("Expected 13 on hand with 3 expired and 10 available, got %+v", level)
+	}
+
+	orderID := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 11, orderID, nil); err == nil {
+		t.Error("Expected expired stock not to be reservable")
+	}
+	if err := store.ReserveStock(productID, 6, orderID, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+	if err := store.CommitReservation(orderID); err != nil {
+		t.Fatalf("Failed to commit reservation: %v", err)
+	}
+
+	lots, err := store.GetProductLots(productID)
+	if err != nil {
+		t.Fatalf("Failed to get lots: %v", err)
+	}
+	remaining := make(map[string]int)
+	for _, lot := range lots {
+		remaining[lot.LotNumber] = lot.Quantity
+	}
+	if remaining["SOON"] != 0 || remaining["LATE"] != 4 || remaining["OLD"] != 3 {
+		t.Errorf("Expected the sale to empty lot SOON and take 1 from LATE, got %v", remaining)
+	}
+
+	expiring, err := store.GetExpiringLots(7, nil)
+	if err != nil {
+		t.Fatalf("Failed to get expiring lots: %v", err)
+	}
+	if len(expiring) != 1 || expiring[0].LotNumber != "OLD" || !expiring[0].Expired {
+		t.Errorf("Expected only the expired lot to expire within 7 days, got %+v", expiring)
+	}
+
+	writtenOff, err := store.WriteOffExpiredLots(nil)
+	if err != nil {
+		t.Fatalf("Failed to write off expired lots: %v", err)
+	}
+	if len(writtenOff) != 1 || writtenOff[0].Quantity != 3 {
+		t.Errorf("Expected 3 units of lot OLD to be written off, got %+v", writtenOff)
+	}
+
+	level, err = store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != 4 || level.Expired != 0 || level.Available != 4 {
+		t.Errorf("Expected 4 units left after the write-off, got %+v", level)
+	}
+
+	history, err := store.GetStockHistory(productID, 1)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if *history[0].ReferenceType != types.RefTypeAdjustment || *history[0].ReasonCode != types.AdjustmentExpired {
+		t.Errorf("Expected the write-off to be an EXPIRED adjustment, got %+v", history[0])
+	}
+}
+
+// Test that a reservation no single warehouse can cover is split across warehouses and committed from each
+func TestReserveStockAcrossWarehouses(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	mainWarehouse := defaultWarehouseID(t, db)
+	eastWarehouse := createTestWarehouse(t, db, "EAST", "US", "NY", 10)
+	addInitialStock(t, store, productID, 3)
+	if err := store.AddStock(productID, &eastWarehouse, 5, nil, nil, "East stock", types.RefTypeRestock, nil); err != nil {
+		t.Fatalf("Failed to add stock: %v", err)
+	}
+
+	// the whole line fits in the east warehouse, so nearest ships it from there alone
+	if err := store.SetReservationStrategy(types.ReserveNearest); err != nil {
+		t.Fatalf("Failed to set strategy: %v", err)
+	}
+	nearOrder := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 2, nearOrder, &types.UserAddress{Country: "US", StateProvince: "NY"}); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+
+	// 6 units fit in neither warehouse
+	splitOrder := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 6, splitOrder, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+	if err := store.CommitReservation(splitOrder); err != nil {
+		t.Fatalf("Failed to commit reservation: %v", err)
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	available := make(map[int]int)
+	for _, stock := range level.Warehouses {
+		available[stock.WarehouseID] = stock.Available
+	}
+	if available[mainWarehouse] != 0 || available[eastWarehouse] != 0 || level.OnHand != 2 || level.Held != 2 {
+		t.Errorf("Expected both warehouses to be drained with 2 units held in the east one, got %+v", level)
+	}
+
+	expectedError := fmt.Sprintf("insufficient stock for product %d: available 0, requested 1", productID)
+	if err := store.ReserveStock(productID, 1, createTestOrder(t, db, userID, 99.99), nil); err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+}
+
+// Test that a backorder product sells beyond its stock up to the limit and
+// incoming stock fills the oldest backorders first
+func TestBackorders(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	addInitialStock(t, store, productID, 2)
+
+	limit := 3
+	if err := store.SetStockPolicy(types.StockPolicy{ProductID: productID, Policy: types.StockPolicyBackorder, Limit: &limit}); err != nil {
+		t.Fatalf("Failed to set stock policy: %v", err)
+	}
+
+	// 2 units come from stock, 2 are backordered
+	firstOrder := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 4, firstOrder, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+
+	// only 1 unit of the limit is left
+	expectedError := fmt.Sprintf("insufficient stock for product %d: available 0, requested 2", productID)
+	if err := store.ReserveStock(productID, 2, createTestOrder(t, db, userID, 99.99), nil); err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+
+	secondOrder := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 1, secondOrder, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+
+	for _, orderID := range []int{firstOrder, secondOrder} {
+		if err := store.CommitReservation(orderID); err != nil {
+			t.Fatalf("Failed to commit reservation: %v", err)
+		}
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != -3 || level.Available != -3 {
+		t.Errorf("Expected the ledger to owe 3 units, got %+v", level)
+	}
+
+	// 2 incoming units fill the first order's backorder, the second one waits
+	addInitialStock(t, store, productID, 2)
+
+	open := types.BackorderStatusOpen
+	backorders, err := store.GetBackorders(&open)
+	if err != nil {
+		t.Fatalf("Failed to get backorders: %v", err)
+	}
+	if len(backorders) != 1 || backorders[0].OrderID != secondOrder || backorders[0].Allocated != 0 {
+		t.Errorf("Expected only the second order to wait for stock, got %+v", backorders)
+	}
+
+	// a unit found in the warehouse fills the second one like a delivery would
+	if err := store.AdjustStock(productID, nil, 1, types.AdjustmentFound, "Found on the shelf"); err != nil {
+		t.Fatalf("Failed to adjust stock: %v", err)
+	}
+	backorders, err = store.GetBackorders(&open)
+	if err != nil {
+		t.Fatalf("Failed to get backorders: %v", err)
+	}
+	if len(backorders) != 0 {
+		t.Errorf("Expected no backorder to wait for stock, got %+v", backorders)
+	}
+
+	addInitialStock(t, store, productID, 5)
+
+	allocated := types.BackorderStatusAllocated
+	backorders, err = store.GetBackorders(&allocated)
+	if err != nil {
+		t.Fatalf("Failed to get backorders: %v", err)
+	}
+	if len(backorders) != 2 || backorders[0].OrderID != firstOrder || backorders[0].Quantity != 2 || backorders[1].AllocatedAt == nil {
+		t.Errorf("Expected both backorders to be allocated, got %+v", backorders)
+	}
+
+	level, err = store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != 5 || level.Available != 5 {
+		t.Errorf("Expected 5 units left once the backorders are filled, got %+v", level)
+	}
+}
+
+// Test that cancelling a paid order puts its stock back into the warehouse and lot
+// it was taken from, and cancels its backorders instead of creating stock
+func TestReverseCommittedReservation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	backorderedProduct, _ := setupTestData(t, db)
+	eastWarehouse := createTestWarehouse(t, db, "EAST", "US", "NY", 10)
+
+	expiresAt := time.Now().Truncate(24*time.Hour).AddDate(0, 0, 30)
+	lot := &types.LotInfo{LotNumber: "L1", ExpiresAt: &expiresAt}
+	if err := store.AddStock(productID, &eastWarehouse, 3, nil, lot, "East stock", types.RefTypeRestock, nil); err != nil {
+		t.Fatalf("Failed to add stock: %v", err)
+	}
+	limit := 5
+	if err := store.SetStockPolicy(types.StockPolicy{ProductID: backorderedProduct, Policy: types.StockPolicyBackorder, Limit: &limit}); err != nil {
+		t.Fatalf("Failed to set stock policy: %v", err)
+	}
+
+	orderID := createTestOrder(t, db, userID, 99.99)
+	lines := []types.CartItem{{ProductID: productID, Quantity: 2}, {ProductID: backorderedProduct, Quantity: 1}}
+	if err := store.ReserveStockLines(orderID, lines, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+	if err := store.CommitReservation(orderID); err != nil {
+		t.Fatalf("Failed to commit reservation: %v", err)
+	}
+
+	// reversing twice must not put the stock back twice
+	for i := 0; i < 2; i++ {
+		if err := store.ReverseCommittedReservation(orderID); err != nil {
+			t.Fatalf("Failed to reverse reservation: %v", err)
+		}
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	onHand := make(map[int]int)
+	for _, stock := range level.Warehouses {
+		onHand[stock.WarehouseID] = stock.OnHand
+	}
+	if onHand[eastWarehouse] != 3 || level.OnHand != 3 {
+		t.Errorf("Expected all 3 units back in the east warehouse, got %+v", level)
+	}
+
+	lots, err := store.GetProductLots(productID)
+	if err != nil {
+		t.Fatalf("Failed to get lots: %v", err)
+	}
+	if len(lots) != 1 || lots[0].LotNumber != "L1" || lots[0].Quantity != 3 {
+		t.Errorf("Expected the units back in lot L1, got %+v", lots)
+	}
+
+	level, err = store.GetStockLevel(backorderedProduct)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	if level.OnHand != 0 {
+		t.Errorf("Expected the backordered unit not to create stock, got %+v", level)
+	}
+
+	cancelled := types.BackorderStatusCancelled
+	backorders, err := store.GetBackorders(&cancelled)
+	if err != nil {
+		t.Fatalf("Failed to get backorders: %v", err)
+	}
+	if len(backorders) != 1 || backorders[0].OrderID != orderID {
+		t.Errorf("Expected the backorder of the order to be cancelled, got %+v", backorders)
+	}
+}
+
+// Test that returned goods go back to the warehouse and lot they were shipped from
+func TestRestockReturn(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	productID, userID := setupTestData(t, db)
+	eastWarehouse := createTestWarehouse(t, db, "EAST", "US", "NY", 10)
+
+	expiresAt := time.Now().Truncate(24*time.Hour).AddDate(0, 0, 30)
+	lot := &types.LotInfo{LotNumber: "L1", ExpiresAt: &expiresAt}
+	if err := store.AddStock(productID, &eastWarehouse, 3, nil, lot, "East stock", types.RefTypeRestock, nil); err != nil {
+		t.Fatalf("Failed to add stock: %v", err)
+	}
+
+	orderID := createTestOrder(t, db, userID, 99.99)
+	if err := store.ReserveStock(productID, 2, orderID, nil); err != nil {
+		t.Fatalf("Failed to reserve stock: %v", err)
+	}
+	if err := store.CommitReservation(orderID); err != nil {
+		t.Fatalf("Failed to commit reservation: %v", err)
+	}
+
+	// two returns, the first one restocked twice as a retry would, the
+	// second one claims more than the order shipped
+	for i := 0; i < 2; i++ {
+		if err := store.RestockReturn(orderID, productID, 1, nil, "Return #1", 1); err != nil {
+			t.Fatalf("Failed to restock return: %v", err)
+		}
+	}
+	if err := store.RestockReturn(orderID, productID, 2, nil, "Return #2", 2); err != nil {
+		t.Fatalf("Failed to restock return: %v", err)
+	}
+
+	level, err := store.GetStockLevel(productID)
+	if err != nil {
+		t.Fatalf("Failed to get stock level: %v", err)
+	}
+	onHand := make(map[int]int)
+	for _, stock := range level.Warehouses {
+		onHand[stock.WarehouseID] = stock.OnHand
+	}
+	if onHand[eastWarehouse] != 3 || level.OnHand != 4 {
+		t.Errorf("Expected the 2 shipped units back in the east warehouse and 1 more in the default one, got %+v", level)
+	}
+
+	lots, err := store.GetProductLots(productID)
+	if err != nil {
+		t.Fatalf("Failed to get lots: %v", err)
+	}
+	if len(lots) != 1 || lots[0].LotNumber != "L1" || lots[0].Quantity != 3 {
+		t.Errorf("Expected the shipped units back in lot L1, got %+v", lots)
+	}
+}
+
+type recordingNotifier struct {
+	events []types.StockEvent
+}
+
+func (n *recordingNotifier) Notify(event types.StockEvent) error {
+	n.events = append(n.events, event)
+	return nil
+}
+
+// Test that crossing the reorder threshold raises one alert per transition
+func TestStockAlerts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	notifier := &recordingNotifier{}
+	store.SetNotifier(notifier)
+	productID, userID := setupTestData(t, db)
+	addInitialStock(t, store, productID, 10)
+
+	if err := store.SetReorderThreshold(productID, 5); err != nil {
+		t.Fatalf("Failed to set threshold: %v", err)
+	}
+
+	// 10 -> 6 stays above the threshold, 6 -> 4 and 4 -> 3 are low once, 3 -> 0 is out
+	for _, quantity := range []int{4, 2, 1, 3} {
+		if err := store.ReserveStock(productID, quantity, createTestOrder(t, db, userID, 99.99), nil); err != nil {
+			t.Fatalf("Failed to reserve stock: %v", err)
+		}
+	}
+
+	if len(notifier.events) != 2 || notifier.events[0].Type != types.StockEventLowStock || notifier.events[1].Type != types.StockEventOutOfStock {
+		t.Fatalf("Expected a low stock then an out of stock event, got %+v", notifier.events)
+	}
+	if notifier.events[0].Available != 4 || notifier.events[0].ReorderLevel != 5 {
+		t.Errorf("Expected the low stock event at 4 available, got %+v", notifier.events[0])
+	}
+
+	alerts, err := store.GetStockAlerts()
+	if err != nil {
+		t.Fatalf("Failed to get alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].State != types.StockAlertOutOfStock || alerts[0].Available != 0 {
+		t.Errorf("Expected the product to be listed as out of stock, got %+v", alerts)
+	}
+
+	// restocking clears the alert, so the next drop alerts again
+	addInitialStock(t, store, productID, 10)
+	alerts, err = store.GetStockAlerts()
+	if err != nil {
+		t.Fatalf("Failed to get alerts: %v", err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Expected no alerts after restocking, got %+v", alerts)
+	}
+}
+
+// Test that back-in-stock subscriptions fire once when stock comes back
+func TestBackInStockSubscription(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewStore(db)
+	notifier := &recordingNotifier{}
+	store.SetNotifier(notifier)
+	productID, userID := setupTestData(t, db)
+	addInitialStock(t, store, productID, 1)
+
+	expectedError := fmt.Sprintf("product %d is in stock", productID)
+	if _, err := store.Subscribe(productID, userID); err == nil || err.Error() != expectedError {
+		t.Errorf("Expected error '%s', got '%v'", expectedError, err)
+	}
+
+	if err := store.AdjustStock(productID, nil, -1, types.AdjustmentDamaged, ""); err != nil {
+		t.Fatalf("Failed to write off stock: %v", err)
+	}
+	subscription, err := store.Subscribe(productID, userID)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if subscription.Status != types.SubscriptionActive {
+		t.Errorf("Expected an active subscription, got %s", subscription.Status)
+	}
+
+	notifier.events = nil
+	addInitialStock(t, store, productID, 3)
+	addInitialStock(t, store, productID, 2)
+
+	var backInStock []types.StockEvent
+	for _, event := range notifier.events {
+		if event.Type == types.StockEventBackInStock {
+			backInStock = append(backInStock, event)
+		}
+	}
+	if len(backInStock) != 1 || backInStock[0].UserID != userID || backInStock[0].Available != 3 || backInStock[0].Email == "" {
+		t.Errorf("Expected one back in stock event for user %d at 3 available, got %+v", userID, backInStock)
+	}
+
+	if err := store.Unsubscribe(productID, userID); err == nil || err.Error() != "subscription not found" {
+		t.Errorf("Expected a notified subscription to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package inventory
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// sweepBatchSize bounds the holds expired per store call
+const sweepBatchSize = 100
+
+// HoldSweeper periodically expires stale stock holds and cancels the pending
+// orders they belonged to
+type HoldSweeper struct {
+	store      types.InventoryStore
+	orderStore types.OrderStore
+	interval   time.Duration
+}
+
+func NewHoldSweeper(store types.InventoryStore, orderStore types.OrderStore, interval time.Duration) *HoldSweeper {
+	return &HoldSweeper{store: store, orderStore: orderStore, interval: interval}
+}
+
+// Run sweeps every interval until the context is cancelled
+func (s *HoldSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if cancelled, err := s.Sweep(); err != nil {
+				log.Printf("stock hold sweep failed: %v", err)
+			} else if cancelled > 0 {
+				log.Printf("stock hold sweep cancelled %d unpaid orders", cancelled)
+			}
+		}
+	}
+}
+
+// Sweep expires all stale holds and returns the number of orders cancelled
+func (s *HoldSweeper) Sweep() (int, error) {
+	cancelled := 0
+	for {
+		orderIDs, err := s.store.ExpireHolds(sweepBatchSize)
+		if err != nil {
+			return cancelled, err
+		}
+		if len(orderIDs) == 0 {
+			return cancelled, nil
+		}
+
+		for _, orderID := range orderIDs {
+			// the order may have been cancelled or paid meanwhile, then there is nothing to do
+			if err := s.orderStore.UpdateOrderStatus(orderID, types.OrderStatusPending, types.OrderStatusCancelled); err == nil {
+				cancelled++
+			}
+
+			// other holds of the order may not have expired yet
+			if err := s.store.ReleaseReservation(orderID); err != nil {
+				log.Printf("failed to release stock reservation of order %d: %v", orderID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package inventory
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// SetValuationMethod задаёт метод оценки себестоимости при резервировании и в отчётах
+func (s *Store) SetValuationMethod(method types.ValuationMethod) error {
+	switch method {
+	case types.ValuationFIFO, types.ValuationAverage:
+		s.valuation = method
+		return nil
+	default:
+		return fmt.Errorf("unknown valuation method %q, must be one of: fifo, average", method)
+	}
+}
+
+// applyMovementCost ведёт стоимость запасов по движению: приход открывает слой
+// FIFO и пересчитывает среднюю себестоимость, расход списывает самые старые слои
+// (средняя при расходе не меняется). Стоимость считается по товару в целом,
+// поэтому перемещения между складами её не трогают.
+func applyMovementCost(tx *sql.Tx, movement types.InventoryMovement, movementID int64) error {
+	if movement.ReferenceType != nil && *movement.ReferenceType == types.RefTypeTransfer {
+		return nil
+	}
+
+	quantity, average, err := lockProductCost(tx, movement.ProductID)
+	if err != nil {
+		return err
+	}
+
+	if movement.MovementType == types.MovementTypeOut {
+		if err := consumeCostLayers(tx, movement.ProductID, movement.Quantity); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"UPDATE product_costs SET quantity = GREATEST(CAST(quantity AS SIGNED) - ?, 0) WHERE product_id = ?",
+			movement.Quantity, movement.ProductID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update product cost: %w", err)
+		}
+		return nil
+	}
+
+	// Приход без цены (возврат без известной себестоимости, найденный товар)
+	// оценивается по текущей средней
+	unitCost := average
+	if movement.UnitCost != nil {
+		unitCost = *movement.UnitCost
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO cost_layers (product_id, movement_id, unit_cost, quantity_remaining) VALUES (?, ?, ?, ?)",
+		movement.ProductID, movementID, unitCost, movement.Quantity,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add cost layer: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"UPDATE product_costs SET quantity = ?, average_cost = ? WHERE product_id = ?",
+		quantity+movement.Quantity, weightedAverage(average, quantity, unitCost, movement.Quantity), movement.ProductID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update product cost: %w", err)
+	}
+
+	return nil
+}
+
+// lockProductCost блокирует строку себестоимости товара до конца транзакции и
+// возвращает оценённое количество и среднюю себестоимость. Пока строка
+// заблокирована, слои FIFO товара меняет только эта транзакция.
+func lockProductCost(tx *sql.Tx, productID int) (int, types.Money, error) {
+	_, err := tx.Exec("INSERT IGNORE INTO product_costs (product_id) VALUES (?)", productID)
+	if err != nil {
+		return 0, types.Money{}, fmt.Errorf("failed to create product cost: %w", err)
+	}
+
+	var quantity int
+	var average types.Money
+	err = tx.QueryRow("SELECT quantity, average_cost FROM product_costs WHERE product_id = ? FOR UPDATE", productID).
+		Scan(&quantity, &average)
+	if err != nil {
+		return 0, types.Money{}, fmt.Errorf("failed to lock product cost: %w", err)
+	}
+
+	return quantity, average, nil
+}
+
+// consumeCostLayers списывает quantity единиц со слоёв товара, начиная с самого старого
+func consumeCostLayers(tx *sql.Tx, productID, quantity int) error {
+	layers, err := openCostLayers(tx, productID, true)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range layers {
+		if quantity == 0 {
+			break
+		}
+		take := min(layer.remaining, quantity)
+		_, err := tx.Exec("UPDATE cost_layers SET quantity_remaining = quantity_remaining - ? WHERE id = ?", take, layer.id)
+		if err != nil {
+			return fmt.Errorf("failed to consume cost layer: %w", err)
+		}
+		quantity -= take
+	}
+
+	return nil
+}
+
+// openCostLayers читает слои товара с остатком, от старых к новым
+func openCostLayers(tx *sql.Tx, productID int, forUpdate bool) ([]costLayer, error) {
+	query := `
+		SELECT id, unit_cost, quantity_remaining
+		FROM cost_layers
+		WHERE product_id = ? AND quantity_remaining > 0
+		ORDER BY id
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	rows, err := tx.Query(query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cost layers: %w", err)
+	}
+	defer rows.Close()
+
+	var layers []costLayer
+	for rows.Next() {
+		var layer costLayer
+		if err := rows.Scan(&layer.id, &layer.unitCost, &layer.remaining); err != nil {
+			return nil, fmt.Errorf("failed to scan cost layer: %w", err)
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, rows.Err()
+}
+
+// reservationUnitCost оценивает себестоимость единицы резервируемого товара.
+// По FIFO единицы под уже активными холдами спишутся раньше, поэтому их слои пропускаются.
+// Вызывается под блокировкой балансов товара, до создания новых холдов.
+func (s *Store) reservationUnitCost(tx *sql.Tx, productID, quantity int) (types.Money, error) {
+	var average types.Money
+	err := tx.QueryRow("SELECT average_cost FROM product_costs WHERE product_id = ?", productID).Scan(&average)
+	if err != nil && err != sql.ErrNoRows {
+		return types.Money{}, fmt.Errorf("failed to get product cost: %w", err)
+	}
+	if err == sql.ErrNoRows {
+		average = types.NewMoney(0, types.DefaultCurrency)
+	}
+
+	if s.valuation == types.ValuationAverage {
+		return average, nil
+	}
+
+	var held int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM stock_holds
+		WHERE product_id = ? AND status = 'ACTIVE' AND expires_at > NOW()
+	`, productID).Scan(&held)
+	if err != nil {
+		return types.Money{}, fmt.Errorf("failed to get held stock: %w", err)
+	}
+
+	layers, err := openCostLayers(tx, productID, false)
+	if err != nil {
+		return types.Money{}, err
+	}
+
+	return fifoUnitCost(layers, held, quantity, average), nil
+}
+
+// ValuationMethod возвращает метод оценки, заданный для магазина
+func (s *Store) ValuationMethod() types.ValuationMethod {
+	return s.valuation
+}
+
+// GetStockValuation оценивает остатки каждого товара на складах указанным методом
+func (s *Store) GetStockValuation(method types.ValuationMethod) ([]types.ProductValuation, error) {
+	rows, err := s.db.Query(`
+		SELECT p.id, p.name, sl.on_hand, COALESCE(pc.average_cost, 0),
+		       COALESCE(cl.quantity, 0), COALESCE(cl.value, 0)
+		FROM (
+			SELECT product_id, SUM(on_hand) AS on_hand
+			FROM stock_levels
+			GROUP BY product_id
+			HAVING SUM(on_hand) > 0
+		) sl
+		JOIN products p ON p.id = sl.product_id
+		LEFT JOIN product_costs pc ON pc.product_id = sl.product_id
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity_remaining) AS quantity, SUM(quantity_remaining * unit_cost) AS value
+			FROM cost_layers
+			WHERE quantity_remaining > 0
+			GROUP BY product_id
+		) cl ON cl.product_id = sl.product_id
+		ORDER BY p.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock valuation: %w", err)
+	}
+	defer rows.Close()
+
+	valuations := []types.ProductValuation{}
+	for rows.Next() {
+		var valuation types.ProductValuation
+		var average, layeredValue types.Money
+		var layeredQuantity int
+		err := rows.Scan(&valuation.ProductID, &valuation.ProductName, &valuation.OnHand, &average,
+			&layeredQuantity, &layeredValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stock valuation: %w", err)
+		}
+
+		valuation.Value = stockValue(method, valuation.OnHand, average, layeredQuantity, layeredValue)
+		valuation.UnitCost = valuation.Value.MulDiv(1, int64(valuation.OnHand))
+		valuations = append(valuations, valuation)
+	}
+
+	return valuations, rows.Err()
+}
+
+// GetOrderMargins считает валовую маржу оплаченных и выполненных заказов за период.
+// Выручка — сумма без налога и доставки, пересчитанная в базовую валюту по курсу заказа.
+func (s *Store) GetOrderMargins(from, to *time.Time) ([]types.OrderMargin, error) {
+	conditions := []string{"o.status IN (?, ?, ?)"}
+	args := []any{types.OrderStatusPaid, types.OrderStatusPartiallyShipped, types.OrderStatusCompleted}
+	if from != nil {
+		conditions = append(conditions, "o.createdAt >= ?")
+		args = append(args, *from)
+	}
+	if to != nil {
+		conditions = append(conditions, "o.createdAt <= ?")
+		args = append(args, *to)
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT o.id, o.createdAt, o.subtotal, o.exchange_rate,
+		       COALESCE(SUM(oi.quantity * oi.unit_cost), 0), COALESCE(SUM(oi.unit_cost IS NULL), 0)
+		FROM orders o
+		LEFT JOIN order_items oi ON oi.orderId = o.id
+		WHERE %s
+		GROUP BY o.id
+		ORDER BY o.createdAt, o.id
+	`, strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order margins: %w", err)
+	}
+	defer rows.Close()
+
+	margins := []types.OrderMargin{}
+	for rows.Next() {
+		var margin types.OrderMargin
+		var subtotal types.Money
+		var exchangeRate types.Rate
+		err := rows.Scan(&margin.OrderID, &margin.CreatedAt, &subtotal, &exchangeRate, &margin.Cost, &margin.UncostedItems)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order margin: %w", err)
+		}
+
+		margin.Revenue = toBaseCurrency(subtotal, exchangeRate)
+		margin.Margin, margin.MarginPercent = grossMargin(margin.Revenue, margin.Cost)
+		margins = append(margins, margin)
+	}
+
+	return margins, rows.Err()
+}
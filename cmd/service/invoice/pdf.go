@@ -0,0 +1,259 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pageWidth is the width of the printable area of an A4 page with 15mm margins
+const pageWidth = 180.0
+
+// document is an A4 page layout shared by invoices and packing slips. It uses
+// the built-in Helvetica, so text is translated to its cp1252 encoding.
+type document struct {
+	pdf *gofpdf.Fpdf
+	tr  func(string) string
+}
+
+func newDocument(title string, created time.Time) *document {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetTitle(title, false)
+	pdf.SetCreator("go_rest_tut", false)
+	// a fixed creation date and catalog order make the same input render the same bytes
+	pdf.SetCreationDate(created)
+	pdf.SetCatalogSort(true)
+	pdf.AddPage()
+
+	return &document{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+}
+
+func (d *document) font(style string, size float64) {
+	d.pdf.SetFont("Helvetica", style, size)
+}
+
+// text writes a line of text and moves to the next line
+func (d *document) text(s string) {
+	d.pdf.CellFormat(0, 5, d.tr(s), "", 1, "L", false, 0, "")
+}
+
+// block writes the title, if any, and the lines of a block of text such as an
+// address at x, y with the given width, and returns where it ends
+func (d *document) block(x, y, width float64, title string, lines []string) float64 {
+	d.pdf.SetXY(x, y)
+	if title != "" {
+		d.font("B", 9)
+		d.pdf.CellFormat(width, 5, d.tr(title), "", 2, "L", false, 0, "")
+	}
+	d.font("", 9)
+	for _, line := range lines {
+		d.pdf.MultiCell(width, 4.5, d.tr(line), "", "L", false)
+		d.pdf.SetX(x)
+	}
+	return d.pdf.GetY()
+}
+
+// tableColumn is a column of a line item table
+type tableColumn struct {
+	title string
+	width float64
+	align string
+}
+
+func (d *document) tableHeader(columns []tableColumn) {
+	d.font("B", 8)
+	d.pdf.SetFillColor(235, 235, 235)
+	for _, column := range columns {
+		d.pdf.CellFormat(column.width, 6, d.tr(column.title), "B", 0, column.align, true, 0, "")
+	}
+	d.pdf.Ln(-1)
+	d.font("", 8)
+}
+
+func (d *document) tableRow(columns []tableColumn, values []string) {
+	// long descriptions are cut to the column rather than wrapped
+	for i, column := range columns {
+		value := d.tr(values[i])
+		for value != "" && d.pdf.GetStringWidth(value) > column.width-2 {
+			value = value[:len(value)-1]
+		}
+		d.pdf.CellFormat(column.width, 5.5, value, "", 0, column.align, false, 0, "")
+	}
+	d.pdf.Ln(-1)
+}
+
+// totalRow writes a label and an amount aligned to the right of the page
+func (d *document) totalRow(label, amount string, bold bool) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	d.font(style, 9)
+	d.pdf.CellFormat(pageWidth-35, 6, d.tr(label), "", 0, "R", false, 0, "")
+	d.pdf.CellFormat(35, 6, d.tr(amount), "", 1, "R", false, 0, "")
+}
+
+func (d *document) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addressLines lays out an order address, or the formatted address of orders
+// placed before addresses were kept in full
+func addressLines(address *types.OrderAddress, fallback string) []string {
+	if address == nil {
+		return []string{fallback}
+	}
+
+	name := strings.TrimSpace(strings.Join([]string{address.Title, address.FirstName, address.LastName}, " "))
+	lines := []string{name}
+	if address.Company != nil && *address.Company != "" {
+		lines = append(lines, *address.Company)
+	}
+	lines = append(lines, address.AddressLine1)
+	if address.AddressLine2 != nil && *address.AddressLine2 != "" {
+		lines = append(lines, *address.AddressLine2)
+	}
+	lines = append(lines,
+		strings.TrimSpace(address.PostalCode+" "+address.City),
+		strings.Trim(strings.Join([]string{address.StateProvince, address.Country}, ", "), ", "),
+	)
+	if address.Phone != nil && *address.Phone != "" {
+		lines = append(lines, *address.Phone)
+	}
+	return lines
+}
+
+func sellerLines(seller types.InvoiceSeller) []string {
+	var lines []string
+	if seller.Address != "" {
+		lines = append(lines, seller.Address)
+	}
+	if seller.TaxID != "" {
+		lines = append(lines, "Tax ID: "+seller.TaxID)
+	}
+	if seller.Email != "" {
+		lines = append(lines, seller.Email)
+	}
+	return lines
+}
+
+var invoiceColumns = []tableColumn{
+	{"SKU", 25, "L"},
+	{"Description", 73, "L"},
+	{"Qty", 12, "R"},
+	{"Unit price", 22, "R"},
+	{"Tax rate", 14, "R"},
+	{"Tax", 16, "R"},
+	{"Total", 18, "R"},
+}
+
+// renderInvoice lays out the invoice of an order as a PDF
+func renderInvoice(invoice types.Invoice, seller types.InvoiceSeller, order types.OrderWithItems) ([]byte, error) {
+	d := newDocument("Invoice "+invoice.Number, invoice.IssuedAt)
+
+	d.font("B", 16)
+	d.text(seller.Name)
+	top := d.block(15, d.pdf.GetY(), 100, "", sellerLines(seller))
+
+	d.pdf.SetXY(125, 15)
+	d.font("B", 16)
+	d.pdf.CellFormat(70, 8, "INVOICE", "", 2, "R", false, 0, "")
+	d.font("", 9)
+	for _, line := range []string{
+		"Number: " + invoice.Number,
+		"Date: " + invoice.IssuedAt.Format("2006-01-02"),
+		fmt.Sprintf("Order: #%d of %s", order.ID, order.CreatedAt.UTC().Format("2006-01-02")),
+	} {
+		d.pdf.CellFormat(70, 5, d.tr(line), "", 2, "R", false, 0, "")
+	}
+
+	billing := order.BillingAddress
+	if billing == nil {
+		billing = order.ShippingAddress
+	}
+	y := max(top, d.pdf.GetY()) + 8
+	end := d.block(15, y, 85, "Bill to", addressLines(billing, order.Address))
+	end = max(end, d.block(110, y, 85, "Ship to", addressLines(order.ShippingAddress, order.Address)))
+	d.pdf.SetXY(15, end+8)
+
+	d.tableHeader(invoiceColumns)
+	for _, item := range order.Items {
+		d.tableRow(invoiceColumns, []string{
+			item.ProductSKU,
+			item.ProductName,
+			strconv.Itoa(item.Quantity),
+			item.Price.String(),
+			formatTaxRate(item.TaxRate),
+			item.Tax.String(),
+			item.Total.String(),
+		})
+		for _, component := range item.Components {
+			d.tableRow(invoiceColumns, []string{
+				component.ProductSKU, fmt.Sprintf("  %d x %s", component.Quantity, component.ProductName), "", "", "", "", "",
+			})
+		}
+	}
+	d.pdf.Ln(4)
+
+	d.totalRow("Subtotal", formatAmount(invoice.Subtotal), false)
+	if !invoice.ShippingCost.IsZero() {
+		d.totalRow("Shipping", formatAmount(invoice.ShippingCost), false)
+	}
+	for _, tax := range invoiceTaxSummary(order) {
+		d.totalRow(fmt.Sprintf("Tax %s on %s", formatTaxRate(tax.Rate), formatAmount(tax.Net)), formatAmount(tax.Tax), false)
+	}
+	d.totalRow("Total", formatAmount(invoice.Total), true)
+
+	return d.bytes()
+}
+
+var packingSlipColumns = []tableColumn{
+	{"SKU", 35, "L"},
+	{"Description", 115, "L"},
+	{"Qty", 15, "R"},
+	{"Packed", 15, "C"},
+}
+
+// renderPackingSlip lays out the packing slip of an order as a PDF: what to
+// pick and where to send it, without prices
+func renderPackingSlip(order types.OrderWithItems, seller types.InvoiceSeller, created time.Time) ([]byte, error) {
+	d := newDocument(fmt.Sprintf("Packing slip for order %d", order.ID), created)
+
+	d.font("B", 16)
+	d.text("Packing slip")
+	d.font("", 9)
+	d.text(fmt.Sprintf("Order #%d of %s", order.ID, order.CreatedAt.UTC().Format("2006-01-02")))
+
+	y := d.pdf.GetY() + 6
+	end := d.block(15, y, 85, "From", append([]string{seller.Name}, sellerLines(seller)...))
+	end = max(end, d.block(110, y, 85, "Ship to", addressLines(order.ShippingAddress, order.Address)))
+	d.pdf.SetXY(15, end+8)
+
+	d.tableHeader(packingSlipColumns)
+	units := 0
+	for _, item := range order.Items {
+		units += item.Quantity
+		d.tableRow(packingSlipColumns, []string{item.ProductSKU, item.ProductName, strconv.Itoa(item.Quantity), "[  ]"})
+		for _, component := range item.Components {
+			d.tableRow(packingSlipColumns, []string{
+				component.ProductSKU, "  " + component.ProductName, strconv.Itoa(component.Quantity), "[  ]",
+			})
+		}
+	}
+	d.pdf.Ln(4)
+	d.font("B", 9)
+	d.text(fmt.Sprintf("%d items, %d units", len(order.Items), units))
+
+	return d.bytes()
+}
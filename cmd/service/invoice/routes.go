@@ -0,0 +1,133 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store      types.InvoiceStore
+	orderStore types.OrderStore
+	userStore  types.UserStore
+	seller     types.InvoiceSeller
+}
+
+func NewHandler(store types.InvoiceStore, orderStore types.OrderStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, orderStore: orderStore, userStore: userStore}
+}
+
+// SetSeller sets the business named on new invoices and on packing slips
+func (h *Handler) SetSeller(seller types.InvoiceSeller) {
+	h.seller = seller
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Customers get the invoices of their own orders
+	router.HandleFunc("/orders/{id}/invoice.pdf", auth.WithJWTAuth(h.handleGetInvoice, h.userStore)).Methods(http.MethodGet)
+
+	// Staff print packing slips for any order
+	router.HandleFunc("/admin/orders/{id}/packing-slip.pdf", auth.WithAdminAuth(h.handleGetPackingSlip, h.userStore)).Methods(http.MethodGet)
+}
+
+// GET /api/v1/orders/{id}/invoice.pdf - get the invoice of an order, issuing
+// it the first time it is asked for
+func (h *Handler) handleGetInvoice(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	order, err := h.orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		if err.Error() == "order not found or not owned by user" {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	invoice, err := h.store.GetInvoice(order.ID)
+	if err != nil {
+		if err.Error() != "invoice not found" {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := checkInvoiceable(*order); err != nil {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+
+		invoice, err = h.issueInvoice(*order)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	writePDF(w, r, fmt.Sprintf("invoice-%s.pdf", invoice.Number), invoice.IssuedAt, invoice.PDF)
+}
+
+// issueInvoice issues the invoice of a paid order. When another request issued
+// it first, that invoice is returned.
+func (h *Handler) issueInvoice(order types.OrderWithItems) (*types.Invoice, error) {
+	invoice := newInvoice(order, time.Now())
+	err := h.store.IssueInvoice(&invoice, func(invoice types.Invoice) ([]byte, error) {
+		return renderInvoice(invoice, h.seller, order)
+	})
+	if err != nil {
+		if err.Error() == "invoice already issued" {
+			return h.store.GetInvoice(order.ID)
+		}
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// GET /api/v1/admin/orders/{id}/packing-slip.pdf - get the packing slip of any order
+func (h *Handler) handleGetPackingSlip(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	order, err := h.orderStore.GetOrder(orderID)
+	if err != nil {
+		if err.Error() == "order not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	pdf, err := renderPackingSlip(*order, h.seller, now)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to render packing slip: %w", err))
+		return
+	}
+
+	writePDF(w, r, fmt.Sprintf("packing-slip-%d.pdf", order.ID), now, pdf)
+}
+
+// writePDF sends a PDF document as a download
+func writePDF(w http.ResponseWriter, r *http.Request, filename string, modified time.Time, pdf []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	http.ServeContent(w, r, "", modified, bytes.NewReader(pdf))
+}
@@ -0,0 +1,81 @@
+package invoice
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// formatInvoiceNumber makes the number of the nth invoice of a year, e.g. INV-2026-000042
+func formatInvoiceNumber(prefix string, year, n int) string {
+	return fmt.Sprintf("%s-%d-%06d", prefix, year, n)
+}
+
+// invoicedStatuses lists the statuses of orders that were paid for, and so
+// can be invoiced. A refunded order keeps its invoice, refunds don't undo it.
+var invoicedStatuses = []string{
+	types.OrderStatusPaid,
+	types.OrderStatusPartiallyShipped,
+	types.OrderStatusCompleted,
+	types.OrderStatusRefunded,
+}
+
+// checkInvoiceable tells whether an invoice can be issued for an order
+func checkInvoiceable(order types.OrderWithItems) error {
+	if !slices.Contains(invoicedStatuses, order.Status) {
+		return fmt.Errorf("order is %s, only paid orders can be invoiced", order.Status)
+	}
+	return nil
+}
+
+// newInvoice starts the invoice of an order, to be numbered when issued
+func newInvoice(order types.OrderWithItems, issuedAt time.Time) types.Invoice {
+	return types.Invoice{
+		OrderID:      order.ID,
+		Currency:     order.Currency,
+		Subtotal:     order.Subtotal,
+		Tax:          order.Tax,
+		ShippingCost: order.ShippingCost,
+		Total:        order.Total,
+		IssuedAt:     issuedAt.UTC().Truncate(time.Second),
+	}
+}
+
+// invoiceTax is the tax charged at one rate
+type invoiceTax struct {
+	Rate types.Rate
+	Net  types.Money // the lines taxed at the rate
+	Tax  types.Money
+}
+
+// invoiceTaxSummary totals the lines of an order by tax rate, lowest rate first
+func invoiceTaxSummary(order types.OrderWithItems) []invoiceTax {
+	var summary []invoiceTax
+	for _, item := range order.Items {
+		i := slices.IndexFunc(summary, func(tax invoiceTax) bool { return tax.Rate == item.TaxRate })
+		if i < 0 {
+			summary = append(summary, invoiceTax{Rate: item.TaxRate, Net: item.Subtotal, Tax: item.Tax})
+			continue
+		}
+		summary[i].Net = summary[i].Net.Add(item.Subtotal)
+		summary[i].Tax = summary[i].Tax.Add(item.Tax)
+	}
+
+	slices.SortFunc(summary, func(a, b invoiceTax) int {
+		return cmp.Compare(a.Rate, b.Rate)
+	})
+	return summary
+}
+
+// formatTaxRate formats a tax rate as a percentage, e.g. 0.0725 as 7.25%
+func formatTaxRate(rate types.Rate) string {
+	return (rate * 100).String() + "%"
+}
+
+// formatAmount formats an amount with its currency, e.g. 12.34 USD
+func formatAmount(m types.Money) string {
+	return m.String() + " " + m.Currency
+}
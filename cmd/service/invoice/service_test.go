@@ -0,0 +1,133 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func testOrder() types.OrderWithItems {
+	usd := func(s string) types.Money { return types.MustParseMoney(s, types.DefaultCurrency) }
+	company := "Analytical Engines Ltd"
+	return types.OrderWithItems{
+		ID:           42,
+		Subtotal:     usd("45.00"),
+		Tax:          usd("4.50"),
+		ShippingCost: usd("5.00"),
+		Total:        usd("54.50"),
+		Currency:     types.DefaultCurrency,
+		Status:       types.OrderStatusPaid,
+		Address:      "Ada Lovelace, 12 St James's Square, London SW1Y 4JH, GB",
+		CreatedAt:    time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC),
+		ShippingAddress: &types.OrderAddress{
+			FirstName:     "Ada",
+			LastName:      "Lovelace",
+			Company:       &company,
+			AddressLine1:  "12 St James's Square",
+			City:          "London",
+			StateProvince: "Westminster",
+			PostalCode:    "SW1Y 4JH",
+			Country:       "GB",
+		},
+		Items: []types.OrderItemWithProduct{
+			{ProductName: "Café crème mug", ProductSKU: "MUG-1", Quantity: 2, Price: usd("10.00"), TaxRate: types.MustParseRate("0.2"),
+				Subtotal: usd("20.00"), Tax: usd("4.00"), Total: usd("24.00")},
+			{ProductName: "Tea gift box", ProductSKU: "BOX-1", Quantity: 1, Price: usd("20.00"), TaxRate: types.MustParseRate("0"),
+				Subtotal: usd("20.00"), Total: usd("20.00"),
+				Components: []types.OrderItemComponent{{ProductName: "Earl Grey", ProductSKU: "TEA-1", Quantity: 2}}},
+			{ProductName: "Spoon", Quantity: 1, Price: usd("2.50"), TaxRate: types.MustParseRate("0.2"),
+				Subtotal: usd("2.50"), Tax: usd("0.50"), Total: usd("3.00")},
+		},
+	}
+}
+
+func TestFormatInvoiceNumber(t *testing.T) {
+	if got := formatInvoiceNumber("INV", 2026, 42); got != "INV-2026-000042" {
+		t.Errorf("Expected INV-2026-000042, got %s", got)
+	}
+}
+
+func TestCheckInvoiceable(t *testing.T) {
+	tests := map[string]bool{
+		types.OrderStatusPending:          false,
+		types.OrderStatusPaid:             true,
+		types.OrderStatusPartiallyShipped: true,
+		types.OrderStatusCompleted:        true,
+		types.OrderStatusCancelled:        false,
+		types.OrderStatusRefunded:         true,
+	}
+	for status, invoiceable := range tests {
+		err := checkInvoiceable(types.OrderWithItems{Status: status})
+		if (err == nil) != invoiceable {
+			t.Errorf("Expected %s orders invoiceable: %v, got %v", status, invoiceable, err)
+		}
+	}
+}
+
+func TestInvoiceTaxSummary(t *testing.T) {
+	summary := invoiceTaxSummary(testOrder())
+	if len(summary) != 2 {
+		t.Fatalf("Expected a line per tax rate, got %+v", summary)
+	}
+
+	if summary[0].Rate != 0 || summary[0].Net.String() != "20.00" || !summary[0].Tax.IsZero() {
+		t.Errorf("Expected 20.00 untaxed first, got %+v", summary[0])
+	}
+	if formatTaxRate(summary[1].Rate) != "20%" || summary[1].Net.String() != "22.50" || summary[1].Tax.String() != "4.50" {
+		t.Errorf("Expected 4.50 tax at 20%% on 22.50, got %+v", summary[1])
+	}
+}
+
+func TestAddressLines(t *testing.T) {
+	order := testOrder()
+
+	lines := addressLines(order.ShippingAddress, order.Address)
+	expected := []string{"Ada Lovelace", "Analytical Engines Ltd", "12 St James's Square", "SW1Y 4JH London", "Westminster, GB"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected line %d to be %q, got %q", i, expected[i], lines[i])
+		}
+	}
+
+	if lines := addressLines(nil, order.Address); len(lines) != 1 || lines[0] != order.Address {
+		t.Errorf("Expected the formatted address of an order without one, got %v", lines)
+	}
+}
+
+func TestRenderInvoice(t *testing.T) {
+	order := testOrder()
+	invoice := newInvoice(order, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	invoice.Number = "INV-2026-000007"
+	seller := types.InvoiceSeller{Name: "Go REST Shop", Address: "1 Market Street, Springfield", TaxID: "GB123456789"}
+
+	pdf, err := renderInvoice(invoice, seller, order)
+	if err != nil {
+		t.Fatalf("Failed to render invoice: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.Contains(pdf, []byte("(Invoice INV-2026-000007)")) {
+		t.Errorf("Expected a PDF titled with the invoice number")
+	}
+
+	again, err := renderInvoice(invoice, seller, order)
+	if err != nil {
+		t.Fatalf("Failed to render invoice: %v", err)
+	}
+	if !bytes.Equal(pdf, again) {
+		t.Errorf("Expected the same invoice to render the same PDF")
+	}
+}
+
+func TestRenderPackingSlip(t *testing.T) {
+	pdf, err := renderPackingSlip(testOrder(), types.InvoiceSeller{Name: "Go REST Shop"}, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to render packing slip: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.Contains(pdf, []byte("(Packing slip for order 42)")) {
+		t.Errorf("Expected a PDF titled with the order")
+	}
+}
@@ -0,0 +1,128 @@
+package invoice
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+type Store struct {
+	db     *sql.DB
+	prefix string // invoice numbers start with it
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db, prefix: "INV"}
+}
+
+// SetNumberPrefix sets the prefix of new invoice numbers
+func (s *Store) SetNumberPrefix(prefix string) {
+	if prefix != "" {
+		s.prefix = prefix
+	}
+}
+
+// IssueInvoice numbers the invoice within the year it is issued and stores it
+// with its PDF. The year's sequence stays locked until the invoice is stored,
+// so numbers follow each other without gaps: a failure gives the number back.
+func (s *Store) IssueInvoice(invoice *types.Invoice, render func(types.Invoice) ([]byte, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	series := invoice.IssuedAt.Year()
+	_, err = tx.Exec(
+		"INSERT INTO invoice_sequences (series) VALUES (?) ON DUPLICATE KEY UPDATE series = series",
+		series,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create invoice sequence: %w", err)
+	}
+
+	var last int
+	err = tx.QueryRow("SELECT last_number FROM invoice_sequences WHERE series = ? FOR UPDATE", series).Scan(&last)
+	if err != nil {
+		return fmt.Errorf("failed to lock invoice sequence: %w", err)
+	}
+
+	// checked under the lock, so two requests can't both invoice the order
+	var issued int
+	err = tx.QueryRow("SELECT COUNT(*) FROM invoices WHERE order_id = ?", invoice.OrderID).Scan(&issued)
+	if err != nil {
+		return fmt.Errorf("failed to check invoice: %w", err)
+	}
+	if issued > 0 {
+		return fmt.Errorf("invoice already issued")
+	}
+
+	invoice.Number = formatInvoiceNumber(s.prefix, series, last+1)
+	pdf, err := render(*invoice)
+	if err != nil {
+		return fmt.Errorf("failed to render invoice: %w", err)
+	}
+	invoice.PDF = pdf
+
+	_, err = tx.Exec("UPDATE invoice_sequences SET last_number = ? WHERE series = ?", last+1, series)
+	if err != nil {
+		return fmt.Errorf("failed to update invoice sequence: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO invoices (order_id, number, currency, subtotal, tax, shipping_cost, total, issued_at, pdf)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, invoice.OrderID, invoice.Number, invoice.Currency, invoice.Subtotal, invoice.Tax, invoice.ShippingCost,
+		invoice.Total, invoice.IssuedAt, invoice.PDF)
+	if err != nil {
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get invoice ID: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	invoice.ID = int(id)
+
+	return nil
+}
+
+// GetInvoice retrieves the invoice of an order with its PDF
+func (s *Store) GetInvoice(orderID int) (*types.Invoice, error) {
+	var invoice types.Invoice
+	err := s.db.QueryRow(`
+		SELECT id, order_id, number, currency, subtotal, tax, shipping_cost, total, issued_at, pdf
+		FROM invoices
+		WHERE order_id = ?
+	`, orderID).Scan(
+		&invoice.ID,
+		&invoice.OrderID,
+		&invoice.Number,
+		&invoice.Currency,
+		&invoice.Subtotal,
+		&invoice.Tax,
+		&invoice.ShippingCost,
+		&invoice.Total,
+		&invoice.IssuedAt,
+		&invoice.PDF,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invoice not found")
+		}
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+
+	// amounts are stored as plain decimals in the currency of the invoice
+	invoice.Subtotal.Currency = invoice.Currency
+	invoice.Tax.Currency = invoice.Currency
+	invoice.ShippingCost.Currency = invoice.Currency
+	invoice.Total.Currency = invoice.Currency
+
+	return &invoice, nil
+}
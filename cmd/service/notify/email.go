@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// EmailNotifier turns stock events into emails: low and out of stock alerts
+// go to the shop's alert address, back in stock notices to the subscriber
+type EmailNotifier struct {
+	sender  types.EmailSender
+	alertTo string
+}
+
+func NewEmailNotifier(sender types.EmailSender, alertTo string) *EmailNotifier {
+	return &EmailNotifier{sender: sender, alertTo: alertTo}
+}
+
+func (n *EmailNotifier) Notify(event types.StockEvent) error {
+	to, subject, body := n.alertTo, "", ""
+	switch event.Type {
+	case types.StockEventLowStock:
+		subject = fmt.Sprintf("Low stock: %s", event.ProductName)
+		body = fmt.Sprintf("Product %d (%s) is down to %d available, its reorder level is %d.",
+			event.ProductID, event.ProductName, event.Available, event.ReorderLevel)
+	case types.StockEventOutOfStock:
+		subject = fmt.Sprintf("Out of stock: %s", event.ProductName)
+		body = fmt.Sprintf("Product %d (%s) has run out of stock.", event.ProductID, event.ProductName)
+	case types.StockEventBackInStock:
+		to = event.Email
+		subject = fmt.Sprintf("%s is back in stock", event.ProductName)
+		body = fmt.Sprintf("Good news: %s is available again. Order soon, only %d left.", event.ProductName, event.Available)
+	default:
+		return fmt.Errorf("unknown stock event type %s", event.Type)
+	}
+
+	if to == "" {
+		return nil
+	}
+
+	if err := n.sender.SendEmail(to, subject, body); err != nil {
+		return fmt.Errorf("failed to email stock event to %s: %w", to, err)
+	}
+	return nil
+}
+
+// SMTPSender sends emails through an SMTP server with PLAIN auth
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPSender(host, port, username, password, from string) *SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPSender{addr: host + ":" + port, auth: auth, from: from}
+}
+
+// headerValue drops line breaks so values cannot inject extra headers
+var headerValue = strings.NewReplacer("\r", " ", "\n", " ")
+
+func (s *SMTPSender) SendEmail(to, subject, body string) error {
+	msg := strings.Join([]string{
+		"From: " + headerValue.Replace(s.from),
+		"To: " + headerValue.Replace(to),
+		"Subject: " + headerValue.Replace(subject),
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg))
+}
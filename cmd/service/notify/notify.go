@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"errors"
+	"log"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// LogNotifier writes stock events to the standard logger
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(event types.StockEvent) error {
+	switch event.Type {
+	case types.StockEventBackInStock:
+		log.Printf("stock event %s: product %d (%s) has %d available, notifying user %d",
+			event.Type, event.ProductID, event.ProductName, event.Available, event.UserID)
+	default:
+		log.Printf("stock event %s: product %d (%s) has %d available, reorder level %d",
+			event.Type, event.ProductID, event.ProductName, event.Available, event.ReorderLevel)
+	}
+	return nil
+}
+
+// MultiNotifier fans every event out to all of its sinks. A failing sink
+// does not stop the others, their errors are joined.
+type MultiNotifier struct {
+	notifiers []types.Notifier
+}
+
+func NewMultiNotifier(notifiers ...types.Notifier) *MultiNotifier {
+	return &MultiNotifier{notifiers: notifiers}
+}
+
+func (n *MultiNotifier) Notify(event types.StockEvent) error {
+	var errs []error
+	for _, notifier := range n.notifiers {
+		if err := notifier.Notify(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
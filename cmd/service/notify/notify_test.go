@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, "whsec_test")
+	err := notifier.Notify(types.StockEvent{Type: types.StockEventLowStock, ProductID: 7, Available: 2, ReorderLevel: 5})
+	if err != nil {
+		t.Fatalf("Expected the webhook to be delivered, got %v", err)
+	}
+	if signature != Sign([]byte("whsec_test"), body) {
+		t.Errorf("Expected the body to be signed, got signature %q", signature)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	if err := NewWebhookNotifier(failing.URL, "").Notify(types.StockEvent{Type: types.StockEventOutOfStock}); err == nil {
+		t.Error("Expected a failing webhook to return an error")
+	}
+}
+
+type mockEmailSender struct {
+	sent []string
+}
+
+func (m *mockEmailSender) SendEmail(to, subject, body string) error {
+	m.sent = append(m.sent, to+": "+subject)
+	return nil
+}
+
+func TestEmailNotifier(t *testing.T) {
+	sender := &mockEmailSender{}
+	notifier := NewEmailNotifier(sender, "stock@example.com")
+
+	events := []types.StockEvent{
+		{Type: types.StockEventOutOfStock, ProductID: 1, ProductName: "Lamp"},
+		{Type: types.StockEventBackInStock, ProductID: 1, ProductName: "Lamp", Available: 3, UserID: 4, Email: "jane@example.com"},
+	}
+	for _, event := range events {
+		if err := notifier.Notify(event); err != nil {
+			t.Fatalf("Failed to notify %s: %v", event.Type, err)
+		}
+	}
+
+	expected := []string{"stock@example.com: Out of stock: Lamp", "jane@example.com: Lamp is back in stock"}
+	if len(sender.sent) != len(expected) || sender.sent[0] != expected[0] || sender.sent[1] != expected[1] {
+		t.Errorf("Expected emails %v, got %v", expected, sender.sent)
+	}
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(event types.StockEvent) error {
+	return errors.New("sink down")
+}
+
+func TestMultiNotifierKeepsGoingAfterAFailure(t *testing.T) {
+	sender := &mockEmailSender{}
+	notifier := NewMultiNotifier(failingNotifier{}, NewEmailNotifier(sender, "stock@example.com"))
+
+	err := notifier.Notify(types.StockEvent{Type: types.StockEventOutOfStock, ProductName: "Lamp"})
+	if err == nil || err.Error() != "sink down" {
+		t.Errorf("Expected the failing sink's error, got %v", err)
+	}
+	if len(sender.sent) != 1 {
+		t.Errorf("Expected the email sink to still be notified, got %v", sender.sent)
+	}
+}
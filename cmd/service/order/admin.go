@@ -0,0 +1,267 @@
+package order
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// adminOrderSortColumns maps the sort fields of the admin order list to columns.
+// Totals are compared in the base currency, as orders are placed in many.
+var adminOrderSortColumns = map[string]string{
+	"id":        "o.id",
+	"createdAt": "o.createdAt",
+	"total":     "o.total / o.exchange_rate",
+	"status":    "o.status",
+	"email":     "u.email",
+}
+
+// adminOrderConditions builds the WHERE clause shared by SearchOrders and CountOrders
+func adminOrderConditions(filters types.AdminOrderFilters) (string, []any) {
+	conditions := []string{"1 = 1"}
+	args := []any{}
+
+	if filters.Status != nil {
+		conditions = append(conditions, "o.status = ?")
+		args = append(args, *filters.Status)
+	}
+
+	if filters.FromDate != nil {
+		conditions = append(conditions, "o.createdAt >= ?")
+		args = append(args, *filters.FromDate)
+	}
+
+	if filters.ToDate != nil {
+		conditions = append(conditions, "o.createdAt <= ?")
+		args = append(args, *filters.ToDate)
+	}
+
+	if filters.Email != nil {
+		conditions = append(conditions, "u.email LIKE ?")
+		args = append(args, "%"+escapeLike(*filters.Email)+"%")
+	}
+
+	if filters.ProductID != nil {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM order_items oi WHERE oi.orderId = o.id AND oi.productId = ?)")
+		args = append(args, *filters.ProductID)
+	}
+
+	if filters.MinTotal != nil {
+		conditions = append(conditions, "o.total / o.exchange_rate >= ?")
+		args = append(args, *filters.MinTotal)
+	}
+
+	if filters.MaxTotal != nil {
+		conditions = append(conditions, "o.total / o.exchange_rate <= ?")
+		args = append(args, *filters.MaxTotal)
+	}
+
+	if filters.Country != nil {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM order_addresses a WHERE a.order_id = o.id AND a.type = 'shipping' AND a.country = ?)")
+		args = append(args, *filters.Country)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// adminOrderOrderBy builds the ORDER BY clause of the admin order list, newest
+// first by default. The order ID always breaks ties so pages are stable.
+func adminOrderOrderBy(sort []types.OrderSort) (string, error) {
+	if len(sort) == 0 {
+		sort = []types.OrderSort{{Field: "createdAt", Descending: true}}
+	}
+
+	keys := make([]string, 0, len(sort)+1)
+	byID := false
+	for _, key := range sort {
+		column, ok := adminOrderSortColumns[key.Field]
+		if !ok {
+			return "", fmt.Errorf("cannot sort orders by %s", key.Field)
+		}
+		if key.Field == "id" {
+			byID = true
+		}
+		if key.Descending {
+			column += " DESC"
+		}
+		keys = append(keys, column)
+	}
+	if !byID {
+		keys = append(keys, "o.id DESC")
+	}
+
+	return " ORDER BY " + strings.Join(keys, ", "), nil
+}
+
+// SearchOrders retrieves the orders of all users with their customers
+func (s *Store) SearchOrders(filters types.AdminOrderFilters) ([]types.AdminOrder, error) {
+	where, args := adminOrderConditions(filters)
+	orderBy, err := adminOrderOrderBy(filters.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + orderColumns + `, u.id, u.firstName, u.lastName, u.email
+		FROM orders o
+		JOIN users u ON u.id = o.userId
+		WHERE ` + where + orderBy
+
+	if filters.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filters.Limit)
+
+		if filters.Offset > 0 {
+			query += " OFFSET ?"
+			args = append(args, filters.Offset)
+		}
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search orders: %w", err)
+	}
+
+	orders := []types.AdminOrder{}
+	for rows.Next() {
+		var customer types.OrderCustomer
+		order, err := scanRowIntoOrder(rows, &customer.ID, &customer.FirstName, &customer.LastName, &customer.Email)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, types.AdminOrder{OrderWithItems: *order, Customer: customer})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search orders: %w", err)
+	}
+
+	page := make([]*types.OrderWithItems, len(orders))
+	for i := range orders {
+		page[i] = &orders[i].OrderWithItems
+	}
+	if err := s.loadOrderDetails(page...); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// CountOrders returns the number of orders of all users matching the filters
+func (s *Store) CountOrders(filters types.AdminOrderFilters) (int, error) {
+	where, args := adminOrderConditions(filters)
+
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM orders o
+		JOIN users u ON u.id = o.userId
+		WHERE `+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count orders: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetAdminOrder retrieves any order with its customer
+func (s *Store) GetAdminOrder(orderID int) (*types.AdminOrder, error) {
+	var customer types.OrderCustomer
+	order, err := scanRowIntoOrder(s.db.QueryRow(`
+		SELECT `+orderColumns+`, u.id, u.firstName, u.lastName, u.email
+		FROM orders o
+		JOIN users u ON u.id = o.userId
+		WHERE o.id = ?
+	`, orderID), &customer.ID, &customer.FirstName, &customer.LastName, &customer.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("order not found")
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if err := s.loadOrderDetails(order); err != nil {
+		return nil, err
+	}
+	if err := s.loadOrderShipments(order); err != nil {
+		return nil, err
+	}
+
+	return &types.AdminOrder{OrderWithItems: *order, Customer: customer}, nil
+}
+
+// streamOrdersChunk is the number of orders StreamOrders loads at a time
+const streamOrdersChunk = 500
+
+// StreamOrders calls fn for every order of all users matching the filters,
+// oldest first. Orders are read in chunks past the last one seen, so memory
+// stays flat however many orders match and no query is left open while fn runs.
+func (s *Store) StreamOrders(filters types.OrderFilters, fn func(types.AdminOrder) error) error {
+	conditions, filterArgs := orderFilterConditions(filters)
+
+	var last *types.AdminOrder
+	for {
+		query := `
+			SELECT ` + orderColumns + `, u.id, u.firstName, u.lastName, u.email
+			FROM orders o
+			JOIN users u ON u.id = o.userId
+			WHERE 1 = 1` + conditions
+		args := append([]any{}, filterArgs...)
+		if last != nil {
+			query += " AND (o.createdAt > ? OR (o.createdAt = ? AND o.id > ?))"
+			args = append(args, last.CreatedAt, last.CreatedAt, last.ID)
+		}
+		query += " ORDER BY o.createdAt, o.id LIMIT ?"
+		args = append(args, streamOrdersChunk)
+
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to stream orders: %w", err)
+		}
+
+		orders := make([]types.AdminOrder, 0, streamOrdersChunk)
+		for rows.Next() {
+			var customer types.OrderCustomer
+			order, err := scanRowIntoOrder(rows, &customer.ID, &customer.FirstName, &customer.LastName, &customer.Email)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan order: %w", err)
+			}
+			orders = append(orders, types.AdminOrder{OrderWithItems: *order, Customer: customer})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to stream orders: %w", err)
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		chunk := make([]*types.OrderWithItems, len(orders))
+		for i := range orders {
+			chunk[i] = &orders[i].OrderWithItems
+		}
+		if err := s.loadOrderDetails(chunk...); err != nil {
+			return err
+		}
+
+		for _, order := range orders {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+
+		if len(orders) < streamOrdersChunk {
+			return nil
+		}
+		last = &orders[len(orders)-1]
+	}
+}
@@ -0,0 +1,176 @@
+package order
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// exportContentTypes maps the export formats to their content types
+var exportContentTypes = map[types.ExportFormat]string{
+	types.ExportFormatCSV:    "text/csv",
+	types.ExportFormatNDJSON: "application/x-ndjson",
+	types.ExportFormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// parseExportFormat checks an export format, csv by default
+func parseExportFormat(format string) (types.ExportFormat, error) {
+	if format == "" {
+		return types.ExportFormatCSV, nil
+	}
+	if _, ok := exportContentTypes[types.ExportFormat(format)]; !ok {
+		return "", fmt.Errorf("invalid format. Must be csv, ndjson or xlsx")
+	}
+	return types.ExportFormat(format), nil
+}
+
+// orderExportHeader is the header row of a CSV or XLSX order export
+var orderExportHeader = []string{
+	"order_id", "created_at", "status", "customer_id", "customer_email", "customer_name",
+	"currency", "exchange_rate", "order_subtotal", "order_tax", "shipping_cost", "order_total", "refunded_amount",
+	"shipping_country", "shipping_address",
+	"item_id", "product_id", "product_sku", "product_name", "quantity", "price", "tax_rate",
+	"item_subtotal", "item_tax", "item_total",
+}
+
+// orderExportNumeric lists the columns of orderExportHeader holding numbers
+var orderExportNumeric = map[int]bool{
+	0: true, 3: true, 7: true, 8: true, 9: true, 10: true, 11: true, 12: true,
+	15: true, 16: true, 19: true, 20: true, 21: true, 22: true, 23: true, 24: true,
+}
+
+// orderExportRows formats an order as rows of a CSV or XLSX export, one per
+// line item. An order without items still gets a row, with the item columns empty.
+func orderExportRows(order types.AdminOrder) [][]string {
+	var country string
+	if order.ShippingAddress != nil {
+		country = order.ShippingAddress.Country
+	}
+
+	orderColumns := []string{
+		strconv.Itoa(order.ID),
+		order.CreatedAt.UTC().Format(time.RFC3339),
+		order.Status,
+		strconv.Itoa(order.Customer.ID),
+		order.Customer.Email,
+		strings.TrimSpace(order.Customer.FirstName + " " + order.Customer.LastName),
+		order.Currency,
+		order.ExchangeRate.String(),
+		order.Subtotal.String(),
+		order.Tax.String(),
+		order.ShippingCost.String(),
+		order.Total.String(),
+		order.RefundedAmount.String(),
+		country,
+		order.Address,
+	}
+
+	if len(order.Items) == 0 {
+		return [][]string{append(orderColumns, make([]string, len(orderExportHeader)-len(orderColumns))...)}
+	}
+
+	rows := make([][]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		row := append([]string{}, orderColumns...)
+		rows = append(rows, append(row,
+			strconv.Itoa(item.ID),
+			strconv.Itoa(item.ProductID),
+			item.ProductSKU,
+			item.ProductName,
+			strconv.Itoa(item.Quantity),
+			item.Price.String(),
+			item.TaxRate.String(),
+			item.Subtotal.String(),
+			item.Tax.String(),
+			item.Total.String(),
+		))
+	}
+	return rows
+}
+
+// orderExporter writes orders to an export file one at a time
+type orderExporter interface {
+	WriteOrder(order types.AdminOrder) error
+	// Flush sends what is written so far to the output
+	Flush() error
+	// Close ends the file; the output itself is left open
+	Close() error
+}
+
+// newOrderExporter starts an export in the format, writing the header if it has one
+func newOrderExporter(format types.ExportFormat, w io.Writer) (orderExporter, error) {
+	switch format {
+	case types.ExportFormatCSV:
+		exporter := &csvOrderExporter{csv: csv.NewWriter(w)}
+		if err := exporter.csv.Write(orderExportHeader); err != nil {
+			return nil, err
+		}
+		return exporter, nil
+	case types.ExportFormatNDJSON:
+		return &ndjsonOrderExporter{encoder: json.NewEncoder(w)}, nil
+	case types.ExportFormatXLSX:
+		sheet, err := newXLSXWriter(w, orderExportNumeric)
+		if err != nil {
+			return nil, err
+		}
+		if err := sheet.WriteRow(orderExportHeader); err != nil {
+			return nil, err
+		}
+		return &xlsxOrderExporter{sheet: sheet}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %s", format)
+	}
+}
+
+type csvOrderExporter struct {
+	csv *csv.Writer
+}
+
+func (e *csvOrderExporter) WriteOrder(order types.AdminOrder) error {
+	for _, row := range orderExportRows(order) {
+		if err := e.csv.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *csvOrderExporter) Flush() error {
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+func (e *csvOrderExporter) Close() error { return e.Flush() }
+
+type ndjsonOrderExporter struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonOrderExporter) WriteOrder(order types.AdminOrder) error {
+	return e.encoder.Encode(order)
+}
+
+func (e *ndjsonOrderExporter) Flush() error { return nil }
+func (e *ndjsonOrderExporter) Close() error { return nil }
+
+type xlsxOrderExporter struct {
+	sheet *xlsxWriter
+}
+
+func (e *xlsxOrderExporter) WriteOrder(order types.AdminOrder) error {
+	for _, row := range orderExportRows(order) {
+		if err := e.sheet.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *xlsxOrderExporter) Flush() error { return e.sheet.Flush() }
+func (e *xlsxOrderExporter) Close() error { return e.sheet.Close() }
@@ -0,0 +1,158 @@
+package order
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func testExportOrders() []types.AdminOrder {
+	usd := func(s string) types.Money { return types.MustParseMoney(s, types.DefaultCurrency) }
+	return []types.AdminOrder{
+		{
+			OrderWithItems: types.OrderWithItems{
+				ID:        1,
+				Total:     usd("30.00"),
+				Currency:  types.DefaultCurrency,
+				Status:    types.OrderStatusPaid,
+				Address:   "1 Main St, Springfield",
+				CreatedAt: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+				Items: []types.OrderItemWithProduct{
+					{ID: 10, ProductID: 5, ProductName: "Mug", Quantity: 2, Price: usd("10.00"), Total: usd("20.00")},
+					{ID: 11, ProductID: 6, ProductName: `Tea & "Biscuits" <box>`, Quantity: 1, Price: usd("10.00"), Total: usd("10.00")},
+				},
+			},
+			Customer: types.OrderCustomer{ID: 7, FirstName: "Ada", LastName: "Lovelace", Email: "ada@shop.test"},
+		},
+		{
+			OrderWithItems: types.OrderWithItems{ID: 2, Status: types.OrderStatusPending, CreatedAt: time.Date(2026, 10, 18, 13, 0, 0, 0, time.UTC)},
+			Customer:       types.OrderCustomer{ID: 8, Email: "bob@shop.test"},
+		},
+	}
+}
+
+func TestOrderExportRows(t *testing.T) {
+	orders := testExportOrders()
+
+	rows := orderExportRows(orders[0])
+	if len(rows) != 2 {
+		t.Fatalf("Expected a row per line item, got %d", len(rows))
+	}
+	for _, row := range rows {
+		if len(row) != len(orderExportHeader) {
+			t.Fatalf("Expected %d columns, got %d", len(orderExportHeader), len(row))
+		}
+	}
+	if rows[0][0] != "1" || rows[0][4] != "ada@shop.test" || rows[0][5] != "Ada Lovelace" || rows[1][18] != `Tea & "Biscuits" <box>` {
+		t.Errorf("Expected the order and its second item on the second row, got %v", rows[1])
+	}
+
+	rows = orderExportRows(orders[1])
+	if len(rows) != 1 || len(rows[0]) != len(orderExportHeader) || rows[0][0] != "2" || rows[0][15] != "" {
+		t.Errorf("Expected one row with empty item columns for an order without items, got %v", rows)
+	}
+}
+
+func TestOrderExporter(t *testing.T) {
+	export := func(t *testing.T, format types.ExportFormat) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		exporter, err := newOrderExporter(format, &buf)
+		if err != nil {
+			t.Fatalf("Failed to start export: %v", err)
+		}
+		for _, order := range testExportOrders() {
+			if err := exporter.WriteOrder(order); err != nil {
+				t.Fatalf("Failed to write order: %v", err)
+			}
+		}
+		if err := exporter.Close(); err != nil {
+			t.Fatalf("Failed to close export: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		records, err := csv.NewReader(bytes.NewReader(export(t, types.ExportFormatCSV))).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to read CSV: %v", err)
+		}
+		if len(records) != 4 || records[0][0] != "order_id" || records[3][0] != "2" {
+			t.Errorf("Expected a header and 3 rows, got %v", records)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(string(export(t, types.ExportFormatNDJSON))), "\n")
+		if len(lines) != 2 || !strings.Contains(lines[0], `"email":"ada@shop.test"`) {
+			t.Errorf("Expected one line per order, got %v", lines)
+		}
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		data := export(t, types.ExportFormatXLSX)
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("Failed to open workbook: %v", err)
+		}
+
+		var sheet []byte
+		for _, f := range archive.File {
+			if f.Name == "xl/worksheets/sheet1.xml" {
+				r, err := f.Open()
+				if err != nil {
+					t.Fatalf("Failed to open sheet: %v", err)
+				}
+				sheet, _ = io.ReadAll(r)
+				r.Close()
+			}
+		}
+
+		var worksheet struct {
+			Rows []struct {
+				Cells []struct {
+					Ref    string `xml:"r,attr"`
+					Type   string `xml:"t,attr"`
+					Value  string `xml:"v"`
+					Inline string `xml:"is>t"`
+				} `xml:"c"`
+			} `xml:"sheetData>row"`
+		}
+		if err := xml.Unmarshal(sheet, &worksheet); err != nil {
+			t.Fatalf("Expected a well formed sheet, got %v", err)
+		}
+		if len(worksheet.Rows) != 4 {
+			t.Fatalf("Expected a header and 3 rows, got %d", len(worksheet.Rows))
+		}
+
+		first := worksheet.Rows[1].Cells[0]
+		if first.Ref != "A2" || first.Type != "" || first.Value != "1" {
+			t.Errorf("Expected the order ID as a number in A2, got %+v", first)
+		}
+		found := false
+		for _, cell := range worksheet.Rows[2].Cells {
+			if cell.Inline == `Tea & "Biscuits" <box>` {
+				found = cell.Type == "inlineStr"
+			}
+		}
+		if !found {
+			t.Errorf("Expected the product name as text on the third row, got %+v", worksheet.Rows[2])
+		}
+	})
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+	for i, expected := range tests {
+		if got := xlsxColumn(i); got != expected {
+			t.Errorf("Expected column %d to be %s, got %s", i, expected, got)
+		}
+	}
+}
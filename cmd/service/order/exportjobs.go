@@ -0,0 +1,122 @@
+package order
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// CreateExportJob records a pending export and sets its ID and creation time
+func (s *Store) CreateExportJob(job *types.ExportJob) error {
+	filters, err := json.Marshal(job.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to encode export filters: %w", err)
+	}
+
+	result, err := s.db.Exec(
+		"INSERT INTO export_jobs (user_id, format, filters) VALUES (?, ?, ?)",
+		job.UserID, job.Format, filters,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create export job: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get export job ID: %w", err)
+	}
+
+	created, err := s.GetExportJob(int(id))
+	if err != nil {
+		return err
+	}
+	*job = *created
+
+	return nil
+}
+
+// GetExportJob retrieves an export job
+func (s *Store) GetExportJob(jobID int) (*types.ExportJob, error) {
+	var job types.ExportJob
+	var filters []byte
+	var filePath, jobErr sql.NullString
+	var finishedAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT id, user_id, format, filters, status, file_path, row_count, error, created_at, finished_at
+		FROM export_jobs
+		WHERE id = ?
+	`, jobID).Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Format,
+		&filters,
+		&job.Status,
+		&filePath,
+		&job.Rows,
+		&jobErr,
+		&job.CreatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("export job not found")
+		}
+		return nil, fmt.Errorf("failed to get export job: %w", err)
+	}
+
+	if err := json.Unmarshal(filters, &job.Filters); err != nil {
+		return nil, fmt.Errorf("failed to decode export filters: %w", err)
+	}
+	job.FilePath = filePath.String
+	job.Error = jobErr.String
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
+
+// StartExportJob marks a pending export as running
+func (s *Store) StartExportJob(jobID int) error {
+	result, err := s.db.Exec(
+		"UPDATE export_jobs SET status = 'RUNNING' WHERE id = ? AND status = 'PENDING'",
+		jobID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start export job: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to start export job: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("export job %d is not pending", jobID)
+	}
+
+	return nil
+}
+
+// FinishExportJob records the file of a finished export, or why it failed
+func (s *Store) FinishExportJob(jobID int, filePath string, rows int, jobErr error) error {
+	status := types.ExportJobDone
+	var path, message any = filePath, nil
+	if jobErr != nil {
+		status = types.ExportJobFailed
+		path, message = nil, jobErr.Error()
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE export_jobs
+		SET status = ?, file_path = ?, row_count = ?, error = ?, finished_at = NOW()
+		WHERE id = ?
+	`, status, path, rows, message, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to finish export job: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/config"
+	"github.com/go-sql-driver/mysql"
+)
+
+// queryCounter counts the statements run through a *sql.DB opened by
+// openCountingDB, so tests can assert how many queries a store call makes
+type queryCounter struct {
+	queries atomic.Int64
+}
+
+func (c *queryCounter) Reset()       { c.queries.Store(0) }
+func (c *queryCounter) Count() int64 { return c.queries.Load() }
+
+// openCountingDB opens the test database through a connector that counts
+// every query and exec, whether sent directly or as a prepared statement
+func openCountingDB(tb testing.TB) (*sql.DB, *queryCounter) {
+	tb.Helper()
+
+	cfg := config.Envs
+	connector, err := mysql.NewConnector(&mysql.Config{
+		User:                 cfg.DBUser,
+		Passwd:               cfg.DBPassword,
+		Net:                  "tcp",
+		Addr:                 cfg.DBAddress,
+		DBName:               testDBName,
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	})
+	if err != nil {
+		tb.Fatalf("Failed to create connector: %v", err)
+	}
+
+	counter := &queryCounter{}
+	db := sql.OpenDB(&countingConnector{Connector: connector, counter: counter})
+	tb.Cleanup(func() { db.Close() })
+
+	return db, counter
+}
+
+type countingConnector struct {
+	driver.Connector
+	counter *queryCounter
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{conn: conn, counter: c.counter}, nil
+}
+
+// countingConn passes everything to the driver connection. A direct query the
+// driver skips (driver.ErrSkip) is retried by database/sql as a prepared
+// statement, so it is only counted once it actually runs.
+type countingConn struct {
+	conn    driver.Conn
+	counter *queryCounter
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *countingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &countingStmt{stmt: stmt, counter: c.counter}, nil
+}
+
+func (c *countingConn) Close() error { return c.conn.Close() }
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin()
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.counter.queries.Add(1)
+	}
+	return rows, err
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.counter.queries.Add(1)
+	}
+	return result, err
+}
+
+func (c *countingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *countingConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *countingConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+type countingStmt struct {
+	stmt    driver.Stmt
+	counter *queryCounter
+}
+
+func (s *countingStmt) Close() error  { return s.stmt.Close() }
+func (s *countingStmt) NumInput() int { return s.stmt.NumInput() }
+
+func (s *countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.counter.queries.Add(1)
+	return s.stmt.Exec(args)
+}
+
+func (s *countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.counter.queries.Add(1)
+	return s.stmt.Query(args)
+}
+
+func (s *countingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.stmt.(driver.StmtExecContext)
+	if !ok {
+		return s.Exec(namedValues(args))
+	}
+	s.counter.queries.Add(1)
+	return execer.ExecContext(ctx, args)
+}
+
+func (s *countingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.stmt.(driver.StmtQueryContext)
+	if !ok {
+		return s.Query(namedValues(args))
+	}
+	s.counter.queries.Add(1)
+	return queryer.QueryContext(ctx, args)
+}
+
+func (s *countingStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -1,30 +1,93 @@
 package order
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
 	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 )
 
+// orderStatuses lists the statuses accepted by the status filter
+var orderStatuses = []string{
+	types.OrderStatusPending,
+	types.OrderStatusPaid,
+	types.OrderStatusPartiallyShipped,
+	types.OrderStatusCompleted,
+	types.OrderStatusCancelled,
+	types.OrderStatusRefunded,
+}
+
+// CarrierSignatureHeader carries the HMAC-SHA256 of a carrier tracking update, hex encoded
+const CarrierSignatureHeader = "X-Carrier-Signature"
+
+// maxWebhookSize bounds the carrier webhook body read into memory
+const maxWebhookSize = 1 << 20
+
 type Handler struct {
-	store     types.OrderStore
-	userStore types.UserStore
+	store          types.OrderStore
+	adminStore     types.AdminOrderStore
+	exportStore    types.ExportJobStore
+	shipmentStore  types.ShipmentStore
+	inventoryStore types.InventoryStore
+	userStore      types.UserStore
+	exportDir      string // where background exports are written
+	carrierSecret  []byte // carriers sign tracking updates with it
 }
 
-func NewHandler(store types.OrderStore, userStore types.UserStore) *Handler {
-	return &Handler{store: store, userStore: userStore}
+func NewHandler(store types.OrderStore, adminStore types.AdminOrderStore, exportStore types.ExportJobStore, shipmentStore types.ShipmentStore, inventoryStore types.InventoryStore, userStore types.UserStore) *Handler {
+	return &Handler{
+		store:          store,
+		adminStore:     adminStore,
+		exportStore:    exportStore,
+		shipmentStore:  shipmentStore,
+		inventoryStore: inventoryStore,
+		userStore:      userStore,
+		exportDir:      "exports",
+	}
+}
+
+// SetCarrierWebhookSecret sets the secret carriers sign tracking updates with
+func (h *Handler) SetCarrierWebhookSecret(secret string) {
+	h.carrierSecret = []byte(secret)
+}
+
+// SetExportDir sets the directory background exports are written to
+func (h *Handler) SetExportDir(dir string) {
+	if dir != "" {
+		h.exportDir = dir
+	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	// All order routes require authentication
 	router.HandleFunc("/orders", auth.WithJWTAuth(h.handleGetOrders, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/orders/{id}", auth.WithJWTAuth(h.handleGetOrder, h.userStore)).Methods(http.MethodGet)
+
+	// Staff see the orders of all users
+	router.HandleFunc("/admin/orders", auth.WithAdminAuth(h.handleSearchOrders, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/orders/status", auth.WithAdminAuth(h.handleUpdateOrderStatuses, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/orders/export", auth.WithAdminAuth(h.handleExportOrders, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/orders/exports", auth.WithAdminAuth(h.handleCreateExportJob, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/orders/exports/{id}", auth.WithAdminAuth(h.handleGetExportJob, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/orders/exports/{id}/download", auth.WithAdminAuth(h.handleDownloadExport, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/orders/{id}", auth.WithAdminAuth(h.handleGetAdminOrder, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/orders/{id}/shipments", auth.WithAdminAuth(h.handleCreateShipment, h.userStore)).Methods(http.MethodPost)
+
+	// Called by carriers, authenticated by the signature
+	router.HandleFunc("/shipments/webhook", h.handleCarrierWebhook).Methods(http.MethodPost)
 }
 
 // GET /api/v1/orders - get orders for authenticated user with optional filters
@@ -32,20 +95,12 @@ func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 	
 	// Parse query parameters
-	filters := types.OrderFilters{
-		Limit:  10, // Default limit
-		Offset: 0,  // Default offset
-	}
-	
-	// Parse status filter
-	if status := r.URL.Query().Get("status"); status != "" {
-		if status == "pending" || status == "completed" || status == "cancelled" {
-			filters.Status = &status
-		} else {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid status. Must be one of: pending, completed, cancelled"))
-			return
-		}
+	filters, err := parseOrderFilters(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
 	}
+	filters.Limit = 10 // Default limit
 	
 	// Parse limit
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
@@ -67,53 +122,96 @@ func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request) {
 		filters.Offset = offset
 	}
 	
-	// Parse date filters
-	if fromDateStr := r.URL.Query().Get("fromDate"); fromDateStr != "" {
-		fromDate, err := time.Parse("2006-01-02", fromDateStr)
+	// Parse cursor, which replaces offset paging
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		if filters.Offset > 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("cursor and offset cannot be combined"))
+			return
+		}
+		orderCursor, err := decodeOrderCursor(cursor)
 		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid fromDate format. Use YYYY-MM-DD"))
+			utils.WriteError(w, http.StatusBadRequest, err)
 			return
 		}
-		filters.FromDate = &fromDate
+		filters.Cursor = orderCursor
 	}
 	
-	if toDateStr := r.URL.Query().Get("toDate"); toDateStr != "" {
-		toDate, err := time.Parse("2006-01-02", toDateStr)
+	// The total is counted for offset paging unless turned off, and on request with a cursor
+	includeTotal := filters.Cursor == nil
+	if totalStr := r.URL.Query().Get("total"); totalStr != "" {
+		include, err := strconv.ParseBool(totalStr)
 		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid toDate format. Use YYYY-MM-DD"))
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid total. Must be true or false"))
 			return
 		}
-		// Set to end of day
-		toDate = toDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-		filters.ToDate = &toDate
+		includeTotal = include
 	}
 	
-	// Get orders
+	// Get orders, one more than asked for to tell whether there is more
+	limit := filters.Limit
+	filters.Limit = limit + 1
 	orders, err := h.store.GetUserOrders(userID, filters)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 	
-	// Get total count for pagination
-	totalCount, err := h.store.GetOrdersCount(userID, filters)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
-	}
-	
-	// Determine if there are more results
-	hasMore := len(orders) == filters.Limit && (filters.Offset+len(orders)) < totalCount
+	response := buildOrderPage(orders, limit, filters.Cursor, filters.Offset)
 	
-	response := types.OrderListResponse{
-		Orders:  orders,
-		Total:   totalCount,
-		HasMore: hasMore,
+	// Get total count for pagination
+	if includeTotal {
+		totalCount, err := h.store.GetOrdersCount(userID, filters)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		response.Total = &totalCount
 	}
 	
 	utils.WriteJSON(w, http.StatusOK, response)
 }
 
+// parseOrderFilters reads the order filters shared by the order list and the
+// order exports, without paging
+func parseOrderFilters(r *http.Request) (types.OrderFilters, error) {
+	var filters types.OrderFilters
+
+	// Parse status filter
+	if status := r.URL.Query().Get("status"); status != "" {
+		if slices.Contains(orderStatuses, status) {
+			filters.Status = &status
+		} else {
+			return filters, fmt.Errorf("invalid status. Must be one of: %s", strings.Join(orderStatuses, ", "))
+		}
+	}
+
+	// Parse date filters
+	if fromDateStr := r.URL.Query().Get("fromDate"); fromDateStr != "" {
+		fromDate, err := time.Parse("2006-01-02", fromDateStr)
+		if err != nil {
+			return filters, fmt.Errorf("invalid fromDate format. Use YYYY-MM-DD")
+		}
+		filters.FromDate = &fromDate
+	}
+
+	if toDateStr := r.URL.Query().Get("toDate"); toDateStr != "" {
+		toDate, err := time.Parse("2006-01-02", toDateStr)
+		if err != nil {
+			return filters, fmt.Errorf("invalid toDate format. Use YYYY-MM-DD")
+		}
+		// Set to end of day
+		toDate = toDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		filters.ToDate = &toDate
+	}
+
+	// Parse shipping country filter
+	if country := r.URL.Query().Get("country"); country != "" {
+		filters.Country = &country
+	}
+
+	return filters, nil
+}
+
 // GET /api/v1/orders/{id} - get specific order details
 func (h *Handler) handleGetOrder(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
@@ -136,4 +234,509 @@ func (h *Handler) handleGetOrder(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	utils.WriteJSON(w, http.StatusOK, order)
-}
\ No newline at end of file
+}
+
+// GET /api/v1/admin/orders - search the orders of all users
+func (h *Handler) handleSearchOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := types.AdminOrderFilters{Limit: 20}
+
+	if status := query.Get("status"); status != "" {
+		if !slices.Contains(orderStatuses, status) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid status. Must be one of: %s", strings.Join(orderStatuses, ", ")))
+			return
+		}
+		filters.Status = &status
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid limit. Must be between 1 and 100"))
+			return
+		}
+		filters.Limit = limit
+	}
+
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid offset. Must be >= 0"))
+			return
+		}
+		filters.Offset = offset
+	}
+
+	if fromDateStr := query.Get("fromDate"); fromDateStr != "" {
+		fromDate, err := time.Parse("2006-01-02", fromDateStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid fromDate format. Use YYYY-MM-DD"))
+			return
+		}
+		filters.FromDate = &fromDate
+	}
+
+	if toDateStr := query.Get("toDate"); toDateStr != "" {
+		toDate, err := time.Parse("2006-01-02", toDateStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid toDate format. Use YYYY-MM-DD"))
+			return
+		}
+		// Set to end of day
+		toDate = toDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		filters.ToDate = &toDate
+	}
+
+	if email := query.Get("email"); email != "" {
+		filters.Email = &email
+	}
+
+	if productIDStr := query.Get("productId"); productIDStr != "" {
+		productID, err := strconv.Atoi(productIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid productId"))
+			return
+		}
+		filters.ProductID = &productID
+	}
+
+	for param, bound := range map[string]**types.Money{"minTotal": &filters.MinTotal, "maxTotal": &filters.MaxTotal} {
+		if totalStr := query.Get(param); totalStr != "" {
+			total, err := types.ParseMoney(totalStr, types.DefaultCurrency)
+			if err != nil {
+				utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid %s", param))
+				return
+			}
+			*bound = &total
+		}
+	}
+
+	if country := query.Get("country"); country != "" {
+		filters.Country = &country
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		keys, err := parseOrderSort(sort)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		filters.Sort = keys
+	}
+
+	// one more than asked for tells whether there is a next page
+	limit := filters.Limit
+	filters.Limit = limit + 1
+	orders, err := h.adminStore.SearchOrders(filters)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	total, err := h.adminStore.CountOrders(filters)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := types.AdminOrderListResponse{Orders: orders, Total: total}
+	if len(orders) > limit {
+		response.Orders = orders[:limit]
+		response.HasMore = true
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// GET /api/v1/admin/orders/{id} - get any order with its customer
+func (h *Handler) handleGetAdminOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	order, err := h.adminStore.GetAdminOrder(orderID)
+	if err != nil {
+		if err.Error() == "order not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+// POST /api/v1/admin/orders/status - move a batch of orders to a new status.
+// Each order is updated on its own; the ones that cannot move report why.
+func (h *Handler) handleUpdateOrderStatuses(w http.ResponseWriter, r *http.Request) {
+	var payload types.UpdateOrderStatusesPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	results := make([]types.OrderStatusUpdate, 0, len(payload.OrderIDs))
+	updated := 0
+	seen := make(map[int]bool)
+	for _, orderID := range payload.OrderIDs {
+		if seen[orderID] {
+			continue
+		}
+		seen[orderID] = true
+
+		result := types.OrderStatusUpdate{OrderID: orderID}
+		if err := h.updateOrderStatus(orderID, payload.Status); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Status = payload.Status
+			updated++
+		}
+		results = append(results, result)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"results": results,
+		"updated": updated,
+		"count":   len(results),
+	})
+}
+
+// updateOrderStatus moves an order to a status staff can set, releasing the
+// stock held for it when it is cancelled
+func (h *Handler) updateOrderStatus(orderID int, status string) error {
+	order, err := h.store.GetOrder(orderID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkAdminStatusTransition(order.Status, status); err != nil {
+		return err
+	}
+
+	if err := h.store.UpdateOrderStatus(orderID, order.Status, status); err != nil {
+		return err
+	}
+
+	if status == types.OrderStatusCancelled {
+		if err := h.inventoryStore.ReleaseReservation(orderID); err != nil {
+			log.Printf("failed to release stock reservation of order %d: %v", orderID, err)
+		}
+	}
+
+	return nil
+}
+
+// GET /api/v1/admin/orders/export?format=csv|ndjson|xlsx - stream the orders of
+// all users matching the order filters, oldest first
+func (h *Handler) handleExportOrders(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseOrderFilters(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format, err := parseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "orders."+string(format)))
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	_, err = h.exportOrders(w, format, filters, func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+
+	// The status is already sent, so a failure can only cut the file short
+	if err != nil {
+		log.Printf("failed to export orders: %v", err)
+	}
+}
+
+// exportOrders writes every order matching the filters in the format and
+// returns how many it wrote. Output is flushed every 500 orders, so a large
+// export never sits in memory.
+func (h *Handler) exportOrders(w io.Writer, format types.ExportFormat, filters types.OrderFilters, flush func()) (int, error) {
+	exporter, err := newOrderExporter(format, w)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	err = h.adminStore.StreamOrders(filters, func(order types.AdminOrder) error {
+		if err := exporter.WriteOrder(order); err != nil {
+			return err
+		}
+		rows++
+		if rows%500 == 0 {
+			if err := exporter.Flush(); err != nil {
+				return err
+			}
+			flush()
+		}
+		return nil
+	})
+	if closeErr := exporter.Close(); err == nil {
+		err = closeErr
+	}
+	flush()
+
+	return rows, err
+}
+
+// POST /api/v1/admin/orders/exports?format=csv|ndjson|xlsx - export the orders
+// matching the order filters to a file in the background
+func (h *Handler) handleCreateExportJob(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseOrderFilters(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format, err := parseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job := &types.ExportJob{
+		UserID:  auth.GetUserIDFromContext(r.Context()),
+		Format:  format,
+		Filters: filters,
+	}
+	if err := h.exportStore.CreateExportJob(job); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	go h.runExportJob(*job)
+
+	utils.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// runExportJob writes an export to its file. The file only takes its final
+// name once complete, so a download never sees half an export.
+func (h *Handler) runExportJob(job types.ExportJob) {
+	if err := h.exportStore.StartExportJob(job.ID); err != nil {
+		log.Printf("failed to start export job %d: %v", job.ID, err)
+		return
+	}
+
+	path := filepath.Join(h.exportDir, fmt.Sprintf("orders-%d.%s", job.ID, job.Format))
+	rows, err := h.writeExportFile(path, job)
+	if err != nil {
+		log.Printf("export job %d failed: %v", job.ID, err)
+	}
+
+	if err := h.exportStore.FinishExportJob(job.ID, path, rows, err); err != nil {
+		log.Printf("failed to finish export job %d: %v", job.ID, err)
+	}
+}
+
+func (h *Handler) writeExportFile(path string, job types.ExportJob) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	rows, err := h.exportOrders(f, job.Format, job.Filters, func() {})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return rows, fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return rows, fmt.Errorf("failed to save export file: %w", err)
+	}
+
+	return rows, nil
+}
+
+// GET /api/v1/admin/orders/exports/{id} - get a background export, with its
+// download link once done
+func (h *Handler) handleGetExportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.getExportJob(w, r)
+	if !ok {
+		return
+	}
+
+	if job.Status == types.ExportJobDone {
+		job.DownloadURL = fmt.Sprintf("/api/v1/admin/orders/exports/%d/download", job.ID)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, job)
+}
+
+// GET /api/v1/admin/orders/exports/{id}/download - download a finished export
+func (h *Handler) handleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.getExportJob(w, r)
+	if !ok {
+		return
+	}
+
+	if job.Status != types.ExportJobDone {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("export job is %s", strings.ToLower(string(job.Status))))
+		return
+	}
+
+	f, err := os.Open(job.FilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			utils.WriteError(w, http.StatusGone, fmt.Errorf("export file no longer exists"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", exportContentTypes[job.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(job.FilePath)))
+	modified := job.CreatedAt
+	if job.FinishedAt != nil {
+		modified = *job.FinishedAt
+	}
+	http.ServeContent(w, r, "", modified, f)
+}
+
+// getExportJob reads the export job of the request, writing the error response when there is none
+func (h *Handler) getExportJob(w http.ResponseWriter, r *http.Request) (*types.ExportJob, bool) {
+	jobID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid export job ID"))
+		return nil, false
+	}
+
+	job, err := h.exportStore.GetExportJob(jobID)
+	if err != nil {
+		if err.Error() == "export job not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return job, true
+}
+
+// POST /api/v1/admin/orders/{id}/shipments - ship some or all of the lines left to ship
+func (h *Handler) handleCreateShipment(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	var payload types.CreateShipmentPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	shipment := &types.Shipment{
+		OrderID:        orderID,
+		Carrier:        payload.Carrier,
+		TrackingNumber: payload.TrackingNumber,
+	}
+	for _, item := range payload.Items {
+		shipment.Items = append(shipment.Items, types.ShipmentItem{OrderItemID: item.OrderItemID, Quantity: item.Quantity})
+	}
+
+	if err := h.shipmentStore.CreateShipment(shipment); err != nil {
+		message := err.Error()
+		switch {
+		case message == "order not found":
+			utils.WriteError(w, http.StatusNotFound, err)
+		case strings.HasPrefix(message, "order is "), strings.HasSuffix(message, "already exists"), message == "nothing left to ship":
+			utils.WriteError(w, http.StatusConflict, err)
+		case strings.HasPrefix(message, "order item "), strings.HasPrefix(message, "only "):
+			utils.WriteError(w, http.StatusBadRequest, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, shipment)
+}
+
+// POST /api/v1/shipments/webhook - tracking updates pushed by carriers
+func (h *Handler) handleCarrierWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := verifyCarrierSignature(h.carrierSecret, body, r.Header.Get(CarrierSignatureHeader)); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var update types.CarrierTrackingUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid tracking update: %w", err))
+		return
+	}
+
+	if err := utils.Validate.Struct(update); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	shipment, err := h.shipmentStore.GetShipmentByTracking(update.Carrier, update.TrackingNumber)
+	if err != nil {
+		if err.Error() == "shipment not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	shipment, err = h.shipmentStore.AddShipmentEvent(shipment.ID, types.ShipmentEvent{
+		Status:      update.Status,
+		Description: update.Description,
+		Location:    update.Location,
+		OccurredAt:  update.OccurredAt,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"received":    true,
+		"shipment_id": shipment.ID,
+		"status":      shipment.Status,
+	})
+}
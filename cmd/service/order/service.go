@@ -0,0 +1,195 @@
+package order
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// encodeOrderCursor makes the position of an order in the list into an opaque
+// cursor, pointing backward for the previous page or forward for the next one
+func encodeOrderCursor(order types.OrderWithItems, backward bool) string {
+	direction := "next"
+	if backward {
+		direction = "prev"
+	}
+	raw := fmt.Sprintf("order:%s:%d:%d", direction, order.CreatedAt.UnixNano(), order.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOrderCursor(cursor string) (*types.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		parts := strings.Split(string(raw), ":")
+		if len(parts) == 4 && parts[0] == "order" && (parts[1] == "next" || parts[1] == "prev") {
+			createdAt, errTime := strconv.ParseInt(parts[2], 10, 64)
+			orderID, errID := strconv.Atoi(parts[3])
+			if errTime == nil && errID == nil && orderID > 0 {
+				return &types.OrderCursor{
+					CreatedAt: time.Unix(0, createdAt).UTC(),
+					ID:        orderID,
+					Backward:  parts[1] == "prev",
+				}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid cursor")
+}
+
+// buildOrderPage makes a page of limit orders out of orders fetched one beyond
+// the limit in the direction of the cursor, the extra order telling whether
+// there is more in that direction. Going forward from a cursor or an offset
+// there are always newer orders, going backward there are always older ones.
+func buildOrderPage(orders []types.OrderWithItems, limit int, cursor *types.OrderCursor, offset int) types.OrderListResponse {
+	page := types.OrderListResponse{Orders: orders}
+	if len(orders) == 0 {
+		return page
+	}
+
+	backward := cursor != nil && cursor.Backward
+	extra := len(orders) > limit
+
+	if backward {
+		// the extra order is the newest one, at the top of the page
+		if extra {
+			page.Orders = orders[len(orders)-limit:]
+			page.PrevCursor = encodeOrderCursor(page.Orders[0], true)
+		}
+		page.NextCursor = encodeOrderCursor(page.Orders[len(page.Orders)-1], false)
+	} else {
+		if extra {
+			page.Orders = orders[:limit]
+			page.NextCursor = encodeOrderCursor(page.Orders[limit-1], false)
+		}
+		if cursor != nil || offset > 0 {
+			page.PrevCursor = encodeOrderCursor(page.Orders[0], true)
+		}
+	}
+	page.HasMore = page.NextCursor != ""
+
+	return page
+}
+
+// adminOrderSortFields lists the fields the admin order list can be sorted by
+var adminOrderSortFields = []string{"id", "createdAt", "total", "status", "email"}
+
+// parseOrderSort parses a comma separated list of sort fields, each descending
+// when prefixed with "-", e.g. "-total,createdAt"
+func parseOrderSort(sort string) ([]types.OrderSort, error) {
+	var keys []types.OrderSort
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		descending := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+
+		if field == "" {
+			return nil, fmt.Errorf("invalid sort. Use fields separated by commas, e.g. -createdAt,total")
+		}
+		if !slices.Contains(adminOrderSortFields, field) {
+			return nil, fmt.Errorf("invalid sort field %s. Must be one of: %s", field, strings.Join(adminOrderSortFields, ", "))
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("sort field %s is listed twice", field)
+		}
+		seen[field] = true
+
+		keys = append(keys, types.OrderSort{Field: field, Descending: descending})
+	}
+	return keys, nil
+}
+
+// adminStatusTransitions lists the status changes staff can make. Refunds go
+// through returns and payments, which also move the money.
+var adminStatusTransitions = map[string][]string{
+	types.OrderStatusPending: {types.OrderStatusCancelled},
+	types.OrderStatusPaid:    {types.OrderStatusCompleted},
+}
+
+// checkAdminStatusTransition tells whether staff can move an order from one status to another
+func checkAdminStatusTransition(from, to string) error {
+	if !slices.Contains(adminStatusTransitions[from], to) {
+		return fmt.Errorf("cannot change order status from %s to %s", from, to)
+	}
+	return nil
+}
+
+// unshippedLine is what is left to ship of an order line
+type unshippedLine struct {
+	OrderItemID int
+	ProductID   int
+	Remaining   int
+}
+
+// planShipment checks the lines asked to be shipped against what is left of
+// the order, defaulting to everything left, and tells whether the order is
+// fully shipped after them
+func planShipment(lines []unshippedLine, requested []types.ShipmentItem) ([]types.ShipmentItem, bool, error) {
+	remaining := make(map[int]*unshippedLine, len(lines))
+	for i := range lines {
+		remaining[lines[i].OrderItemID] = &lines[i]
+	}
+
+	if len(requested) == 0 {
+		for _, line := range lines {
+			if line.Remaining > 0 {
+				requested = append(requested, types.ShipmentItem{OrderItemID: line.OrderItemID, Quantity: line.Remaining})
+			}
+		}
+		if len(requested) == 0 {
+			return nil, false, fmt.Errorf("nothing left to ship")
+		}
+	}
+
+	items := make([]types.ShipmentItem, 0, len(requested))
+	seen := make(map[int]bool)
+	for _, item := range requested {
+		line, ok := remaining[item.OrderItemID]
+		if !ok {
+			return nil, false, fmt.Errorf("order item %d is not part of the order", item.OrderItemID)
+		}
+		if seen[item.OrderItemID] {
+			return nil, false, fmt.Errorf("order item %d is listed twice", item.OrderItemID)
+		}
+		seen[item.OrderItemID] = true
+		if item.Quantity > line.Remaining {
+			return nil, false, fmt.Errorf("only %d of order item %d left to ship", line.Remaining, item.OrderItemID)
+		}
+
+		line.Remaining -= item.Quantity
+		items = append(items, types.ShipmentItem{OrderItemID: item.OrderItemID, ProductID: line.ProductID, Quantity: item.Quantity})
+	}
+
+	fullyShipped := true
+	for _, line := range lines {
+		if line.Remaining > 0 {
+			fullyShipped = false
+		}
+	}
+
+	return items, fullyShipped, nil
+}
+
+// verifyCarrierSignature checks the hex encoded HMAC-SHA256 a carrier signs
+// its tracking updates with
+func verifyCarrierSignature(secret, body []byte, signature string) error {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(secret) == 0 {
+		return fmt.Errorf("invalid carrier signature")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(expected, mac.Sum(nil)) {
+		return fmt.Errorf("invalid carrier signature")
+	}
+	return nil
+}
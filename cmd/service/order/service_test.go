@@ -0,0 +1,263 @@
+package order
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestOrderCursor(t *testing.T) {
+	order := types.OrderWithItems{ID: 42, CreatedAt: time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)}
+
+	for _, backward := range []bool{false, true} {
+		cursor, err := decodeOrderCursor(encodeOrderCursor(order, backward))
+		if err != nil {
+			t.Fatalf("Failed to decode cursor: %v", err)
+		}
+		if cursor.ID != 42 || !cursor.CreatedAt.Equal(order.CreatedAt) || cursor.Backward != backward {
+			t.Errorf("Expected the cursor of order 42 (backward %v), got %+v", backward, cursor)
+		}
+	}
+
+	for _, invalid := range []string{"", "not base64!", "bW92ZW1lbnQ6MTI", "b3JkZXI6dXA6MTow"} {
+		if _, err := decodeOrderCursor(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestBuildOrderPage(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	// orders 5 to 1, newest first, 3 and 2 created in the same second
+	orders := []types.OrderWithItems{
+		{ID: 5, CreatedAt: now.Add(3 * time.Second)},
+		{ID: 4, CreatedAt: now.Add(2 * time.Second)},
+		{ID: 3, CreatedAt: now.Add(time.Second)},
+		{ID: 2, CreatedAt: now.Add(time.Second)},
+		{ID: 1, CreatedAt: now},
+	}
+	ids := func(page types.OrderListResponse) []int {
+		var ids []int
+		for _, order := range page.Orders {
+			ids = append(ids, order.ID)
+		}
+		return ids
+	}
+	cursorID := func(t *testing.T, cursor string, backward bool) int {
+		t.Helper()
+		decoded, err := decodeOrderCursor(cursor)
+		if err != nil {
+			t.Fatalf("Failed to decode cursor %q: %v", cursor, err)
+		}
+		if decoded.Backward != backward {
+			t.Errorf("Expected cursor backward %v, got %v", backward, decoded.Backward)
+		}
+		return decoded.ID
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		page := buildOrderPage(orders[:3], 2, nil, 0)
+		if got := ids(page); len(got) != 2 || got[0] != 5 || got[1] != 4 {
+			t.Errorf("Expected orders 5 and 4, got %v", got)
+		}
+		if !page.HasMore || cursorID(t, page.NextCursor, false) != 4 || page.PrevCursor != "" {
+			t.Errorf("Expected a next cursor after order 4 and no previous one, got %+v", page)
+		}
+	})
+
+	t.Run("next page", func(t *testing.T) {
+		page := buildOrderPage(orders[2:5], 2, &types.OrderCursor{ID: 4}, 0)
+		if got := ids(page); len(got) != 2 || got[0] != 3 || got[1] != 2 {
+			t.Errorf("Expected orders 3 and 2, got %v", got)
+		}
+		if cursorID(t, page.NextCursor, false) != 2 || cursorID(t, page.PrevCursor, true) != 3 {
+			t.Errorf("Expected cursors around orders 3 and 2, got %+v", page)
+		}
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		page := buildOrderPage(orders[4:], 2, &types.OrderCursor{ID: 2}, 0)
+		if got := ids(page); len(got) != 1 || got[0] != 1 {
+			t.Errorf("Expected order 1, got %v", got)
+		}
+		if page.HasMore || page.NextCursor != "" || cursorID(t, page.PrevCursor, true) != 1 {
+			t.Errorf("Expected only a previous cursor, got %+v", page)
+		}
+	})
+
+	t.Run("previous page", func(t *testing.T) {
+		// read backward from order 2: 3, 4 and the extra 5, flipped by the store
+		page := buildOrderPage(orders[0:3], 2, &types.OrderCursor{ID: 2, Backward: true}, 0)
+		if got := ids(page); len(got) != 2 || got[0] != 4 || got[1] != 3 {
+			t.Errorf("Expected orders 4 and 3, got %v", got)
+		}
+		if cursorID(t, page.PrevCursor, true) != 4 || cursorID(t, page.NextCursor, false) != 3 || !page.HasMore {
+			t.Errorf("Expected cursors around orders 4 and 3, got %+v", page)
+		}
+	})
+
+	t.Run("previous page at the top", func(t *testing.T) {
+		page := buildOrderPage(orders[0:2], 2, &types.OrderCursor{ID: 3, Backward: true}, 0)
+		if got := ids(page); len(got) != 2 || got[0] != 5 || got[1] != 4 {
+			t.Errorf("Expected orders 5 and 4, got %v", got)
+		}
+		if page.PrevCursor != "" || cursorID(t, page.NextCursor, false) != 4 {
+			t.Errorf("Expected only a next cursor, got %+v", page)
+		}
+	})
+
+	t.Run("offset page", func(t *testing.T) {
+		page := buildOrderPage(orders[2:4], 2, nil, 2)
+		if page.HasMore || cursorID(t, page.PrevCursor, true) != 3 {
+			t.Errorf("Expected the last offset page with a previous cursor, got %+v", page)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		page := buildOrderPage(nil, 2, &types.OrderCursor{ID: 1}, 0)
+		if page.HasMore || page.NextCursor != "" || page.PrevCursor != "" {
+			t.Errorf("Expected an empty page without cursors, got %+v", page)
+		}
+	})
+}
+
+func TestParseOrderSort(t *testing.T) {
+	keys, err := parseOrderSort("-total, createdAt")
+	if err != nil {
+		t.Fatalf("Failed to parse sort: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != (types.OrderSort{Field: "total", Descending: true}) || keys[1] != (types.OrderSort{Field: "createdAt"}) {
+		t.Errorf("Expected total descending then createdAt, got %+v", keys)
+	}
+
+	for _, invalid := range []string{"password", "total,,id", "-", "total,-total"} {
+		if _, err := parseOrderSort(invalid); err == nil {
+			t.Errorf("Expected sort %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestAdminOrderOrderBy(t *testing.T) {
+	tests := []struct {
+		sort     []types.OrderSort
+		expected string
+	}{
+		{nil, " ORDER BY o.createdAt DESC, o.id DESC"},
+		{[]types.OrderSort{{Field: "total", Descending: true}, {Field: "email"}}, " ORDER BY o.total / o.exchange_rate DESC, u.email, o.id DESC"},
+		{[]types.OrderSort{{Field: "status"}, {Field: "id"}}, " ORDER BY o.status, o.id"},
+	}
+
+	for _, tt := range tests {
+		orderBy, err := adminOrderOrderBy(tt.sort)
+		if err != nil {
+			t.Fatalf("Failed to build ORDER BY for %+v: %v", tt.sort, err)
+		}
+		if orderBy != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, orderBy)
+		}
+	}
+
+	if _, err := adminOrderOrderBy([]types.OrderSort{{Field: "password"}}); err == nil {
+		t.Error("Expected an unknown field to be rejected")
+	}
+}
+
+func TestCheckAdminStatusTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{types.OrderStatusPaid, types.OrderStatusCompleted, true},
+		{types.OrderStatusPending, types.OrderStatusCancelled, true},
+		{types.OrderStatusPending, types.OrderStatusCompleted, false},
+		{types.OrderStatusPaid, types.OrderStatusCancelled, false},
+		{types.OrderStatusCompleted, types.OrderStatusCompleted, false},
+		{types.OrderStatusRefunded, types.OrderStatusCancelled, false},
+	}
+
+	for _, tt := range tests {
+		err := checkAdminStatusTransition(tt.from, tt.to)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s to %s: expected allowed %v, got %v", tt.from, tt.to, tt.allowed, err)
+		}
+	}
+}
+
+func TestPlanShipment(t *testing.T) {
+	lines := func() []unshippedLine {
+		return []unshippedLine{
+			{OrderItemID: 1, ProductID: 10, Remaining: 2},
+			{OrderItemID: 2, ProductID: 20, Remaining: 1},
+			{OrderItemID: 3, ProductID: 30, Remaining: 0}, // already shipped
+		}
+	}
+
+	t.Run("everything left by default", func(t *testing.T) {
+		items, fullyShipped, err := planShipment(lines(), nil)
+		if err != nil {
+			t.Fatalf("Failed to plan shipment: %v", err)
+		}
+		if len(items) != 2 || items[0].Quantity != 2 || items[1].ProductID != 20 || !fullyShipped {
+			t.Errorf("Expected both lines left in full, got %+v (fully shipped %v)", items, fullyShipped)
+		}
+	})
+
+	t.Run("some lines", func(t *testing.T) {
+		items, fullyShipped, err := planShipment(lines(), []types.ShipmentItem{{OrderItemID: 1, Quantity: 1}})
+		if err != nil {
+			t.Fatalf("Failed to plan shipment: %v", err)
+		}
+		if len(items) != 1 || items[0].ProductID != 10 || fullyShipped {
+			t.Errorf("Expected a partial shipment of line 1, got %+v (fully shipped %v)", items, fullyShipped)
+		}
+	})
+
+	tests := []struct {
+		name      string
+		lines     []unshippedLine
+		requested []types.ShipmentItem
+		expected  string
+	}{
+		{"nothing left", []unshippedLine{{OrderItemID: 3, Remaining: 0}}, nil, "nothing left to ship"},
+		{"another order", lines(), []types.ShipmentItem{{OrderItemID: 9, Quantity: 1}}, "order item 9 is not part of the order"},
+		{"too many", lines(), []types.ShipmentItem{{OrderItemID: 2, Quantity: 2}}, "only 1 of order item 2 left to ship"},
+		{"twice", lines(), []types.ShipmentItem{{OrderItemID: 1, Quantity: 1}, {OrderItemID: 1, Quantity: 1}}, "order item 1 is listed twice"},
+	}
+	for _, tt := range tests {
+		if _, _, err := planShipment(tt.lines, tt.requested); err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestVerifyCarrierSignature(t *testing.T) {
+	secret := []byte("whsec_carrier")
+	body := []byte(`{"carrier":"ups","trackingNumber":"1Z0001","status":"delivered"}`)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	if err := verifyCarrierSignature(secret, body, signature); err != nil {
+		t.Errorf("Expected the signature to verify, got %v", err)
+	}
+
+	for name, tt := range map[string]struct {
+		secret    []byte
+		body      []byte
+		signature string
+	}{
+		"tampered body":  {secret, append(body, ' '), signature},
+		"other secret":   {[]byte("other"), body, signature},
+		"no secret":      {nil, body, signature},
+		"not hex":        {secret, body, "not-hex"},
+		"missing header": {secret, body, ""},
+	} {
+		if err := verifyCarrierSignature(tt.secret, tt.body, tt.signature); err == nil {
+			t.Errorf("%s: expected the signature to be rejected", name)
+		}
+	}
+}
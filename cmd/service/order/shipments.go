@@ -0,0 +1,331 @@
+package order
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// shippableStatuses lists the statuses of orders that can still ship
+var shippableStatuses = []string{types.OrderStatusPaid, types.OrderStatusPartiallyShipped}
+
+// CreateShipment ships lines of a paid order. The order is locked while what
+// is left to ship is checked, so two shipments can't send the same units.
+func (s *Store) CreateShipment(shipment *types.Shipment) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM orders WHERE id = ? FOR UPDATE", shipment.OrderID).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("order not found")
+		}
+		return fmt.Errorf("failed to lock order: %w", err)
+	}
+	if !slices.Contains(shippableStatuses, status) {
+		return fmt.Errorf("order is %s, only paid orders can be shipped", status)
+	}
+
+	lines, err := getUnshippedLines(tx, shipment.OrderID)
+	if err != nil {
+		return err
+	}
+
+	items, fullyShipped, err := planShipment(lines, shipment.Items)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := tx.Exec(`
+		INSERT INTO shipments (order_id, carrier, tracking_number, status, shipped_at, last_event_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, shipment.OrderID, shipment.Carrier, shipment.TrackingNumber, types.ShipmentStatusShipped, now, now)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return fmt.Errorf("shipment %s %s already exists", shipment.Carrier, shipment.TrackingNumber)
+		}
+		return fmt.Errorf("failed to create shipment: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get shipment ID: %w", err)
+	}
+
+	for _, item := range items {
+		_, err := tx.Exec(
+			"INSERT INTO shipment_items (shipment_id, order_item_id, quantity) VALUES (?, ?, ?)",
+			id, item.OrderItemID, item.Quantity,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create shipment item: %w", err)
+		}
+	}
+
+	event := types.ShipmentEvent{Status: types.ShipmentStatusShipped, Description: "Handed to carrier", OccurredAt: now}
+	if err := createShipmentEvent(tx, int(id), event); err != nil {
+		return err
+	}
+
+	orderStatus := types.OrderStatusPartiallyShipped
+	if fullyShipped {
+		orderStatus = types.OrderStatusCompleted
+	}
+	if _, err := tx.Exec("UPDATE orders SET status = ? WHERE id = ?", orderStatus, shipment.OrderID); err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	shipment.ID = int(id)
+	shipment.Status = types.ShipmentStatusShipped
+	shipment.Items = items
+	shipment.Events = []types.ShipmentEvent{event}
+	shipment.ShippedAt = now
+
+	return nil
+}
+
+// getUnshippedLines returns what is left to ship of each line of an order,
+// units being returned (any return not rejected) are not shipped any more
+func getUnshippedLines(tx *sql.Tx, orderID int) ([]unshippedLine, error) {
+	rows, err := tx.Query(`
+		SELECT oi.id, COALESCE(oi.productId, 0),
+			GREATEST(oi.quantity - COALESCE(s.shipped, 0) - COALESCE(r.returned, 0), 0)
+		FROM order_items oi
+		LEFT JOIN (
+			SELECT order_item_id, SUM(quantity) AS shipped
+			FROM shipment_items
+			GROUP BY order_item_id
+		) s ON s.order_item_id = oi.id
+		LEFT JOIN (
+			SELECT ri.order_item_id, SUM(ri.quantity) AS returned
+			FROM return_items ri
+			JOIN returns r ON r.id = ri.return_id
+			WHERE r.order_id = ? AND r.status <> 'rejected'
+			GROUP BY ri.order_item_id
+		) r ON r.order_item_id = oi.id
+		WHERE oi.orderId = ?
+		ORDER BY oi.id
+	`, orderID, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unshipped order lines: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []unshippedLine
+	for rows.Next() {
+		var line unshippedLine
+		if err := rows.Scan(&line.OrderItemID, &line.ProductID, &line.Remaining); err != nil {
+			return nil, fmt.Errorf("failed to scan unshipped order line: %w", err)
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// createShipmentEvent records a tracking update; a carrier resending an update
+// is ignored
+func createShipmentEvent(tx *sql.Tx, shipmentID int, event types.ShipmentEvent) error {
+	_, err := tx.Exec(`
+		INSERT IGNORE INTO shipment_events (shipment_id, status, description, location, occurred_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, shipmentID, event.Status, event.Description, event.Location, event.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to create shipment event: %w", err)
+	}
+
+	return nil
+}
+
+// GetShipmentByTracking retrieves the shipment a carrier knows by a tracking number
+func (s *Store) GetShipmentByTracking(carrier, trackingNumber string) (*types.Shipment, error) {
+	var shipmentID int
+	err := s.db.QueryRow(
+		"SELECT id FROM shipments WHERE carrier = ? AND tracking_number = ?",
+		carrier, trackingNumber,
+	).Scan(&shipmentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("shipment not found")
+		}
+		return nil, fmt.Errorf("failed to get shipment: %w", err)
+	}
+
+	return s.getShipment(shipmentID)
+}
+
+// AddShipmentEvent records a tracking update. The shipment only takes its
+// status when it is the latest update, as carriers may send them out of order.
+func (s *Store) AddShipmentEvent(shipmentID int, event types.ShipmentEvent) (*types.Shipment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	event.OccurredAt = event.OccurredAt.UTC().Truncate(time.Second)
+	if err := createShipmentEvent(tx, shipmentID, event); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE shipments
+		SET status = ?, last_event_at = ?,
+		    delivered_at = IF(? = 'delivered', ?, delivered_at)
+		WHERE id = ? AND last_event_at <= ?
+	`, event.Status, event.OccurredAt, event.Status, event.OccurredAt, shipmentID, event.OccurredAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update shipment status: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getShipment(shipmentID)
+}
+
+func (s *Store) getShipment(shipmentID int) (*types.Shipment, error) {
+	shipments, err := s.getShipments("s.id = ?", shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(shipments) == 0 {
+		return nil, fmt.Errorf("shipment not found")
+	}
+
+	return &shipments[0], nil
+}
+
+// loadOrderShipments fills in the shipments of the orders, oldest first
+func (s *Store) loadOrderShipments(orders ...*types.OrderWithItems) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	placeholders, args, index := orderIndex(orders)
+	shipments, err := s.getShipments(fmt.Sprintf("s.order_id IN (%s)", placeholders), args...)
+	if err != nil {
+		return err
+	}
+
+	for _, shipment := range shipments {
+		order := index[shipment.OrderID]
+		order.Shipments = append(order.Shipments, shipment)
+	}
+
+	return nil
+}
+
+// getShipments retrieves the shipments matching a condition on shipments s
+// with their items and tracking history
+func (s *Store) getShipments(condition string, args ...any) ([]types.Shipment, error) {
+	rows, err := s.db.Query(`
+		SELECT s.id, s.order_id, s.carrier, s.tracking_number, s.status, s.shipped_at, s.delivered_at
+		FROM shipments s
+		WHERE `+condition+`
+		ORDER BY s.id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipments: %w", err)
+	}
+
+	shipments := []types.Shipment{}
+	for rows.Next() {
+		var shipment types.Shipment
+		var deliveredAt sql.NullTime
+		err := rows.Scan(
+			&shipment.ID,
+			&shipment.OrderID,
+			&shipment.Carrier,
+			&shipment.TrackingNumber,
+			&shipment.Status,
+			&shipment.ShippedAt,
+			&deliveredAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan shipment: %w", err)
+		}
+		if deliveredAt.Valid {
+			shipment.DeliveredAt = &deliveredAt.Time
+		}
+		shipment.Items = []types.ShipmentItem{}
+		shipment.Events = []types.ShipmentEvent{}
+		shipments = append(shipments, shipment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get shipments: %w", err)
+	}
+	if len(shipments) == 0 {
+		return shipments, nil
+	}
+
+	index := make(map[int]*types.Shipment, len(shipments))
+	shipmentIDs := make([]any, len(shipments))
+	for i := range shipments {
+		index[shipments[i].ID] = &shipments[i]
+		shipmentIDs[i] = shipments[i].ID
+	}
+	placeholders := strings.Repeat(",?", len(shipments))[1:]
+
+	rows, err = s.db.Query(fmt.Sprintf(`
+		SELECT si.shipment_id, si.order_item_id, COALESCE(oi.productId, 0), si.quantity
+		FROM shipment_items si
+		JOIN order_items oi ON oi.id = si.order_item_id
+		WHERE si.shipment_id IN (%s)
+		ORDER BY si.order_item_id
+	`, placeholders), shipmentIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipment items: %w", err)
+	}
+	for rows.Next() {
+		var shipmentID int
+		var item types.ShipmentItem
+		if err := rows.Scan(&shipmentID, &item.OrderItemID, &item.ProductID, &item.Quantity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan shipment item: %w", err)
+		}
+		index[shipmentID].Items = append(index[shipmentID].Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get shipment items: %w", err)
+	}
+
+	rows, err = s.db.Query(fmt.Sprintf(`
+		SELECT shipment_id, status, description, location, occurred_at
+		FROM shipment_events
+		WHERE shipment_id IN (%s)
+		ORDER BY occurred_at, id
+	`, placeholders), shipmentIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipment events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shipmentID int
+		var event types.ShipmentEvent
+		if err := rows.Scan(&shipmentID, &event.Status, &event.Description, &event.Location, &event.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan shipment event: %w", err)
+		}
+		index[shipmentID].Events = append(index[shipmentID].Events, event)
+	}
+
+	return shipments, rows.Err()
+}
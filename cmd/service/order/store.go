@@ -3,6 +3,8 @@ package order
 import (
 	"database/sql"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 )
@@ -15,11 +17,35 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
+// CreateOrder stores an order together with its shipping and billing
+// addresses. The formatted address is derived from the shipping address.
 func (s *Store) CreateOrder(order types.Order) (int, error) {
-	rew, err := s.db.Exec(
-		"INSERT INTO orders (userId, total, status, address) VALUES (?, ?, ?, ?)",
+	if order.Currency == "" {
+		order.Currency = types.DefaultCurrency
+	}
+	if order.ExchangeRate == 0 {
+		order.ExchangeRate = types.RateOne
+	}
+	if order.ShippingAddress != nil {
+		order.Address = order.ShippingAddress.Format()
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rew, err := tx.Exec(
+		"INSERT INTO orders (userId, subtotal, tax, shipping_method_id, shipping_cost, total, currency, exchange_rate, status, address) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		order.UserID,
+		order.Subtotal,
+		order.Tax,
+		order.ShippingMethodID,
+		order.ShippingCost,
 		order.Total,
+		order.Currency,
+		order.ExchangeRate,
 		order.Status,
 		order.Address,
 	)
@@ -30,31 +56,140 @@ func (s *Store) CreateOrder(order types.Order) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+
+	addresses := map[string]*types.OrderAddress{
+		types.OrderAddressShipping: order.ShippingAddress,
+		types.OrderAddressBilling:  order.BillingAddress,
+	}
+	for addressType, address := range addresses {
+		if address == nil {
+			continue
+		}
+		if err := createOrderAddress(tx, int(id), addressType, address); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
 	return int(id), nil
 }
 
+func createOrderAddress(tx *sql.Tx, orderID int, addressType string, address *types.OrderAddress) error {
+	_, err := tx.Exec(`
+		INSERT INTO order_addresses
+		(order_id, type, title, first_name, last_name, company, address_line_1, address_line_2,
+		 city, state_province, postal_code, country, phone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		orderID,
+		addressType,
+		address.Title,
+		address.FirstName,
+		address.LastName,
+		address.Company,
+		address.AddressLine1,
+		address.AddressLine2,
+		address.City,
+		address.StateProvince,
+		address.PostalCode,
+		address.Country,
+		address.Phone,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create %s address: %w", addressType, err)
+	}
+	return nil
+}
+
+// CreateOrderItem stores an order line. Its unit cost is taken from the stock
+// holds of the order, which record the cost of the goods when they were reserved.
+// A bundle line is stored with its component breakdown and costs what its
+// components cost.
 func (s *Store) CreateOrderItem(orderItem types.OrderItem) error {
-	_, err := s.db.Exec(
-		"INSERT INTO order_items (orderId, productId, quantity, price) VALUES (?, ?, ?, ?)",
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO order_items (orderId, productId, product_name, product_sku, product_image, quantity, price, unit_cost, tax_rate, subtotal, tax, total)
+		VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?, (
+			SELECT ROUND(SUM(h.quantity * h.unit_cost) / SUM(h.quantity), 2)
+			FROM stock_holds h
+			WHERE h.order_id = ? AND h.product_id = ?
+		), ?, ?, ?, ?)
+	`,
 		orderItem.OrderID,
 		orderItem.ProductID,
+		orderItem.ProductName,
+		orderItem.ProductSKU,
+		orderItem.ProductImage,
 		orderItem.Quantity,
 		orderItem.Price,
+		orderItem.OrderID,
+		orderItem.ProductID,
+		orderItem.TaxRate,
+		orderItem.Subtotal,
+		orderItem.Tax,
+		orderItem.Total,
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	if len(orderItem.Components) == 0 {
+		return tx.Commit()
+	}
+
+	itemID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	// components snapshot their product as well
+	for _, component := range orderItem.Components {
+		_, err := tx.Exec(`
+			INSERT INTO order_item_components (order_item_id, product_id, product_name, product_sku, quantity, unit_cost)
+			SELECT ?, p.id, p.name, p.sku, ?, (
+				SELECT ROUND(SUM(h.quantity * h.unit_cost) / SUM(h.quantity), 2)
+				FROM stock_holds h
+				WHERE h.order_id = ? AND h.product_id = p.id
+			)
+			FROM products p
+			WHERE p.id = ?
+		`, itemID, component.Quantity, orderItem.OrderID, component.ProductID)
+		if err != nil {
+			return fmt.Errorf("failed to create order item component: %w", err)
+		}
+	}
+
+	// the cost of the bundle stays unknown while the cost of any component is
+	_, err = tx.Exec(`
+		UPDATE order_items SET unit_cost = (
+			SELECT IF(COUNT(*) = COUNT(c.unit_cost), ROUND(SUM(c.quantity * c.unit_cost) / ?, 2), NULL)
+			FROM order_item_components c
+			WHERE c.order_item_id = ?
+		)
+		WHERE id = ?
+	`, orderItem.Quantity, itemID, itemID)
+	if err != nil {
+		return fmt.Errorf("failed to update bundle cost: %w", err)
+	}
+
+	return tx.Commit()
 }
 
-// GetUserOrders retrieves all orders for a user with filtering and pagination
-func (s *Store) GetUserOrders(userID int, filters types.OrderFilters) ([]types.OrderWithItems, error) {
-	query := `
-		SELECT DISTINCT o.id, o.userId, o.total, o.status, o.address, o.createdAt
-		FROM orders o
-		WHERE o.userId = ?
-	`
-	args := []interface{}{userID}
+// orderColumns lists the orders columns read by scanRowIntoOrder
+const orderColumns = "o.id, o.userId, o.subtotal, o.tax, o.shipping_method_id, o.shipping_cost, o.total, o.refunded_amount, o.currency, o.exchange_rate, o.status, o.address, o.createdAt"
+
+// orderFilterConditions builds the conditions of the order filters, each
+// starting with AND, for a query on orders o
+func orderFilterConditions(filters types.OrderFilters) (string, []any) {
+	query := ""
+	args := []any{}
 
 	// Add status filter if provided
 	if filters.Status != nil {
@@ -73,15 +208,45 @@ func (s *Store) GetUserOrders(userID int, filters types.OrderFilters) ([]types.O
 		args = append(args, *filters.ToDate)
 	}
 
-	// Add ordering and pagination
-	query += " ORDER BY o.createdAt DESC"
+	if filters.Country != nil {
+		query += " AND EXISTS (SELECT 1 FROM order_addresses a WHERE a.order_id = o.id AND a.type = 'shipping' AND a.country = ?)"
+		args = append(args, *filters.Country)
+	}
+
+	return query, args
+}
+
+// GetUserOrders retrieves all orders for a user with filtering and pagination
+func (s *Store) GetUserOrders(userID int, filters types.OrderFilters) ([]types.OrderWithItems, error) {
+	query := `
+		SELECT DISTINCT ` + orderColumns + `
+		FROM orders o
+		WHERE o.userId = ?
+	`
+	conditions, args := orderFilterConditions(filters)
+	query += conditions
+	args = append([]any{userID}, args...)
+
+	// Add ordering and pagination, newest first with ties broken by ID
+	cursor := filters.Cursor
+	switch {
+	case cursor == nil:
+		query += " ORDER BY o.createdAt DESC, o.id DESC"
+	case cursor.Backward:
+		// the page before the cursor is read upwards and flipped below
+		query += " AND (o.createdAt > ? OR (o.createdAt = ? AND o.id > ?)) ORDER BY o.createdAt ASC, o.id ASC"
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	default:
+		query += " AND (o.createdAt < ? OR (o.createdAt = ? AND o.id < ?)) ORDER BY o.createdAt DESC, o.id DESC"
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
 
 	if filters.Limit > 0 {
 		query += " LIMIT ?"
 		args = append(args, filters.Limit)
 	}
 
-	if filters.Offset > 0 {
+	if filters.Offset > 0 && cursor == nil {
 		query += " OFFSET ?"
 		args = append(args, filters.Offset)
 	}
@@ -90,31 +255,31 @@ func (s *Store) GetUserOrders(userID int, filters types.OrderFilters) ([]types.O
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user orders: %w", err)
 	}
-	defer rows.Close()
 
 	var orders []types.OrderWithItems
 	for rows.Next() {
-		var order types.OrderWithItems
-		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.Total,
-			&order.Status,
-			&order.Address,
-			&order.CreatedAt,
-		)
+		order, err := scanRowIntoOrder(rows)
 		if err != nil {
+			rows.Close()
 			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
+		orders = append(orders, *order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get user orders: %w", err)
+	}
+	if cursor != nil && cursor.Backward {
+		slices.Reverse(orders)
+	}
 
-		// Get items for this order
-		items, err := s.getOrderItems(order.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get order items for order %d: %w", order.ID, err)
-		}
-		order.Items = items
-
-		orders = append(orders, order)
+	// the items and addresses of the whole page are loaded at once
+	page := make([]*types.OrderWithItems, len(orders))
+	for i := range orders {
+		page[i] = &orders[i]
+	}
+	if err := s.loadOrderDetails(page...); err != nil {
+		return nil, err
 	}
 
 	return orders, nil
@@ -123,21 +288,12 @@ func (s *Store) GetUserOrders(userID int, filters types.OrderFilters) ([]types.O
 // GetOrderByID retrieves a specific order by ID for a user
 func (s *Store) GetOrderByID(orderID, userID int) (*types.OrderWithItems, error) {
 	query := `
-		SELECT o.id, o.userId, o.total, o.status, o.address, o.createdAt
+		SELECT ` + orderColumns + `
 		FROM orders o
 		WHERE o.id = ? AND o.userId = ?
 	`
 
-	var order types.OrderWithItems
-	err := s.db.QueryRow(query, orderID, userID).Scan(
-		&order.ID,
-		&order.UserID,
-		&order.Total,
-		&order.Status,
-		&order.Address,
-		&order.CreatedAt,
-	)
-
+	order, err := scanRowIntoOrder(s.db.QueryRow(query, orderID, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("order not found or not owned by user")
@@ -145,38 +301,71 @@ func (s *Store) GetOrderByID(orderID, userID int) (*types.OrderWithItems, error)
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	// Get items for this order
-	items, err := s.getOrderItems(order.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get order items: %w", err)
+	// Get items, addresses and shipments for this order
+	if err := s.loadOrderDetails(order); err != nil {
+		return nil, err
+	}
+	if err := s.loadOrderShipments(order); err != nil {
+		return nil, err
 	}
-	order.Items = items
 
-	return &order, nil
+	return order, nil
 }
 
-// GetOrdersCount returns the total count of orders for a user with filters
-func (s *Store) GetOrdersCount(userID int, filters types.OrderFilters) (int, error) {
-	query := "SELECT COUNT(*) FROM orders WHERE userId = ?"
-	args := []interface{}{userID}
+// GetOrder retrieves an order by ID regardless of its owner, for internal
+// processing such as payments
+func (s *Store) GetOrder(orderID int) (*types.OrderWithItems, error) {
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders o
+		WHERE o.id = ?
+	`
 
-	// Add status filter if provided
-	if filters.Status != nil {
-		query += " AND status = ?"
-		args = append(args, *filters.Status)
+	order, err := scanRowIntoOrder(s.db.QueryRow(query, orderID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("order not found")
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	// Add date range filters if provided
-	if filters.FromDate != nil {
-		query += " AND createdAt >= ?"
-		args = append(args, *filters.FromDate)
+	if err := s.loadOrderDetails(order); err != nil {
+		return nil, err
 	}
 
-	if filters.ToDate != nil {
-		query += " AND createdAt <= ?"
-		args = append(args, *filters.ToDate)
+	return order, nil
+}
+
+// UpdateOrderStatus moves an order from one status to another. The update only
+// applies while the order is still in fromStatus, so concurrent transitions
+// (e.g. a duplicated webhook) cannot both succeed.
+func (s *Store) UpdateOrderStatus(orderID int, fromStatus, toStatus string) error {
+	result, err := s.db.Exec(
+		"UPDATE orders SET status = ? WHERE id = ? AND status = ?",
+		toStatus, orderID, fromStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
+	if rowsAffected == 0 {
+		return fmt.Errorf("order not found or not in status %s", fromStatus)
+	}
+
+	return nil
+}
+
+// GetOrdersCount returns the total count of orders for a user with filters
+func (s *Store) GetOrdersCount(userID int, filters types.OrderFilters) (int, error) {
+	conditions, args := orderFilterConditions(filters)
+	query := "SELECT COUNT(*) FROM orders o WHERE o.userId = ?" + conditions
+	args = append([]any{userID}, args...)
+
 	var count int
 	err := s.db.QueryRow(query, args...).Scan(&count)
 	if err != nil {
@@ -186,24 +375,104 @@ func (s *Store) GetOrdersCount(userID int, filters types.OrderFilters) (int, err
 	return count, nil
 }
 
-// getOrderItems retrieves all items for a specific order with product details
-func (s *Store) getOrderItems(orderID int) ([]types.OrderItemWithProduct, error) {
-	query := `
-		SELECT 
-			oi.id, oi.orderId, oi.productId, oi.quantity, oi.price,
-			p.name, p.image
-		FROM order_items oi
-		JOIN products p ON oi.productId = p.id
-		WHERE oi.orderId = ?
-		ORDER BY oi.id
-	`
+// loadOrderDetails fills in the items and addresses of the orders. The number
+// of queries doesn't depend on the number of orders.
+func (s *Store) loadOrderDetails(orders ...*types.OrderWithItems) error {
+	if err := s.loadOrderItems(orders...); err != nil {
+		return fmt.Errorf("failed to get order items: %w", err)
+	}
+	return s.loadOrderAddresses(orders...)
+}
+
+// orderIndex returns the IN placeholders and arguments for the IDs of the
+// orders, along with the orders by ID
+func orderIndex(orders []*types.OrderWithItems) (string, []any, map[int]*types.OrderWithItems) {
+	placeholders := strings.Repeat("?,", len(orders)-1) + "?"
+	args := make([]any, len(orders))
+	index := make(map[int]*types.OrderWithItems, len(orders))
+	for i, order := range orders {
+		args[i] = order.ID
+		index[order.ID] = order
+	}
+	return placeholders, args, index
+}
+
+// loadOrderAddresses fills in the shipping and billing addresses of the orders.
+// Orders placed before addresses were stored keep their formatted address only.
+func (s *Store) loadOrderAddresses(orders ...*types.OrderWithItems) error {
+	if len(orders) == 0 {
+		return nil
+	}
 
-	rows, err := s.db.Query(query, orderID)
+	placeholders, args, index := orderIndex(orders)
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT order_id, type, title, first_name, last_name, company, address_line_1, address_line_2,
+		       city, state_province, postal_code, country, phone
+		FROM order_addresses
+		WHERE order_id IN (%s)
+	`, placeholders), args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query order items: %w", err)
+		return fmt.Errorf("failed to query order addresses: %w", err)
 	}
 	defer rows.Close()
 
+	for rows.Next() {
+		var orderID int
+		var addressType string
+		var address types.OrderAddress
+		err := rows.Scan(
+			&orderID,
+			&addressType,
+			&address.Title,
+			&address.FirstName,
+			&address.LastName,
+			&address.Company,
+			&address.AddressLine1,
+			&address.AddressLine2,
+			&address.City,
+			&address.StateProvince,
+			&address.PostalCode,
+			&address.Country,
+			&address.Phone,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan order address: %w", err)
+		}
+
+		order := index[orderID]
+		switch addressType {
+		case types.OrderAddressShipping:
+			order.ShippingAddress = &address
+			order.Address = address.Format()
+		case types.OrderAddressBilling:
+			order.BillingAddress = &address
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadOrderItems fills in the items of the orders with their fulfilment and
+// bundle breakdown, the amounts are in the currency of each order
+func (s *Store) loadOrderItems(orders ...*types.OrderWithItems) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	placeholders, args, index := orderIndex(orders)
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT 
+			oi.id, oi.orderId, COALESCE(oi.productId, 0), oi.quantity, oi.price,
+			oi.tax_rate, oi.subtotal, oi.tax, oi.total,
+			oi.product_name, COALESCE(oi.product_sku, ''), oi.product_image
+		FROM order_items oi
+		WHERE oi.orderId IN (%s)
+		ORDER BY oi.orderId, oi.id
+	`, placeholders), args...)
+	if err != nil {
+		return fmt.Errorf("failed to query order items: %w", err)
+	}
+
 	var items []types.OrderItemWithProduct
 	for rows.Next() {
 		var item types.OrderItemWithProduct
@@ -213,14 +482,160 @@ func (s *Store) getOrderItems(orderID int) ([]types.OrderItemWithProduct, error)
 			&item.ProductID,
 			&item.Quantity,
 			&item.Price,
+			&item.TaxRate,
+			&item.Subtotal,
+			&item.Tax,
+			&item.Total,
 			&item.ProductName,
+			&item.ProductSKU,
 			&item.ProductImage,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order item: %w", err)
+			rows.Close()
+			return fmt.Errorf("failed to scan order item: %w", err)
 		}
+		currency := index[item.OrderID].Currency
+		item.Price.Currency = currency
+		item.Subtotal.Currency = currency
+		item.Tax.Currency = currency
+		item.Total.Currency = currency
 		items = append(items, item)
 	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	fulfilment, err := s.getOrderFulfilment(placeholders, args)
+	if err != nil {
+		return err
+	}
+
+	components, err := s.getOrderItemComponents(placeholders, args, fulfilment)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		item.Fulfilment = fulfilment[item.OrderID][item.ProductID]
+		for _, allocation := range item.Fulfilment {
+			if allocation.Backordered {
+				item.Backordered += allocation.Quantity
+			}
+		}
+		item.Components = components[item.ID]
+
+		order := index[item.OrderID]
+		order.Items = append(order.Items, item)
+	}
+
+	return nil
+}
+
+// getOrderItemComponents returns, per order item, the component breakdown of
+// the bundle lines of the orders
+func (s *Store) getOrderItemComponents(placeholders string, orderIDs []any, fulfilment map[int]map[int][]types.StockAllocation) (map[int][]types.OrderItemComponent, error) {
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT oi.orderId, c.order_item_id, COALESCE(c.product_id, 0), c.product_name, COALESCE(c.product_sku, ''), c.quantity, c.unit_cost
+		FROM order_item_components c
+		JOIN order_items oi ON oi.id = c.order_item_id
+		WHERE oi.orderId IN (%s)
+		ORDER BY c.id
+	`, placeholders), orderIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order item components: %w", err)
+	}
+	defer rows.Close()
+
+	components := make(map[int][]types.OrderItemComponent)
+	for rows.Next() {
+		var orderID, itemID int
+		var component types.OrderItemComponent
+		err := rows.Scan(&orderID, &itemID, &component.ProductID, &component.ProductName, &component.ProductSKU, &component.Quantity, &component.UnitCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order item component: %w", err)
+		}
+		component.Fulfilment = fulfilment[orderID][component.ProductID]
+		components[itemID] = append(components[itemID], component)
+	}
+
+	return components, rows.Err()
+}
+
+// getOrderFulfilment returns, per order and product, the warehouses the stock
+// is held or was shipped from, units ordered beyond stock listed separately
+func (s *Store) getOrderFulfilment(placeholders string, orderIDs []any) (map[int]map[int][]types.StockAllocation, error) {
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT h.order_id, h.product_id, h.warehouse_id, w.code, h.backordered, SUM(h.quantity)
+		FROM stock_holds h
+		JOIN warehouses w ON w.id = h.warehouse_id
+		WHERE h.order_id IN (%s) AND h.status IN ('ACTIVE', 'COMMITTED')
+		GROUP BY h.order_id, h.product_id, h.warehouse_id, w.code, w.priority, h.backordered
+		ORDER BY h.order_id, h.product_id, h.backordered, w.priority, h.warehouse_id
+	`, placeholders), orderIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order fulfilment: %w", err)
+	}
+	defer rows.Close()
 
-	return items, nil
+	fulfilment := make(map[int]map[int][]types.StockAllocation)
+	for rows.Next() {
+		var orderID, productID int
+		var allocation types.StockAllocation
+		if err := rows.Scan(&orderID, &productID, &allocation.WarehouseID, &allocation.WarehouseCode, &allocation.Backordered, &allocation.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan order fulfilment: %w", err)
+		}
+		if fulfilment[orderID] == nil {
+			fulfilment[orderID] = make(map[int][]types.StockAllocation)
+		}
+		fulfilment[orderID][productID] = append(fulfilment[orderID][productID], allocation)
+	}
+
+	return fulfilment, rows.Err()
+}
+
+// Helper function to scan database row into OrderWithItems struct (without items),
+// any columns selected after the order columns are scanned into extra
+func scanRowIntoOrder(scanner interface {
+	Scan(dest ...any) error
+}, extra ...any) (*types.OrderWithItems, error) {
+	var order types.OrderWithItems
+	var shippingMethodID sql.NullInt64
+
+	dest := []any{
+		&order.ID,
+		&order.UserID,
+		&order.Subtotal,
+		&order.Tax,
+		&shippingMethodID,
+		&order.ShippingCost,
+		&order.Total,
+		&order.RefundedAmount,
+		&order.Currency,
+		&order.ExchangeRate,
+		&order.Status,
+		&order.Address,
+		&order.CreatedAt,
+	}
+	if err := scanner.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	// amounts are stored as plain decimals in the currency of the order
+	order.Subtotal.Currency = order.Currency
+	order.Tax.Currency = order.Currency
+	order.ShippingCost.Currency = order.Currency
+	order.Total.Currency = order.Currency
+	order.RefundedAmount.Currency = order.Currency
+
+	if shippingMethodID.Valid {
+		id := int(shippingMethodID.Int64)
+		order.ShippingMethodID = &id
+	}
+
+	return &order, nil
 }
@@ -10,11 +10,15 @@ import (
 
 	"github.com/HollyEllmo/go_rest_tut/cmd/config"
 	"github.com/HollyEllmo/go_rest_tut/cmd/db"
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/product"
 	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// testDBName is the database the order store tests run against
+const testDBName = "go_rest_tut_order_test"
+
 var testDB *sql.DB
 var orderStore *Store
 
@@ -22,7 +26,6 @@ func TestMain(m *testing.M) {
 	cfg := config.Envs
 	
 	// Connect to test database
-	testDBName := "go_rest_tut_order_test"
 	var err error
 	testDB, err = db.NewMySQLStorage(mysql.Config{
 		User:                 cfg.DBUser,
@@ -93,11 +96,15 @@ func runTestMigrations() {
 	// Create products table
 	productsTableSQL := `
 		CREATE TABLE IF NOT EXISTS products (
-			id INT AUTO_INCREMENT PRIMARY KEY,
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
 			name VARCHAR(255) NOT NULL,
+			sku VARCHAR(64) NULL UNIQUE,
 			description TEXT,
 			image VARCHAR(255) NOT NULL,
 			price DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
+			tax_class VARCHAR(50) NOT NULL DEFAULT 'standard',
+			weight_grams INT UNSIGNED NOT NULL DEFAULT 0,
 			createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)
 	`
@@ -107,8 +114,15 @@ func runTestMigrations() {
 		CREATE TABLE IF NOT EXISTS orders (
 			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
 			userId INT UNSIGNED NOT NULL,
+			subtotal DECIMAL(10,2) NOT NULL DEFAULT 0,
+			tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+			shipping_method_id INT UNSIGNED NULL,
+			shipping_cost DECIMAL(10,2) NOT NULL DEFAULT 0,
 			total DECIMAL(10,2) NOT NULL,
-			status ENUM('pending','completed','cancelled') NOT NULL DEFAULT 'pending',
+			refunded_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
+			exchange_rate DECIMAL(18,8) NOT NULL DEFAULT 1,
+			status ENUM('pending','paid','partially_shipped','completed','cancelled','refunded') NOT NULL DEFAULT 'pending',
 			address TEXT NOT NULL,
 			createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			
@@ -123,16 +137,154 @@ func runTestMigrations() {
 		CREATE TABLE IF NOT EXISTS order_items (
 			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
 			orderId INT UNSIGNED NOT NULL,
-			productId INT UNSIGNED NOT NULL,
+			productId INT UNSIGNED NULL,
+			product_name VARCHAR(255) NOT NULL,
+			product_sku VARCHAR(64) NULL,
+			product_image VARCHAR(255) NOT NULL DEFAULT '',
 			quantity INT NOT NULL,
 			price DECIMAL(10,2) NOT NULL,
+			unit_cost DECIMAL(10,2) NULL,
+			tax_rate DECIMAL(6,4) NOT NULL DEFAULT 0,
+			subtotal DECIMAL(10,2) NOT NULL DEFAULT 0,
+			tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+			total DECIMAL(10,2) NOT NULL DEFAULT 0,
 			
 			KEY idx_order_items_order_id (orderId),
-			KEY idx_order_items_product_id (productId)
+			KEY idx_order_items_product_id (productId),
+			FOREIGN KEY (productId) REFERENCES products(id) ON DELETE SET NULL
 		)
 	`
 	
-	tables := []string{usersTableSQL, productsTableSQL, ordersTableSQL, orderItemsTableSQL}
+	// Create warehouses and stock_holds tables, the holds record where each line ships from
+	warehousesTableSQL := `
+		CREATE TABLE IF NOT EXISTS warehouses (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			code VARCHAR(20) NOT NULL UNIQUE,
+			priority INT NOT NULL DEFAULT 0
+		)
+	`
+
+	stockHoldsTableSQL := `
+		CREATE TABLE IF NOT EXISTS stock_holds (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			product_id INT UNSIGNED NOT NULL,
+			warehouse_id INT UNSIGNED NOT NULL,
+			order_id INT UNSIGNED NOT NULL,
+			quantity INT NOT NULL,
+			backordered BOOLEAN NOT NULL DEFAULT FALSE,
+			unit_cost DECIMAL(10,2) NULL,
+			status ENUM('ACTIVE', 'COMMITTED', 'RELEASED', 'EXPIRED') NOT NULL DEFAULT 'ACTIVE',
+
+			KEY idx_stock_holds_order_id (order_id)
+		)
+	`
+
+	// Create order_item_components table, the breakdown of bundle lines
+	orderItemComponentsTableSQL := `
+		CREATE TABLE IF NOT EXISTS order_item_components (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			order_item_id INT UNSIGNED NOT NULL,
+			product_id INT UNSIGNED NULL,
+			product_name VARCHAR(255) NOT NULL,
+			product_sku VARCHAR(64) NULL,
+			quantity INT UNSIGNED NOT NULL,
+			unit_cost DECIMAL(10,2) NULL,
+			FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL
+		)
+	`
+
+	// Create order_addresses table, the addresses copied at checkout
+	orderAddressesTableSQL := `
+		CREATE TABLE IF NOT EXISTS order_addresses (
+			order_id INT UNSIGNED NOT NULL,
+			type ENUM('shipping', 'billing') NOT NULL,
+			title VARCHAR(100) NOT NULL DEFAULT '',
+			first_name VARCHAR(100) NOT NULL,
+			last_name VARCHAR(100) NOT NULL,
+			company VARCHAR(100) NULL,
+			address_line_1 VARCHAR(255) NOT NULL,
+			address_line_2 VARCHAR(255) NULL,
+			city VARCHAR(100) NOT NULL,
+			state_province VARCHAR(100) NOT NULL,
+			postal_code VARCHAR(20) NOT NULL,
+			country VARCHAR(100) NOT NULL,
+			phone VARCHAR(20) NULL,
+			PRIMARY KEY (order_id, type)
+		)
+	`
+
+	// Create export_jobs table, the background order exports
+	exportJobsTableSQL := `
+		CREATE TABLE IF NOT EXISTS export_jobs (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			format ENUM('csv', 'ndjson', 'xlsx') NOT NULL,
+			filters JSON NOT NULL,
+			status ENUM('PENDING', 'RUNNING', 'DONE', 'FAILED') NOT NULL DEFAULT 'PENDING',
+			file_path VARCHAR(255) NULL,
+			row_count INT UNSIGNED NOT NULL DEFAULT 0,
+			error TEXT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP NULL
+		)
+	`
+
+	// Create shipments tables, the parcels sent for orders and their tracking
+	shipmentsTableSQL := `
+		CREATE TABLE IF NOT EXISTS shipments (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			order_id INT NOT NULL,
+			carrier VARCHAR(50) NOT NULL,
+			tracking_number VARCHAR(100) NOT NULL,
+			status ENUM('shipped', 'in_transit', 'out_for_delivery', 'delivered', 'exception') NOT NULL DEFAULT 'shipped',
+			shipped_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP NULL,
+			last_event_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uk_shipments_tracking (carrier, tracking_number)
+		)
+	`
+
+	shipmentItemsTableSQL := `
+		CREATE TABLE IF NOT EXISTS shipment_items (
+			shipment_id INT UNSIGNED NOT NULL,
+			order_item_id INT NOT NULL,
+			quantity INT UNSIGNED NOT NULL,
+			PRIMARY KEY (shipment_id, order_item_id)
+		)
+	`
+
+	shipmentEventsTableSQL := `
+		CREATE TABLE IF NOT EXISTS shipment_events (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			shipment_id INT UNSIGNED NOT NULL,
+			status ENUM('shipped', 'in_transit', 'out_for_delivery', 'delivered', 'exception') NOT NULL,
+			description VARCHAR(255) NOT NULL DEFAULT '',
+			location VARCHAR(100) NOT NULL DEFAULT '',
+			occurred_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uk_shipment_events (shipment_id, status, occurred_at)
+		)
+	`
+
+	// Create returns tables, units being returned are not shipped
+	returnsTableSQL := `
+		CREATE TABLE IF NOT EXISTS returns (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			order_id INT UNSIGNED NOT NULL,
+			status ENUM('requested', 'approved', 'rejected', 'received', 'refunding', 'refunded') NOT NULL DEFAULT 'requested'
+		)
+	`
+
+	returnItemsTableSQL := `
+		CREATE TABLE IF NOT EXISTS return_items (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			return_id INT UNSIGNED NOT NULL,
+			order_item_id INT UNSIGNED NOT NULL,
+			quantity INT NOT NULL
+		)
+	`
+
+	tables := []string{usersTableSQL, productsTableSQL, ordersTableSQL, orderItemsTableSQL, warehousesTableSQL, stockHoldsTableSQL, orderItemComponentsTableSQL, orderAddressesTableSQL, exportJobsTableSQL, shipmentsTableSQL, shipmentItemsTableSQL, shipmentEventsTableSQL, returnsTableSQL, returnItemsTableSQL}
 	
 	for _, tableSQL := range tables {
 		if _, err := testDB.Exec(tableSQL); err != nil {
@@ -142,6 +294,16 @@ func runTestMigrations() {
 }
 
 func cleanupTestDB() {
+	testDB.Exec("DROP TABLE IF EXISTS return_items")
+	testDB.Exec("DROP TABLE IF EXISTS returns")
+	testDB.Exec("DROP TABLE IF EXISTS shipment_events")
+	testDB.Exec("DROP TABLE IF EXISTS shipment_items")
+	testDB.Exec("DROP TABLE IF EXISTS shipments")
+	testDB.Exec("DROP TABLE IF EXISTS export_jobs")
+	testDB.Exec("DROP TABLE IF EXISTS order_addresses")
+	testDB.Exec("DROP TABLE IF EXISTS order_item_components")
+	testDB.Exec("DROP TABLE IF EXISTS stock_holds")
+	testDB.Exec("DROP TABLE IF EXISTS warehouses")
 	testDB.Exec("DROP TABLE IF EXISTS order_items")
 	testDB.Exec("DROP TABLE IF EXISTS orders")
 	testDB.Exec("DROP TABLE IF EXISTS products")
@@ -182,7 +344,7 @@ func setupTestData() (int, int, int) {
 	// Create test order
 	order := types.Order{
 		UserID:  userID,
-		Total:   199.98,
+		Total:   types.MustParseMoney("199.98", types.DefaultCurrency),
 		Status:  "completed",
 		Address: "123 Test St, Test City, TC 12345",
 	}
@@ -194,10 +356,12 @@ func setupTestData() (int, int, int) {
 	
 	// Create test order items
 	orderItem := types.OrderItem{
-		OrderID:   orderID,
-		ProductID: productID,
-		Quantity:  2,
-		Price:     99.99,
+		OrderID:      orderID,
+		ProductID:    productID,
+		ProductName:  "Test Product",
+		ProductImage: "test.jpg",
+		Quantity:     2,
+		Price:        types.MustParseMoney("99.99", types.DefaultCurrency),
 	}
 	
 	err = orderStore.CreateOrderItem(orderItem)
@@ -209,6 +373,16 @@ func setupTestData() (int, int, int) {
 }
 
 func cleanupTestData() {
+	testDB.Exec("DELETE FROM return_items")
+	testDB.Exec("DELETE FROM returns")
+	testDB.Exec("DELETE FROM shipment_events")
+	testDB.Exec("DELETE FROM shipment_items")
+	testDB.Exec("DELETE FROM shipments")
+	testDB.Exec("DELETE FROM export_jobs")
+	testDB.Exec("DELETE FROM order_addresses")
+	testDB.Exec("DELETE FROM order_item_components")
+	testDB.Exec("DELETE FROM stock_holds")
+	testDB.Exec("DELETE FROM warehouses")
 	testDB.Exec("DELETE FROM order_items")
 	testDB.Exec("DELETE FROM orders")
 	testDB.Exec("DELETE FROM products")
@@ -264,7 +438,7 @@ func TestOrderStore_GetUserOrdersWithStatusFilter(t *testing.T) {
 	// Create a pending order
 	pendingOrder := types.Order{
 		UserID:  userID,
-		Total:   49.99,
+		Total:   types.MustParseMoney("49.99", types.DefaultCurrency),
 		Status:  "pending",
 		Address: "456 Another St",
 	}
@@ -279,7 +453,7 @@ func TestOrderStore_GetUserOrdersWithStatusFilter(t *testing.T) {
 		OrderID:   pendingOrderID,
 		ProductID: productID,
 		Quantity:  1,
-		Price:     49.99,
+		Price:     types.MustParseMoney("49.99", types.DefaultCurrency),
 	})
 	if err != nil {
 		t.Fatalf("Failed to create pending order item: %v", err)
@@ -332,7 +506,7 @@ func TestOrderStore_GetUserOrdersWithPagination(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		order := types.Order{
 			UserID:  userID,
-			Total:   float64(100 + i*10),
+			Total:   types.NewMoney(int64(100+i*10)*100, types.DefaultCurrency),
 			Status:  "completed",
 			Address: fmt.Sprintf("Address %d", i),
 		}
@@ -346,7 +520,7 @@ func TestOrderStore_GetUserOrdersWithPagination(t *testing.T) {
 			OrderID:   orderID,
 			ProductID: productID,
 			Quantity:  1,
-			Price:     float64(100 + i*10),
+			Price:     types.NewMoney(int64(100+i*10)*100, types.DefaultCurrency),
 		})
 		if err != nil {
 			t.Fatalf("Failed to create order item %d: %v", i, err)
@@ -430,7 +604,7 @@ func TestOrderStore_GetOrdersCount(t *testing.T) {
 	// Create additional orders with different statuses
 	pendingOrder := types.Order{
 		UserID:  userID,
-		Total:   49.99,
+		Total:   types.MustParseMoney("49.99", types.DefaultCurrency),
 		Status:  "pending",
 		Address: "Pending Address",
 	}
@@ -444,7 +618,7 @@ func TestOrderStore_GetOrdersCount(t *testing.T) {
 		OrderID:   pendingOrderID,
 		ProductID: productID,
 		Quantity:  1,
-		Price:     49.99,
+		Price:     types.MustParseMoney("49.99", types.DefaultCurrency),
 	})
 	if err != nil {
 		t.Fatalf("Failed to create pending order item: %v", err)
@@ -501,7 +675,7 @@ func TestOrderStore_GetUserOrdersWithDateFilter(t *testing.T) {
 		OrderID:   yesterdayOrderID,
 		ProductID: productID,
 		Quantity:  1,
-		Price:     75.50,
+		Price:     types.MustParseMoney("75.50", types.DefaultCurrency),
 	})
 	if err != nil {
 		t.Fatalf("Failed to create yesterday order item: %v", err)
@@ -537,4 +711,599 @@ func TestOrderStore_GetUserOrdersWithDateFilter(t *testing.T) {
 	if len(orders) != 1 {
 		t.Errorf("Expected 1 order until yesterday, got %d", len(orders))
 	}
-}
\ No newline at end of file
+}
+func TestOrderStore_BundleItem(t *testing.T) {
+	defer cleanupTestData()
+	userID, productID, orderID := setupTestData()
+
+	res, err := testDB.Exec("INSERT INTO products (name, description, image, price) VALUES ('Gift Set', 'A bundle', 'gift.jpg', 49.99)")
+	if err != nil {
+		t.Fatalf("Failed to create bundle product: %v", err)
+	}
+	bundleID, _ := res.LastInsertId()
+
+	res, err = testDB.Exec("INSERT INTO warehouses (code) VALUES ('MAIN')")
+	if err != nil {
+		t.Fatalf("Failed to create warehouse: %v", err)
+	}
+	warehouseID, _ := res.LastInsertId()
+
+	// the components of 2 gift sets were reserved at 3.00 a unit
+	_, err = testDB.Exec(
+		"INSERT INTO stock_holds (product_id, warehouse_id, order_id, quantity, unit_cost) VALUES (?, ?, ?, 4, 3.00)",
+		productID, warehouseID, orderID,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create stock hold: %v", err)
+	}
+
+	err = orderStore.CreateOrderItem(types.OrderItem{
+		OrderID:     orderID,
+		ProductID:   int(bundleID),
+		ProductName: "Gift Set",
+		Quantity:    2,
+		Price:       types.MustParseMoney("49.99", types.DefaultCurrency),
+		Components: []types.OrderItemComponent{
+			{ProductID: productID, Quantity: 4},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle order item: %v", err)
+	}
+
+	order, err := orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order by ID: %v", err)
+	}
+
+	if len(order.Items) != 2 {
+		t.Fatalf("Expected 2 order items, got %d", len(order.Items))
+	}
+
+	bundle := order.Items[1]
+	if len(bundle.Components) != 1 || bundle.Components[0].ProductID != productID || bundle.Components[0].Quantity != 4 {
+		t.Errorf("Expected the bundle line to list 4 units of product %d, got %+v", productID, bundle.Components)
+	}
+	if bundle.Components[0].ProductName != "Test Product" || len(bundle.Components[0].Fulfilment) != 1 {
+		t.Errorf("Expected the component to carry its name and warehouse, got %+v", bundle.Components[0])
+	}
+	if len(order.Items[0].Components) != 0 {
+		t.Errorf("Expected the plain line to have no components, got %+v", order.Items[0].Components)
+	}
+
+	var unitCost types.Money
+	if err := testDB.QueryRow("SELECT unit_cost FROM order_items WHERE productId = ?", bundleID).Scan(&unitCost); err != nil {
+		t.Fatalf("Failed to get bundle cost: %v", err)
+	}
+	if unitCost != types.MustParseMoney("6.00", types.DefaultCurrency) {
+		t.Errorf("Expected the bundle to cost 6.00 a unit, got %s", unitCost)
+	}
+}
+
+func TestOrderStore_ItemSnapshot(t *testing.T) {
+	defer cleanupTestData()
+	userID, productID, orderID := setupTestData()
+
+	productStore := product.NewStore(testDB)
+
+	// the catalog moves on after checkout
+	err := productStore.UpdateProduct(&types.Product{
+		ID:          productID,
+		Name:        "Renamed Product",
+		SKU:         "NEW-1",
+		Description: "A test product",
+		Image:       "new.jpg",
+		Price:       types.MustParseMoney("89.99", types.DefaultCurrency),
+		Currency:    types.DefaultCurrency,
+		TaxClass:    types.DefaultTaxClass,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update product: %v", err)
+	}
+
+	order, err := orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order by ID: %v", err)
+	}
+	item := order.Items[0]
+	if item.ProductName != "Test Product" || item.ProductImage != "test.jpg" || item.ProductSKU != "" {
+		t.Errorf("Expected the item as purchased, got %+v", item)
+	}
+
+	// and the product disappearing doesn't lose the line
+	if err := productStore.DeleteProduct(productID); err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+
+	order, err = orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order by ID: %v", err)
+	}
+	if len(order.Items) != 1 || order.Items[0].ProductName != "Test Product" || order.Items[0].ProductID != 0 {
+		t.Errorf("Expected the item of a deleted product to remain, got %+v", order.Items)
+	}
+}
+
+func TestOrderStore_Addresses(t *testing.T) {
+	defer cleanupTestData()
+	userID, _, orderID := setupTestData()
+
+	company := "Acme"
+	shipping := &types.OrderAddress{
+		FirstName:     "Jane",
+		LastName:      "Doe",
+		Company:       &company,
+		AddressLine1:  "1 Main St",
+		City:          "Berlin",
+		StateProvince: "BE",
+		PostalCode:    "10115",
+		Country:       "Germany",
+	}
+	billing := &types.OrderAddress{
+		FirstName:     "Jane",
+		LastName:      "Doe",
+		AddressLine1:  "2 Side St",
+		City:          "Paris",
+		StateProvince: "IDF",
+		PostalCode:    "75001",
+		Country:       "France",
+	}
+
+	shippedID, err := orderStore.CreateOrder(types.Order{
+		UserID:          userID,
+		Total:           types.MustParseMoney("10.00", types.DefaultCurrency),
+		Status:          types.OrderStatusPending,
+		ShippingAddress: shipping,
+		BillingAddress:  billing,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	order, err := orderStore.GetOrderByID(shippedID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order by ID: %v", err)
+	}
+	if order.ShippingAddress == nil || *order.ShippingAddress.Company != "Acme" || order.ShippingAddress.Country != "Germany" {
+		t.Errorf("Expected the shipping address as given, got %+v", order.ShippingAddress)
+	}
+	if order.BillingAddress == nil || order.BillingAddress.City != "Paris" || order.BillingAddress.Company != nil {
+		t.Errorf("Expected the billing address as given, got %+v", order.BillingAddress)
+	}
+	if order.Address != shipping.Format() {
+		t.Errorf("Expected the address formatted from the shipping address, got %q", order.Address)
+	}
+
+	// the order from setupTestData predates structured addresses
+	legacy, err := orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order by ID: %v", err)
+	}
+	if legacy.ShippingAddress != nil || legacy.Address != "123 Test St, Test City, TC 12345" {
+		t.Errorf("Expected the legacy order to keep its formatted address, got %+v", legacy)
+	}
+
+	country := "Germany"
+	filters := types.OrderFilters{Limit: 10, Country: &country}
+	orders, err := orderStore.GetUserOrders(userID, filters)
+	if err != nil {
+		t.Fatalf("Failed to get user orders: %v", err)
+	}
+	if len(orders) != 1 || orders[0].ID != shippedID || orders[0].BillingAddress == nil {
+		t.Errorf("Expected only the order shipped to Germany, got %+v", orders)
+	}
+
+	count, err := orderStore.GetOrdersCount(userID, filters)
+	if err != nil {
+		t.Fatalf("Failed to get orders count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 order shipped to Germany, got %d", count)
+	}
+}
+
+func TestOrderStore_GetUserOrdersCursor(t *testing.T) {
+	defer cleanupTestData()
+	userID, productID, _ := setupTestData()
+	createTestOrders(t, userID, productID, 4)
+
+	// all five orders placed in the same second, so only the ID orders them
+	if _, err := testDB.Exec("UPDATE orders SET createdAt = '2026-10-18 12:00:00' WHERE userId = ?", userID); err != nil {
+		t.Fatalf("Failed to update orders: %v", err)
+	}
+
+	var seen []int
+	var cursor *types.OrderCursor
+	for {
+		orders, err := orderStore.GetUserOrders(userID, types.OrderFilters{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Failed to get user orders: %v", err)
+		}
+		if len(orders) == 0 {
+			break
+		}
+		for _, order := range orders {
+			seen = append(seen, order.ID)
+		}
+		last := orders[len(orders)-1]
+		cursor = &types.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("Expected to page through 5 orders, got %v", seen)
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] >= seen[i-1] {
+			t.Errorf("Expected the orders newest first without repeats, got %v", seen)
+		}
+	}
+
+	// and back from the oldest
+	oldest := seen[4]
+	cursor = &types.OrderCursor{CreatedAt: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), ID: oldest, Backward: true}
+	orders, err := orderStore.GetUserOrders(userID, types.OrderFilters{Limit: 2, Cursor: cursor})
+	if err != nil {
+		t.Fatalf("Failed to get user orders: %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != seen[2] || orders[1].ID != seen[3] {
+		t.Errorf("Expected orders %v before the oldest, got %+v", seen[2:4], orders)
+	}
+}
+
+func TestOrderStore_SearchOrders(t *testing.T) {
+	defer cleanupTestData()
+	userID, productID, orderID := setupTestData()
+
+	res, err := testDB.Exec("INSERT INTO users (firstName, lastName, email, password) VALUES ('Other', 'Customer', 'other@shop.test', 'hashedpassword')")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	otherID, _ := res.LastInsertId()
+
+	otherOrderID, err := orderStore.CreateOrder(types.Order{
+		UserID:  int(otherID),
+		Total:   types.MustParseMoney("15.00", types.DefaultCurrency),
+		Status:  types.OrderStatusPaid,
+		Address: "Other Address",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// everyone's orders, the largest first
+	orders, err := orderStore.SearchOrders(types.AdminOrderFilters{
+		Sort: []types.OrderSort{{Field: "total", Descending: true}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to search orders: %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != orderID || orders[1].ID != otherOrderID {
+		t.Fatalf("Expected both orders, the largest first, got %+v", orders)
+	}
+	if orders[0].Customer.ID != userID || orders[0].Customer.Email != "test@example.com" || len(orders[0].Items) != 1 {
+		t.Errorf("Expected the order with its customer and items, got %+v", orders[0])
+	}
+
+	email := "other@"
+	maxTotal := types.MustParseMoney("20.00", types.DefaultCurrency)
+	tests := []struct {
+		name     string
+		filters  types.AdminOrderFilters
+		expected []int
+	}{
+		{"by email", types.AdminOrderFilters{Email: &email}, []int{otherOrderID}},
+		{"by product", types.AdminOrderFilters{ProductID: &productID}, []int{orderID}},
+		{"by total", types.AdminOrderFilters{MaxTotal: &maxTotal}, []int{otherOrderID}},
+	}
+	for _, tt := range tests {
+		orders, err := orderStore.SearchOrders(tt.filters)
+		if err != nil {
+			t.Fatalf("%s: failed to search orders: %v", tt.name, err)
+		}
+		count, err := orderStore.CountOrders(tt.filters)
+		if err != nil {
+			t.Fatalf("%s: failed to count orders: %v", tt.name, err)
+		}
+		if len(orders) != len(tt.expected) || orders[0].ID != tt.expected[0] || count != len(tt.expected) {
+			t.Errorf("%s: expected orders %v, got %d orders (%d counted)", tt.name, tt.expected, len(orders), count)
+		}
+	}
+
+	order, err := orderStore.GetAdminOrder(otherOrderID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if order.Customer.FirstName != "Other" || order.Customer.Email != "other@shop.test" {
+		t.Errorf("Expected the order of the other customer, got %+v", order.Customer)
+	}
+
+	if _, err := orderStore.GetAdminOrder(otherOrderID + 1000); err == nil || err.Error() != "order not found" {
+		t.Errorf("Expected order not found, got %v", err)
+	}
+}
+
+func TestOrderStore_StreamOrders(t *testing.T) {
+	defer cleanupTestData()
+	userID, productID, orderID := setupTestData()
+	createTestOrders(t, userID, productID, 2)
+
+	var orders []types.AdminOrder
+	err := orderStore.StreamOrders(types.OrderFilters{Limit: 1}, func(order types.AdminOrder) error {
+		orders = append(orders, order)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to stream orders: %v", err)
+	}
+	if len(orders) != 3 || orders[0].ID != orderID {
+		t.Fatalf("Expected all 3 orders oldest first, ignoring the limit, got %d", len(orders))
+	}
+	if orders[0].Customer.Email != "test@example.com" || len(orders[0].Items) != 1 || len(orders[1].Items) != 2 {
+		t.Errorf("Expected the orders with their customer and items, got %+v", orders[0])
+	}
+
+	status := types.OrderStatusPaid
+	count := 0
+	err = orderStore.StreamOrders(types.OrderFilters{Status: &status}, func(order types.AdminOrder) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to stream orders: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected the 2 paid orders, got %d", count)
+	}
+}
+
+func TestOrderStore_ExportJobs(t *testing.T) {
+	defer cleanupTestData()
+	userID, _, _ := setupTestData()
+
+	country := "DE"
+	job := &types.ExportJob{UserID: userID, Format: types.ExportFormatXLSX, Filters: types.OrderFilters{Country: &country}}
+	if err := orderStore.CreateExportJob(job); err != nil {
+		t.Fatalf("Failed to create export job: %v", err)
+	}
+	if job.ID == 0 || job.Status != types.ExportJobPending {
+		t.Fatalf("Expected a pending job, got %+v", job)
+	}
+
+	if err := orderStore.StartExportJob(job.ID); err != nil {
+		t.Fatalf("Failed to start export job: %v", err)
+	}
+	if err := orderStore.StartExportJob(job.ID); err == nil {
+		t.Errorf("Expected a running job not to start again")
+	}
+
+	if err := orderStore.FinishExportJob(job.ID, "exports/orders-1.xlsx", 3, nil); err != nil {
+		t.Fatalf("Failed to finish export job: %v", err)
+	}
+
+	job, err := orderStore.GetExportJob(job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get export job: %v", err)
+	}
+	if job.Status != types.ExportJobDone || job.Rows != 3 || job.FilePath != "exports/orders-1.xlsx" || job.FinishedAt == nil {
+		t.Errorf("Expected a finished job, got %+v", job)
+	}
+	if job.Filters.Country == nil || *job.Filters.Country != "DE" {
+		t.Errorf("Expected the filters to be kept, got %+v", job.Filters)
+	}
+
+	if _, err := orderStore.GetExportJob(job.ID + 1000); err == nil || err.Error() != "export job not found" {
+		t.Errorf("Expected export job not found, got %v", err)
+	}
+}
+
+func TestOrderStore_Shipments(t *testing.T) {
+	defer cleanupTestData()
+	userID, _, orderID := setupTestData()
+
+	// the test order is completed, ship a paid one
+	if err := orderStore.UpdateOrderStatus(orderID, types.OrderStatusCompleted, types.OrderStatusPaid); err != nil {
+		t.Fatalf("Failed to update order status: %v", err)
+	}
+	order, err := orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	itemID := order.Items[0].ID
+
+	first := &types.Shipment{
+		OrderID:        orderID,
+		Carrier:        "ups",
+		TrackingNumber: "1Z0001",
+		Items:          []types.ShipmentItem{{OrderItemID: itemID, Quantity: 1}},
+	}
+	if err := orderStore.CreateShipment(first); err != nil {
+		t.Fatalf("Failed to create shipment: %v", err)
+	}
+	if first.ID == 0 || first.Status != types.ShipmentStatusShipped || len(first.Events) != 1 {
+		t.Fatalf("Expected a shipped shipment, got %+v", first)
+	}
+
+	order, err = orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if order.Status != types.OrderStatusPartiallyShipped || len(order.Shipments) != 1 || order.Shipments[0].Items[0].Quantity != 1 {
+		t.Fatalf("Expected a partially shipped order with its shipment, got %s with %+v", order.Status, order.Shipments)
+	}
+
+	tooMany := &types.Shipment{OrderID: orderID, Carrier: "ups", TrackingNumber: "1Z0002", Items: []types.ShipmentItem{{OrderItemID: itemID, Quantity: 2}}}
+	if err := orderStore.CreateShipment(tooMany); err == nil || err.Error() != fmt.Sprintf("only 1 of order item %d left to ship", itemID) {
+		t.Errorf("Expected only 1 unit left to ship, got %v", err)
+	}
+
+	duplicate := &types.Shipment{OrderID: orderID, Carrier: "ups", TrackingNumber: "1Z0001"}
+	if err := orderStore.CreateShipment(duplicate); err == nil || err.Error() != "shipment ups 1Z0001 already exists" {
+		t.Errorf("Expected the tracking number to be taken, got %v", err)
+	}
+
+	// the rest of the order, by default
+	rest := &types.Shipment{OrderID: orderID, Carrier: "dhl", TrackingNumber: "JD0002"}
+	if err := orderStore.CreateShipment(rest); err != nil {
+		t.Fatalf("Failed to create shipment: %v", err)
+	}
+	status, err := orderStore.GetOrder(orderID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if status.Status != types.OrderStatusCompleted {
+		t.Errorf("Expected the fully shipped order to be completed, got %s", status.Status)
+	}
+
+	// tracking updates, the delivery arriving before the update that preceded it
+	shipment, err := orderStore.GetShipmentByTracking("ups", "1Z0001")
+	if err != nil {
+		t.Fatalf("Failed to get shipment: %v", err)
+	}
+	delivered := first.ShippedAt.Add(48 * time.Hour)
+	for _, event := range []types.ShipmentEvent{
+		{Status: types.ShipmentStatusDelivered, Location: "Springfield", OccurredAt: delivered},
+		{Status: types.ShipmentStatusInTransit, Location: "Hub", OccurredAt: delivered.Add(-24 * time.Hour)},
+		{Status: types.ShipmentStatusDelivered, Location: "Springfield", OccurredAt: delivered},
+	} {
+		shipment, err = orderStore.AddShipmentEvent(shipment.ID, event)
+		if err != nil {
+			t.Fatalf("Failed to add shipment event: %v", err)
+		}
+	}
+	if shipment.Status != types.ShipmentStatusDelivered || shipment.DeliveredAt == nil || !shipment.DeliveredAt.Equal(delivered) {
+		t.Errorf("Expected the shipment delivered at %v, got %s at %v", delivered, shipment.Status, shipment.DeliveredAt)
+	}
+	if len(shipment.Events) != 3 || shipment.Events[1].Status != types.ShipmentStatusInTransit {
+		t.Errorf("Expected the shipped, in transit and delivered events in order, got %+v", shipment.Events)
+	}
+
+	if _, err := orderStore.GetShipmentByTracking("ups", "unknown"); err == nil || err.Error() != "shipment not found" {
+		t.Errorf("Expected shipment not found, got %v", err)
+	}
+}
+
+// createTestOrders places n more orders of two items each for the user
+// Test that units returned before shipping are not shipped any more
+func TestOrderStore_ShipmentAfterReturn(t *testing.T) {
+	defer cleanupTestData()
+	userID, _, orderID := setupTestData()
+
+	if err := orderStore.UpdateOrderStatus(orderID, types.OrderStatusCompleted, types.OrderStatusPaid); err != nil {
+		t.Fatalf("Failed to update order status: %v", err)
+	}
+	order, err := orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	itemID := order.Items[0].ID
+
+	// one of the 2 units comes back, a rejected return doesn't count
+	for _, status := range []types.ReturnStatus{types.ReturnStatusApproved, types.ReturnStatusRejected} {
+		result, err := testDB.Exec("INSERT INTO returns (order_id, status) VALUES (?, ?)", orderID, status)
+		if err != nil {
+			t.Fatalf("Failed to create return: %v", err)
+		}
+		returnID, _ := result.LastInsertId()
+		if _, err := testDB.Exec("INSERT INTO return_items (return_id, order_item_id, quantity) VALUES (?, ?, 1)", returnID, itemID); err != nil {
+			t.Fatalf("Failed to create return item: %v", err)
+		}
+	}
+
+	tooMany := &types.Shipment{OrderID: orderID, Carrier: "ups", TrackingNumber: "1Z0101", Items: []types.ShipmentItem{{OrderItemID: itemID, Quantity: 2}}}
+	if err := orderStore.CreateShipment(tooMany); err == nil || err.Error() != fmt.Sprintf("only 1 of order item %d left to ship", itemID) {
+		t.Errorf("Expected only 1 unit left to ship, got %v", err)
+	}
+
+	rest := &types.Shipment{OrderID: orderID, Carrier: "ups", TrackingNumber: "1Z0102"}
+	if err := orderStore.CreateShipment(rest); err != nil {
+		t.Fatalf("Failed to create shipment: %v", err)
+	}
+	if len(rest.Items) != 1 || rest.Items[0].Quantity != 1 {
+		t.Errorf("Expected the unit not returned to ship, got %+v", rest.Items)
+	}
+
+	status, err := orderStore.GetOrder(orderID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if status.Status != types.OrderStatusCompleted {
+		t.Errorf("Expected the order to be completed, got %s", status.Status)
+	}
+}
+
+func createTestOrders(tb testing.TB, userID, productID, n int) {
+	tb.Helper()
+
+	for i := 0; i < n; i++ {
+		orderID, err := orderStore.CreateOrder(types.Order{
+			UserID:  userID,
+			Total:   types.MustParseMoney("20.00", types.DefaultCurrency),
+			Status:  types.OrderStatusPaid,
+			Address: fmt.Sprintf("Address %d", i),
+		})
+		if err != nil {
+			tb.Fatalf("Failed to create order: %v", err)
+		}
+
+		for j := 0; j < 2; j++ {
+			err := orderStore.CreateOrderItem(types.OrderItem{
+				OrderID:     orderID,
+				ProductID:   productID,
+				ProductName: "Test Product",
+				Quantity:    1,
+				Price:       types.MustParseMoney("10.00", types.DefaultCurrency),
+			})
+			if err != nil {
+				tb.Fatalf("Failed to create order item: %v", err)
+			}
+		}
+	}
+}
+
+func TestOrderStore_GetUserOrdersQueryCount(t *testing.T) {
+	defer cleanupTestData()
+	userID, productID, _ := setupTestData()
+
+	countingDB, counter := openCountingDB(t)
+	store := NewStore(countingDB)
+
+	queriesPerPage := func(limit int) int64 {
+		counter.Reset()
+		orders, err := store.GetUserOrders(userID, types.OrderFilters{Limit: limit})
+		if err != nil {
+			t.Fatalf("Failed to get user orders: %v", err)
+		}
+		if len(orders) != limit {
+			t.Fatalf("Expected a page of %d orders, got %d", limit, len(orders))
+		}
+		return counter.Count()
+	}
+
+	single := queriesPerPage(1)
+	createTestOrders(t, userID, productID, 49)
+	page := queriesPerPage(50)
+
+	// orders, items, fulfilment, bundle components and addresses
+	if page != 5 || single != page {
+		t.Errorf("Expected 5 queries for any page, got %d for 1 order and %d for 50", single, page)
+	}
+}
+
+func BenchmarkOrderStore_GetUserOrders(b *testing.B) {
+	defer cleanupTestData()
+	userID, productID, _ := setupTestData()
+	createTestOrders(b, userID, productID, 99)
+
+	countingDB, counter := openCountingDB(b)
+	store := NewStore(countingDB)
+	filters := types.OrderFilters{Limit: 100}
+
+	counter.Reset()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.GetUserOrders(userID, filters); err != nil {
+			b.Fatalf("Failed to get user orders: %v", err)
+		}
+	}
+	b.ReportMetric(float64(counter.Count())/float64(b.N), "queries/op")
+}
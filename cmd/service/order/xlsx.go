@@ -0,0 +1,111 @@
+package order
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// xlsxParts are the fixed parts of a workbook with a single sheet
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Orders" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// xlsxWriter writes a single sheet workbook row by row. The sheet is the last
+// part of the archive, so rows go straight to the output and are never held.
+type xlsxWriter struct {
+	zip     *zip.Writer
+	sheet   io.Writer
+	numeric map[int]bool // columns written as numbers
+	rows    int
+}
+
+func newXLSXWriter(w io.Writer, numeric map[int]bool) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{zip: archive, sheet: sheet, numeric: numeric}, nil
+}
+
+// WriteRow appends a row. Empty cells are left out, and numeric columns fall
+// back to text for values that are not numbers.
+func (x *xlsxWriter) WriteRow(values []string) error {
+	x.rows++
+	if _, err := fmt.Fprintf(x.sheet, `<row r="%d">`, x.rows); err != nil {
+		return err
+	}
+
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		ref := xlsxColumn(i) + strconv.Itoa(x.rows)
+		if _, err := strconv.ParseFloat(value, 64); err == nil && x.numeric[i] {
+			if _, err := fmt.Fprintf(x.sheet, `<c r="%s"><v>%s</v></c>`, ref, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(x.sheet, []byte(value)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(x.sheet, `</t></is></c>`); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(x.sheet, `</row>`)
+	return err
+}
+
+// Flush sends the rows written so far to the output
+func (x *xlsxWriter) Flush() error {
+	return x.zip.Flush()
+}
+
+// Close ends the sheet and the archive
+func (x *xlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// xlsxColumn names the zero based column i as in a cell reference: A, B, ... Z, AA, AB, ...
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
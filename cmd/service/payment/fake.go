@@ -0,0 +1,171 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// Payment method tokens understood by the fake provider. Any other token is
+// authorised and can be captured.
+const (
+	FakeTokenDeclined = "tok_fail"    // the intent fails immediately
+	FakeTokenPending  = "tok_pending" // the intent stays processing until a webhook settles it
+)
+
+// FakeProvider is a deterministic in-memory payment gateway for local
+// development and tests. Intent IDs are sequential and webhooks are signed
+// with HMAC-SHA256 over the raw body using the shared secret.
+type FakeProvider struct {
+	secret []byte
+
+	mu       sync.Mutex
+	seq      int
+	intents  map[string]*types.PaymentIntent
+	refunded map[string]types.Money
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		secret:   []byte(webhookSecret),
+		intents:  make(map[string]*types.PaymentIntent),
+		refunded: make(map[string]types.Money),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// CreateIntent authorises the amount, the outcome depends only on the payment method token
+func (p *FakeProvider) CreateIntent(orderID int, amount types.Money, paymentMethod string) (*types.PaymentIntent, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("invalid payment amount %s", amount)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	intent := &types.PaymentIntent{
+		ID:     fmt.Sprintf("pi_fake_%d_%d", orderID, p.seq),
+		Status: types.IntentRequiresCapture,
+		Amount: amount,
+	}
+
+	switch paymentMethod {
+	case FakeTokenDeclined:
+		intent.Status = types.IntentFailed
+		intent.FailureReason = "card_declined"
+	case FakeTokenPending:
+		intent.Status = types.IntentProcessing
+	}
+
+	p.intents[intent.ID] = intent
+	copied := *intent
+	return &copied, nil
+}
+
+// Capture collects an authorised intent
+func (p *FakeProvider) Capture(intentID string) (*types.PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("payment intent %s not found", intentID)
+	}
+	if intent.Status != types.IntentRequiresCapture {
+		return nil, fmt.Errorf("payment intent %s cannot be captured in status %s", intentID, intent.Status)
+	}
+
+	intent.Status = types.IntentSucceeded
+	copied := *intent
+	return &copied, nil
+}
+
+// Refund returns up to the captured amount of an intent, possibly in several parts
+func (p *FakeProvider) Refund(intentID string, amount types.Money) (*types.PaymentRefund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("payment intent %s not found", intentID)
+	}
+	if intent.Status != types.IntentSucceeded {
+		return nil, fmt.Errorf("payment intent %s cannot be refunded in status %s", intentID, intent.Status)
+	}
+
+	refunded := p.refunded[intentID]
+	if refunded.Currency == "" {
+		refunded = types.NewMoney(0, intent.Amount.Currency)
+	}
+	if !amount.IsPositive() || refunded.Add(amount).Cmp(intent.Amount) > 0 {
+		return nil, fmt.Errorf("invalid refund amount %s for payment intent %s", amount, intentID)
+	}
+	p.refunded[intentID] = refunded.Add(amount)
+
+	p.seq++
+	return &types.PaymentRefund{
+		ID:     fmt.Sprintf("re_fake_%d", p.seq),
+		Amount: amount,
+	}, nil
+}
+
+// fakeWebhook is the body of a fake provider webhook
+type fakeWebhook struct {
+	IntentID string `json:"intentId"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ParseWebhook verifies the signature and decodes a webhook body
+func (p *FakeProvider) ParseWebhook(payload []byte, signature string) (*types.PaymentEvent, error) {
+	// without a secret anyone could sign, so nothing is accepted
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(p.secret) == 0 || !hmac.Equal(expected, p.sign(payload)) {
+		return nil, fmt.Errorf("invalid webhook signature")
+	}
+
+	var webhook fakeWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	status := types.PaymentIntentStatus(webhook.Status)
+	switch status {
+	case types.IntentSucceeded, types.IntentFailed, types.IntentExpired:
+	default:
+		return nil, fmt.Errorf("invalid webhook payload: unknown status %q", webhook.Status)
+	}
+
+	// keep the in-memory intent in step so it can be refunded later
+	p.mu.Lock()
+	if intent, ok := p.intents[webhook.IntentID]; ok {
+		intent.Status = status
+	}
+	p.mu.Unlock()
+
+	return &types.PaymentEvent{
+		IntentID:      webhook.IntentID,
+		Status:        status,
+		FailureReason: webhook.Reason,
+	}, nil
+}
+
+// Sign returns the signature header value for a webhook body
+func (p *FakeProvider) Sign(payload []byte) string {
+	return hex.EncodeToString(p.sign(payload))
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
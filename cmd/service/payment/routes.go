@@ -0,0 +1,186 @@
+package payment
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+// SignatureHeader carries the webhook signature
+const SignatureHeader = "X-Payment-Signature"
+
+// maxWebhookSize bounds the webhook body read into memory
+const maxWebhookSize = 1 << 20
+
+type Handler struct {
+	store          types.PaymentStore
+	orderStore     types.OrderStore
+	inventoryStore types.InventoryStore
+	userStore      types.UserStore
+	provider       types.PaymentProvider
+}
+
+func NewHandler(store types.PaymentStore, orderStore types.OrderStore, inventoryStore types.InventoryStore, userStore types.UserStore, provider types.PaymentProvider) *Handler {
+	return &Handler{store: store, orderStore: orderStore, inventoryStore: inventoryStore, userStore: userStore, provider: provider}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/orders/{id}/pay", auth.WithJWTAuth(h.handlePayOrder, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/orders/{id}/payments", auth.WithJWTAuth(h.handleGetOrderPayments, h.userStore)).Methods(http.MethodGet)
+
+	// Called by the payment provider, authenticated by the signature
+	router.HandleFunc("/payments/webhook", h.handleWebhook).Methods(http.MethodPost)
+}
+
+// POST /api/v1/orders/{id}/pay - pay a pending order
+func (h *Handler) handlePayOrder(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	orderID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	var payload types.PayOrderPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	order, err := h.orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		if err.Error() == "order not found or not owned by user" {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if order.Status != types.OrderStatusPending {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("order is %s, only pending orders can be paid", order.Status))
+		return
+	}
+
+	// one attempt at a time, a second charge would have to be refunded
+	payments, err := h.store.GetPaymentsForOrder(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, payment := range payments {
+		if payment.Status == types.PaymentStatusPending || payment.Status == types.PaymentStatusSucceeded {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("order already has a %s payment", payment.Status))
+			return
+		}
+	}
+
+	payment, err := h.payOrder(order, payload.PaymentMethod)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	status := http.StatusOK
+	orderStatus := types.OrderStatusPaid
+	switch payment.Status {
+	case types.PaymentStatusPending:
+		status = http.StatusAccepted
+		orderStatus = types.OrderStatusPending
+	case types.PaymentStatusFailed, types.PaymentStatusExpired:
+		status = http.StatusPaymentRequired
+		orderStatus = types.OrderStatusCancelled
+	}
+
+	utils.WriteJSON(w, status, map[string]any{
+		"payment":      payment,
+		"order_status": orderStatus,
+	})
+}
+
+// GET /api/v1/orders/{id}/payments - list the payment attempts of an order
+func (h *Handler) handleGetOrderPayments(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	orderID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	if _, err := h.orderStore.GetOrderByID(orderID, userID); err != nil {
+		if err.Error() == "order not found or not owned by user" {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	payments, err := h.store.GetPaymentsForOrder(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"payments": payments,
+		"count":    len(payments),
+	})
+}
+
+// POST /api/v1/payments/webhook - payment status notifications from the provider
+func (h *Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	event, err := h.provider.ParseWebhook(body, r.Header.Get(SignatureHeader))
+	if err != nil {
+		if err.Error() == "invalid webhook signature" {
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	payment, err := h.store.GetPaymentByProviderID(h.provider.Name(), event.IntentID)
+	if err != nil {
+		if err.Error() == "payment not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.settlePayment(payment, event.Status, event.FailureReason); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"received":   true,
+		"payment_id": payment.ID,
+		"status":     payment.Status,
+	})
+}
@@ -0,0 +1,456 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/gorilla/mux"
+)
+
+func TestPaymentHandlers(t *testing.T) {
+	t.Run("should mark the order paid when the payment succeeds", func(t *testing.T) {
+		env := newTestEnv()
+
+		rr := env.pay(t, "tok_visa")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		if env.orders.order.Status != types.OrderStatusPaid {
+			t.Errorf("expected order to be paid, got %s", env.orders.order.Status)
+		}
+		if env.payments.payments[0].Status != types.PaymentStatusSucceeded {
+			t.Errorf("expected payment to succeed, got %s", env.payments.payments[0].Status)
+		}
+		if len(env.inventory.committed) != 1 || len(env.inventory.released) != 0 {
+			t.Errorf("expected the reservation to be committed, got committed %v released %v",
+				env.inventory.committed, env.inventory.released)
+		}
+	})
+
+	t.Run("should refund the payment when the stock holds expired", func(t *testing.T) {
+		env := newTestEnv()
+		env.inventory.expired = true
+
+		rr := env.pay(t, "tok_visa")
+		if rr.Code == http.StatusOK {
+			t.Fatalf("expected the payment to be rejected, got %d: %s", rr.Code, rr.Body)
+		}
+
+		if env.orders.order.Status != types.OrderStatusCancelled {
+			t.Errorf("expected order to be cancelled, got %s", env.orders.order.Status)
+		}
+		if _, err := env.provider.Refund(env.payments.payments[0].ProviderPaymentID, types.MustParseMoney("0.01", "USD")); err == nil {
+			t.Error("expected the payment to be refunded in full")
+		}
+	})
+
+	t.Run("should refund and put back the committed stock when the order was cancelled during payment", func(t *testing.T) {
+		env := newTestEnv()
+		env.inventory.onCommit = func() { env.orders.order.Status = types.OrderStatusCancelled }
+
+		rr := env.pay(t, "tok_visa")
+		if rr.Code == http.StatusOK {
+			t.Fatalf("expected the payment to be rejected, got %d: %s", rr.Code, rr.Body)
+		}
+
+		if len(env.inventory.reversed) != 1 || env.inventory.reversed[0] != 1 {
+			t.Errorf("expected the committed stock of order 1 to be put back, got %v", env.inventory.reversed)
+		}
+		if _, err := env.provider.Refund(env.payments.payments[0].ProviderPaymentID, types.MustParseMoney("0.01", "USD")); err == nil {
+			t.Error("expected the payment to be refunded in full")
+		}
+	})
+
+	t.Run("should cancel the order and release stock when the payment is declined", func(t *testing.T) {
+		env := newTestEnv()
+
+		rr := env.pay(t, FakeTokenDeclined)
+		if rr.Code != http.StatusPaymentRequired {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusPaymentRequired, rr.Code, rr.Body)
+		}
+
+		if env.orders.order.Status != types.OrderStatusCancelled {
+			t.Errorf("expected order to be cancelled, got %s", env.orders.order.Status)
+		}
+		if len(env.inventory.released) != 1 || env.inventory.released[0] != 1 {
+			t.Errorf("expected the reservation of order 1 to be released, got %v", env.inventory.released)
+		}
+	})
+
+	t.Run("should reject paying an order that is not pending", func(t *testing.T) {
+		env := newTestEnv()
+		env.orders.order.Status = types.OrderStatusPaid
+
+		rr := env.pay(t, "tok_visa")
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if len(env.payments.payments) != 0 {
+			t.Errorf("expected no payment attempt, got %d", len(env.payments.payments))
+		}
+	})
+
+	t.Run("should settle a pending payment from a signed webhook only once", func(t *testing.T) {
+		env := newTestEnv()
+
+		rr := env.pay(t, FakeTokenPending)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body)
+		}
+
+		body, _ := json.Marshal(fakeWebhook{
+			IntentID: env.payments.payments[0].ProviderPaymentID,
+			Status:   string(types.IntentExpired),
+		})
+
+		for i := 0; i < 2; i++ {
+			rr = env.webhook(t, body, env.provider.Sign(body))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+			}
+		}
+
+		if env.payments.payments[0].Status != types.PaymentStatusExpired {
+			t.Errorf("expected payment to expire, got %s", env.payments.payments[0].Status)
+		}
+		if env.orders.order.Status != types.OrderStatusCancelled {
+			t.Errorf("expected order to be cancelled, got %s", env.orders.order.Status)
+		}
+		if len(env.inventory.released) != 1 {
+			t.Errorf("expected the reservation to be released once, got %v", env.inventory.released)
+		}
+	})
+
+	t.Run("should reject paying an order with a pending payment", func(t *testing.T) {
+		env := newTestEnv()
+
+		if rr := env.pay(t, FakeTokenPending); rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body)
+		}
+
+		rr := env.pay(t, "tok_visa")
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if len(env.payments.payments) != 1 {
+			t.Errorf("expected a single payment attempt, got %d", len(env.payments.payments))
+		}
+	})
+
+	t.Run("should keep the stock of a paid order when a second payment succeeds", func(t *testing.T) {
+		env := newTestEnv()
+
+		// two attempts racing past the pending payment check
+		for i := 0; i < 2; i++ {
+			order, _ := env.orders.GetOrder(1)
+			if _, err := env.handler.payOrder(order, FakeTokenPending); err != nil {
+				t.Fatalf("failed to start payment: %v", err)
+			}
+		}
+
+		// the first one succeeds, its webhook arrives twice
+		first, _ := json.Marshal(fakeWebhook{IntentID: env.payments.payments[0].ProviderPaymentID, Status: string(types.IntentSucceeded)})
+		for i := 0; i < 2; i++ {
+			if rr := env.webhook(t, first, env.provider.Sign(first)); rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+			}
+		}
+
+		second, _ := json.Marshal(fakeWebhook{IntentID: env.payments.payments[1].ProviderPaymentID, Status: string(types.IntentSucceeded)})
+		env.webhook(t, second, env.provider.Sign(second))
+
+		if env.orders.order.Status != types.OrderStatusPaid {
+			t.Errorf("expected order to be paid, got %s", env.orders.order.Status)
+		}
+		if len(env.inventory.reversed) != 0 {
+			t.Errorf("expected the stock of the paid order to stay committed, got reversed %v", env.inventory.reversed)
+		}
+		if len(env.inventory.committed) != 2 {
+			t.Errorf("expected one commit per succeeded payment, got %v", env.inventory.committed)
+		}
+		if _, err := env.provider.Refund(env.payments.payments[0].ProviderPaymentID, types.MustParseMoney("0.01", "USD")); err != nil {
+			t.Errorf("expected the first payment to be kept, got %v", err)
+		}
+		if _, err := env.provider.Refund(env.payments.payments[1].ProviderPaymentID, types.MustParseMoney("0.01", "USD")); err == nil {
+			t.Error("expected the second payment to be refunded in full")
+		}
+	})
+
+	t.Run("should reject a webhook with an invalid signature", func(t *testing.T) {
+		env := newTestEnv()
+
+		body := []byte(`{"intentId":"pi_fake_1_1","status":"succeeded"}`)
+		rr := env.webhook(t, body, NewFakeProvider("other secret").Sign(body))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestFakeProvider_Refund(t *testing.T) {
+	provider := NewFakeProvider("secret")
+	amount := types.MustParseMoney("30.00", "USD")
+
+	intent, err := provider.CreateIntent(1, amount, "tok_visa")
+	if err != nil {
+		t.Fatalf("failed to create intent: %v", err)
+	}
+	if _, err := provider.Refund(intent.ID, amount); err == nil {
+		t.Error("expected an uncaptured intent not to be refundable")
+	}
+
+	if _, err := provider.Capture(intent.ID); err != nil {
+		t.Fatalf("failed to capture intent: %v", err)
+	}
+	if _, err := provider.Refund(intent.ID, types.MustParseMoney("20.00", "USD")); err != nil {
+		t.Fatalf("failed to refund: %v", err)
+	}
+	if _, err := provider.Refund(intent.ID, types.MustParseMoney("10.01", "USD")); err == nil {
+		t.Error("expected refunds over the captured amount to be rejected")
+	}
+}
+
+func TestFakeProvider_ParseWebhookWithoutSecret(t *testing.T) {
+	provider := NewFakeProvider("")
+
+	body := []byte(`{"intentId":"pi_fake_1_1","status":"succeeded"}`)
+	if _, err := provider.ParseWebhook(body, provider.Sign(body)); err == nil || err.Error() != "invalid webhook signature" {
+		t.Errorf("expected webhooks to be rejected without a secret, got %v", err)
+	}
+}
+
+type testEnv struct {
+	handler   *Handler
+	provider  *FakeProvider
+	payments  *mockPaymentStore
+	orders    *mockOrderStore
+	inventory *mockInventoryStore
+}
+
+func newTestEnv() *testEnv {
+	env := &testEnv{
+		provider: NewFakeProvider("secret"),
+		payments: &mockPaymentStore{},
+		orders: &mockOrderStore{order: types.OrderWithItems{
+			ID:     1,
+			UserID: 7,
+			Total:  types.MustParseMoney("59.97", "USD"),
+			Status: types.OrderStatusPending,
+			Items: []types.OrderItemWithProduct{
+				{ProductID: 1, Quantity: 2},
+				{ProductID: 2, Quantity: 1},
+			},
+		}},
+		inventory: &mockInventoryStore{},
+	}
+	env.handler = NewHandler(env.payments, env.orders, env.inventory, nil, env.provider)
+	return env
+}
+
+func (env *testEnv) pay(t *testing.T, paymentMethod string) *httptest.ResponseRecorder {
+	marshalled, _ := json.Marshal(types.PayOrderPayload{PaymentMethod: paymentMethod})
+
+	req, err := http.NewRequest(http.MethodPost, "/orders/1/pay", bytes.NewBuffer(marshalled))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, env.orders.order.UserID))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+
+	router.HandleFunc("/orders/{id}/pay", env.handler.handlePayOrder)
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func (env *testEnv) webhook(t *testing.T, body []byte, signature string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set(SignatureHeader, signature)
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+
+	router.HandleFunc("/payments/webhook", env.handler.handleWebhook)
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+type mockPaymentStore struct {
+	payments []types.Payment
+}
+
+func (m *mockPaymentStore) CreatePayment(payment *types.Payment) error {
+	payment.ID = len(m.payments) + 1
+	m.payments = append(m.payments, *payment)
+	return nil
+}
+
+func (m *mockPaymentStore) UpdatePaymentStatus(paymentID int, status types.PaymentStatus, failureReason *string) (bool, error) {
+	if m.payments[paymentID-1].Status != types.PaymentStatusPending {
+		return false, nil
+	}
+	m.payments[paymentID-1].Status = status
+	m.payments[paymentID-1].FailureReason = failureReason
+	return true, nil
+}
+
+func (m *mockPaymentStore) GetPaymentByProviderID(provider, providerPaymentID string) (*types.Payment, error) {
+	for _, payment := range m.payments {
+		if payment.Provider == provider && payment.ProviderPaymentID == providerPaymentID {
+			return &payment, nil
+		}
+	}
+	return nil, fmt.Errorf("payment not found")
+}
+
+func (m *mockPaymentStore) GetPaymentsForOrder(orderID int) ([]types.Payment, error) {
+	return m.payments, nil
+}
+
+type mockOrderStore struct {
+	order types.OrderWithItems
+}
+
+func (m *mockOrderStore) CreateOrder(types.Order) (int, error) {
+	return 0, nil
+}
+
+func (m *mockOrderStore) CreateOrderItem(types.OrderItem) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetUserOrders(userID int, filters types.OrderFilters) ([]types.OrderWithItems, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) GetOrderByID(orderID, userID int) (*types.OrderWithItems, error) {
+	if orderID != m.order.ID || userID != m.order.UserID {
+		return nil, fmt.Errorf("order not found or not owned by user")
+	}
+	order := m.order
+	return &order, nil
+}
+
+func (m *mockOrderStore) GetOrdersCount(userID int, filters types.OrderFilters) (int, error) {
+	return 0, nil
+}
+
+func (m *mockOrderStore) GetOrder(orderID int) (*types.OrderWithItems, error) {
+	order := m.order
+	return &order, nil
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(orderID int, fromStatus, toStatus string) error {
+	if m.order.Status != fromStatus {
+		return fmt.Errorf("order not found or not in status %s", fromStatus)
+	}
+	m.order.Status = toStatus
+	return nil
+}
+
+type mockInventoryStore struct {
+	expired   bool
+	onCommit  func()
+	committed []int
+	released  []int
+	reversed  []int
+}
+
+func (m *mockInventoryStore) GetCurrentStock(productID int) (int, error) {
+	return 0, nil
+}
+
+func (m *mockInventoryStore) GetProductsWithStock(productIDs []int) (map[int]int, error) {
+	return nil, nil
+}
+
+func (m *mockInventoryStore) GetStockPolicies(productIDs []int) (map[int]types.StockPolicy, error) {
+	return nil, nil
+}
+
+func (m *mockInventoryStore) ReserveStock(productID, quantity int, orderID int, destination *types.UserAddress) error {
+	return nil
+}
+
+func (m *mockInventoryStore) ReserveStockLines(orderID int, lines []types.CartItem, destination *types.UserAddress) error {
+	return nil
+}
+
+func (m *mockInventoryStore) ReleaseStock(productID, quantity int, reason string) error {
+	return nil
+}
+
+func (m *mockInventoryStore) GetStockLevel(productID int) (*types.StockLevel, error) {
+	return &types.StockLevel{ProductID: productID}, nil
+}
+
+func (m *mockInventoryStore) CommitReservation(orderID int) error {
+	if m.expired {
+		return fmt.Errorf("stock reservation for order %d has expired", orderID)
+	}
+	m.committed = append(m.committed, orderID)
+	if m.onCommit != nil {
+		m.onCommit()
+	}
+	return nil
+}
+
+func (m *mockInventoryStore) ReleaseReservation(orderID int) error {
+	m.released = append(m.released, orderID)
+	return nil
+}
+
+func (m *mockInventoryStore) ReverseCommittedReservation(orderID int) error {
+	m.reversed = append(m.reversed, orderID)
+	return nil
+}
+
+func (m *mockInventoryStore) RestockReturn(orderID, productID, quantity int, unitCost *types.Money, reason string, returnID int) error {
+	return nil
+}
+
+func (m *mockInventoryStore) ExpireHolds(limit int) ([]int, error) {
+	return nil, nil
+}
+
+func (m *mockInventoryStore) AdjustStock(productID int, warehouseID *int, quantity int, reasonCode types.AdjustmentReason, note string) error {
+	return nil
+}
+
+func (m *mockInventoryStore) AddStock(productID int, warehouseID *int, quantity int, unitCost *types.Money, lot *types.LotInfo, reason string, refType types.InventoryRefType, refID *int) error {
+	return nil
+}
+
+func (m *mockInventoryStore) TransferStock(productID, fromWarehouseID, toWarehouseID, quantity int, note string) (*types.StockTransfer, error) {
+	return nil, nil
+}
+
+func (m *mockInventoryStore) GetWarehouseStock(warehouseID int) ([]types.WarehouseStock, error) {
+	return nil, nil
+}
+
+func (m *mockInventoryStore) GetStockHistory(productID int, limit int) ([]types.InventoryMovement, error) {
+	return nil, nil
+}
+
+func (m *mockInventoryStore) GetMovements(filter types.MovementFilter) ([]types.InventoryMovement, error) {
+	return nil, nil
+}
+
+func (m *mockInventoryStore) StreamMovements(filter types.MovementFilter, fn func(types.InventoryMovement) error) error {
+	return nil
+}
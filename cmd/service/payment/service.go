@@ -0,0 +1,155 @@
+package payment
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// payOrder runs one payment attempt for a pending order and settles it
+// right away when the provider answers synchronously
+func (h *Handler) payOrder(order *types.OrderWithItems, paymentMethod string) (*types.Payment, error) {
+	intent, err := h.provider.CreateIntent(order.ID, order.Total, paymentMethod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+	}
+
+	payment := &types.Payment{
+		OrderID:           order.ID,
+		Provider:          h.provider.Name(),
+		ProviderPaymentID: intent.ID,
+		Amount:            order.Total,
+		Status:            types.PaymentStatusPending,
+	}
+	if err := h.store.CreatePayment(payment); err != nil {
+		return nil, err
+	}
+
+	if intent.Status == types.IntentRequiresCapture {
+		intent, err = h.provider.Capture(intent.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture payment: %w", err)
+		}
+	}
+
+	if err := h.settlePayment(payment, intent.Status, intent.FailureReason); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// settlePayment applies the outcome of a payment to the payment record and its
+// order: a successful payment marks the order paid, a failed or expired one
+// cancels it and releases its stock. Payments that are already settled are left
+// alone, since webhooks may be delivered more than once, even at the same time.
+func (h *Handler) settlePayment(payment *types.Payment, status types.PaymentIntentStatus, failureReason string) error {
+	if payment.Status != types.PaymentStatusPending {
+		return nil
+	}
+
+	switch status {
+	case types.IntentSucceeded:
+		settled, err := h.store.UpdatePaymentStatus(payment.ID, types.PaymentStatusSucceeded, nil)
+		if err != nil {
+			return err
+		}
+		if !settled {
+			return h.reloadPayment(payment)
+		}
+		payment.Status = types.PaymentStatusSucceeded
+
+		// turn the stock holds into sales, unless they expired before the payment
+		if err := h.inventoryStore.CommitReservation(payment.OrderID); err != nil {
+			if cancelErr := h.cancelOrder(payment.OrderID); cancelErr != nil {
+				log.Printf("failed to cancel order %d: %v", payment.OrderID, cancelErr)
+			}
+			return h.refundPayment(payment, err)
+		}
+
+		err = h.orderStore.UpdateOrderStatus(payment.OrderID, types.OrderStatusPending, types.OrderStatusPaid)
+		if err != nil {
+			return h.settleUnpayableOrder(payment, err)
+		}
+
+	case types.IntentFailed, types.IntentExpired:
+		paymentStatus := types.PaymentStatusFailed
+		if status == types.IntentExpired {
+			paymentStatus = types.PaymentStatusExpired
+		}
+
+		var reason *string
+		if failureReason != "" {
+			reason = &failureReason
+		}
+		settled, err := h.store.UpdatePaymentStatus(payment.ID, paymentStatus, reason)
+		if err != nil {
+			return err
+		}
+		if !settled {
+			return h.reloadPayment(payment)
+		}
+		payment.Status = paymentStatus
+		payment.FailureReason = reason
+
+		if err := h.cancelOrder(payment.OrderID); err != nil {
+			return err
+		}
+	}
+
+	// still processing, a webhook will settle it
+	return nil
+}
+
+// settleUnpayableOrder handles a succeeded payment whose order could not be
+// marked paid. Only an order cancelled meanwhile gets its committed stock put
+// back; an order already paid by another attempt keeps its stock, and this
+// duplicate charge is refunded.
+func (h *Handler) settleUnpayableOrder(payment *types.Payment, cause error) error {
+	order, err := h.orderStore.GetOrder(payment.OrderID)
+	if err != nil {
+		return fmt.Errorf("failed to mark order %d paid: %w", payment.OrderID, cause)
+	}
+
+	switch order.Status {
+	case types.OrderStatusCancelled:
+		// the customer must not be charged and the committed stock goes back
+		// where it was taken from
+		if err := h.inventoryStore.ReverseCommittedReservation(payment.OrderID); err != nil {
+			log.Printf("failed to put back the stock of cancelled order %d: %v", payment.OrderID, err)
+		}
+		return h.refundPayment(payment, cause)
+	case types.OrderStatusPending:
+		return fmt.Errorf("failed to mark order %d paid: %w", payment.OrderID, cause)
+	default:
+		return h.refundPayment(payment, fmt.Errorf("order is already %s", order.Status))
+	}
+}
+
+// reloadPayment refreshes a payment another request settled first
+func (h *Handler) reloadPayment(payment *types.Payment) error {
+	current, err := h.store.GetPaymentByProviderID(payment.Provider, payment.ProviderPaymentID)
+	if err != nil {
+		return err
+	}
+	*payment = *current
+	return nil
+}
+
+// cancelOrder cancels a pending order and releases its stock holds
+func (h *Handler) cancelOrder(orderID int) error {
+	if err := h.orderStore.UpdateOrderStatus(orderID, types.OrderStatusPending, types.OrderStatusCancelled); err != nil {
+		return err
+	}
+
+	return h.inventoryStore.ReleaseReservation(orderID)
+}
+
+// refundPayment gives back a succeeded payment whose order cannot be fulfilled
+func (h *Handler) refundPayment(payment *types.Payment, cause error) error {
+	if _, err := h.provider.Refund(payment.ProviderPaymentID, payment.Amount); err != nil {
+		return fmt.Errorf("failed to refund payment %d for order %d: %w", payment.ID, payment.OrderID, err)
+	}
+	return fmt.Errorf("order %d cannot be fulfilled, payment refunded: %w", payment.OrderID, cause)
+}
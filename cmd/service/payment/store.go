@@ -0,0 +1,129 @@
+package payment
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// CreatePayment records a new payment attempt and sets its ID
+func (s *Store) CreatePayment(payment *types.Payment) error {
+	if payment.Status == "" {
+		payment.Status = types.PaymentStatusPending
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO payments (order_id, provider, provider_payment_id, amount, currency, status, failure_reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, payment.OrderID, payment.Provider, payment.ProviderPaymentID, payment.Amount, payment.Amount.Currency, payment.Status, payment.FailureReason)
+	if err != nil {
+		return fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get payment ID: %w", err)
+	}
+	payment.ID = int(id)
+
+	return nil
+}
+
+// UpdatePaymentStatus settles a pending payment attempt. It reports false when
+// the payment was already settled, e.g. by another copy of the same webhook.
+func (s *Store) UpdatePaymentStatus(paymentID int, status types.PaymentStatus, failureReason *string) (bool, error) {
+	result, err := s.db.Exec(
+		"UPDATE payments SET status = ?, failure_reason = ? WHERE id = ? AND status = 'pending'",
+		status, failureReason, paymentID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update payment status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// GetPaymentByProviderID retrieves a payment by the ID the provider gave it
+func (s *Store) GetPaymentByProviderID(provider, providerPaymentID string) (*types.Payment, error) {
+	row := s.db.QueryRow(`
+		SELECT id, order_id, provider, provider_payment_id, amount, currency, status, failure_reason, created_at, updated_at
+		FROM payments
+		WHERE provider = ? AND provider_payment_id = ?
+	`, provider, providerPaymentID)
+
+	return scanRowIntoPayment(row)
+}
+
+// GetPaymentsForOrder retrieves all payment attempts of an order, oldest first
+func (s *Store) GetPaymentsForOrder(orderID int) ([]types.Payment, error) {
+	rows, err := s.db.Query(`
+		SELECT id, order_id, provider, provider_payment_id, amount, currency, status, failure_reason, created_at, updated_at
+		FROM payments
+		WHERE order_id = ?
+		ORDER BY id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+	defer rows.Close()
+
+	payments := []types.Payment{}
+	for rows.Next() {
+		payment, err := scanRowIntoPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment row: %w", err)
+		}
+		payments = append(payments, *payment)
+	}
+
+	return payments, nil
+}
+
+// Helper function to scan database row into Payment struct
+func scanRowIntoPayment(scanner interface {
+	Scan(dest ...any) error
+}) (*types.Payment, error) {
+	var payment types.Payment
+	var currency string
+	var failureReason sql.NullString
+
+	err := scanner.Scan(
+		&payment.ID,
+		&payment.OrderID,
+		&payment.Provider,
+		&payment.ProviderPaymentID,
+		&payment.Amount,
+		&currency,
+		&payment.Status,
+		&failureReason,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("payment not found")
+		}
+		return nil, err
+	}
+
+	payment.Amount.Currency = currency
+	if failureReason.Valid {
+		payment.FailureReason = &failureReason.String
+	}
+
+	return &payment, nil
+}
@@ -1,24 +1,34 @@
 package product
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
 	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
 	"github.com/gorilla/mux"
 )
 
 type Handler struct {
-	store types.ProductStore
+	store             types.ProductStore
+	currencyConverter types.CurrencyConverter
+	userStore         types.UserStore
 }
 
-func NewHandler(store types.ProductStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.ProductStore, currencyConverter types.CurrencyConverter, userStore types.UserStore) *Handler {
+	return &Handler{store: store, currencyConverter: currencyConverter, userStore: userStore}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/products", h.handleGetProducts).Methods(http.MethodGet)
 	router.HandleFunc("/products", h.handleCreateProduct).Methods(http.MethodPost)
+
+	// Admin only routes, orders keep the product as it was sold
+	router.HandleFunc("/products/{id}", auth.WithAdminAuth(h.handleUpdateProduct, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{id}", auth.WithAdminAuth(h.handleDeleteProduct, h.userStore)).Methods(http.MethodDelete)
 }
 
 func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
@@ -28,6 +38,15 @@ func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// optional display currency, e.g. /products?currency=EUR
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		ps, err = h.currencyConverter.PriceProducts(ps, currency)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	utils.WriteJSON(w, http.StatusOK, ps)
 }
 
@@ -43,16 +62,139 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currency := strings.ToUpper(payload.Currency)
+	if currency == "" {
+		currency = types.DefaultCurrency
+	}
+
+	// the price must be convertible to the other currencies of the catalog
+	if _, err := h.currencyConverter.GetRate(types.DefaultCurrency, currency); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(payload.Components) > 0 {
+		components, err := h.store.GetProductsByIDs(componentIDs(payload.Components))
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := validateBundleComponents(payload.Components, components); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	product := types.Product{
 		Name:        payload.Name,
+		SKU:         payload.SKU,
 		Description: payload.Description,
+		Image:       payload.Image,
 		Price:       payload.Price,
+		Currency:    currency,
+		TaxClass:    payload.TaxClass,
+		WeightGrams: payload.WeightGrams,
+		Components:  payload.Components,
 	}
 
 	if err := h.store.CreateProduct(&product); err != nil {
+		if err.Error() == fmt.Sprintf("sku %s already exists", product.SKU) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusCreated, product)
 }
+
+// PUT /api/v1/products/{id} - replace the catalog details of a product
+func (h *Handler) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	var payload types.UpdateProductPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	currency := strings.ToUpper(payload.Currency)
+	if currency == "" {
+		currency = types.DefaultCurrency
+	}
+
+	if _, err := h.currencyConverter.GetRate(types.DefaultCurrency, currency); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	products, err := h.store.GetProductsByIDs([]int{productID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(products) == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+
+	product := products[0]
+	product.Name = payload.Name
+	product.SKU = payload.SKU
+	product.Description = payload.Description
+	product.Image = payload.Image
+	product.Price = payload.Price
+	product.Price.Currency = currency
+	product.Currency = currency
+	product.TaxClass = payload.TaxClass
+	if product.TaxClass == "" {
+		product.TaxClass = types.DefaultTaxClass
+	}
+	product.WeightGrams = payload.WeightGrams
+
+	if err := h.store.UpdateProduct(&product); err != nil {
+		if err.Error() == fmt.Sprintf("sku %s already exists", product.SKU) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+// DELETE /api/v1/products/{id} - remove a product from the catalog
+func (h *Handler) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	if err := h.store.DeleteProduct(productID); err != nil {
+		switch {
+		case err.Error() == "product not found":
+			utils.WriteError(w, http.StatusNotFound, err)
+		case err.Error() == fmt.Sprintf("product %d is still in use", productID):
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Product deleted successfully",
+	})
+}
@@ -0,0 +1,44 @@
+package product
+
+import (
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// validateBundleComponents checks the components of a new bundle against the
+// products found for them. Each component is listed once and must be a plain
+// product, bundles cannot be nested.
+func validateBundleComponents(components []types.BundleComponent, products []types.Product) error {
+	found := make(map[int]types.Product, len(products))
+	for _, p := range products {
+		found[p.ID] = p
+	}
+
+	seen := make(map[int]bool, len(components))
+	for _, component := range components {
+		if seen[component.ProductID] {
+			return fmt.Errorf("component %d is listed more than once", component.ProductID)
+		}
+		seen[component.ProductID] = true
+
+		p, ok := found[component.ProductID]
+		if !ok {
+			return fmt.Errorf("component product %d not found", component.ProductID)
+		}
+		if len(p.Components) > 0 {
+			return fmt.Errorf("component product %d is itself a bundle", component.ProductID)
+		}
+	}
+
+	return nil
+}
+
+// componentIDs lists the products a bundle is made of
+func componentIDs(components []types.BundleComponent) []int {
+	ids := make([]int, len(components))
+	for i, component := range components {
+		ids[i] = component.ProductID
+	}
+	return ids
+}
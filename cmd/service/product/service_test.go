@@ -0,0 +1,38 @@
+package product
+
+import (
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestValidateBundleComponents(t *testing.T) {
+	products := []types.Product{
+		{ID: 1},
+		{ID: 2},
+		{ID: 3, Components: []types.BundleComponent{{ProductID: 1, Quantity: 1}}},
+	}
+
+	tests := []struct {
+		name       string
+		components []types.BundleComponent
+		valid      bool
+	}{
+		{"plain products", []types.BundleComponent{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 1}}, true},
+		{"listed twice", []types.BundleComponent{{ProductID: 1, Quantity: 2}, {ProductID: 1, Quantity: 1}}, false},
+		{"unknown product", []types.BundleComponent{{ProductID: 4, Quantity: 1}}, false},
+		{"nested bundle", []types.BundleComponent{{ProductID: 3, Quantity: 1}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateBundleComponents(test.components, products)
+			if test.valid && err != nil {
+				t.Errorf("Expected the components to be valid, got %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("Expected the components to be rejected")
+			}
+		})
+	}
+}
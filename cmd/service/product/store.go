@@ -17,7 +17,7 @@ func NewStore(db *sql.DB) *Store {
 }
 
 func (s *Store) GetProducts() ([]types.Product, error) {
-	rows, err := s.db.Query("SELECT * FROM products")
+	rows, err := s.db.Query("SELECT id, name, COALESCE(sku, ''), description, image, price, currency, tax_class, weight_grams, createdAt FROM products")
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +30,11 @@ func (s *Store) GetProducts() ([]types.Product, error) {
 		}
 		products = append(products, *p)
 	}
+	rows.Close()
+
+	if err := s.loadBundleComponents(products); err != nil {
+		return nil, err
+	}
 	return products, nil
 }
 
@@ -38,32 +43,78 @@ func scanRowsIntoProduct(rows *sql.Rows) (*types.Product, error) {
 	err := rows.Scan(
 		&p.ID,
 		&p.Name,
+		&p.SKU,
 		&p.Description,
+		&p.Image,
 		&p.Price,
+		&p.Currency,
+		&p.TaxClass,
+		&p.WeightGrams,
 		&p.CreatedAt,
 	)
 	if err != nil {
 		return &types.Product{}, err
 	}
+	p.Price.Currency = p.Currency
 	return &p, nil
 }
 
 func (s *Store) CreateProduct(product *types.Product) error {
-	_, err := s.db.Exec(
-		"INSERT INTO products (name, description, price) VALUES (?, ?, ?)",
+	if product.TaxClass == "" {
+		product.TaxClass = types.DefaultTaxClass
+	}
+	if product.Currency == "" {
+		product.Currency = types.DefaultCurrency
+	}
+	product.Price.Currency = product.Currency
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO products (name, sku, description, image, price, currency, tax_class, weight_grams) VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?)",
 		product.Name,
+		product.SKU,
 		product.Description,
+		product.Image,
 		product.Price,
+		product.Currency,
+		product.TaxClass,
+		product.WeightGrams,
 	)
 	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return fmt.Errorf("sku %s already exists", product.SKU)
+		}
 		return err
 	}
-	return nil
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	product.ID = int(id)
+
+	// a bundle is created together with its components
+	for _, component := range product.Components {
+		_, err := tx.Exec(
+			"INSERT INTO bundle_components (bundle_id, component_id, quantity) VALUES (?, ?, ?)",
+			product.ID, component.ProductID, component.Quantity,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add bundle component %d: %w", component.ProductID, err)
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (s *Store) GetProductsByIDs(productIDs []int) ([]types.Product, error) {
 	placeholders := strings.Repeat("?,", len(productIDs)-1) + "?"
-	query := fmt.Sprintf(`SELECT * FROM products WHERE id IN (%s)`, placeholders)
+	query := fmt.Sprintf(`SELECT id, name, COALESCE(sku, ''), description, image, price, currency, tax_class, weight_grams, createdAt FROM products WHERE id IN (%s)`, placeholders)
 
 	// Convert Product IDs to interface slice
 	args := make([]any, len(productIDs))
@@ -83,19 +134,93 @@ func (s *Store) GetProductsByIDs(productIDs []int) ([]types.Product, error) {
 		}
 		products = append(products, *p)
 	}
+	rows.Close()
+
+	if err := s.loadBundleComponents(products); err != nil {
+		return nil, err
+	}
 	return products, nil
 }
 
+// loadBundleComponents fills in the components of the bundles among products
+func (s *Store) loadBundleComponents(products []types.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	placeholders := strings.Repeat("?,", len(products)-1) + "?"
+	args := make([]any, len(products))
+	index := make(map[int]int, len(products))
+	for i, p := range products {
+		args[i] = p.ID
+		index[p.ID] = i
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT bundle_id, component_id, quantity
+		FROM bundle_components
+		WHERE bundle_id IN (%s)
+		ORDER BY bundle_id, component_id
+	`, placeholders), args...)
+	if err != nil {
+		return fmt.Errorf("failed to get bundle components: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bundleID int
+		var component types.BundleComponent
+		if err := rows.Scan(&bundleID, &component.ProductID, &component.Quantity); err != nil {
+			return fmt.Errorf("failed to scan bundle component: %w", err)
+		}
+		p := &products[index[bundleID]]
+		p.Components = append(p.Components, component)
+	}
+
+	return rows.Err()
+}
+
 func (s *Store) UpdateProduct(product *types.Product) error {
 	_, err := s.db.Exec(
-		"UPDATE products SET name = ?, description = ?, price = ? WHERE id = ?",
+		"UPDATE products SET name = ?, sku = NULLIF(?, ''), description = ?, image = ?, price = ?, currency = ?, tax_class = ?, weight_grams = ? WHERE id = ?",
 		product.Name,
+		product.SKU,
 		product.Description,
+		product.Image,
 		product.Price,
+		product.Currency,
+		product.TaxClass,
+		product.WeightGrams,
 		product.ID,
 	)
 	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return fmt.Errorf("sku %s already exists", product.SKU)
+		}
 		return err
 	}
 	return nil
 }
+
+// DeleteProduct removes a product from the catalog. Orders keep their lines
+// of it, products with stock history or used in bundles can't be deleted.
+func (s *Store) DeleteProduct(id int) error {
+	result, err := s.db.Exec("DELETE FROM products WHERE id = ?", id)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key constraint fails") {
+			return fmt.Errorf("product %d is still in use", id)
+		}
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("product not found")
+	}
+
+	return nil
+}
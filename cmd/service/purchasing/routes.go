@@ -0,0 +1,358 @@
+package purchasing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store          types.PurchaseOrderStore
+	inventoryStore types.InventoryStore
+	userStore      types.UserStore
+}
+
+func NewHandler(store types.PurchaseOrderStore, inventoryStore types.InventoryStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, inventoryStore: inventoryStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes for suppliers
+	router.HandleFunc("/suppliers", auth.WithAdminAuth(h.handleGetSuppliers, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/suppliers", auth.WithAdminAuth(h.handleCreateSupplier, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/suppliers/{id}", auth.WithAdminAuth(h.handleGetSupplier, h.userStore)).Methods(http.MethodGet)
+
+	// Admin only routes for purchase orders; the fixed paths go before /{id}
+	router.HandleFunc("/purchase-orders", auth.WithAdminAuth(h.handleCreatePurchaseOrder, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/purchase-orders", auth.WithAdminAuth(h.handleGetPurchaseOrders, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/purchase-orders/open", auth.WithAdminAuth(h.handleGetOpenPurchaseOrders, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/purchase-orders/incoming", auth.WithAdminAuth(h.handleGetIncomingStock, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/purchase-orders/reorder-suggestions", auth.WithAdminAuth(h.handleGetReorderSuggestions, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/purchase-orders/{id}", auth.WithAdminAuth(h.handleGetPurchaseOrder, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/purchase-orders/{id}/receive", auth.WithAdminAuth(h.handleReceivePurchaseOrder, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/purchase-orders/{id}/cancel", auth.WithAdminAuth(h.handleCancelPurchaseOrder, h.userStore)).Methods(http.MethodPost)
+}
+
+// GET /api/v1/suppliers - list suppliers
+func (h *Handler) handleGetSuppliers(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := h.store.GetSuppliers()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"suppliers": suppliers,
+		"count":     len(suppliers),
+	})
+}
+
+// POST /api/v1/suppliers - create a supplier
+func (h *Handler) handleCreateSupplier(w http.ResponseWriter, r *http.Request) {
+	var payload types.SupplierPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	supplier := types.Supplier{
+		Name:         payload.Name,
+		Email:        payload.Email,
+		Phone:        payload.Phone,
+		LeadTimeDays: defaultLeadTimeDays,
+	}
+	if payload.LeadTimeDays != nil {
+		supplier.LeadTimeDays = *payload.LeadTimeDays
+	}
+
+	if err := h.store.CreateSupplier(&supplier); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, supplier)
+}
+
+// GET /api/v1/suppliers/{id} - get a supplier
+func (h *Handler) handleGetSupplier(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid supplier ID"))
+		return
+	}
+
+	supplier, err := h.store.GetSupplier(supplierID)
+	if err != nil {
+		if err.Error() == "supplier not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, supplier)
+}
+
+// POST /api/v1/purchase-orders - order stock from a supplier
+func (h *Handler) handleCreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.CreatePurchaseOrderPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	po, err := purchaseOrderFromPayload(payload, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.CreatePurchaseOrder(po); err != nil {
+		switch {
+		case err.Error() == "supplier not found",
+			payload.WarehouseID != nil && err.Error() == fmt.Sprintf("warehouse %d not found", *payload.WarehouseID):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case strings.HasPrefix(err.Error(), "product ") &&
+			(strings.HasSuffix(err.Error(), " not found") || strings.HasSuffix(err.Error(), " is listed twice")):
+			utils.WriteError(w, http.StatusBadRequest, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	h.writePurchaseOrder(w, http.StatusCreated, po.ID)
+}
+
+// GET /api/v1/purchase-orders - list purchase orders, optionally filtered by status
+func (h *Handler) handleGetPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	var statuses []types.PurchaseOrderStatus
+	if s := r.URL.Query().Get("status"); s != "" {
+		status := types.PurchaseOrderStatus(s)
+		switch status {
+		case types.PurchaseOrderOpen, types.PurchaseOrderPartiallyReceived, types.PurchaseOrderReceived, types.PurchaseOrderCancelled:
+			statuses = append(statuses, status)
+		default:
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid status. Must be one of: OPEN, PARTIALLY_RECEIVED, RECEIVED, CANCELLED"))
+			return
+		}
+	}
+
+	h.writePurchaseOrders(w, statuses)
+}
+
+// GET /api/v1/purchase-orders/open - purchase orders still waiting for stock
+func (h *Handler) handleGetOpenPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	h.writePurchaseOrders(w, []types.PurchaseOrderStatus{types.PurchaseOrderOpen, types.PurchaseOrderPartiallyReceived})
+}
+
+// GET /api/v1/purchase-orders/incoming - quantities per product that open purchase orders still have to deliver
+func (h *Handler) handleGetIncomingStock(w http.ResponseWriter, r *http.Request) {
+	incoming, err := h.store.GetIncomingStock()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"incoming": incoming,
+		"count":    len(incoming),
+	})
+}
+
+// GET /api/v1/purchase-orders/reorder-suggestions - what to order, from sales over the last `days` days
+// (default 30), to cover the supplier lead time plus `cover` days (default 14)
+func (h *Handler) handleGetReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	days, ok := parsePositiveInt(w, r, "days", 30)
+	if !ok {
+		return
+	}
+	coverDays, ok := parsePositiveInt(w, r, "cover", 14)
+	if !ok {
+		return
+	}
+
+	velocity, err := h.store.GetProductVelocity(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	suggestions := []types.ReorderSuggestion{}
+	for _, v := range velocity {
+		if suggestion := suggestReorder(v, days, coverDays); suggestion.SuggestedQuantity > 0 {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"suggestions": suggestions,
+		"days":        days,
+		"cover_days":  coverDays,
+		"count":       len(suggestions),
+	})
+}
+
+// GET /api/v1/purchase-orders/{id} - get a purchase order with its lines
+func (h *Handler) handleGetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	purchaseOrderID, ok := parsePurchaseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	h.writePurchaseOrder(w, http.StatusOK, purchaseOrderID)
+}
+
+// POST /api/v1/purchase-orders/{id}/receive - book a (partial) delivery and add it to stock
+func (h *Handler) handleReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	purchaseOrderID, ok := parsePurchaseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.ReceivePurchaseOrderPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	lots := make(map[int]*types.LotInfo)
+	for _, line := range payload.Lines {
+		lot, err := lotFromLine(line)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		lots[line.ProductID] = lot
+	}
+
+	po, err := h.store.ReceivePurchaseOrder(purchaseOrderID, payload.Lines)
+	if err != nil {
+		switch {
+		case err.Error() == "purchase order not found or not open":
+			utils.WriteError(w, http.StatusConflict, err)
+		case strings.HasPrefix(err.Error(), "product ") || strings.HasPrefix(err.Error(), "cannot receive"):
+			utils.WriteError(w, http.StatusBadRequest, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	// received units are valued at the cost on the order, lines without a cost at the average
+	costs := make(map[int]*types.Money)
+	for _, line := range po.Lines {
+		if !line.UnitCost.IsZero() {
+			costs[line.ProductID] = &line.UnitCost
+		}
+	}
+
+	reason := fmt.Sprintf("Purchase order #%d", po.ID)
+	for _, line := range payload.Lines {
+		err := h.inventoryStore.AddStock(line.ProductID, &po.WarehouseID, line.Quantity, costs[line.ProductID], lots[line.ProductID], reason, types.RefTypePurchase, &po.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to stock product %d: %w", line.ProductID, err))
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, po)
+}
+
+// POST /api/v1/purchase-orders/{id}/cancel - cancel a purchase order nothing has been received on
+func (h *Handler) handleCancelPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	purchaseOrderID, ok := parsePurchaseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.CancelPurchaseOrder(purchaseOrderID); err != nil {
+		if err.Error() == fmt.Sprintf("purchase order not found or not in status %s", types.PurchaseOrderOpen) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writePurchaseOrder(w, http.StatusOK, purchaseOrderID)
+}
+
+func parsePurchaseOrderID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	purchaseOrderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid purchase order ID"))
+		return 0, false
+	}
+	return purchaseOrderID, true
+}
+
+func parsePositiveInt(w http.ResponseWriter, r *http.Request, name string, fallback int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s must be a positive number of days", name))
+		return 0, false
+	}
+	return n, true
+}
+
+func (h *Handler) writePurchaseOrder(w http.ResponseWriter, status int, purchaseOrderID int) {
+	po, err := h.store.GetPurchaseOrder(purchaseOrderID)
+	if err != nil {
+		if err.Error() == "purchase order not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, status, po)
+}
+
+func (h *Handler) writePurchaseOrders(w http.ResponseWriter, statuses []types.PurchaseOrderStatus) {
+	purchaseOrders, err := h.store.GetPurchaseOrders(statuses)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"purchase_orders": purchaseOrders,
+		"count":           len(purchaseOrders),
+	})
+}
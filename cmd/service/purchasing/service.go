@@ -0,0 +1,93 @@
+package purchasing
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// suggestReorder turns recent sales into an order quantity: enough to cover
+// the daily sales rate over the supplier's lead time plus coverDays, less what
+// is available and already incoming
+func suggestReorder(velocity types.ProductVelocity, days, coverDays int) types.ReorderSuggestion {
+	suggestion := types.ReorderSuggestion{ProductVelocity: velocity}
+	if days <= 0 {
+		return suggestion
+	}
+
+	suggestion.DailySales = float64(velocity.UnitsSold) / float64(days)
+	demand := int(math.Ceil(suggestion.DailySales * float64(velocity.LeadTimeDays+coverDays)))
+	suggestion.SuggestedQuantity = max(demand-max(velocity.Available, 0)-velocity.Incoming, 0)
+
+	return suggestion
+}
+
+// purchaseOrderFromPayload builds a purchase order from a create request
+func purchaseOrderFromPayload(payload types.CreatePurchaseOrderPayload, createdBy int) (*types.PurchaseOrder, error) {
+	po := &types.PurchaseOrder{
+		SupplierID: payload.SupplierID,
+		Note:       payload.Note,
+		CreatedBy:  createdBy,
+	}
+	if payload.WarehouseID != nil {
+		po.WarehouseID = *payload.WarehouseID
+	}
+
+	var err error
+	if po.ExpectedAt, err = parseDate(payload.ExpectedAt); err != nil {
+		return nil, err
+	}
+
+	for _, line := range payload.Lines {
+		poLine := types.PurchaseOrderLine{
+			ProductID:       line.ProductID,
+			QuantityOrdered: line.Quantity,
+			UnitCost:        types.NewMoney(0, types.DefaultCurrency),
+		}
+		if line.UnitCost != nil {
+			if line.UnitCost.IsNegative() {
+				return nil, fmt.Errorf("unit cost of product %d cannot be negative", line.ProductID)
+			}
+			poLine.UnitCost = *line.UnitCost
+			poLine.UnitCost.Currency = types.DefaultCurrency
+		}
+		if poLine.ExpectedAt, err = parseDate(line.ExpectedAt); err != nil {
+			return nil, err
+		}
+		po.Lines = append(po.Lines, poLine)
+	}
+
+	return po, nil
+}
+
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return &date, nil
+}
+
+// lotFromLine reads the optional lot a receipt line arrives in
+func lotFromLine(line types.ReceivePurchaseOrderLinePayload) (*types.LotInfo, error) {
+	lotNumber := strings.TrimSpace(line.LotNumber)
+	if lotNumber == "" {
+		if line.ExpiresAt != "" {
+			return nil, fmt.Errorf("expiry date of product %d requires a lot number", line.ProductID)
+		}
+		return nil, nil
+	}
+
+	expiresAt, err := parseDate(line.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &types.LotInfo{LotNumber: lotNumber, ExpiresAt: expiresAt}, nil
+}
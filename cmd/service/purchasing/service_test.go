@@ -0,0 +1,69 @@
+package purchasing
+
+import (
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestSuggestReorder(t *testing.T) {
+	tests := []struct {
+		name      string
+		velocity  types.ProductVelocity
+		expected  int
+		dailySale float64
+	}{
+		// 60 units in 30 days = 2 a day, over 7 + 14 days = 42
+		{"covers lead time and review period", types.ProductVelocity{UnitsSold: 60, LeadTimeDays: 7}, 42, 2},
+		{"nets off available and incoming stock", types.ProductVelocity{UnitsSold: 60, LeadTimeDays: 7, Available: 20, Incoming: 10}, 12, 2},
+		{"suggests nothing when well stocked", types.ProductVelocity{UnitsSold: 60, LeadTimeDays: 7, Available: 50}, 0, 2},
+		{"rounds partial units up", types.ProductVelocity{UnitsSold: 1, LeadTimeDays: 1}, 1, 1.0 / 30},
+		{"ignores oversold stock", types.ProductVelocity{UnitsSold: 30, LeadTimeDays: 0, Available: -3}, 14, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestion := suggestReorder(tt.velocity, 30, 14)
+			if suggestion.SuggestedQuantity != tt.expected {
+				t.Errorf("Expected to suggest %d, got %d", tt.expected, suggestion.SuggestedQuantity)
+			}
+			if suggestion.DailySales != tt.dailySale {
+				t.Errorf("Expected %v daily sales, got %v", tt.dailySale, suggestion.DailySales)
+			}
+		})
+	}
+}
+
+func TestPurchaseOrderFromPayload(t *testing.T) {
+	cost := types.MustParseMoney("2.50", "")
+	po, err := purchaseOrderFromPayload(types.CreatePurchaseOrderPayload{
+		SupplierID: 1,
+		ExpectedAt: "2026-11-01",
+		Lines: []types.PurchaseOrderLinePayload{
+			{ProductID: 3, Quantity: 10, UnitCost: &cost},
+			{ProductID: 4, Quantity: 5, ExpectedAt: "2026-11-15"},
+		},
+	}, 9)
+	if err != nil {
+		t.Fatalf("Failed to build purchase order: %v", err)
+	}
+
+	if po.ExpectedAt == nil || po.ExpectedAt.Format("2006-01-02") != "2026-11-01" || po.CreatedBy != 9 {
+		t.Errorf("Expected the order to be due 2026-11-01 and created by user 9, got %+v", po)
+	}
+	if po.Lines[0].UnitCost.String() != "2.50" || po.Lines[0].UnitCost.Currency != types.DefaultCurrency {
+		t.Errorf("Expected a unit cost of 2.50 %s, got %s %s", types.DefaultCurrency, po.Lines[0].UnitCost, po.Lines[0].UnitCost.Currency)
+	}
+	if po.Lines[1].ExpectedAt == nil || !po.Lines[1].UnitCost.IsZero() {
+		t.Errorf("Expected the second line to have its own date and no cost, got %+v", po.Lines[1])
+	}
+
+	negative := types.MustParseMoney("-1.00", "")
+	_, err = purchaseOrderFromPayload(types.CreatePurchaseOrderPayload{
+		SupplierID: 1,
+		Lines:      []types.PurchaseOrderLinePayload{{ProductID: 3, Quantity: 1, UnitCost: &negative}},
+	}, 9)
+	if err == nil {
+		t.Error("Expected a negative unit cost to be refused")
+	}
+}
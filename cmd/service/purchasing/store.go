@@ -0,0 +1,510 @@
+package purchasing
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// defaultLeadTimeDays applies to suppliers created without a lead time
+const defaultLeadTimeDays = 7
+
+const purchaseOrderColumns = `
+	po.id, po.supplier_id, s.name, po.warehouse_id, po.status, po.expected_at,
+	po.note, po.created_by, po.created_at, po.updated_at
+`
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetSuppliers retrieves all suppliers by name
+func (s *Store) GetSuppliers() ([]types.Supplier, error) {
+	rows, err := s.db.Query("SELECT id, name, email, phone, lead_time_days, created_at FROM suppliers ORDER BY name, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suppliers: %w", err)
+	}
+	defer rows.Close()
+
+	suppliers := []types.Supplier{}
+	for rows.Next() {
+		supplier, err := scanRowIntoSupplier(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan supplier: %w", err)
+		}
+		suppliers = append(suppliers, *supplier)
+	}
+
+	return suppliers, rows.Err()
+}
+
+// GetSupplier retrieves a supplier by ID
+func (s *Store) GetSupplier(supplierID int) (*types.Supplier, error) {
+	row := s.db.QueryRow("SELECT id, name, email, phone, lead_time_days, created_at FROM suppliers WHERE id = ?", supplierID)
+	supplier, err := scanRowIntoSupplier(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("supplier not found")
+		}
+		return nil, fmt.Errorf("failed to get supplier: %w", err)
+	}
+
+	return supplier, nil
+}
+
+// CreateSupplier creates a supplier and sets its ID and creation time
+func (s *Store) CreateSupplier(supplier *types.Supplier) error {
+	result, err := s.db.Exec(
+		"INSERT INTO suppliers (name, email, phone, lead_time_days) VALUES (?, ?, ?, ?)",
+		supplier.Name, supplier.Email, supplier.Phone, supplier.LeadTimeDays,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create supplier: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get supplier ID: %w", err)
+	}
+	supplier.ID = int(id)
+
+	return s.db.QueryRow("SELECT created_at FROM suppliers WHERE id = ?", supplier.ID).Scan(&supplier.CreatedAt)
+}
+
+// CreatePurchaseOrder creates an open purchase order with its lines. A zero
+// warehouse ID places it for the default warehouse.
+func (s *Store) CreatePurchaseOrder(po *types.PurchaseOrder) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var supplierID int
+	if err := tx.QueryRow("SELECT id FROM suppliers WHERE id = ?", po.SupplierID).Scan(&supplierID); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("supplier not found")
+		}
+		return fmt.Errorf("failed to get supplier: %w", err)
+	}
+
+	if po.WarehouseID == 0 {
+		err = tx.QueryRow("SELECT id FROM warehouses WHERE is_default = TRUE LIMIT 1").Scan(&po.WarehouseID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no default warehouse configured")
+		}
+	} else {
+		err = tx.QueryRow("SELECT id FROM warehouses WHERE id = ?", po.WarehouseID).Scan(&po.WarehouseID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("warehouse %d not found", po.WarehouseID)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get warehouse: %w", err)
+	}
+
+	po.Status = types.PurchaseOrderOpen
+	result, err := tx.Exec(`
+		INSERT INTO purchase_orders (supplier_id, warehouse_id, status, expected_at, note, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, po.SupplierID, po.WarehouseID, po.Status, po.ExpectedAt, po.Note, po.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to create purchase order: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get purchase order ID: %w", err)
+	}
+	po.ID = int(id)
+
+	for i := range po.Lines {
+		line := &po.Lines[i]
+
+		var productID int
+		if err := tx.QueryRow("SELECT id FROM products WHERE id = ?", line.ProductID).Scan(&productID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("product %d not found", line.ProductID)
+			}
+			return fmt.Errorf("failed to get product: %w", err)
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO purchase_order_lines (purchase_order_id, product_id, quantity_ordered, unit_cost, expected_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, po.ID, line.ProductID, line.QuantityOrdered, line.UnitCost, line.ExpectedAt)
+		if err != nil {
+			if strings.Contains(err.Error(), "Duplicate entry") {
+				return fmt.Errorf("product %d is listed twice", line.ProductID)
+			}
+			return fmt.Errorf("failed to create purchase order line: %w", err)
+		}
+
+		lineID, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get purchase order line ID: %w", err)
+		}
+		line.ID = int(lineID)
+	}
+
+	return tx.Commit()
+}
+
+// GetPurchaseOrder retrieves a purchase order with its lines
+func (s *Store) GetPurchaseOrder(purchaseOrderID int) (*types.PurchaseOrder, error) {
+	row := s.db.QueryRow(`
+		SELECT `+purchaseOrderColumns+`
+		FROM purchase_orders po
+		JOIN suppliers s ON s.id = po.supplier_id
+		WHERE po.id = ?
+	`, purchaseOrderID)
+
+	po, err := scanRowIntoPurchaseOrder(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("purchase order not found")
+		}
+		return nil, fmt.Errorf("failed to get purchase order: %w", err)
+	}
+
+	if err := s.loadPurchaseOrderLines(po); err != nil {
+		return nil, err
+	}
+
+	return po, nil
+}
+
+// GetPurchaseOrders retrieves purchase orders in any of the statuses (all when
+// none are given), the soonest expected first
+func (s *Store) GetPurchaseOrders(statuses []types.PurchaseOrderStatus) ([]types.PurchaseOrder, error) {
+	query := `
+		SELECT ` + purchaseOrderColumns + `
+		FROM purchase_orders po
+		JOIN suppliers s ON s.id = po.supplier_id
+	`
+	args := []any{}
+	if len(statuses) > 0 {
+		query += fmt.Sprintf(" WHERE po.status IN (%s)", strings.Repeat(",?", len(statuses))[1:])
+		for _, status := range statuses {
+			args = append(args, status)
+		}
+	}
+	query += " ORDER BY po.expected_at IS NULL, po.expected_at, po.id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase orders: %w", err)
+	}
+
+	purchaseOrders := []types.PurchaseOrder{}
+	for rows.Next() {
+		po, err := scanRowIntoPurchaseOrder(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan purchase order: %w", err)
+		}
+		purchaseOrders = append(purchaseOrders, *po)
+	}
+	rows.Close()
+
+	for i := range purchaseOrders {
+		if err := s.loadPurchaseOrderLines(&purchaseOrders[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return purchaseOrders, nil
+}
+
+// ReceivePurchaseOrder books delivered quantities against the lines of an open
+// purchase order. Receiving more than is outstanding on a line is refused; the
+// order is received once every line is complete. Stock itself is added by the
+// caller, referencing the purchase order.
+func (s *Store) ReceivePurchaseOrder(purchaseOrderID int, lines []types.ReceivePurchaseOrderLinePayload) (*types.PurchaseOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status types.PurchaseOrderStatus
+	err = tx.QueryRow("SELECT status FROM purchase_orders WHERE id = ? FOR UPDATE", purchaseOrderID).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to lock purchase order: %w", err)
+	}
+	if err == sql.ErrNoRows || (status != types.PurchaseOrderOpen && status != types.PurchaseOrderPartiallyReceived) {
+		return nil, fmt.Errorf("purchase order not found or not open")
+	}
+
+	rows, err := tx.Query(`
+		SELECT product_id, quantity_ordered - quantity_received
+		FROM purchase_order_lines
+		WHERE purchase_order_id = ?
+	`, purchaseOrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase order lines: %w", err)
+	}
+
+	outstanding := make(map[int]int)
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan purchase order line: %w", err)
+		}
+		outstanding[productID] = quantity
+	}
+	rows.Close()
+
+	for _, line := range lines {
+		remaining, ok := outstanding[line.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("product %d is not on purchase order %d", line.ProductID, purchaseOrderID)
+		}
+		if line.Quantity > remaining {
+			return nil, fmt.Errorf("cannot receive %d of product %d, only %d outstanding", line.Quantity, line.ProductID, remaining)
+		}
+		outstanding[line.ProductID] = remaining - line.Quantity
+
+		_, err := tx.Exec(`
+			UPDATE purchase_order_lines SET quantity_received = quantity_received + ?
+			WHERE purchase_order_id = ? AND product_id = ?
+		`, line.Quantity, purchaseOrderID, line.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive product %d: %w", line.ProductID, err)
+		}
+	}
+
+	status = types.PurchaseOrderReceived
+	for _, remaining := range outstanding {
+		if remaining > 0 {
+			status = types.PurchaseOrderPartiallyReceived
+			break
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE purchase_orders SET status = ? WHERE id = ?", status, purchaseOrderID); err != nil {
+		return nil, fmt.Errorf("failed to update purchase order status: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetPurchaseOrder(purchaseOrderID)
+}
+
+// CancelPurchaseOrder cancels an order nothing has been received on yet
+func (s *Store) CancelPurchaseOrder(purchaseOrderID int) error {
+	result, err := s.db.Exec(
+		"UPDATE purchase_orders SET status = ? WHERE id = ? AND status = ?",
+		types.PurchaseOrderCancelled, purchaseOrderID, types.PurchaseOrderOpen,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel purchase order: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("purchase order not found or not in status %s", types.PurchaseOrderOpen)
+	}
+
+	return nil
+}
+
+// GetIncomingStock sums, per product, what open purchase orders still have to deliver
+func (s *Store) GetIncomingStock() ([]types.IncomingStock, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			l.product_id,
+			p.name,
+			SUM(l.quantity_ordered - l.quantity_received),
+			COUNT(DISTINCT po.id),
+			MIN(COALESCE(l.expected_at, po.expected_at))
+		FROM purchase_order_lines l
+		JOIN purchase_orders po ON po.id = l.purchase_order_id
+		JOIN products p ON p.id = l.product_id
+		WHERE po.status IN ('OPEN', 'PARTIALLY_RECEIVED') AND l.quantity_received < l.quantity_ordered
+		GROUP BY l.product_id, p.name
+		ORDER BY l.product_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get incoming stock: %w", err)
+	}
+	defer rows.Close()
+
+	incoming := []types.IncomingStock{}
+	for rows.Next() {
+		var item types.IncomingStock
+		var expectedAt sql.NullTime
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.Incoming, &item.PurchaseOrders, &expectedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan incoming stock: %w", err)
+		}
+		if expectedAt.Valid {
+			item.NextExpectedAt = &expectedAt.Time
+		}
+		incoming = append(incoming, item)
+	}
+
+	return incoming, rows.Err()
+}
+
+// GetProductVelocity returns the units of each product sold on paid orders
+// since the given time, with its available and incoming stock and the lead
+// time of the supplier it was last ordered from
+func (s *Store) GetProductVelocity(since time.Time) ([]types.ProductVelocity, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			p.id,
+			p.name,
+			sold.units,
+			COALESCE(sl.on_hand, 0) - COALESCE(h.held, 0),
+			COALESCE(inc.incoming, 0),
+			sup.id,
+			sup.lead_time_days
+		FROM products p
+		JOIN (
+			SELECT oi.productId, SUM(oi.quantity) AS units
+			FROM order_items oi
+			JOIN orders o ON o.id = oi.orderId
+			WHERE o.createdAt >= ? AND o.status IN ('paid', 'partially_shipped', 'completed')
+			GROUP BY oi.productId
+		) sold ON sold.productId = p.id
+		LEFT JOIN (
+			SELECT product_id, SUM(on_hand) AS on_hand
+			FROM stock_levels
+			GROUP BY product_id
+		) sl ON sl.product_id = p.id
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity) AS held
+			FROM stock_holds
+			WHERE status = 'ACTIVE' AND expires_at > NOW()
+			GROUP BY product_id
+		) h ON h.product_id = p.id
+		LEFT JOIN (
+			SELECT l.product_id, SUM(l.quantity_ordered - l.quantity_received) AS incoming
+			FROM purchase_order_lines l
+			JOIN purchase_orders po ON po.id = l.purchase_order_id
+			WHERE po.status IN ('OPEN', 'PARTIALLY_RECEIVED')
+			GROUP BY l.product_id
+		) inc ON inc.product_id = p.id
+		LEFT JOIN suppliers sup ON sup.id = (
+			SELECT po.supplier_id
+			FROM purchase_order_lines l
+			JOIN purchase_orders po ON po.id = l.purchase_order_id
+			WHERE l.product_id = p.id
+			ORDER BY po.created_at DESC, po.id DESC
+			LIMIT 1
+		)
+		ORDER BY p.id
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product velocity: %w", err)
+	}
+	defer rows.Close()
+
+	velocity := []types.ProductVelocity{}
+	for rows.Next() {
+		var item types.ProductVelocity
+		var supplierID, leadTimeDays sql.NullInt64
+		err := rows.Scan(&item.ProductID, &item.ProductName, &item.UnitsSold, &item.Available, &item.Incoming,
+			&supplierID, &leadTimeDays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan product velocity: %w", err)
+		}
+
+		item.LeadTimeDays = defaultLeadTimeDays
+		if supplierID.Valid {
+			id := int(supplierID.Int64)
+			item.SupplierID = &id
+			item.LeadTimeDays = int(leadTimeDays.Int64)
+		}
+		velocity = append(velocity, item)
+	}
+
+	return velocity, rows.Err()
+}
+
+// loadPurchaseOrderLines fills in the lines of a purchase order
+func (s *Store) loadPurchaseOrderLines(po *types.PurchaseOrder) error {
+	rows, err := s.db.Query(`
+		SELECT id, product_id, quantity_ordered, quantity_received, unit_cost, expected_at
+		FROM purchase_order_lines
+		WHERE purchase_order_id = ?
+		ORDER BY id
+	`, po.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get purchase order lines: %w", err)
+	}
+	defer rows.Close()
+
+	po.Lines = []types.PurchaseOrderLine{}
+	for rows.Next() {
+		var line types.PurchaseOrderLine
+		var expectedAt sql.NullTime
+		err := rows.Scan(&line.ID, &line.ProductID, &line.QuantityOrdered, &line.QuantityReceived, &line.UnitCost, &expectedAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan purchase order line: %w", err)
+		}
+		if expectedAt.Valid {
+			line.ExpectedAt = &expectedAt.Time
+		}
+		po.Lines = append(po.Lines, line)
+	}
+
+	return rows.Err()
+}
+
+func scanRowIntoSupplier(scanner interface{ Scan(dest ...any) error }) (*types.Supplier, error) {
+	var supplier types.Supplier
+	err := scanner.Scan(
+		&supplier.ID,
+		&supplier.Name,
+		&supplier.Email,
+		&supplier.Phone,
+		&supplier.LeadTimeDays,
+		&supplier.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &supplier, nil
+}
+
+func scanRowIntoPurchaseOrder(scanner interface{ Scan(dest ...any) error }) (*types.PurchaseOrder, error) {
+	var po types.PurchaseOrder
+	var expectedAt sql.NullTime
+
+	err := scanner.Scan(
+		&po.ID,
+		&po.SupplierID,
+		&po.SupplierName,
+		&po.WarehouseID,
+		&po.Status,
+		&expectedAt,
+		&po.Note,
+		&po.CreatedBy,
+		&po.CreatedAt,
+		&po.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedAt.Valid {
+		po.ExpectedAt = &expectedAt.Time
+	}
+
+	return &po, nil
+}
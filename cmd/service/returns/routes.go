@@ -0,0 +1,340 @@
+package returns
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store          types.ReturnStore
+	orderStore     types.OrderStore
+	inventoryStore types.InventoryStore
+	paymentStore   types.PaymentStore
+	provider       types.PaymentProvider
+	userStore      types.UserStore
+}
+
+func NewHandler(store types.ReturnStore, orderStore types.OrderStore, inventoryStore types.InventoryStore, paymentStore types.PaymentStore, provider types.PaymentProvider, userStore types.UserStore) *Handler {
+	return &Handler{store: store, orderStore: orderStore, inventoryStore: inventoryStore, paymentStore: paymentStore, provider: provider, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Customer routes
+	router.HandleFunc("/orders/{id}/returns", auth.WithJWTAuth(h.handleCreateReturn, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/orders/{id}/returns", auth.WithJWTAuth(h.handleGetOrderReturns, h.userStore)).Methods(http.MethodGet)
+
+	// Admin only routes to process returns
+	router.HandleFunc("/returns", auth.WithAdminAuth(h.handleGetReturns, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/returns/{id}", auth.WithAdminAuth(h.handleGetReturn, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/returns/{id}/approve", auth.WithAdminAuth(h.handleApproveReturn, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/returns/{id}/reject", auth.WithAdminAuth(h.handleRejectReturn, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/returns/{id}/receive", auth.WithAdminAuth(h.handleReceiveReturn, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/returns/{id}/refund", auth.WithAdminAuth(h.handleRefundReturn, h.userStore)).Methods(http.MethodPost)
+}
+
+// POST /api/v1/orders/{id}/returns - request a return for some lines of an order
+func (h *Handler) handleCreateReturn(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	var payload types.CreateReturnPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	order, err := h.orderStore.GetOrderByID(orderID, userID)
+	if err != nil {
+		if err.Error() == "order not found or not owned by user" {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if order.Status != types.OrderStatusPaid && order.Status != types.OrderStatusPartiallyShipped && order.Status != types.OrderStatusCompleted {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("order is %s, only paid, partially shipped or completed orders can be returned", order.Status))
+		return
+	}
+
+	returned, err := h.store.GetReturnedQuantities(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items, err := buildReturnItems(order, payload.Items, returned)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ret := &types.Return{
+		OrderID:      order.ID,
+		UserID:       userID,
+		Status:       types.ReturnStatusRequested,
+		Reason:       payload.Reason,
+		RefundAmount: types.NewMoney(0, order.Currency),
+		Items:        items,
+	}
+	for _, item := range items {
+		ret.RefundAmount = ret.RefundAmount.Add(item.RefundAmount)
+	}
+
+	if err := h.store.CreateReturn(ret); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, ret)
+}
+
+// GET /api/v1/orders/{id}/returns - list the returns of an order
+func (h *Handler) handleGetOrderReturns(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	if _, err := h.orderStore.GetOrderByID(orderID, userID); err != nil {
+		if err.Error() == "order not found or not owned by user" {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	returns, err := h.store.GetReturnsForOrder(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	refunds, err := h.store.GetRefundsForOrder(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"returns": returns,
+		"refunds": refunds,
+		"count":   len(returns),
+	})
+}
+
+// GET /api/v1/returns - list all returns, optionally filtered by status
+func (h *Handler) handleGetReturns(w http.ResponseWriter, r *http.Request) {
+	var status *types.ReturnStatus
+	if s := r.URL.Query().Get("status"); s != "" {
+		returnStatus := types.ReturnStatus(s)
+		switch returnStatus {
+		case types.ReturnStatusRequested, types.ReturnStatusApproved, types.ReturnStatusRejected,
+			types.ReturnStatusReceived, types.ReturnStatusRefunding, types.ReturnStatusRefunded:
+			status = &returnStatus
+		default:
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid status. Must be one of: requested, approved, rejected, received, refunding, refunded"))
+			return
+		}
+	}
+
+	returns, err := h.store.GetReturns(status)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"returns": returns,
+		"count":   len(returns),
+	})
+}
+
+// GET /api/v1/returns/{id} - get a return
+func (h *Handler) handleGetReturn(w http.ResponseWriter, r *http.Request) {
+	ret, ok := h.getReturn(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+// POST /api/v1/returns/{id}/approve - accept a return request
+func (h *Handler) handleApproveReturn(w http.ResponseWriter, r *http.Request) {
+	h.transitionReturn(w, r, types.ReturnStatusRequested, types.ReturnStatusApproved)
+}
+
+// POST /api/v1/returns/{id}/reject - decline a return request
+func (h *Handler) handleRejectReturn(w http.ResponseWriter, r *http.Request) {
+	h.transitionReturn(w, r, types.ReturnStatusRequested, types.ReturnStatusRejected)
+}
+
+// POST /api/v1/returns/{id}/receive - record the returned goods and restock them
+func (h *Handler) handleReceiveReturn(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, by default every line is restocked
+	var payload types.ReceiveReturnPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	ret, ok := h.getReturn(w, r)
+	if !ok {
+		return
+	}
+
+	// a received return is only restocked again, with the lines as recorded,
+	// to finish a restock that failed
+	if ret.Status != types.ReturnStatusReceived {
+		restockable := make(map[int]bool)
+		for _, item := range ret.Items {
+			restockable[item.ID] = true
+		}
+		for _, item := range payload.Items {
+			if _, ok := restockable[item.ReturnItemID]; !ok {
+				utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("return item %d is not part of return %d", item.ReturnItemID, ret.ID))
+				return
+			}
+			restockable[item.ReturnItemID] = item.Restockable
+		}
+
+		if err := h.store.MarkReturnReceived(ret.ID, restockable); err != nil {
+			if err.Error() == fmt.Sprintf("return not found or not in status %s", types.ReturnStatusApproved) {
+				utils.WriteError(w, http.StatusConflict, err)
+				return
+			}
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		ret.Status = types.ReturnStatusReceived
+		for i := range ret.Items {
+			ret.Items[i].Restockable = restockable[ret.Items[i].ID]
+		}
+	}
+
+	if err := h.restockReturn(ret); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("%w, receive the return again to retry", err))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+// POST /api/v1/returns/{id}/refund - refund a received return
+func (h *Handler) handleRefundReturn(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, by default the whole return is refunded
+	var payload types.RefundReturnPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ret, ok := h.getReturn(w, r)
+	if !ok {
+		return
+	}
+
+	if ret.Status != types.ReturnStatusReceived {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("return is %s, only received returns can be refunded", ret.Status))
+		return
+	}
+
+	amount := ret.RefundAmount
+	if payload.Amount != nil {
+		amount = types.NewMoney(payload.Amount.Amount, ret.RefundAmount.Currency)
+		if !amount.IsPositive() || amount.Cmp(ret.RefundAmount) > 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("refund amount must be between 0 and %s", ret.RefundAmount))
+			return
+		}
+	}
+
+	refund, err := h.refundReturn(ret, amount)
+	if err != nil {
+		if err.Error() == fmt.Sprintf("return not found or not in status %s", types.ReturnStatusReceived) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, refund)
+}
+
+func (h *Handler) transitionReturn(w http.ResponseWriter, r *http.Request, fromStatus, toStatus types.ReturnStatus) {
+	returnID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid return ID"))
+		return
+	}
+
+	if err := h.store.UpdateReturnStatus(returnID, fromStatus, toStatus); err != nil {
+		if err.Error() == fmt.Sprintf("return not found or not in status %s", fromStatus) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ret, err := h.store.GetReturn(returnID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+// getReturn loads the return of the request path, writing the error response if it fails
+func (h *Handler) getReturn(w http.ResponseWriter, r *http.Request) (*types.Return, bool) {
+	returnID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid return ID"))
+		return nil, false
+	}
+
+	ret, err := h.store.GetReturn(returnID)
+	if err != nil {
+		if err.Error() == "return not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return ret, true
+}
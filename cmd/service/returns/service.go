@@ -0,0 +1,189 @@
+package returns
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// buildReturnItems checks the requested lines against the order and the
+// quantities already being returned, and prices each line's refund
+func buildReturnItems(order *types.OrderWithItems, requested []types.ReturnItemPayload, returned map[int]int) ([]types.ReturnItem, error) {
+	orderItems := make(map[int]types.OrderItemWithProduct)
+	for _, item := range order.Items {
+		orderItems[item.ID] = item
+	}
+
+	// the same line may be listed more than once
+	requestedQuantities := make(map[int]int)
+	items := make([]types.ReturnItem, 0, len(requested))
+	for _, line := range requested {
+		orderItem, ok := orderItems[line.OrderItemID]
+		if !ok {
+			return nil, fmt.Errorf("order item %d is not part of order %d", line.OrderItemID, order.ID)
+		}
+
+		alreadyReturned := returned[line.OrderItemID] + requestedQuantities[line.OrderItemID]
+		if alreadyReturned+line.Quantity > orderItem.Quantity {
+			return nil, fmt.Errorf("cannot return %d of order item %d: ordered %d, already returned %d",
+				line.Quantity, line.OrderItemID, orderItem.Quantity, alreadyReturned)
+		}
+		requestedQuantities[line.OrderItemID] += line.Quantity
+
+		items = append(items, types.ReturnItem{
+			OrderItemID:  orderItem.ID,
+			ProductID:    orderItem.ProductID,
+			Quantity:     line.Quantity,
+			Restockable:  true,
+			RefundAmount: lineRefund(orderItem.Total, orderItem.Quantity, alreadyReturned, line.Quantity),
+		})
+	}
+
+	return items, nil
+}
+
+// lineRefund is the share of a line total for quantity units, after
+// alreadyReturned units were refunded. Computing it as the difference of
+// cumulative shares means returning a whole line in several parts refunds
+// exactly its total, with no cent lost to rounding.
+func lineRefund(lineTotal types.Money, ordered, alreadyReturned, quantity int) types.Money {
+	before := lineTotal.MulDiv(int64(alreadyReturned), int64(ordered))
+	after := lineTotal.MulDiv(int64(alreadyReturned+quantity), int64(ordered))
+	return after.Sub(before)
+}
+
+// restockLines lists what the restockable lines of a return put back into
+// stock. A returned bundle goes back as its components, each at its own cost.
+func restockLines(items []types.ReturnItem, order *types.OrderWithItems) []types.ReturnItem {
+	orderItems := make(map[int]types.OrderItemWithProduct)
+	for _, item := range order.Items {
+		orderItems[item.ID] = item
+	}
+
+	lines := make([]types.ReturnItem, 0, len(items))
+	for _, item := range items {
+		if !item.Restockable {
+			continue
+		}
+
+		// a deleted product has no stock left to go back to
+		orderItem := orderItems[item.OrderItemID]
+		if len(orderItem.Components) == 0 {
+			if item.ProductID != 0 {
+				lines = append(lines, item)
+			}
+			continue
+		}
+		for _, component := range orderItem.Components {
+			if component.ProductID == 0 {
+				continue
+			}
+			line := item
+			line.ProductID = component.ProductID
+			line.Quantity = component.Quantity / orderItem.Quantity * item.Quantity
+			line.UnitCost = component.UnitCost
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// mergeRestockLines adds up the lines of the same product, e.g. a product
+// returned on its own and as part of a bundle. The first known cost is kept.
+func mergeRestockLines(lines []types.ReturnItem) []types.ReturnItem {
+	index := make(map[int]int)
+	merged := make([]types.ReturnItem, 0, len(lines))
+	for _, line := range lines {
+		i, ok := index[line.ProductID]
+		if !ok {
+			index[line.ProductID] = len(merged)
+			merged = append(merged, line)
+			continue
+		}
+		merged[i].Quantity += line.Quantity
+		if merged[i].UnitCost == nil {
+			merged[i].UnitCost = line.UnitCost
+		}
+	}
+
+	return merged
+}
+
+// restockReturn puts the restockable lines of a received return back into
+// the warehouses and lots they were shipped from. The inventory counts what
+// each product of the return already got back, so a restock that failed part
+// way through can be run again.
+func (h *Handler) restockReturn(ret *types.Return) error {
+	order, err := h.orderStore.GetOrder(ret.OrderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range mergeRestockLines(restockLines(ret.Items, order)) {
+		err := h.inventoryStore.RestockReturn(ret.OrderID, item.ProductID, item.Quantity, item.UnitCost,
+			fmt.Sprintf("Return #%d for order %d", ret.ID, ret.OrderID), ret.ID)
+		if err != nil {
+			return fmt.Errorf("failed to restock product %d: %w", item.ProductID, err)
+		}
+	}
+
+	return nil
+}
+
+// refundReturn pays back the amount of a received return through the
+// provider that took the payment, and records the refund against the order
+func (h *Handler) refundReturn(ret *types.Return, amount types.Money) (*types.Refund, error) {
+	order, err := h.orderStore.GetOrder(ret.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	refundable := order.Total.Sub(order.RefundedAmount)
+	if amount.Cmp(refundable) > 0 {
+		return nil, fmt.Errorf("refund of %s exceeds the refundable amount %s of order %d", amount, refundable, order.ID)
+	}
+
+	payments, err := h.paymentStore.GetPaymentsForOrder(order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payment *types.Payment
+	for i := range payments {
+		if payments[i].Status == types.PaymentStatusSucceeded {
+			payment = &payments[i]
+			break
+		}
+	}
+	if payment == nil {
+		return nil, fmt.Errorf("order %d has no captured payment to refund", order.ID)
+	}
+
+	// claim the return first, a concurrent request must not refund it again
+	if err := h.store.UpdateReturnStatus(ret.ID, types.ReturnStatusReceived, types.ReturnStatusRefunding); err != nil {
+		return nil, err
+	}
+
+	providerRefund, err := h.provider.Refund(payment.ProviderPaymentID, amount)
+	if err != nil {
+		if releaseErr := h.store.UpdateReturnStatus(ret.ID, types.ReturnStatusRefunding, types.ReturnStatusReceived); releaseErr != nil {
+			log.Printf("failed to release return %d after a failed refund: %v", ret.ID, releaseErr)
+		}
+		return nil, fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	refund := &types.Refund{
+		OrderID:          order.ID,
+		ReturnID:         &ret.ID,
+		PaymentID:        &payment.ID,
+		Amount:           amount,
+		ProviderRefundID: providerRefund.ID,
+	}
+	if err := h.store.CreateRefund(refund); err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
@@ -0,0 +1,154 @@
+package returns
+
+import (
+	"testing"
+	"testing/quick"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestBuildReturnItems(t *testing.T) {
+	order := &types.OrderWithItems{
+		ID: 1,
+		Items: []types.OrderItemWithProduct{
+			{ID: 10, ProductID: 1, Quantity: 3, Total: usd("10.00")},
+			{ID: 11, ProductID: 2, Quantity: 1, Total: usd("5.00")},
+		},
+	}
+
+	t.Run("should price partial returns per line", func(t *testing.T) {
+		items, err := buildReturnItems(order, []types.ReturnItemPayload{
+			{OrderItemID: 10, Quantity: 1},
+			{OrderItemID: 11, Quantity: 1},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Failed to build return items: %v", err)
+		}
+
+		if items[0].RefundAmount != usd("3.33") || items[0].ProductID != 1 || !items[0].Restockable {
+			t.Errorf("Expected 1 of 3 units to refund 3.33, got %+v", items[0])
+		}
+		if items[1].RefundAmount != usd("5.00") {
+			t.Errorf("Expected the whole second line to refund 5.00, got %s", items[1].RefundAmount)
+		}
+	})
+
+	t.Run("should count quantities already returned", func(t *testing.T) {
+		returned := map[int]int{10: 2}
+
+		items, err := buildReturnItems(order, []types.ReturnItemPayload{{OrderItemID: 10, Quantity: 1}}, returned)
+		if err != nil {
+			t.Fatalf("Failed to build return items: %v", err)
+		}
+		// 6.67 was refunded for the first two units, the last one gets the rest
+		if items[0].RefundAmount != usd("3.33") {
+			t.Errorf("Expected the last unit to refund 3.33, got %s", items[0].RefundAmount)
+		}
+
+		_, err = buildReturnItems(order, []types.ReturnItemPayload{{OrderItemID: 10, Quantity: 2}}, returned)
+		if err == nil {
+			t.Error("Expected returning more than ordered to fail")
+		}
+	})
+
+	t.Run("should reject lines listed twice over the ordered quantity", func(t *testing.T) {
+		_, err := buildReturnItems(order, []types.ReturnItemPayload{
+			{OrderItemID: 11, Quantity: 1},
+			{OrderItemID: 11, Quantity: 1},
+		}, nil)
+		if err == nil {
+			t.Error("Expected the duplicated line to fail")
+		}
+	})
+
+	t.Run("should reject items of other orders", func(t *testing.T) {
+		_, err := buildReturnItems(order, []types.ReturnItemPayload{{OrderItemID: 99, Quantity: 1}}, nil)
+		if err == nil {
+			t.Error("Expected an unknown order item to fail")
+		}
+	})
+}
+
+// Property: returning a line in any number of parts refunds exactly its total
+func TestLineRefund_PartsSumToLineTotal(t *testing.T) {
+	property := func(total uint32, parts []uint8) bool {
+		lineTotal := types.NewMoney(int64(total), "USD")
+
+		ordered := 0
+		for _, part := range parts {
+			ordered += int(part%5) + 1
+		}
+		if ordered == 0 {
+			return true
+		}
+
+		refunded := types.NewMoney(0, "USD")
+		returned := 0
+		for _, part := range parts {
+			quantity := int(part%5) + 1
+			refunded = refunded.Add(lineRefund(lineTotal, ordered, returned, quantity))
+			returned += quantity
+		}
+
+		return refunded == lineTotal
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRestockLines(t *testing.T) {
+	cost := usd("2.50")
+	order := &types.OrderWithItems{
+		ID: 1,
+		Items: []types.OrderItemWithProduct{
+			{ID: 10, ProductID: 1, Quantity: 3},
+			{ID: 11, ProductID: 5, Quantity: 2, Components: []types.OrderItemComponent{
+				{ProductID: 2, Quantity: 2, UnitCost: &cost},
+				{ProductID: 3, Quantity: 6},
+				{ProductID: 0, Quantity: 2}, // deleted since
+			}},
+			{ID: 12, ProductID: 0, Quantity: 1},
+		},
+	}
+
+	lines := restockLines([]types.ReturnItem{
+		{OrderItemID: 10, ProductID: 1, Quantity: 2, Restockable: false},
+		{OrderItemID: 11, ProductID: 5, Quantity: 1, Restockable: true},
+		{OrderItemID: 12, ProductID: 0, Quantity: 1, Restockable: true},
+	}, order)
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected the returned bundle to restock its 2 components, got %+v", lines)
+	}
+	if lines[0].ProductID != 2 || lines[0].Quantity != 1 || lines[0].UnitCost != &cost {
+		t.Errorf("Expected 1 unit of product 2 at its own cost, got %+v", lines[0])
+	}
+	if lines[1].ProductID != 3 || lines[1].Quantity != 3 || lines[1].UnitCost != nil {
+		t.Errorf("Expected 3 units of product 3 without a known cost, got %+v", lines[1])
+	}
+}
+
+func TestMergeRestockLines(t *testing.T) {
+	cost := usd("2.50")
+	lines := mergeRestockLines([]types.ReturnItem{
+		{OrderItemID: 10, ProductID: 1, Quantity: 2},
+		{OrderItemID: 11, ProductID: 2, Quantity: 1},
+		{OrderItemID: 12, ProductID: 1, Quantity: 3, UnitCost: &cost},
+	})
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per product, got %+v", lines)
+	}
+	if lines[0].ProductID != 1 || lines[0].Quantity != 5 || lines[0].UnitCost != &cost {
+		t.Errorf("Expected 5 units of product 1 at the known cost, got %+v", lines[0])
+	}
+	if lines[1].ProductID != 2 || lines[1].Quantity != 1 {
+		t.Errorf("Expected 1 unit of product 2, got %+v", lines[1])
+	}
+}
+
+func usd(amount string) types.Money {
+	return types.MustParseMoney(amount, "USD")
+}
@@ -0,0 +1,398 @@
+package returns
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// CreateReturn creates a return request with its lines and sets their IDs
+func (s *Store) CreateReturn(ret *types.Return) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if ret.Status == "" {
+		ret.Status = types.ReturnStatusRequested
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO returns (order_id, user_id, status, reason, currency)
+		VALUES (?, ?, ?, ?, ?)
+	`, ret.OrderID, ret.UserID, ret.Status, ret.Reason, ret.RefundAmount.Currency)
+	if err != nil {
+		return fmt.Errorf("failed to create return: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get return ID: %w", err)
+	}
+	ret.ID = int(id)
+
+	for i := range ret.Items {
+		item := &ret.Items[i]
+		item.ReturnID = ret.ID
+
+		result, err := tx.Exec(`
+			INSERT INTO return_items (return_id, order_item_id, product_id, quantity, restockable, refund_amount)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, item.ReturnID, item.OrderItemID, item.ProductID, item.Quantity, item.Restockable, item.RefundAmount)
+		if err != nil {
+			return fmt.Errorf("failed to create return item: %w", err)
+		}
+
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get return item ID: %w", err)
+		}
+		item.ID = int(itemID)
+	}
+
+	return tx.Commit()
+}
+
+// GetReturn retrieves a return with its lines
+func (s *Store) GetReturn(returnID int) (*types.Return, error) {
+	row := s.db.QueryRow(`
+		SELECT id, order_id, user_id, status, reason, currency, created_at, updated_at
+		FROM returns
+		WHERE id = ?
+	`, returnID)
+
+	ret, err := scanRowIntoReturn(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadReturnItems(ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// GetReturns retrieves all returns, optionally in one status, newest first
+func (s *Store) GetReturns(status *types.ReturnStatus) ([]types.Return, error) {
+	query := `
+		SELECT id, order_id, user_id, status, reason, currency, created_at, updated_at
+		FROM returns
+	`
+	args := []interface{}{}
+
+	if status != nil {
+		query += " WHERE status = ?"
+		args = append(args, *status)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	return s.queryReturns(query, args...)
+}
+
+// GetReturnsForOrder retrieves the returns of an order, oldest first
+func (s *Store) GetReturnsForOrder(orderID int) ([]types.Return, error) {
+	return s.queryReturns(`
+		SELECT id, order_id, user_id, status, reason, currency, created_at, updated_at
+		FROM returns
+		WHERE order_id = ?
+		ORDER BY id
+	`, orderID)
+}
+
+// GetReturnedQuantities sums the quantities per order line that are already
+// part of a return which has not been rejected
+func (s *Store) GetReturnedQuantities(orderID int) (map[int]int, error) {
+	rows, err := s.db.Query(`
+		SELECT ri.order_item_id, SUM(ri.quantity)
+		FROM return_items ri
+		JOIN returns r ON r.id = ri.return_id
+		WHERE r.order_id = ? AND r.status <> 'rejected'
+		GROUP BY ri.order_item_id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get returned quantities: %w", err)
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]int)
+	for rows.Next() {
+		var orderItemID, quantity int
+		if err := rows.Scan(&orderItemID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan returned quantity: %w", err)
+		}
+		quantities[orderItemID] = quantity
+	}
+
+	return quantities, nil
+}
+
+// UpdateReturnStatus moves a return from one status to another, the update
+// only applies while the return is still in fromStatus
+func (s *Store) UpdateReturnStatus(returnID int, fromStatus, toStatus types.ReturnStatus) error {
+	result, err := s.db.Exec(
+		"UPDATE returns SET status = ? WHERE id = ? AND status = ?",
+		toStatus, returnID, fromStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update return status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("return not found or not in status %s", fromStatus)
+	}
+
+	return nil
+}
+
+// MarkReturnReceived records which lines can be restocked and moves an approved return to received
+func (s *Store) MarkReturnReceived(returnID int, restockable map[int]bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE returns SET status = ? WHERE id = ? AND status = ?",
+		types.ReturnStatusReceived, returnID, types.ReturnStatusApproved,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update return status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("return not found or not in status %s", types.ReturnStatusApproved)
+	}
+
+	for returnItemID, ok := range restockable {
+		_, err := tx.Exec(
+			"UPDATE return_items SET restockable = ? WHERE id = ? AND return_id = ?",
+			ok, returnItemID, returnID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update return item: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreateRefund records a refund, adds it to the refunded amount of the order
+// and marks its return, claimed as refunding, refunded in one transaction. A fully refunded order
+// moves to the refunded status.
+func (s *Store) CreateRefund(refund *types.Refund) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO refunds (order_id, return_id, payment_id, amount, currency, provider_refund_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, refund.OrderID, refund.ReturnID, refund.PaymentID, refund.Amount, refund.Amount.Currency, refund.ProviderRefundID)
+	if err != nil {
+		return fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get refund ID: %w", err)
+	}
+	refund.ID = int(id)
+
+	// MySQL assigns left to right, the status sees the new refunded amount
+	_, err = tx.Exec(`
+		UPDATE orders
+		SET refunded_amount = refunded_amount + ?,
+		    status = IF(refunded_amount >= total, 'refunded', status)
+		WHERE id = ?
+	`, refund.Amount, refund.OrderID)
+	if err != nil {
+		return fmt.Errorf("failed to update refunded amount: %w", err)
+	}
+
+	if refund.ReturnID != nil {
+		result, err := tx.Exec(
+			"UPDATE returns SET status = ? WHERE id = ? AND status = ?",
+			types.ReturnStatusRefunded, *refund.ReturnID, types.ReturnStatusRefunding,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update return status: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			return fmt.Errorf("return not found or not in status %s", types.ReturnStatusRefunding)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRefundsForOrder retrieves the refunds of an order, oldest first
+func (s *Store) GetRefundsForOrder(orderID int) ([]types.Refund, error) {
+	rows, err := s.db.Query(`
+		SELECT id, order_id, return_id, payment_id, amount, currency, provider_refund_id, created_at
+		FROM refunds
+		WHERE order_id = ?
+		ORDER BY id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+	defer rows.Close()
+
+	refunds := []types.Refund{}
+	for rows.Next() {
+		var refund types.Refund
+		var returnID, paymentID sql.NullInt64
+		var currency string
+
+		err := rows.Scan(
+			&refund.ID,
+			&refund.OrderID,
+			&returnID,
+			&paymentID,
+			&refund.Amount,
+			&currency,
+			&refund.ProviderRefundID,
+			&refund.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan refund row: %w", err)
+		}
+
+		refund.Amount.Currency = currency
+		if returnID.Valid {
+			id := int(returnID.Int64)
+			refund.ReturnID = &id
+		}
+		if paymentID.Valid {
+			id := int(paymentID.Int64)
+			refund.PaymentID = &id
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, nil
+}
+
+func (s *Store) queryReturns(query string, args ...any) ([]types.Return, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get returns: %w", err)
+	}
+
+	returns := []types.Return{}
+	for rows.Next() {
+		ret, err := scanRowIntoReturn(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan return row: %w", err)
+		}
+		returns = append(returns, *ret)
+	}
+	rows.Close()
+
+	for i := range returns {
+		if err := s.loadReturnItems(&returns[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return returns, nil
+}
+
+// loadReturnItems fills in the lines and the refund amount of a return
+func (s *Store) loadReturnItems(ret *types.Return) error {
+	rows, err := s.db.Query(`
+		SELECT ri.id, ri.return_id, ri.order_item_id, ri.product_id, ri.quantity, ri.restockable, ri.refund_amount, oi.unit_cost
+		FROM return_items ri
+		LEFT JOIN order_items oi ON oi.id = ri.order_item_id
+		WHERE ri.return_id = ?
+		ORDER BY ri.id
+	`, ret.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get return items: %w", err)
+	}
+	defer rows.Close()
+
+	currency := ret.RefundAmount.Currency
+	ret.Items = []types.ReturnItem{}
+	for rows.Next() {
+		var item types.ReturnItem
+		err := rows.Scan(
+			&item.ID,
+			&item.ReturnID,
+			&item.OrderItemID,
+			&item.ProductID,
+			&item.Quantity,
+			&item.Restockable,
+			&item.RefundAmount,
+			&item.UnitCost,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan return item: %w", err)
+		}
+
+		item.RefundAmount.Currency = currency
+		ret.RefundAmount = ret.RefundAmount.Add(item.RefundAmount)
+		ret.Items = append(ret.Items, item)
+	}
+
+	return nil
+}
+
+// Helper function to scan database row into Return struct (without items)
+func scanRowIntoReturn(scanner interface {
+	Scan(dest ...any) error
+}) (*types.Return, error) {
+	var ret types.Return
+	var currency string
+
+	err := scanner.Scan(
+		&ret.ID,
+		&ret.OrderID,
+		&ret.UserID,
+		&ret.Status,
+		&ret.Reason,
+		&currency,
+		&ret.CreatedAt,
+		&ret.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("return not found")
+		}
+		return nil, err
+	}
+
+	ret.RefundAmount = types.NewMoney(0, currency)
+	return &ret, nil
+}
@@ -0,0 +1,60 @@
+package shipping
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// Calculator prices the shipping methods of the zones covering an address
+type Calculator struct {
+	store types.ShippingStore
+}
+
+func NewCalculator(store types.ShippingStore) *Calculator {
+	return &Calculator{store: store}
+}
+
+// Quote returns every shipping method available for the address, cheapest first
+func (c *Calculator) Quote(address *types.UserAddress, weightGrams int, subtotal types.Money) ([]types.ShippingQuote, error) {
+	if address == nil {
+		return nil, fmt.Errorf("address is required to quote shipping")
+	}
+
+	methods, err := c.store.GetMethodsForRegion(address.Country, address.StateProvince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shipping methods: %w", err)
+	}
+
+	quotes := make([]types.ShippingQuote, 0, len(methods))
+	for _, method := range methods {
+		quotes = append(quotes, types.ShippingQuote{
+			MethodID: method.ID,
+			Name:     method.Name,
+			Cost:     calculateRate(method, weightGrams, subtotal),
+		})
+	}
+
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].Cost.Amount < quotes[j].Cost.Amount
+	})
+
+	return quotes, nil
+}
+
+// calculateRate prices a single method for the cart weight and subtotal
+func calculateRate(method types.ShippingMethod, weightGrams int, subtotal types.Money) types.Money {
+	switch method.RateType {
+	case types.ShippingRateWeight:
+		// per kg rate prorated by the gram, rounded to the cent
+		return method.BaseRate.Add(method.PerKgRate.MulDiv(int64(weightGrams), 1000))
+	case types.ShippingRateFreeOver:
+		if method.FreeThreshold != nil && subtotal.Amount >= method.FreeThreshold.Amount {
+			return types.NewMoney(0, method.BaseRate.Currency)
+		}
+		return method.BaseRate
+	default:
+		return method.BaseRate
+	}
+}
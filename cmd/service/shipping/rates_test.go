@@ -0,0 +1,82 @@
+package shipping
+
+import (
+	"testing"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestCalculator_Quote(t *testing.T) {
+	threshold := usd("50")
+	store := &mockShippingStore{methods: []types.ShippingMethod{
+		{ID: 1, Name: "Express", RateType: types.ShippingRateFlat, BaseRate: usd("15")},
+		{ID: 2, Name: "Parcel", RateType: types.ShippingRateWeight, BaseRate: usd("2"), PerKgRate: usd("1.5")},
+		{ID: 3, Name: "Standard", RateType: types.ShippingRateFreeOver, BaseRate: usd("5"), FreeThreshold: &threshold},
+	}}
+	calculator := NewCalculator(store)
+	address := &types.UserAddress{Country: "United States", StateProvince: "Texas"}
+
+	t.Run("should price every method and sort by cost", func(t *testing.T) {
+		quotes, err := calculator.Quote(address, 2500, usd("20"))
+		if err != nil {
+			t.Fatalf("Failed to quote shipping: %v", err)
+		}
+
+		expected := []types.ShippingQuote{
+			{MethodID: 3, Name: "Standard", Cost: usd("5")},
+			{MethodID: 2, Name: "Parcel", Cost: usd("5.75")},
+			{MethodID: 1, Name: "Express", Cost: usd("15")},
+		}
+		if len(quotes) != len(expected) {
+			t.Fatalf("Expected %d quotes, got %d", len(expected), len(quotes))
+		}
+		for i := range expected {
+			if quotes[i] != expected[i] {
+				t.Errorf("Expected quote %d to be %+v, got %+v", i, expected[i], quotes[i])
+			}
+		}
+	})
+
+	t.Run("should ship for free over the threshold", func(t *testing.T) {
+		quotes, err := calculator.Quote(address, 0, usd("50"))
+		if err != nil {
+			t.Fatalf("Failed to quote shipping: %v", err)
+		}
+
+		if quotes[0].MethodID != 3 || !quotes[0].Cost.IsZero() {
+			t.Errorf("Expected free standard shipping first, got %+v", quotes[0])
+		}
+	})
+}
+
+func usd(amount string) types.Money {
+	return types.MustParseMoney(amount, "USD")
+}
+
+type mockShippingStore struct {
+	methods []types.ShippingMethod
+}
+
+func (m *mockShippingStore) GetZones() ([]types.ShippingZone, error) {
+	return nil, nil
+}
+
+func (m *mockShippingStore) CreateZone(payload types.CreateShippingZonePayload) (*types.ShippingZone, error) {
+	return nil, nil
+}
+
+func (m *mockShippingStore) DeleteZone(zoneID int) error {
+	return nil
+}
+
+func (m *mockShippingStore) CreateMethod(zoneID int, payload types.CreateShippingMethodPayload) (*types.ShippingMethod, error) {
+	return nil, nil
+}
+
+func (m *mockShippingStore) DeleteMethod(methodID int) error {
+	return nil
+}
+
+func (m *mockShippingStore) GetMethodsForRegion(country, stateProvince string) ([]types.ShippingMethod, error) {
+	return m.methods, nil
+}
@@ -0,0 +1,153 @@
+package shipping
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.ShippingStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.ShippingStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes for shipping configuration
+	router.HandleFunc("/shipping/zones", auth.WithAdminAuth(h.handleGetZones, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/shipping/zones", auth.WithAdminAuth(h.handleCreateZone, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/shipping/zones/{id}", auth.WithAdminAuth(h.handleDeleteZone, h.userStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/shipping/zones/{id}/methods", auth.WithAdminAuth(h.handleCreateMethod, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/shipping/methods/{id}", auth.WithAdminAuth(h.handleDeleteMethod, h.userStore)).Methods(http.MethodDelete)
+}
+
+// GET /api/v1/shipping/zones - list shipping zones with their regions and methods
+func (h *Handler) handleGetZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := h.store.GetZones()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"zones": zones,
+		"count": len(zones),
+	})
+}
+
+// POST /api/v1/shipping/zones - create a shipping zone
+func (h *Handler) handleCreateZone(w http.ResponseWriter, r *http.Request) {
+	var payload types.CreateShippingZonePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	zone, err := h.store.CreateZone(payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, zone)
+}
+
+// DELETE /api/v1/shipping/zones/{id} - delete a shipping zone
+func (h *Handler) handleDeleteZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	zoneID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping zone ID"))
+		return
+	}
+
+	if err := h.store.DeleteZone(zoneID); err != nil {
+		if err.Error() == "shipping zone not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Shipping zone deleted successfully",
+	})
+}
+
+// POST /api/v1/shipping/zones/{id}/methods - add a shipping method to a zone
+func (h *Handler) handleCreateMethod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	zoneID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping zone ID"))
+		return
+	}
+
+	var payload types.CreateShippingMethodPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	if payload.RateType == types.ShippingRateFreeOver && payload.FreeThreshold == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("freeThreshold is required for FREE_OVER methods"))
+		return
+	}
+
+	method, err := h.store.CreateMethod(zoneID, payload)
+	if err != nil {
+		if err.Error() == "shipping zone not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, method)
+}
+
+// DELETE /api/v1/shipping/methods/{id} - delete a shipping method
+func (h *Handler) handleDeleteMethod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	methodID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping method ID"))
+		return
+	}
+
+	if err := h.store.DeleteMethod(methodID); err != nil {
+		if err.Error() == "shipping method not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Shipping method deleted successfully",
+	})
+}
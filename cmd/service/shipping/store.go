@@ -0,0 +1,281 @@
+package shipping
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetZones retrieves all shipping zones with their regions and methods
+func (s *Store) GetZones() ([]types.ShippingZone, error) {
+	rows, err := s.db.Query("SELECT id, name, created_at FROM shipping_zones ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipping zones: %w", err)
+	}
+	defer rows.Close()
+
+	zones := []types.ShippingZone{}
+	zoneIndex := make(map[int]int)
+	for rows.Next() {
+		var zone types.ShippingZone
+		if err := rows.Scan(&zone.ID, &zone.Name, &zone.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan shipping zone: %w", err)
+		}
+		zone.Regions = []types.ShippingZoneRegion{}
+		zone.Methods = []types.ShippingMethod{}
+		zoneIndex[zone.ID] = len(zones)
+		zones = append(zones, zone)
+	}
+
+	regions, err := s.getRegions()
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range regions {
+		if i, ok := zoneIndex[region.ZoneID]; ok {
+			zones[i].Regions = append(zones[i].Regions, region)
+		}
+	}
+
+	methods, err := s.queryMethods(`
+		SELECT id, zone_id, name, rate_type, base_rate, per_kg_rate, free_threshold, is_active, created_at
+		FROM shipping_methods
+		ORDER BY zone_id, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for _, method := range methods {
+		if i, ok := zoneIndex[method.ZoneID]; ok {
+			zones[i].Methods = append(zones[i].Methods, method)
+		}
+	}
+
+	return zones, nil
+}
+
+// CreateZone creates a shipping zone together with the regions it covers
+func (s *Store) CreateZone(payload types.CreateShippingZonePayload) (*types.ShippingZone, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO shipping_zones (name) VALUES (?)", payload.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shipping zone: %w", err)
+	}
+
+	zoneID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipping zone ID: %w", err)
+	}
+
+	zone := &types.ShippingZone{
+		ID:      int(zoneID),
+		Name:    payload.Name,
+		Regions: []types.ShippingZoneRegion{},
+		Methods: []types.ShippingMethod{},
+	}
+
+	for _, region := range payload.Regions {
+		result, err := tx.Exec(
+			"INSERT INTO shipping_zone_regions (zone_id, country, state_province) VALUES (?, ?, ?)",
+			zoneID, region.Country, region.StateProvince,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create shipping zone region: %w", err)
+		}
+
+		regionID, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get shipping zone region ID: %w", err)
+		}
+
+		zone.Regions = append(zone.Regions, types.ShippingZoneRegion{
+			ID:            int(regionID),
+			ZoneID:        zone.ID,
+			Country:       region.Country,
+			StateProvince: region.StateProvince,
+		})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return zone, nil
+}
+
+// DeleteZone deletes a shipping zone with its regions and methods
+func (s *Store) DeleteZone(zoneID int) error {
+	result, err := s.db.Exec("DELETE FROM shipping_zones WHERE id = ?", zoneID)
+	if err != nil {
+		return fmt.Errorf("failed to delete shipping zone: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("shipping zone not found")
+	}
+
+	return nil
+}
+
+// CreateMethod adds a shipping method to a zone
+func (s *Store) CreateMethod(zoneID int, payload types.CreateShippingMethodPayload) (*types.ShippingMethod, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM shipping_zones WHERE id = ?)", zoneID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check shipping zone: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("shipping zone not found")
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO shipping_methods (zone_id, name, rate_type, base_rate, per_kg_rate, free_threshold)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, zoneID, payload.Name, payload.RateType, payload.BaseRate, payload.PerKgRate, payload.FreeThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shipping method: %w", err)
+	}
+
+	methodID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipping method ID: %w", err)
+	}
+
+	methods, err := s.queryMethods(`
+		SELECT id, zone_id, name, rate_type, base_rate, per_kg_rate, free_threshold, is_active, created_at
+		FROM shipping_methods
+		WHERE id = ?
+	`, methodID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("shipping method not found")
+	}
+
+	return &methods[0], nil
+}
+
+// DeleteMethod deletes a shipping method
+func (s *Store) DeleteMethod(methodID int) error {
+	result, err := s.db.Exec("DELETE FROM shipping_methods WHERE id = ?", methodID)
+	if err != nil {
+		return fmt.Errorf("failed to delete shipping method: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("shipping method not found")
+	}
+
+	return nil
+}
+
+// GetMethodsForRegion retrieves the active methods of the zones covering a region.
+// Zones that name the state/province take precedence over country-wide zones.
+func (s *Store) GetMethodsForRegion(country, stateProvince string) ([]types.ShippingMethod, error) {
+	methods, err := s.queryMethods(`
+		SELECT DISTINCT m.id, m.zone_id, m.name, m.rate_type, m.base_rate, m.per_kg_rate,
+		       m.free_threshold, m.is_active, m.created_at
+		FROM shipping_methods m
+		JOIN shipping_zone_regions r ON r.zone_id = m.zone_id
+		WHERE m.is_active = TRUE AND r.country = ? AND r.state_province = ?
+		ORDER BY m.id
+	`, country, stateProvince)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(methods) > 0 {
+		return methods, nil
+	}
+
+	return s.queryMethods(`
+		SELECT DISTINCT m.id, m.zone_id, m.name, m.rate_type, m.base_rate, m.per_kg_rate,
+		       m.free_threshold, m.is_active, m.created_at
+		FROM shipping_methods m
+		JOIN shipping_zone_regions r ON r.zone_id = m.zone_id
+		WHERE m.is_active = TRUE AND r.country = ? AND (r.state_province IS NULL OR r.state_province = '')
+		ORDER BY m.id
+	`, country)
+}
+
+func (s *Store) getRegions() ([]types.ShippingZoneRegion, error) {
+	rows, err := s.db.Query("SELECT id, zone_id, country, state_province FROM shipping_zone_regions ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipping zone regions: %w", err)
+	}
+	defer rows.Close()
+
+	var regions []types.ShippingZoneRegion
+	for rows.Next() {
+		var region types.ShippingZoneRegion
+		var stateProvince sql.NullString
+		if err := rows.Scan(&region.ID, &region.ZoneID, &region.Country, &stateProvince); err != nil {
+			return nil, fmt.Errorf("failed to scan shipping zone region: %w", err)
+		}
+		if stateProvince.Valid {
+			region.StateProvince = &stateProvince.String
+		}
+		regions = append(regions, region)
+	}
+
+	return regions, nil
+}
+
+func (s *Store) queryMethods(query string, args ...any) ([]types.ShippingMethod, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipping methods: %w", err)
+	}
+	defer rows.Close()
+
+	methods := []types.ShippingMethod{}
+	for rows.Next() {
+		var method types.ShippingMethod
+		var freeThreshold sql.Null[types.Money]
+		err := rows.Scan(
+			&method.ID,
+			&method.ZoneID,
+			&method.Name,
+			&method.RateType,
+			&method.BaseRate,
+			&method.PerKgRate,
+			&freeThreshold,
+			&method.IsActive,
+			&method.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan shipping method: %w", err)
+		}
+		if freeThreshold.Valid {
+			method.FreeThreshold = &freeThreshold.V
+		}
+		methods = append(methods, method)
+	}
+
+	return methods, nil
+}
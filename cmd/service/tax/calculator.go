@@ -0,0 +1,103 @@
+package tax
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+// Calculator computes taxes from the rates configured for the shipping region
+type Calculator struct {
+	store types.TaxStore
+}
+
+func NewCalculator(store types.TaxStore) *Calculator {
+	return &Calculator{store: store}
+}
+
+// Calculate taxes every line using the most specific rate for the address:
+// a rate for the state/province wins over a country-wide rate of the same
+// tax class. Lines without a matching rate are not taxed.
+func (c *Calculator) Calculate(address *types.UserAddress, lines []types.TaxableLine) (*types.TaxBreakdown, error) {
+	if address == nil {
+		return nil, fmt.Errorf("address is required to calculate tax")
+	}
+
+	rates, err := c.store.GetTaxRatesForCountry(address.Country)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tax rates: %w", err)
+	}
+
+	breakdown := &types.TaxBreakdown{Lines: make([]types.TaxLine, 0, len(lines))}
+	for _, line := range lines {
+		taxLine := calculateLine(line, findRate(rates, address, line.TaxClass))
+
+		// order totals are always the exact sum of the rounded lines
+		breakdown.Lines = append(breakdown.Lines, taxLine)
+		breakdown.Subtotal = breakdown.Subtotal.Add(taxLine.Subtotal)
+		breakdown.Tax = breakdown.Tax.Add(taxLine.Tax)
+		breakdown.Total = breakdown.Total.Add(taxLine.Total)
+	}
+
+	return breakdown, nil
+}
+
+// findRate picks the rate that applies to the address and tax class
+func findRate(rates []types.TaxRate, address *types.UserAddress, taxClass string) *types.TaxRate {
+	if taxClass == "" {
+		taxClass = types.DefaultTaxClass
+	}
+
+	var countryRate *types.TaxRate
+	for i := range rates {
+		rate := &rates[i]
+		if !strings.EqualFold(rate.Country, address.Country) || !strings.EqualFold(rate.TaxClass, taxClass) {
+			continue
+		}
+
+		if rate.StateProvince == nil || *rate.StateProvince == "" {
+			countryRate = rate
+			continue
+		}
+
+		if strings.EqualFold(strings.TrimSpace(*rate.StateProvince), strings.TrimSpace(address.StateProvince)) {
+			return rate
+		}
+	}
+
+	return countryRate
+}
+
+// calculateLine taxes a single line. Tax is computed on the line total and
+// rounded half away from zero to the cent, so Subtotal + Tax == Total always holds.
+func calculateLine(line types.TaxableLine, rate *types.TaxRate) types.TaxLine {
+	gross := line.UnitPrice.Mul(line.Quantity)
+
+	taxLine := types.TaxLine{
+		ProductID: line.ProductID,
+		Quantity:  line.Quantity,
+		UnitPrice: line.UnitPrice,
+		Subtotal:  gross,
+		Tax:       types.NewMoney(0, gross.Currency),
+		Total:     gross,
+	}
+
+	if rate == nil || rate.Rate == 0 {
+		return taxLine
+	}
+
+	taxLine.TaxRate = rate.Rate
+	taxLine.Inclusive = rate.Inclusive
+
+	if rate.Inclusive {
+		// the price already contains the tax, extract it
+		taxLine.Subtotal = gross.DivRate(types.RateOne + rate.Rate)
+		taxLine.Tax = gross.Sub(taxLine.Subtotal)
+	} else {
+		taxLine.Tax = gross.MulRate(rate.Rate)
+		taxLine.Total = gross.Add(taxLine.Tax)
+	}
+
+	return taxLine
+}
@@ -0,0 +1,168 @@
+package tax
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+func TestCalculator_Calculate(t *testing.T) {
+	california := "California"
+	store := &mockTaxStore{rates: []types.TaxRate{
+		{ID: 1, Name: "VAT", Country: "Germany", TaxClass: "standard", Rate: types.MustParseRate("0.19"), Inclusive: true},
+		{ID: 2, Name: "Reduced VAT", Country: "Germany", TaxClass: "reduced", Rate: types.MustParseRate("0.07"), Inclusive: true},
+		{ID: 3, Name: "US Sales Tax", Country: "United States", TaxClass: "standard", Rate: types.MustParseRate("0.05")},
+		{ID: 4, Name: "CA Sales Tax", Country: "United States", StateProvince: &california, TaxClass: "standard", Rate: types.MustParseRate("0.0725")},
+	}}
+	calculator := NewCalculator(store)
+
+	t.Run("should add exclusive tax on top of the price", func(t *testing.T) {
+		address := &types.UserAddress{Country: "United States", StateProvince: "Texas"}
+		breakdown, err := calculator.Calculate(address, []types.TaxableLine{
+			{ProductID: 1, TaxClass: "standard", UnitPrice: usd("10"), Quantity: 3},
+		})
+		if err != nil {
+			t.Fatalf("Failed to calculate tax: %v", err)
+		}
+
+		if breakdown.Subtotal != usd("30") || breakdown.Tax != usd("1.5") || breakdown.Total != usd("31.5") {
+			t.Errorf("Expected 30 + 1.5 = 31.5, got %v + %v = %v", breakdown.Subtotal, breakdown.Tax, breakdown.Total)
+		}
+	})
+
+	t.Run("should prefer the state rate over the country rate", func(t *testing.T) {
+		address := &types.UserAddress{Country: "united states", StateProvince: "california"}
+		breakdown, err := calculator.Calculate(address, []types.TaxableLine{
+			{ProductID: 1, TaxClass: "standard", UnitPrice: usd("100"), Quantity: 1},
+		})
+		if err != nil {
+			t.Fatalf("Failed to calculate tax: %v", err)
+		}
+
+		if breakdown.Lines[0].TaxRate != types.MustParseRate("0.0725") {
+			t.Errorf("Expected state rate 0.0725, got %v", breakdown.Lines[0].TaxRate)
+		}
+		if breakdown.Tax != usd("7.25") || breakdown.Total != usd("107.25") {
+			t.Errorf("Expected tax 7.25 and total 107.25, got %v and %v", breakdown.Tax, breakdown.Total)
+		}
+	})
+
+	t.Run("should extract inclusive tax from the price", func(t *testing.T) {
+		address := &types.UserAddress{Country: "Germany", StateProvince: "Berlin"}
+		breakdown, err := calculator.Calculate(address, []types.TaxableLine{
+			{ProductID: 1, TaxClass: "standard", UnitPrice: usd("119"), Quantity: 1},
+			{ProductID: 2, TaxClass: "reduced", UnitPrice: usd("10.70"), Quantity: 2},
+		})
+		if err != nil {
+			t.Fatalf("Failed to calculate tax: %v", err)
+		}
+
+		if breakdown.Lines[0].Subtotal != usd("100") || breakdown.Lines[0].Tax != usd("19") {
+			t.Errorf("Expected 100 + 19, got %v + %v", breakdown.Lines[0].Subtotal, breakdown.Lines[0].Tax)
+		}
+		if breakdown.Lines[1].Subtotal != usd("20") || breakdown.Lines[1].Tax != usd("1.4") {
+			t.Errorf("Expected 20 + 1.4, got %v + %v", breakdown.Lines[1].Subtotal, breakdown.Lines[1].Tax)
+		}
+		if breakdown.Total != usd("140.4") {
+			t.Errorf("Expected total to stay at the shelf price 140.4, got %v", breakdown.Total)
+		}
+	})
+
+	t.Run("should not tax lines without a matching rate", func(t *testing.T) {
+		address := &types.UserAddress{Country: "France", StateProvince: "Paris"}
+		breakdown, err := calculator.Calculate(address, []types.TaxableLine{
+			{ProductID: 1, TaxClass: "standard", UnitPrice: usd("50"), Quantity: 2},
+		})
+		if err != nil {
+			t.Fatalf("Failed to calculate tax: %v", err)
+		}
+
+		if breakdown.Tax != usd("0") || breakdown.Total != usd("100") {
+			t.Errorf("Expected untaxed total 100, got tax %v and total %v", breakdown.Tax, breakdown.Total)
+		}
+	})
+}
+
+// quickCart is a random cart and tax rate for property tests
+type quickCart struct {
+	Rate      types.Rate
+	Inclusive bool
+	Lines     []types.TaxableLine
+}
+
+func (quickCart) Generate(r *rand.Rand, size int) reflect.Value {
+	cart := quickCart{
+		Rate:      types.Rate(r.Int63n(30_000_000)), // 0% - 30%
+		Inclusive: r.Intn(2) == 0,
+	}
+	for i := 0; i < 1+r.Intn(size+1); i++ {
+		cart.Lines = append(cart.Lines, types.TaxableLine{
+			ProductID: i + 1,
+			TaxClass:  types.DefaultTaxClass,
+			UnitPrice: types.NewMoney(r.Int63n(1_000_000), "USD"),
+			Quantity:  1 + r.Intn(20),
+		})
+	}
+	return reflect.ValueOf(cart)
+}
+
+func TestCalculator_TotalsEqualSumOfLines(t *testing.T) {
+	property := func(cart quickCart) bool {
+		store := &mockTaxStore{rates: []types.TaxRate{
+			{Country: "Germany", TaxClass: types.DefaultTaxClass, Rate: cart.Rate, Inclusive: cart.Inclusive},
+		}}
+		breakdown, err := NewCalculator(store).Calculate(&types.UserAddress{Country: "Germany"}, cart.Lines)
+		if err != nil {
+			t.Logf("Failed to calculate tax: %v", err)
+			return false
+		}
+
+		subtotal, tax, total := usd("0"), usd("0"), usd("0")
+		for i, line := range breakdown.Lines {
+			if line.Subtotal.Add(line.Tax) != line.Total {
+				t.Logf("Line %d: %v + %v != %v", i, line.Subtotal, line.Tax, line.Total)
+				return false
+			}
+			gross := cart.Lines[i].UnitPrice.Mul(cart.Lines[i].Quantity)
+			if cart.Inclusive && line.Total != gross || !cart.Inclusive && line.Subtotal != gross {
+				t.Logf("Line %d: shelf price %v not preserved", i, gross)
+				return false
+			}
+			subtotal, tax, total = subtotal.Add(line.Subtotal), tax.Add(line.Tax), total.Add(line.Total)
+		}
+
+		return breakdown.Subtotal == subtotal && breakdown.Tax == tax && breakdown.Total == total &&
+			breakdown.Subtotal.Add(breakdown.Tax) == breakdown.Total
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func usd(amount string) types.Money {
+	return types.MustParseMoney(amount, "USD")
+}
+
+type mockTaxStore struct {
+	rates []types.TaxRate
+}
+
+func (m *mockTaxStore) GetTaxRates() ([]types.TaxRate, error) {
+	return m.rates, nil
+}
+
+func (m *mockTaxStore) GetTaxRatesForCountry(country string) ([]types.TaxRate, error) {
+	return m.rates, nil
+}
+
+func (m *mockTaxStore) CreateTaxRate(payload types.CreateTaxRatePayload) (*types.TaxRate, error) {
+	return nil, nil
+}
+
+func (m *mockTaxStore) DeleteTaxRate(id int) error {
+	return nil
+}
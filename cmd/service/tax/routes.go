@@ -0,0 +1,89 @@
+package tax
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.TaxStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.TaxStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes for tax configuration
+	router.HandleFunc("/tax/rates", auth.WithAdminAuth(h.handleGetTaxRates, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/tax/rates", auth.WithAdminAuth(h.handleCreateTaxRate, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/tax/rates/{id}", auth.WithAdminAuth(h.handleDeleteTaxRate, h.userStore)).Methods(http.MethodDelete)
+}
+
+// GET /api/v1/tax/rates - list all tax rates
+func (h *Handler) handleGetTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.store.GetTaxRates()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"rates": rates,
+		"count": len(rates),
+	})
+}
+
+// POST /api/v1/tax/rates - create a tax rate
+func (h *Handler) handleCreateTaxRate(w http.ResponseWriter, r *http.Request) {
+	var payload types.CreateTaxRatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return
+	}
+
+	rate, err := h.store.CreateTaxRate(payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, rate)
+}
+
+// DELETE /api/v1/tax/rates/{id} - delete a tax rate
+func (h *Handler) handleDeleteTaxRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid tax rate ID"))
+		return
+	}
+
+	if err := h.store.DeleteTaxRate(id); err != nil {
+		if err.Error() == "tax rate not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Tax rate deleted successfully",
+	})
+}
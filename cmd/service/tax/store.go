@@ -0,0 +1,140 @@
+package tax
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetTaxRates retrieves all configured tax rates
+func (s *Store) GetTaxRates() ([]types.TaxRate, error) {
+	query := `
+		SELECT id, name, country, state_province, tax_class, rate, inclusive, created_at
+		FROM tax_rates
+		ORDER BY country, state_province, tax_class
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax rates: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRowsIntoTaxRates(rows)
+}
+
+// GetTaxRatesForCountry retrieves all tax rates configured for a country
+func (s *Store) GetTaxRatesForCountry(country string) ([]types.TaxRate, error) {
+	query := `
+		SELECT id, name, country, state_province, tax_class, rate, inclusive, created_at
+		FROM tax_rates
+		WHERE country = ?
+	`
+
+	rows, err := s.db.Query(query, country)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax rates for country %s: %w", country, err)
+	}
+	defer rows.Close()
+
+	return scanRowsIntoTaxRates(rows)
+}
+
+// CreateTaxRate creates a new tax rate
+func (s *Store) CreateTaxRate(payload types.CreateTaxRatePayload) (*types.TaxRate, error) {
+	taxClass := payload.TaxClass
+	if taxClass == "" {
+		taxClass = types.DefaultTaxClass
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO tax_rates (name, country, state_province, tax_class, rate, inclusive)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, payload.Name, payload.Country, payload.StateProvince, taxClass, payload.Rate, payload.Inclusive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tax rate: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax rate ID: %w", err)
+	}
+
+	row := s.db.QueryRow(`
+		SELECT id, name, country, state_province, tax_class, rate, inclusive, created_at
+		FROM tax_rates
+		WHERE id = ?
+	`, id)
+	return scanRowIntoTaxRate(row)
+}
+
+// DeleteTaxRate deletes a tax rate
+func (s *Store) DeleteTaxRate(id int) error {
+	result, err := s.db.Exec("DELETE FROM tax_rates WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tax rate: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("tax rate not found")
+	}
+
+	return nil
+}
+
+func scanRowsIntoTaxRates(rows *sql.Rows) ([]types.TaxRate, error) {
+	rates := []types.TaxRate{}
+	for rows.Next() {
+		rate, err := scanRowIntoTaxRate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tax rate row: %w", err)
+		}
+		rates = append(rates, *rate)
+	}
+	return rates, nil
+}
+
+// Helper function to scan database row into TaxRate struct
+func scanRowIntoTaxRate(scanner interface {
+	Scan(dest ...any) error
+}) (*types.TaxRate, error) {
+	var rate types.TaxRate
+	var stateProvince sql.NullString
+
+	err := scanner.Scan(
+		&rate.ID,
+		&rate.Name,
+		&rate.Country,
+		&stateProvince,
+		&rate.TaxClass,
+		&rate.Rate,
+		&rate.Inclusive,
+		&rate.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tax rate not found")
+		}
+		return nil, err
+	}
+
+	if stateProvince.Valid {
+		rate.StateProvince = &stateProvince.String
+	}
+
+	return &rate, nil
+}
@@ -16,7 +16,7 @@ func NewStore(db *sql.DB) *Store {
 }
 
 func (s *Store) GetUserByEmail(email string) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE email = ?", email)
+	rows, err := s.db.Query("SELECT id, firstName, lastName, email, password, role, createdAt FROM users WHERE email = ?", email)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +45,7 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.LastName,
 		&user.Email,
 		&user.Password,
+		&user.Role,
 		&user.CreatedAt,
 	)
 
@@ -56,7 +57,7 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 }
 
 func (s *Store) GetUserByID(id int) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE id = ?", id)
+	rows, err := s.db.Query("SELECT id, firstName, lastName, email, password, role, createdAt FROM users WHERE id = ?", id)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,150 @@
+package warehouse
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/service/auth"
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+	"github.com/HollyEllmo/go_rest_tut/cmd/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.WarehouseStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.WarehouseStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// Admin only routes for warehouse configuration
+	router.HandleFunc("/warehouses", auth.WithAdminAuth(h.handleGetWarehouses, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/warehouses", auth.WithAdminAuth(h.handleCreateWarehouse, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/warehouses/{id}", auth.WithAdminAuth(h.handleGetWarehouse, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/warehouses/{id}", auth.WithAdminAuth(h.handleUpdateWarehouse, h.userStore)).Methods(http.MethodPut)
+}
+
+// GET /api/v1/warehouses - list warehouses by priority
+func (h *Handler) handleGetWarehouses(w http.ResponseWriter, r *http.Request) {
+	warehouses, err := h.store.GetWarehouses()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"warehouses": warehouses,
+		"count":      len(warehouses),
+	})
+}
+
+// POST /api/v1/warehouses - create a warehouse
+func (h *Handler) handleCreateWarehouse(w http.ResponseWriter, r *http.Request) {
+	payload, ok := parseWarehousePayload(w, r)
+	if !ok {
+		return
+	}
+
+	warehouse := warehouseFromPayload(payload)
+	if err := h.store.CreateWarehouse(&warehouse); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetWarehouse(warehouse.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GET /api/v1/warehouses/{id} - get a warehouse
+func (h *Handler) handleGetWarehouse(w http.ResponseWriter, r *http.Request) {
+	warehouseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid warehouse ID"))
+		return
+	}
+
+	warehouse, err := h.store.GetWarehouse(warehouseID)
+	if err != nil {
+		if err.Error() == "warehouse not found" {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, warehouse)
+}
+
+// PUT /api/v1/warehouses/{id} - replace the details of a warehouse
+func (h *Handler) handleUpdateWarehouse(w http.ResponseWriter, r *http.Request) {
+	warehouseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid warehouse ID"))
+		return
+	}
+
+	payload, ok := parseWarehousePayload(w, r)
+	if !ok {
+		return
+	}
+
+	warehouse := warehouseFromPayload(payload)
+	warehouse.ID = warehouseID
+	if err := h.store.UpdateWarehouse(&warehouse); err != nil {
+		switch err.Error() {
+		case "warehouse not found":
+			utils.WriteError(w, http.StatusNotFound, err)
+		case "cannot unset the default warehouse, make another warehouse the default instead":
+			utils.WriteError(w, http.StatusConflict, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	updated, err := h.store.GetWarehouse(warehouseID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func parseWarehousePayload(w http.ResponseWriter, r *http.Request) (types.WarehousePayload, bool) {
+	var payload types.WarehousePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return payload, false
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, errors)
+		return payload, false
+	}
+
+	return payload, true
+}
+
+func warehouseFromPayload(payload types.WarehousePayload) types.Warehouse {
+	return types.Warehouse{
+		Code:          payload.Code,
+		Name:          payload.Name,
+		Country:       payload.Country,
+		StateProvince: payload.StateProvince,
+		Priority:      payload.Priority,
+		IsDefault:     payload.IsDefault,
+	}
+}
@@ -0,0 +1,148 @@
+package warehouse
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
+)
+
+const warehouseColumns = "id, code, name, country, state_province, priority, is_default, created_at"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetWarehouses retrieves all warehouses in the order checkout ships from them
+func (s *Store) GetWarehouses() ([]types.Warehouse, error) {
+	rows, err := s.db.Query("SELECT " + warehouseColumns + " FROM warehouses ORDER BY priority, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warehouses: %w", err)
+	}
+	defer rows.Close()
+
+	warehouses := []types.Warehouse{}
+	for rows.Next() {
+		warehouse, err := scanRowIntoWarehouse(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan warehouse: %w", err)
+		}
+		warehouses = append(warehouses, *warehouse)
+	}
+
+	return warehouses, rows.Err()
+}
+
+// GetWarehouse retrieves a warehouse by ID
+func (s *Store) GetWarehouse(warehouseID int) (*types.Warehouse, error) {
+	row := s.db.QueryRow("SELECT "+warehouseColumns+" FROM warehouses WHERE id = ?", warehouseID)
+	warehouse, err := scanRowIntoWarehouse(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("warehouse not found")
+		}
+		return nil, fmt.Errorf("failed to get warehouse: %w", err)
+	}
+
+	return warehouse, nil
+}
+
+// CreateWarehouse stores a new warehouse and sets its ID. A new default
+// warehouse takes over from the previous one.
+func (s *Store) CreateWarehouse(warehouse *types.Warehouse) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if warehouse.IsDefault {
+		if _, err := tx.Exec("UPDATE warehouses SET is_default = FALSE WHERE is_default = TRUE"); err != nil {
+			return fmt.Errorf("failed to unset default warehouse: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO warehouses (code, name, country, state_province, priority, is_default)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, warehouse.Code, warehouse.Name, warehouse.Country, warehouse.StateProvince, warehouse.Priority, warehouse.IsDefault)
+	if err != nil {
+		return fmt.Errorf("failed to create warehouse: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get warehouse ID: %w", err)
+	}
+	warehouse.ID = int(id)
+
+	return tx.Commit()
+}
+
+// UpdateWarehouse replaces the details of a warehouse. There is always exactly
+// one default warehouse: it can be moved to another warehouse but not unset.
+func (s *Store) UpdateWarehouse(warehouse *types.Warehouse) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var isDefault bool
+	err = tx.QueryRow("SELECT is_default FROM warehouses WHERE id = ? FOR UPDATE", warehouse.ID).Scan(&isDefault)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("warehouse not found")
+		}
+		return fmt.Errorf("failed to get warehouse: %w", err)
+	}
+
+	if isDefault && !warehouse.IsDefault {
+		return fmt.Errorf("cannot unset the default warehouse, make another warehouse the default instead")
+	}
+	if warehouse.IsDefault && !isDefault {
+		if _, err := tx.Exec("UPDATE warehouses SET is_default = FALSE WHERE is_default = TRUE"); err != nil {
+			return fmt.Errorf("failed to unset default warehouse: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE warehouses
+		SET code = ?, name = ?, country = ?, state_province = ?, priority = ?, is_default = ?
+		WHERE id = ?
+	`, warehouse.Code, warehouse.Name, warehouse.Country, warehouse.StateProvince, warehouse.Priority, warehouse.IsDefault, warehouse.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update warehouse: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func scanRowIntoWarehouse(scanner interface{ Scan(dest ...any) error }) (*types.Warehouse, error) {
+	var warehouse types.Warehouse
+	var stateProvince sql.NullString
+
+	err := scanner.Scan(
+		&warehouse.ID,
+		&warehouse.Code,
+		&warehouse.Name,
+		&warehouse.Country,
+		&stateProvince,
+		&warehouse.Priority,
+		&warehouse.IsDefault,
+		&warehouse.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if stateProvince.Valid {
+		warehouse.StateProvince = &stateProvince.String
+	}
+
+	return &warehouse, nil
+}
@@ -0,0 +1,499 @@
+package types
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts read without an explicit currency
+const DefaultCurrency = "USD"
+
+// minorUnits is the number of decimal places of the supported currencies
+const minorUnits = 2
+
+// Money is an exact amount of money in minor units (cents) plus its currency.
+// It is stored as DECIMAL(10, 2) and encoded in JSON as a string, e.g. "12.34".
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "12.34" or "-0.5".
+// More than two decimal places are rejected rather than silently rounded.
+func ParseMoney(s, currency string) (Money, error) {
+	amount, err := parseDecimal(s, minorUnits)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// MustParseMoney is like ParseMoney but panics on invalid input, for constants and tests
+func MustParseMoney(s, currency string) Money {
+	m, err := ParseMoney(s, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m Money) String() string {
+	return formatDecimal(m.Amount, minorUnits)
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Cmp returns -1, 0 or +1 depending on whether m is less than, equal to or greater than o
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currencyWith(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currencyWith(o)}
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// MulDiv multiplies the amount by num/den, rounding half away from zero
+func (m Money) MulDiv(num, den int64) Money {
+	result := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	return Money{Amount: divRound(result, big.NewInt(den)), Currency: m.Currency}
+}
+
+// MulRate multiplies the amount by a rate, rounding half away from zero.
+// This is the rounding rule used for taxes.
+func (m Money) MulRate(r Rate) Money {
+	return m.MulDiv(int64(r), rateScale)
+}
+
+// DivRate divides the amount by a rate, rounding half away from zero.
+// Dividing a gross amount by 1+tax rate gives the net amount.
+func (m Money) DivRate(r Rate) Money {
+	if r == 0 {
+		panic("money: division by zero rate")
+	}
+	return m.MulDiv(rateScale, int64(r))
+}
+
+// Convert converts the amount into another currency at the given exchange
+// rate (1 unit of m.Currency = rate units of currency), rounding half away from zero
+func (m Money) Convert(rate Rate, currency string) Money {
+	converted := m.MulRate(rate)
+	converted.Currency = currency
+	return converted
+}
+
+// Allocate splits the amount proportionally to the weights without losing a cent:
+// the parts always add up to the original amount. Remainders go to the parts
+// with the largest fractional share first. This is the rounding rule used
+// when spreading discounts and order level amounts over lines.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	var total int64
+	for _, w := range weights {
+		if w < 0 {
+			panic("money: negative allocation weight")
+		}
+		total += w
+	}
+	if total == 0 {
+		// nothing to weigh by, split evenly
+		even := make([]int64, len(weights))
+		for i := range even {
+			even[i] = 1
+		}
+		weights, total = even, int64(len(even))
+	}
+
+	type share struct {
+		index     int
+		remainder int64
+	}
+	shares := make([]share, len(weights))
+
+	abs := m.Amount
+	sign := int64(1)
+	if abs < 0 {
+		abs, sign = -abs, -1
+	}
+
+	var allocated int64
+	for i, w := range weights {
+		product := new(big.Int).Mul(big.NewInt(abs), big.NewInt(w))
+		quo, rem := new(big.Int).QuoRem(product, big.NewInt(total), new(big.Int))
+		parts[i] = Money{Amount: quo.Int64(), Currency: m.Currency}
+		shares[i] = share{index: i, remainder: rem.Int64()}
+		allocated += quo.Int64()
+	}
+
+	// hand out the leftover cents, largest remainder first, ties to the earliest part
+	for left := abs - allocated; left > 0; left-- {
+		best := -1
+		for i, s := range shares {
+			if s.remainder >= 0 && (best < 0 || s.remainder > shares[best].remainder) {
+				best = i
+			}
+		}
+		parts[shares[best].index].Amount++
+		shares[best].remainder = -1
+	}
+
+	for i := range parts {
+		parts[i].Amount *= sign
+	}
+
+	return parts
+}
+
+// SumMoney adds up amounts of the same currency
+func SumMoney(amounts ...Money) Money {
+	var total Money
+	for _, m := range amounts {
+		total = total.Add(m)
+	}
+	return total
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts both "12.34" and 12.34. Numbers are parsed from their
+// text, never through float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	amount, err := parseDecimal(s, minorUnits)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %w", data, err)
+	}
+	m.Amount = amount
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns
+func (m *Money) Scan(src any) error {
+	var amount int64
+	switch v := src.(type) {
+	case nil:
+		amount = 0
+	case []byte:
+		a, err := parseDecimalRounded(string(v), minorUnits)
+		if err != nil {
+			return fmt.Errorf("failed to scan money: %w", err)
+		}
+		amount = a
+	case string:
+		a, err := parseDecimalRounded(v, minorUnits)
+		if err != nil {
+			return fmt.Errorf("failed to scan money: %w", err)
+		}
+		amount = a
+	case int64:
+		amount = v * 100
+	default:
+		return fmt.Errorf("failed to scan money: unsupported type %T", src)
+	}
+
+	m.Amount = amount
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+	return nil
+}
+
+// Value implements driver.Valuer, amounts are written as exact decimal strings
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m Money) mustMatch(o Money) {
+	if m.Currency != "" && o.Currency != "" && m.Currency != o.Currency {
+		panic(fmt.Sprintf("money: currency mismatch %s and %s", m.Currency, o.Currency))
+	}
+}
+
+func (m Money) currencyWith(o Money) string {
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return o.Currency
+}
+
+// rateScale is the fixed point scale of Rate, 8 decimal places
+const rateScale = 100000000
+
+// Rate is an exact decimal ratio such as a tax rate (0.0725) or an exchange
+// rate, stored with 8 decimal places. It is encoded in JSON as a string.
+type Rate int64
+
+// ParseRate parses a decimal string such as "0.0725"
+func ParseRate(s string) (Rate, error) {
+	r, err := parseDecimal(s, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	return Rate(r), nil
+}
+
+// MustParseRate is like ParseRate but panics on invalid input, for constants and tests
+func MustParseRate(s string) Rate {
+	r, err := ParseRate(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// RateOne is the rate 1.0
+const RateOne Rate = rateScale
+
+func (r Rate) String() string {
+	s := formatDecimal(int64(r), 8)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Inverse returns 1/r rounded to 8 decimal places, e.g. the EUR->USD rate
+// from a USD->EUR rate. The inverse of a zero rate is zero.
+func (r Rate) Inverse() Rate {
+	if r == 0 {
+		return 0
+	}
+	return Rate(divRound(big.NewInt(rateScale*rateScale), big.NewInt(int64(r))))
+}
+
+// Float64 returns an approximation of the rate, only for validation and display
+func (r Rate) Float64() float64 {
+	return float64(r) / rateScale
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	v, err := parseDecimal(s, 8)
+	if err != nil {
+		return fmt.Errorf("invalid rate %s: %w", data, err)
+	}
+	*r = Rate(v)
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns
+func (r *Rate) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*r = 0
+	case []byte:
+		return r.scanString(string(v))
+	case string:
+		return r.scanString(v)
+	case int64:
+		*r = Rate(v * rateScale)
+	default:
+		return fmt.Errorf("failed to scan rate: unsupported type %T", src)
+	}
+	return nil
+}
+
+func (r *Rate) scanString(s string) error {
+	v, err := parseDecimalRounded(s, 8)
+	if err != nil {
+		return fmt.Errorf("failed to scan rate: %w", err)
+	}
+	*r = Rate(v)
+	return nil
+}
+
+// Value implements driver.Valuer
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// parseDecimal parses a decimal string into an integer scaled by 10^places,
+// rejecting values with more decimal places
+func parseDecimal(s string, places int) (int64, error) {
+	intPart, fracPart, negative, err := splitDecimal(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(fracPart) > places {
+		if strings.TrimRight(fracPart[places:], "0") != "" {
+			return 0, fmt.Errorf("more than %d decimal places", places)
+		}
+		fracPart = fracPart[:places]
+	}
+	return scaleDecimal(intPart, fracPart, negative, places)
+}
+
+// parseDecimalRounded is like parseDecimal but rounds extra decimal places half away from zero
+func parseDecimalRounded(s string, places int) (int64, error) {
+	intPart, fracPart, negative, err := splitDecimal(s)
+	if err != nil {
+		return 0, err
+	}
+
+	roundUp := false
+	if len(fracPart) > places {
+		roundUp = fracPart[places] >= '5'
+		fracPart = fracPart[:places]
+	}
+
+	v, err := scaleDecimal(intPart, fracPart, false, places)
+	if err != nil {
+		return 0, err
+	}
+	if roundUp {
+		v++
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+func splitDecimal(s string) (intPart, fracPart string, negative bool, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", "", false, fmt.Errorf("empty value")
+	}
+
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ = strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return "", "", false, fmt.Errorf("no digits")
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return "", "", false, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+
+	return intPart, fracPart, negative, nil
+}
+
+func scaleDecimal(intPart, fracPart string, negative bool, places int) (int64, error) {
+	digits := intPart + fracPart + strings.Repeat("0", places-len(fracPart))
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		return 0, nil
+	}
+
+	if negative {
+		digits = "-" + digits
+	}
+	v, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value out of range")
+	}
+	return v, nil
+}
+
+func formatDecimal(v int64, places int) string {
+	sign := ""
+	u := new(big.Int).SetInt64(v)
+	if v < 0 {
+		sign = "-"
+		u.Neg(u)
+	}
+
+	digits := u.String()
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
+
+// divRound divides rounding half away from zero
+func divRound(num, den *big.Int) int64 {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+
+	// compare 2*|rem| with |den|
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	if twice.Cmp(new(big.Int).Abs(den)) >= 0 {
+		if (num.Sign() < 0) != (den.Sign() < 0) {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+
+	return quo.Int64()
+}
@@ -0,0 +1,213 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/quick"
+)
+
+func TestMoney_ExactArithmetic(t *testing.T) {
+	sum := MustParseMoney("0.1", "USD").Add(MustParseMoney("0.2", "USD"))
+	if sum != MustParseMoney("0.3", "USD") {
+		t.Errorf("Expected 0.1 + 0.2 = 0.30, got %s", sum)
+	}
+
+	line := MustParseMoney("19.99", "USD").Mul(3)
+	if line.String() != "59.97" {
+		t.Errorf("Expected 19.99 x 3 = 59.97, got %s", line)
+	}
+}
+
+func TestMoney_Parse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		valid    bool
+	}{
+		{"12.34", 1234, true},
+		{"12", 1200, true},
+		{"12.5", 1250, true},
+		{"-0.05", -5, true},
+		{".99", 99, true},
+		{"1.230", 123, true},
+		{"1.234", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.input, "USD")
+		if tt.valid && err != nil {
+			t.Errorf("Expected %q to parse, got %v", tt.input, err)
+			continue
+		}
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("Expected %q to be rejected, got %s", tt.input, m)
+			}
+			continue
+		}
+		if m.Amount != tt.expected {
+			t.Errorf("Expected %q to be %d minor units, got %d", tt.input, tt.expected, m.Amount)
+		}
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	encoded, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{MustParseMoney("1234.5", "USD")})
+	if err != nil {
+		t.Fatalf("Failed to encode money: %v", err)
+	}
+	if string(encoded) != `{"price":"1234.50"}` {
+		t.Errorf("Expected money to be encoded as a string, got %s", encoded)
+	}
+
+	for _, input := range []string{`{"price":"0.10"}`, `{"price":0.10}`} {
+		var decoded struct {
+			Price Money `json:"price"`
+		}
+		if err := json.Unmarshal([]byte(input), &decoded); err != nil {
+			t.Fatalf("Failed to decode %s: %v", input, err)
+		}
+		if decoded.Price.Amount != 10 {
+			t.Errorf("Expected %s to decode to 10 minor units, got %d", input, decoded.Price.Amount)
+		}
+	}
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("99.99")); err != nil {
+		t.Fatalf("Failed to scan money: %v", err)
+	}
+	if m.Amount != 9999 || m.Currency != DefaultCurrency {
+		t.Errorf("Expected 9999 %s, got %d %s", DefaultCurrency, m.Amount, m.Currency)
+	}
+}
+
+func TestMoney_MulRateRoundsHalfAwayFromZero(t *testing.T) {
+	tests := []struct {
+		amount   string
+		rate     string
+		expected string
+	}{
+		{"10.00", "0.0725", "0.73"}, // 0.725
+		{"0.10", "0.05", "0.01"},    // 0.005
+		{"0.10", "0.04", "0.00"},    // 0.004
+		{"-10.00", "0.0725", "-0.73"},
+		{"119.00", "0.19", "22.61"},
+	}
+
+	for _, tt := range tests {
+		got := MustParseMoney(tt.amount, "USD").MulRate(MustParseRate(tt.rate))
+		if got.String() != tt.expected {
+			t.Errorf("Expected %s x %s = %s, got %s", tt.amount, tt.rate, tt.expected, got)
+		}
+	}
+}
+
+func TestRate_String(t *testing.T) {
+	if s := MustParseRate("0.0725").String(); s != "0.0725" {
+		t.Errorf("Expected 0.0725, got %s", s)
+	}
+	if s := MustParseRate("1").String(); s != "1" {
+		t.Errorf("Expected 1, got %s", s)
+	}
+}
+
+// Property: a total is exactly the sum of its lines, whatever the order of addition
+func TestMoney_TotalEqualsSumOfLines(t *testing.T) {
+	property := func(prices []int32, quantities []uint8) bool {
+		lines := make([]Money, 0, len(prices))
+		var expected int64
+		for i, price := range prices {
+			quantity := 1
+			if i < len(quantities) {
+				quantity = int(quantities[i]) + 1
+			}
+			line := NewMoney(int64(price), "USD").Mul(quantity)
+			lines = append(lines, line)
+			expected += int64(price) * int64(quantity)
+		}
+
+		forward := SumMoney(lines...)
+		backward := NewMoney(0, "USD")
+		for i := len(lines) - 1; i >= 0; i-- {
+			backward = backward.Add(lines[i])
+		}
+
+		return forward.Amount == expected && backward.Amount == expected
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Property: allocating an amount (e.g. a discount) never gains or loses a cent
+func TestMoney_AllocateSumsToTotal(t *testing.T) {
+	property := func(amount int32, weights []uint16) bool {
+		ws := make([]int64, len(weights))
+		for i, w := range weights {
+			ws[i] = int64(w)
+		}
+
+		parts := NewMoney(int64(amount), "USD").Allocate(ws)
+		if len(ws) == 0 {
+			return len(parts) == 0
+		}
+
+		sum := SumMoney(parts...)
+		if sum.Amount != int64(amount) {
+			return false
+		}
+
+		// every part is within one cent of its exact share
+		var total int64
+		for _, w := range ws {
+			total += w
+		}
+		for i, part := range parts {
+			if total == 0 {
+				break
+			}
+			exact := float64(amount) * float64(ws[i]) / float64(total)
+			if diff := float64(part.Amount) - exact; diff > 1 || diff < -1 {
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Property: formatting and parsing round-trips exactly
+func TestMoney_StringRoundTrip(t *testing.T) {
+	property := func(amount int64) bool {
+		m := NewMoney(amount, "USD")
+		parsed, err := ParseMoney(m.String(), "USD")
+		return err == nil && parsed == m
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMoney_Convert(t *testing.T) {
+	price := MustParseMoney("19.99", "USD")
+
+	eur := price.Convert(MustParseRate("0.92"), "EUR")
+	if eur.String() != "18.39" || eur.Currency != "EUR" {
+		t.Errorf("Expected 18.39 EUR, got %s %s", eur, eur.Currency)
+	}
+
+	if inverse := MustParseRate("0.8").Inverse(); inverse != MustParseRate("1.25") {
+		t.Errorf("Expected the inverse of 0.8 to be 1.25, got %s", inverse)
+	}
+}
@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"time"
+)
 
 type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
@@ -13,6 +17,7 @@ type ProductStore interface {
 	GetProductsByIDs(ps []int) ([]Product, error)
 	CreateProduct(product *Product) error
 	UpdateProduct(*Product) error
+	DeleteProduct(id int) error
 }
 
 type OrderStore interface {
@@ -21,66 +26,324 @@ type OrderStore interface {
 	GetUserOrders(userID int, filters OrderFilters) ([]OrderWithItems, error)
 	GetOrderByID(orderID, userID int) (*OrderWithItems, error)
 	GetOrdersCount(userID int, filters OrderFilters) (int, error)
+	GetOrder(orderID int) (*OrderWithItems, error)
+	UpdateOrderStatus(orderID int, fromStatus, toStatus string) error
 }
 
+// Order statuses
+const (
+	OrderStatusPending          = "pending"
+	OrderStatusPaid             = "paid"
+	OrderStatusPartiallyShipped = "partially_shipped" // some lines shipped, the rest still to go
+	OrderStatusCompleted        = "completed"
+	OrderStatusCancelled        = "cancelled"
+	OrderStatusRefunded         = "refunded" // fully refunded
+)
+
 type Order struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"userId"`
-	Total     float64   `json:"total"`
-	Status    string    `json:"status"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID               int       `json:"id"`
+	UserID           int       `json:"userId"`
+	Subtotal         Money     `json:"subtotal"`
+	Tax              Money     `json:"tax"`
+	ShippingMethodID *int      `json:"shippingMethodId,omitempty"`
+	ShippingCost     Money     `json:"shippingCost"`
+	Total            Money     `json:"total"`
+	RefundedAmount   Money     `json:"refundedAmount"`
+	Currency         string    `json:"currency"`
+	ExchangeRate     Rate      `json:"exchangeRate"` // base currency to order currency, locked at checkout
+	Status           string    `json:"status"`
+	Address          string    `json:"address"` // derived from ShippingAddress when set
+	CreatedAt        time.Time `json:"createdAt"`
+	// ShippingAddress and BillingAddress are the addresses as they were at checkout
+	ShippingAddress *OrderAddress `json:"shippingAddress,omitempty"`
+	BillingAddress  *OrderAddress `json:"billingAddress,omitempty"`
 }
 
 type OrderItem struct {
-	ID        int     `json:"id"`
-	OrderID   int     `json:"orderId"`
-	ProductID int     `json:"productId"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ID        int `json:"id"`
+	OrderID   int `json:"orderId"`
+	ProductID int `json:"productId"` // 0 once the product is deleted
+	// ProductName, ProductSKU and ProductImage snapshot the product at checkout
+	ProductName  string `json:"productName"`
+	ProductSKU   string `json:"productSku,omitempty"`
+	ProductImage string `json:"productImage"`
+	Quantity     int    `json:"quantity"`
+	Price        Money  `json:"price"`
+	TaxRate      Rate   `json:"taxRate"`
+	Subtotal     Money  `json:"subtotal"`
+	Tax          Money  `json:"tax"`
+	Total        Money  `json:"total"`
+	// Components is the breakdown of a bundle line
+	Components []OrderItemComponent `json:"components,omitempty"`
+}
+
+// OrderItemComponent is a product shipped as part of a bundle line. Quantity
+// covers the whole line, not a single bundle.
+type OrderItemComponent struct {
+	ProductID   int    `json:"productId"` // 0 once the product is deleted
+	ProductName string `json:"productName,omitempty"`
+	ProductSKU  string `json:"productSku,omitempty"`
+	Quantity    int    `json:"quantity"`
+	UnitCost    *Money `json:"-"`
+	// Fulfilment lists the warehouses the component is held or shipped from
+	Fulfilment []StockAllocation `json:"fulfilment,omitempty"`
 }
 
-// OrderItemWithProduct represents an order item with full product details
+// OrderItemWithProduct represents an order item with the product details
+// captured at checkout
 type OrderItemWithProduct struct {
-	ID          int     `json:"id"`
-	OrderID     int     `json:"orderId"`
-	ProductID   int     `json:"productId"`
-	ProductName string  `json:"productName"`
+	ID           int    `json:"id"`
+	OrderID      int    `json:"orderId"`
+	ProductID    int    `json:"productId"` // 0 once the product is deleted
+	ProductName  string `json:"productName"`
+	ProductSKU   string `json:"productSku,omitempty"`
 	ProductImage string `json:"productImage"`
-	Quantity    int     `json:"quantity"`
-	Price       float64 `json:"price"`
+	Quantity     int    `json:"quantity"`
+	Price        Money  `json:"price"`
+	TaxRate      Rate   `json:"taxRate"`
+	Subtotal     Money  `json:"subtotal"`
+	Tax          Money  `json:"tax"`
+	Total        Money  `json:"total"`
+	// Fulfilment lists the warehouses the line is held or shipped from
+	Fulfilment []StockAllocation `json:"fulfilment,omitempty"`
+	// Backordered counts the units of the line ordered beyond stock
+	Backordered int `json:"backordered,omitempty"`
+	// Components is the breakdown of a bundle line
+	Components []OrderItemComponent `json:"components,omitempty"`
 }
 
 // OrderWithItems represents an order with all its items
 type OrderWithItems struct {
-	ID        int                     `json:"id"`
-	UserID    int                     `json:"userId"`
-	Total     float64                 `json:"total"`
-	Status    string                  `json:"status"`
-	Address   string                  `json:"address"`
-	CreatedAt time.Time               `json:"createdAt"`
-	Items     []OrderItemWithProduct  `json:"items"`
+	ID               int                    `json:"id"`
+	UserID           int                    `json:"userId"`
+	Subtotal         Money                  `json:"subtotal"`
+	Tax              Money                  `json:"tax"`
+	ShippingMethodID *int                   `json:"shippingMethodId,omitempty"`
+	ShippingCost     Money                  `json:"shippingCost"`
+	Total            Money                  `json:"total"`
+	RefundedAmount   Money                  `json:"refundedAmount"`
+	Currency         string                 `json:"currency"`
+	ExchangeRate     Rate                   `json:"exchangeRate"`
+	Status           string                 `json:"status"`
+	Address          string                 `json:"address"` // formatted shipping address
+	CreatedAt        time.Time              `json:"createdAt"`
+	ShippingAddress  *OrderAddress          `json:"shippingAddress,omitempty"`
+	BillingAddress   *OrderAddress          `json:"billingAddress,omitempty"`
+	Items            []OrderItemWithProduct `json:"items"`
+	// Shipments are loaded for a single order only, not for order lists
+	Shipments []Shipment `json:"shipments,omitempty"`
 }
 
 // OrderFilters represents filters for order queries
 type OrderFilters struct {
-	Status    *string    `json:"status,omitempty"`
-	FromDate  *time.Time `json:"fromDate,omitempty"`
-	ToDate    *time.Time `json:"toDate,omitempty"`
-	Limit     int        `json:"limit"`
-	Offset    int        `json:"offset"`
+	Status   *string    `json:"status,omitempty"`
+	FromDate *time.Time `json:"fromDate,omitempty"`
+	ToDate   *time.Time `json:"toDate,omitempty"`
+	Country  *string    `json:"country,omitempty"` // shipping country
+	Limit    int        `json:"limit"`
+	Offset   int        `json:"offset"`
+	// Cursor continues the list from an order instead of skipping Offset orders
+	Cursor *OrderCursor `json:"-"`
+}
+
+// OrderCursor is a position in the order list, which runs from the newest
+// order to the oldest. Orders created in the same instant are told apart by ID.
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        int
+	Backward  bool // towards newer orders, for the previous page
 }
 
 // OrderListResponse represents the response for order list
 type OrderListResponse struct {
-	Orders  []OrderWithItems `json:"orders"`
-	Total   int              `json:"total"`
-	HasMore bool             `json:"hasMore"`
+	Orders     []OrderWithItems `json:"orders"`
+	Total      *int             `json:"total,omitempty"` // only when counted
+	HasMore    bool             `json:"hasMore"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+	PrevCursor string           `json:"prevCursor,omitempty"`
+}
+
+// AdminOrderFilters filters and sorts the orders of all users
+type AdminOrderFilters struct {
+	Status    *string
+	FromDate  *time.Time
+	ToDate    *time.Time
+	Email     *string // part of the customer's email
+	ProductID *int    // orders containing the product
+	MinTotal  *Money  // bounds on the order total in the base currency
+	MaxTotal  *Money
+	Country   *string // shipping country
+	Sort      []OrderSort
+	Limit     int
+	Offset    int
+}
+
+// OrderSort is a sort key of the admin order list
+type OrderSort struct {
+	Field      string // id, createdAt, total, status or email
+	Descending bool
+}
+
+// OrderCustomer is the user who placed an order
+type OrderCustomer struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+}
+
+// AdminOrder is an order together with its customer
+type AdminOrder struct {
+	OrderWithItems
+	Customer OrderCustomer `json:"customer"`
+}
+
+// AdminOrderListResponse represents the response for the admin order list
+type AdminOrderListResponse struct {
+	Orders  []AdminOrder `json:"orders"`
+	Total   int          `json:"total"`
+	HasMore bool         `json:"hasMore"`
+}
+
+// UpdateOrderStatusesPayload moves a batch of orders to a new status
+type UpdateOrderStatusesPayload struct {
+	OrderIDs []int  `json:"orderIds" validate:"required,min=1,max=100"`
+	Status   string `json:"status" validate:"required,oneof=completed cancelled"`
+}
+
+// OrderStatusUpdate is the outcome of a status update for a single order
+type OrderStatusUpdate struct {
+	OrderID int    `json:"orderId"`
+	Status  string `json:"status,omitempty"` // the new status, when updated
+	Error   string `json:"error,omitempty"`
+}
+
+// Admin Order Store interface
+type AdminOrderStore interface {
+	SearchOrders(filters AdminOrderFilters) ([]AdminOrder, error)
+	CountOrders(filters AdminOrderFilters) (int, error)
+	GetAdminOrder(orderID int) (*AdminOrder, error)
+	// StreamOrders calls fn for every order of all users matching the filters,
+	// oldest first, ignoring limit and offset
+	StreamOrders(filters OrderFilters, fn func(AdminOrder) error) error
+}
+
+// ExportFormat is the file format of an order export
+type ExportFormat string
+
+const (
+	ExportFormatCSV    ExportFormat = "csv"    // one row per order line
+	ExportFormatNDJSON ExportFormat = "ndjson" // one order per line
+	ExportFormatXLSX   ExportFormat = "xlsx"   // the CSV rows as a spreadsheet
+)
+
+// ExportJobStatus is the state of a background export
+type ExportJobStatus string
+
+const (
+	ExportJobPending ExportJobStatus = "PENDING"
+	ExportJobRunning ExportJobStatus = "RUNNING"
+	ExportJobDone    ExportJobStatus = "DONE"
+	ExportJobFailed  ExportJobStatus = "FAILED"
+)
+
+// ExportJob is an order export written to a file in the background
+type ExportJob struct {
+	ID          int             `json:"id"`
+	UserID      int             `json:"userId"` // who asked for it
+	Format      ExportFormat    `json:"format"`
+	Filters     OrderFilters    `json:"filters"`
+	Status      ExportJobStatus `json:"status"`
+	Rows        int             `json:"rows"` // orders written
+	FilePath    string          `json:"-"`
+	Error       string          `json:"error,omitempty"`
+	DownloadURL string          `json:"downloadUrl,omitempty"` // once done
+	CreatedAt   time.Time       `json:"createdAt"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// ShipmentStatus is where a shipment is, as last reported by the carrier
+type ShipmentStatus string
+
+const (
+	ShipmentStatusShipped        ShipmentStatus = "shipped" // handed to the carrier
+	ShipmentStatusInTransit      ShipmentStatus = "in_transit"
+	ShipmentStatusOutForDelivery ShipmentStatus = "out_for_delivery"
+	ShipmentStatusDelivered      ShipmentStatus = "delivered"
+	ShipmentStatusException      ShipmentStatus = "exception" // delayed, damaged or undeliverable
+)
+
+// Shipment is a parcel sent for an order, covering some or all of its lines
+type Shipment struct {
+	ID             int             `json:"id"`
+	OrderID        int             `json:"orderId"`
+	Carrier        string          `json:"carrier"`
+	TrackingNumber string          `json:"trackingNumber"`
+	Status         ShipmentStatus  `json:"status"`
+	Items          []ShipmentItem  `json:"items"`
+	Events         []ShipmentEvent `json:"events"` // oldest first
+	ShippedAt      time.Time       `json:"shippedAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+}
+
+// ShipmentItem is how much of an order line a shipment holds
+type ShipmentItem struct {
+	OrderItemID int `json:"orderItemId"`
+	ProductID   int `json:"productId"`
+	Quantity    int `json:"quantity"`
+}
+
+// ShipmentEvent is a tracking update of a shipment
+type ShipmentEvent struct {
+	Status      ShipmentStatus `json:"status"`
+	Description string         `json:"description,omitempty"`
+	Location    string         `json:"location,omitempty"`
+	OccurredAt  time.Time      `json:"occurredAt"`
+}
+
+type ShipmentItemPayload struct {
+	OrderItemID int `json:"orderItemId" validate:"required"`
+	Quantity    int `json:"quantity" validate:"required,min=1"`
+}
+
+type CreateShipmentPayload struct {
+	Carrier        string                `json:"carrier" validate:"required,max=50"`
+	TrackingNumber string                `json:"trackingNumber" validate:"required,max=100"`
+	Items          []ShipmentItemPayload `json:"items" validate:"dive"` // Optional: defaults to everything left to ship
+}
+
+// CarrierTrackingUpdate is a tracking update pushed by a carrier
+type CarrierTrackingUpdate struct {
+	Carrier        string         `json:"carrier" validate:"required"`
+	TrackingNumber string         `json:"trackingNumber" validate:"required"`
+	Status         ShipmentStatus `json:"status" validate:"required,oneof=shipped in_transit out_for_delivery delivered exception"`
+	Description    string         `json:"description" validate:"max=255"`
+	Location       string         `json:"location" validate:"max=100"`
+	OccurredAt     time.Time      `json:"occurredAt" validate:"required"`
+}
+
+// Shipment Store interface
+type ShipmentStore interface {
+	// CreateShipment ships lines of a paid order and moves the order to
+	// partially_shipped, or completed once every line has shipped
+	CreateShipment(shipment *Shipment) error
+	GetShipmentByTracking(carrier, trackingNumber string) (*Shipment, error)
+	// AddShipmentEvent records a tracking update; the shipment takes the
+	// status of its latest event, so updates may arrive in any order
+	AddShipmentEvent(shipmentID int, event ShipmentEvent) (*Shipment, error)
+}
+
+// Export Job Store interface
+type ExportJobStore interface {
+	CreateExportJob(job *ExportJob) error
+	GetExportJob(jobID int) (*ExportJob, error)
+	StartExportJob(jobID int) error
+	FinishExportJob(jobID int, filePath string, rows int, jobErr error) error
 }
 
 // GetOrdersPayload represents query parameters for getting orders
 type GetOrdersPayload struct {
-	Status *string `json:"status,omitempty" validate:"omitempty,oneof=pending completed cancelled"`
+	Status *string `json:"status,omitempty" validate:"omitempty,oneof=pending paid completed cancelled refunded"`
 	Limit  *int    `json:"limit,omitempty" validate:"omitempty,min=1,max=100"`
 	Offset *int    `json:"offset,omitempty" validate:"omitempty,min=0"`
 }
@@ -88,17 +351,49 @@ type GetOrdersPayload struct {
 type Product struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
+	SKU         string    `json:"sku,omitempty"`
 	Description string    `json:"description"`
 	Image       string    `json:"image"`
-	Price       float64   `json:"price"`
+	Price       Money     `json:"price"`
+	Currency    string    `json:"currency"`
+	TaxClass    string    `json:"taxClass"`
+	WeightGrams int       `json:"weightGrams"`
 	CreatedAt   time.Time `json:"createdAt"`
+	// Components makes the product a bundle: it holds no stock of its own and
+	// is available as long as all its components are
+	Components []BundleComponent `json:"components,omitempty"`
+}
+
+// BundleComponent is a product a bundle is made of, Quantity units per bundle
+type BundleComponent struct {
+	ProductID int `json:"productId" validate:"required"`
+	Quantity  int `json:"quantity" validate:"required,gt=0"`
 }
 
 type CreateProductPayload struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description" validate:"required"`
-	Image       string  `json:"image" validate:"required"`
-	Price       float64 `json:"price" validate:"required,gt=0"`
+	Name        string `json:"name" validate:"required"`
+	SKU         string `json:"sku,omitempty" validate:"omitempty,max=64"`
+	Description string `json:"description" validate:"required"`
+	Image       string `json:"image" validate:"required"`
+	Price       Money  `json:"price" validate:"required,gt=0"`
+	Currency    string `json:"currency,omitempty" validate:"omitempty,len=3"` // defaults to the base currency
+	TaxClass    string `json:"taxClass,omitempty" validate:"omitempty,max=50"`
+	WeightGrams int    `json:"weightGrams" validate:"gte=0"`
+	// Components turns the product into a bundle of existing products
+	Components []BundleComponent `json:"components,omitempty" validate:"omitempty,dive"`
+}
+
+// UpdateProductPayload replaces the catalog details of a product, the
+// components of a bundle stay as they are
+type UpdateProductPayload struct {
+	Name        string `json:"name" validate:"required"`
+	SKU         string `json:"sku,omitempty" validate:"omitempty,max=64"`
+	Description string `json:"description" validate:"required"`
+	Image       string `json:"image" validate:"required"`
+	Price       Money  `json:"price" validate:"required,gt=0"`
+	Currency    string `json:"currency,omitempty" validate:"omitempty,len=3"` // defaults to the base currency
+	TaxClass    string `json:"taxClass,omitempty" validate:"omitempty,max=50"`
+	WeightGrams int    `json:"weightGrams" validate:"gte=0"`
 }
 
 type User struct {
@@ -107,9 +402,15 @@ type User struct {
 	LastName  string    `json:"lastName"`
 	Email     string    `json:"email"`
 	Password  string    `json:"password"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+)
+
 type RegisterUserPayload struct {
 	FirstName string `json:"firstName" validate:"required"`
 	LastName  string `json:"lastName" validate:"required"`
@@ -128,22 +429,51 @@ type CartItem struct {
 }
 
 type CartCheckoutPayload struct {
-	Items     []CartItem `json:"items" validate:"required"`
-	AddressID *int       `json:"addressId,omitempty"` // Optional: use specific address, if nil use default
+	Items            []CartItem `json:"items" validate:"required"`
+	AddressID        *int       `json:"addressId,omitempty"`                           // Optional: use specific address, if nil use default
+	BillingAddressID *int       `json:"billingAddressId,omitempty"`                    // Optional: if nil the shipping address is billed
+	ShippingMethodID *int       `json:"shippingMethodId,omitempty"`                    // Optional: if nil the cheapest available method is used
+	Currency         string     `json:"currency,omitempty" validate:"omitempty,len=3"` // Optional: if empty the base currency is used
 }
 
 // Inventory Movement types
 type InventoryMovement struct {
 	ID            int                   `json:"id"`
 	ProductID     int                   `json:"productId"`
+	WarehouseID   int                   `json:"warehouseId"`
+	LotID         *int                  `json:"lotId,omitempty"`
 	MovementType  InventoryMovementType `json:"movementType"`
 	Quantity      int                   `json:"quantity"`
+	BalanceAfter  *int                  `json:"balanceAfter,omitempty"` // on hand in the warehouse after the movement
+	UnitCost      *Money                `json:"unitCost,omitempty"`     // IN movements only, in the base currency
 	Reason        string                `json:"reason"`
+	ReasonCode    *AdjustmentReason     `json:"reasonCode,omitempty"`
 	ReferenceID   *int                  `json:"referenceId,omitempty"`
 	ReferenceType *InventoryRefType     `json:"referenceType,omitempty"`
 	CreatedAt     time.Time             `json:"createdAt"`
 }
 
+// MovementFilter narrows the movement ledger. Movements come newest first;
+// BeforeID continues a page after the last movement seen.
+type MovementFilter struct {
+	ProductID     *int
+	WarehouseID   *int
+	MovementType  *InventoryMovementType
+	ReferenceType *InventoryRefType
+	ReferenceID   *int
+	From          *time.Time
+	To            *time.Time
+	BeforeID      *int
+	Limit         int // 0 means no limit, for exports
+}
+
+// MovementPage is one page of the movement ledger
+type MovementPage struct {
+	Movements  []InventoryMovement `json:"movements"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+	HasMore    bool                `json:"hasMore"`
+}
+
 type InventoryMovementType string
 
 const (
@@ -158,16 +488,429 @@ const (
 	RefTypeRestock    InventoryRefType = "RESTOCK"
 	RefTypeAdjustment InventoryRefType = "ADJUSTMENT"
 	RefTypeReturn     InventoryRefType = "RETURN"
+	RefTypeTransfer   InventoryRefType = "TRANSFER"
+	RefTypePurchase   InventoryRefType = "PURCHASE_ORDER"
 )
 
 // Inventory Store interface
 type InventoryStore interface {
 	GetCurrentStock(productID int) (int, error)
 	GetProductsWithStock(productIDs []int) (map[int]int, error)
-	ReserveStock(productID, quantity int, orderID int) error
+	GetStockPolicies(productIDs []int) (map[int]StockPolicy, error)
+	ReserveStock(productID, quantity int, orderID int, destination *UserAddress) error
+	ReserveStockLines(orderID int, lines []CartItem, destination *UserAddress) error
 	ReleaseStock(productID, quantity int, reason string) error
-	AddStock(productID, quantity int, reason string, refType InventoryRefType, refID *int) error
+	AddStock(productID int, warehouseID *int, quantity int, unitCost *Money, lot *LotInfo, reason string, refType InventoryRefType, refID *int) error
 	GetStockHistory(productID int, limit int) ([]InventoryMovement, error)
+	GetMovements(filter MovementFilter) ([]InventoryMovement, error)
+	StreamMovements(filter MovementFilter, fn func(InventoryMovement) error) error
+	GetStockLevel(productID int) (*StockLevel, error)
+	CommitReservation(orderID int) error
+	ReleaseReservation(orderID int) error
+	ReverseCommittedReservation(orderID int) error
+	RestockReturn(orderID, productID, quantity int, unitCost *Money, reason string, returnID int) error
+	ExpireHolds(limit int) ([]int, error)
+	AdjustStock(productID int, warehouseID *int, quantity int, reasonCode AdjustmentReason, note string) error
+	TransferStock(productID, fromWarehouseID, toWarehouseID, quantity int, note string) (*StockTransfer, error)
+	GetWarehouseStock(warehouseID int) ([]WarehouseStock, error)
+}
+
+// AdjustmentReason says why stock was corrected outside of sales and restocks
+type AdjustmentReason string
+
+const (
+	AdjustmentDamaged         AdjustmentReason = "DAMAGED"
+	AdjustmentLost            AdjustmentReason = "LOST"
+	AdjustmentTheft           AdjustmentReason = "THEFT"
+	AdjustmentExpired         AdjustmentReason = "EXPIRED"
+	AdjustmentFound           AdjustmentReason = "FOUND"
+	AdjustmentCountCorrection AdjustmentReason = "COUNT_CORRECTION"
+	AdjustmentOther           AdjustmentReason = "OTHER"
+)
+
+// AdjustStockPayload is a signed correction: negative quantities write stock off
+type AdjustStockPayload struct {
+	WarehouseID *int             `json:"warehouseId,omitempty"` // the default warehouse when omitted
+	Quantity    int              `json:"quantity" validate:"required,ne=0"`
+	ReasonCode  AdjustmentReason `json:"reasonCode" validate:"required,oneof=DAMAGED LOST THEFT EXPIRED FOUND COUNT_CORRECTION OTHER"`
+	Note        string           `json:"note" validate:"max=100"`
+}
+
+// Stock take (physical count) types
+type StockTakeStatus string
+
+const (
+	StockTakeOpen      StockTakeStatus = "OPEN"
+	StockTakePosted    StockTakeStatus = "POSTED"
+	StockTakeCancelled StockTakeStatus = "CANCELLED"
+)
+
+type StockTake struct {
+	ID          int             `json:"id"`
+	WarehouseID int             `json:"warehouseId"`
+	Status      StockTakeStatus `json:"status"`
+	Note        string          `json:"note"`
+	CreatedBy   int             `json:"createdBy"`
+	Lines       []StockTakeLine `json:"lines"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	PostedAt    *time.Time      `json:"postedAt,omitempty"`
+}
+
+// StockTakeLine is the counted quantity of a product. While the stock take is
+// open the expected quantity is the current on-hand stock; posting freezes it.
+type StockTakeLine struct {
+	ProductID        int `json:"productId"`
+	CountedQuantity  int `json:"countedQuantity"`
+	ExpectedQuantity int `json:"expectedQuantity"`
+	Variance         int `json:"variance"`
+}
+
+type CreateStockTakePayload struct {
+	WarehouseID *int   `json:"warehouseId,omitempty"` // the default warehouse when omitted
+	Note        string `json:"note" validate:"max=255"`
+}
+
+type StockCountPayload struct {
+	ProductID       int `json:"productId" validate:"required"`
+	CountedQuantity int `json:"countedQuantity" validate:"gte=0"`
+}
+
+type SubmitStockCountsPayload struct {
+	Counts []StockCountPayload `json:"counts" validate:"required,min=1,dive"`
+}
+
+// Stock Take Store interface
+type StockTakeStore interface {
+	CreateStockTake(warehouseID *int, note string, createdBy int) (int, error)
+	GetStockTakes(status *StockTakeStatus) ([]StockTake, error)
+	GetStockTake(stockTakeID int) (*StockTake, error)
+	SetStockCounts(stockTakeID int, counts []StockCountPayload) error
+	PostStockTake(stockTakeID int) error
+	CancelStockTake(stockTakeID int) error
+}
+
+// StockLevel splits the stock of a product into what is on hand and what is
+// held for unpaid orders
+type StockLevel struct {
+	ProductID  int              `json:"productId"`
+	OnHand     int              `json:"onHand"`
+	Held       int              `json:"held"`
+	Expired    int              `json:"expired"` // in expired lots, on hand until written off but not for sale
+	Available  int              `json:"available"`
+	Warehouses []WarehouseStock `json:"warehouses"`
+}
+
+// WarehouseStock is the stock level of a product in one warehouse
+type WarehouseStock struct {
+	ProductID     int    `json:"productId"`
+	WarehouseID   int    `json:"warehouseId"`
+	WarehouseCode string `json:"warehouseCode"`
+	OnHand        int    `json:"onHand"`
+	Held          int    `json:"held"`
+	Expired       int    `json:"expired"`
+	Available     int    `json:"available"`
+}
+
+// StockAllocation is the part of an order line held or shipped from a warehouse
+type StockAllocation struct {
+	WarehouseID   int    `json:"warehouseId"`
+	WarehouseCode string `json:"warehouseCode"`
+	Quantity      int    `json:"quantity"`
+	Backordered   bool   `json:"backordered,omitempty"` // ordered beyond stock, ships when restocked
+}
+
+// LotInfo identifies the lot (batch) stock is received in
+type LotInfo struct {
+	LotNumber string
+	ExpiresAt *time.Time // nil for lots that do not expire
+}
+
+// StockLot is a lot of a product in a warehouse
+type StockLot struct {
+	ID          int        `json:"id"`
+	ProductID   int        `json:"productId"`
+	WarehouseID int        `json:"warehouseId"`
+	LotNumber   string     `json:"lotNumber"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	Quantity    int        `json:"quantity"`
+	Expired     bool       `json:"expired"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// Stock Lot Store interface
+type StockLotStore interface {
+	GetProductLots(productID int) ([]StockLot, error)
+	GetExpiringLots(days int, warehouseID *int) ([]StockLot, error)
+	WriteOffExpiredLots(warehouseID *int) ([]StockLot, error)
+}
+
+// StockPolicyType says what happens to orders beyond the available stock of a product
+type StockPolicyType string
+
+const (
+	StockPolicyDeny      StockPolicyType = "deny"      // reject them
+	StockPolicyBackorder StockPolicyType = "backorder" // accept up to a limit, ship when restocked
+	StockPolicyPreorder  StockPolicyType = "preorder"  // accept until the release date
+)
+
+// StockPolicy lets a product be ordered beyond its available stock
+type StockPolicy struct {
+	ProductID int             `json:"productId"`
+	Policy    StockPolicyType `json:"policy"`
+	// Limit caps the units on order beyond stock: required for backorders,
+	// pre-orders are unlimited without it
+	Limit       *int       `json:"limit,omitempty"`
+	ReleaseDate *time.Time `json:"releaseDate,omitempty"` // pre-orders are taken until this date
+}
+
+// Orderable is how many units can be ordered when inStock units are available
+// and backlog units are already on order beyond stock
+func (p StockPolicy) Orderable(inStock, backlog int, now time.Time) int {
+	switch {
+	case p.Policy == StockPolicyBackorder && p.Limit != nil:
+		return inStock + max(*p.Limit-backlog, 0)
+	case p.Policy == StockPolicyPreorder && p.ReleaseDate != nil && now.Before(*p.ReleaseDate):
+		if p.Limit == nil {
+			return math.MaxInt
+		}
+		return inStock + max(*p.Limit-backlog, 0)
+	default:
+		return inStock
+	}
+}
+
+type SetStockPolicyPayload struct {
+	Policy      StockPolicyType `json:"policy" validate:"required,oneof=deny backorder preorder"`
+	Limit       *int            `json:"limit,omitempty" validate:"omitempty,gt=0"`
+	ReleaseDate string          `json:"releaseDate,omitempty"` // YYYY-MM-DD, required for pre-orders
+}
+
+type BackorderStatus string
+
+const (
+	BackorderStatusOpen      BackorderStatus = "OPEN"      // still waiting for stock
+	BackorderStatusAllocated BackorderStatus = "ALLOCATED" // incoming stock covers it, ready to ship
+	BackorderStatusCancelled BackorderStatus = "CANCELLED" // the order was cancelled after payment
+)
+
+// Backorder is a paid order line, or part of one, taken beyond the available stock
+type Backorder struct {
+	ID          int             `json:"id"`
+	OrderID     int             `json:"orderId"`
+	ProductID   int             `json:"productId"`
+	WarehouseID int             `json:"warehouseId"`
+	Quantity    int             `json:"quantity"`
+	Allocated   int             `json:"allocated"` // units of incoming stock assigned so far
+	Status      BackorderStatus `json:"status"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	AllocatedAt *time.Time      `json:"allocatedAt,omitempty"`
+}
+
+type AllocateBackordersPayload struct {
+	ProductID *int `json:"productId,omitempty"` // all products with open backorders when omitted
+}
+
+// Backorder Store interface
+type BackorderStore interface {
+	GetStockPolicy(productID int) (*StockPolicy, error)
+	SetStockPolicy(policy StockPolicy) error
+	GetBackorders(status *BackorderStatus) ([]Backorder, error)
+	AllocateBackorders(productID *int) ([]Backorder, error)
+}
+
+type StockTransfer struct {
+	ID              int       `json:"id"`
+	ProductID       int       `json:"productId"`
+	FromWarehouseID int       `json:"fromWarehouseId"`
+	ToWarehouseID   int       `json:"toWarehouseId"`
+	Quantity        int       `json:"quantity"`
+	Note            string    `json:"note"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+type TransferStockPayload struct {
+	FromWarehouseID int    `json:"fromWarehouseId" validate:"required"`
+	ToWarehouseID   int    `json:"toWarehouseId" validate:"required,nefield=FromWarehouseID"`
+	Quantity        int    `json:"quantity" validate:"required,gt=0"`
+	Note            string `json:"note" validate:"max=100"`
+}
+
+// ReservationStrategy decides which warehouses checkout holds stock in
+type ReservationStrategy string
+
+const (
+	// ReservePriority ships from the first warehouse by priority that has the whole quantity
+	ReservePriority ReservationStrategy = "priority"
+	// ReserveNearest ships from the warehouse closest to the shipping address that has the whole quantity
+	ReserveNearest ReservationStrategy = "nearest"
+	// ReserveSplit takes stock from warehouses in priority order until the quantity is covered
+	ReserveSplit ReservationStrategy = "split"
+)
+
+// Warehouse types
+type Warehouse struct {
+	ID            int       `json:"id"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Country       string    `json:"country"`
+	StateProvince *string   `json:"stateProvince,omitempty"`
+	Priority      int       `json:"priority"`
+	IsDefault     bool      `json:"isDefault"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type WarehousePayload struct {
+	Code          string  `json:"code" validate:"required,max=20"`
+	Name          string  `json:"name" validate:"required,max=100"`
+	Country       string  `json:"country" validate:"required,max=100"`
+	StateProvince *string `json:"stateProvince,omitempty" validate:"omitempty,max=100"`
+	Priority      int     `json:"priority"`
+	IsDefault     bool    `json:"isDefault"`
+}
+
+// Warehouse Store interface
+type WarehouseStore interface {
+	GetWarehouses() ([]Warehouse, error)
+	GetWarehouse(warehouseID int) (*Warehouse, error)
+	CreateWarehouse(warehouse *Warehouse) error
+	UpdateWarehouse(warehouse *Warehouse) error
+}
+
+// StockDrift is a product whose materialized stock level disagrees with
+// its movement ledger
+type StockDrift struct {
+	ProductID   int `json:"productId"`
+	WarehouseID int `json:"warehouseId"`
+	Ledger      int `json:"ledger"`
+	StockLevel  int `json:"stockLevel"`
+}
+
+type StockHoldStatus string
+
+const (
+	HoldStatusActive    StockHoldStatus = "ACTIVE"
+	HoldStatusCommitted StockHoldStatus = "COMMITTED"
+	HoldStatusReleased  StockHoldStatus = "RELEASED"
+	HoldStatusExpired   StockHoldStatus = "EXPIRED"
+)
+
+// StockAlertState is where a product stands against its reorder threshold
+type StockAlertState string
+
+const (
+	StockAlertOK         StockAlertState = "OK"
+	StockAlertLowStock   StockAlertState = "LOW_STOCK"
+	StockAlertOutOfStock StockAlertState = "OUT_OF_STOCK"
+)
+
+// StockAlert is a product currently at or below its reorder threshold
+type StockAlert struct {
+	ProductID    int             `json:"productId"`
+	ProductName  string          `json:"productName"`
+	State        StockAlertState `json:"state"`
+	Available    int             `json:"available"`
+	ReorderLevel int             `json:"reorderLevel"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+}
+
+type SetReorderThresholdPayload struct {
+	ReorderLevel *int `json:"reorderLevel" validate:"required,gte=0"`
+}
+
+type StockSubscriptionStatus string
+
+const (
+	SubscriptionActive    StockSubscriptionStatus = "ACTIVE"
+	SubscriptionNotified  StockSubscriptionStatus = "NOTIFIED"
+	SubscriptionCancelled StockSubscriptionStatus = "CANCELLED"
+)
+
+// StockSubscription is a customer waiting to hear that a product is back in stock
+type StockSubscription struct {
+	ID         int                     `json:"id"`
+	ProductID  int                     `json:"productId"`
+	UserID     int                     `json:"userId"`
+	Status     StockSubscriptionStatus `json:"status"`
+	CreatedAt  time.Time               `json:"createdAt"`
+	NotifiedAt *time.Time              `json:"notifiedAt,omitempty"`
+}
+
+// ValuationMethod decides how stock on hand and sold goods are costed
+type ValuationMethod string
+
+const (
+	// ValuationFIFO costs goods at the price of the oldest units still in stock
+	ValuationFIFO ValuationMethod = "fifo"
+	// ValuationAverage costs goods at the weighted average price of all units bought
+	ValuationAverage ValuationMethod = "average"
+)
+
+// ProductValuation is the value of the stock of a product, in the base currency
+type ProductValuation struct {
+	ProductID   int    `json:"productId"`
+	ProductName string `json:"productName"`
+	OnHand      int    `json:"onHand"`
+	UnitCost    Money  `json:"unitCost"`
+	Value       Money  `json:"value"`
+}
+
+// OrderMargin is the gross margin of an order: revenue net of tax and
+// shipping, less the cost of the goods. Amounts are in the base currency.
+type OrderMargin struct {
+	OrderID       int       `json:"orderId"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Revenue       Money     `json:"revenue"`
+	Cost          Money     `json:"cost"`
+	Margin        Money     `json:"margin"`
+	MarginPercent float64   `json:"marginPercent"`
+	UncostedItems int       `json:"uncostedItems"` // lines sold before costs were tracked
+}
+
+// Valuation Store interface
+type ValuationStore interface {
+	ValuationMethod() ValuationMethod
+	GetStockValuation(method ValuationMethod) ([]ProductValuation, error)
+	GetOrderMargins(from, to *time.Time) ([]OrderMargin, error)
+}
+
+// Stock Alert Store interface
+type StockAlertStore interface {
+	SetReorderThreshold(productID, reorderLevel int) error
+	GetStockAlerts() ([]StockAlert, error)
+	Subscribe(productID, userID int) (*StockSubscription, error)
+	Unsubscribe(productID, userID int) error
+}
+
+// StockEventType names a stock notification
+type StockEventType string
+
+const (
+	StockEventLowStock    StockEventType = "LOW_STOCK"
+	StockEventOutOfStock  StockEventType = "OUT_OF_STOCK"
+	StockEventBackInStock StockEventType = "BACK_IN_STOCK"
+)
+
+// StockEvent is raised to a Notifier. Low and out of stock events are meant
+// for the shop, back in stock events for the subscribed customer in Email.
+type StockEvent struct {
+	Type         StockEventType `json:"type"`
+	ProductID    int            `json:"productId"`
+	ProductName  string         `json:"productName"`
+	Available    int            `json:"available"`
+	ReorderLevel int            `json:"reorderLevel,omitempty"`
+	UserID       int            `json:"userId,omitempty"`
+	Email        string         `json:"email,omitempty"`
+	OccurredAt   time.Time      `json:"occurredAt"`
+}
+
+// Notifier delivers stock events to a sink (log, webhook, email)
+type Notifier interface {
+	Notify(event StockEvent) error
+}
+
+// EmailSender sends a plain text email
+type EmailSender interface {
+	SendEmail(to, subject, body string) error
 }
 
 // User Address types
@@ -190,6 +933,69 @@ type UserAddress struct {
 	UpdatedAt     time.Time `json:"updatedAt"`
 }
 
+// Order address types
+const (
+	OrderAddressShipping = "shipping"
+	OrderAddressBilling  = "billing"
+)
+
+// OrderAddress is a copy of a user address kept with an order, so editing or
+// deleting the address later doesn't change where the order went
+type OrderAddress struct {
+	Title         string  `json:"title,omitempty"`
+	FirstName     string  `json:"firstName"`
+	LastName      string  `json:"lastName"`
+	Company       *string `json:"company,omitempty"`
+	AddressLine1  string  `json:"addressLine1"`
+	AddressLine2  *string `json:"addressLine2,omitempty"`
+	City          string  `json:"city"`
+	StateProvince string  `json:"stateProvince"`
+	PostalCode    string  `json:"postalCode"`
+	Country       string  `json:"country"`
+	Phone         *string `json:"phone,omitempty"`
+}
+
+// NewOrderAddress copies a user address for an order
+func NewOrderAddress(addr *UserAddress) *OrderAddress {
+	return &OrderAddress{
+		Title:         addr.Title,
+		FirstName:     addr.FirstName,
+		LastName:      addr.LastName,
+		Company:       addr.Company,
+		AddressLine1:  addr.AddressLine1,
+		AddressLine2:  addr.AddressLine2,
+		City:          addr.City,
+		StateProvince: addr.StateProvince,
+		PostalCode:    addr.PostalCode,
+		Country:       addr.Country,
+		Phone:         addr.Phone,
+	}
+}
+
+// Format renders the address as lines of text, e.g. for a shipping label
+func (a OrderAddress) Format() string {
+	addressString := fmt.Sprintf("%s %s", a.FirstName, a.LastName)
+
+	if a.Company != nil && *a.Company != "" {
+		addressString += fmt.Sprintf("\n%s", *a.Company)
+	}
+
+	addressString += fmt.Sprintf("\n%s", a.AddressLine1)
+
+	if a.AddressLine2 != nil && *a.AddressLine2 != "" {
+		addressString += fmt.Sprintf("\n%s", *a.AddressLine2)
+	}
+
+	addressString += fmt.Sprintf("\n%s, %s %s", a.City, a.StateProvince, a.PostalCode)
+	addressString += fmt.Sprintf("\n%s", a.Country)
+
+	if a.Phone != nil && *a.Phone != "" {
+		addressString += fmt.Sprintf("\nPhone: %s", *a.Phone)
+	}
+
+	return addressString
+}
+
 type CreateAddressPayload struct {
 	Title         string  `json:"title" validate:"required,max=100"`
 	FirstName     string  `json:"firstName" validate:"required,max=100"`
@@ -230,3 +1036,485 @@ type AddressStore interface {
 	GetDefaultAddress(userID int) (*UserAddress, error)
 	SetDefaultAddress(addressID, userID int) error
 }
+
+// Tax types
+type TaxRate struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Country       string    `json:"country"`
+	StateProvince *string   `json:"stateProvince,omitempty"`
+	TaxClass      string    `json:"taxClass"`
+	Rate          Rate      `json:"rate"`
+	Inclusive     bool      `json:"inclusive"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type CreateTaxRatePayload struct {
+	Name          string  `json:"name" validate:"required,max=100"`
+	Country       string  `json:"country" validate:"required,max=100"`
+	StateProvince *string `json:"stateProvince,omitempty" validate:"omitempty,max=100"`
+	TaxClass      string  `json:"taxClass,omitempty" validate:"omitempty,max=50"`
+	Rate          Rate    `json:"rate" validate:"gte=0,lt=1"`
+	Inclusive     bool    `json:"inclusive"`
+}
+
+const DefaultTaxClass = "standard"
+
+// TaxableLine is a single cart line to be taxed
+type TaxableLine struct {
+	ProductID int    `json:"productId"`
+	TaxClass  string `json:"taxClass"`
+	UnitPrice Money  `json:"unitPrice"`
+	Quantity  int    `json:"quantity"`
+}
+
+// TaxLine is the tax result for a single cart line
+type TaxLine struct {
+	ProductID int   `json:"productId"`
+	Quantity  int   `json:"quantity"`
+	UnitPrice Money `json:"unitPrice"`
+	TaxRate   Rate  `json:"taxRate"`
+	Inclusive bool  `json:"inclusive"`
+	Subtotal  Money `json:"subtotal"`
+	Tax       Money `json:"tax"`
+	Total     Money `json:"total"`
+}
+
+// TaxBreakdown is the tax result for a whole cart
+type TaxBreakdown struct {
+	Lines    []TaxLine `json:"lines"`
+	Subtotal Money     `json:"subtotal"`
+	Tax      Money     `json:"tax"`
+	Total    Money     `json:"total"`
+}
+
+// Tax Store interface
+type TaxStore interface {
+	GetTaxRates() ([]TaxRate, error)
+	GetTaxRatesForCountry(country string) ([]TaxRate, error)
+	CreateTaxRate(payload CreateTaxRatePayload) (*TaxRate, error)
+	DeleteTaxRate(id int) error
+}
+
+// TaxCalculator computes taxes for cart lines shipped to an address
+type TaxCalculator interface {
+	Calculate(address *UserAddress, lines []TaxableLine) (*TaxBreakdown, error)
+}
+
+// Shipping types
+type ShippingRateType string
+
+const (
+	ShippingRateFlat     ShippingRateType = "FLAT"
+	ShippingRateWeight   ShippingRateType = "WEIGHT"
+	ShippingRateFreeOver ShippingRateType = "FREE_OVER"
+)
+
+type ShippingZone struct {
+	ID        int                  `json:"id"`
+	Name      string               `json:"name"`
+	Regions   []ShippingZoneRegion `json:"regions"`
+	Methods   []ShippingMethod     `json:"methods"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+type ShippingZoneRegion struct {
+	ID            int     `json:"id"`
+	ZoneID        int     `json:"zoneId"`
+	Country       string  `json:"country"`
+	StateProvince *string `json:"stateProvince,omitempty"`
+}
+
+type ShippingMethod struct {
+	ID            int              `json:"id"`
+	ZoneID        int              `json:"zoneId"`
+	Name          string           `json:"name"`
+	RateType      ShippingRateType `json:"rateType"`
+	BaseRate      Money            `json:"baseRate"`
+	PerKgRate     Money            `json:"perKgRate"`
+	FreeThreshold *Money           `json:"freeThreshold,omitempty"`
+	IsActive      bool             `json:"isActive"`
+	CreatedAt     time.Time        `json:"createdAt"`
+}
+
+type ShippingRegionPayload struct {
+	Country       string  `json:"country" validate:"required,max=100"`
+	StateProvince *string `json:"stateProvince,omitempty" validate:"omitempty,max=100"`
+}
+
+type CreateShippingZonePayload struct {
+	Name    string                  `json:"name" validate:"required,max=100"`
+	Regions []ShippingRegionPayload `json:"regions" validate:"required,min=1,dive"`
+}
+
+type CreateShippingMethodPayload struct {
+	Name          string           `json:"name" validate:"required,max=100"`
+	RateType      ShippingRateType `json:"rateType" validate:"required,oneof=FLAT WEIGHT FREE_OVER"`
+	BaseRate      Money            `json:"baseRate" validate:"gte=0"`
+	PerKgRate     Money            `json:"perKgRate" validate:"gte=0"`
+	FreeThreshold *Money           `json:"freeThreshold,omitempty" validate:"omitempty,gte=0"` // Required for FREE_OVER
+}
+
+// ShippingQuote is the price of a shipping method for a particular cart
+type ShippingQuote struct {
+	MethodID int    `json:"methodId"`
+	Name     string `json:"name"`
+	Cost     Money  `json:"cost"`
+}
+
+// Shipping Store interface
+type ShippingStore interface {
+	GetZones() ([]ShippingZone, error)
+	CreateZone(payload CreateShippingZonePayload) (*ShippingZone, error)
+	DeleteZone(zoneID int) error
+	CreateMethod(zoneID int, payload CreateShippingMethodPayload) (*ShippingMethod, error)
+	DeleteMethod(methodID int) error
+	GetMethodsForRegion(country, stateProvince string) ([]ShippingMethod, error)
+}
+
+// ShippingCalculator prices the shipping methods available for an address
+type ShippingCalculator interface {
+	Quote(address *UserAddress, weightGrams int, subtotal Money) ([]ShippingQuote, error)
+}
+
+// Currency types
+type ExchangeRate struct {
+	BaseCurrency  string    `json:"baseCurrency"`
+	QuoteCurrency string    `json:"quoteCurrency"`
+	Rate          Rate      `json:"rate"` // 1 base = rate quote
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type SetExchangeRatePayload struct {
+	BaseCurrency  string `json:"baseCurrency" validate:"required,len=3"`
+	QuoteCurrency string `json:"quoteCurrency" validate:"required,len=3,nefield=BaseCurrency"`
+	Rate          Rate   `json:"rate" validate:"required,gt=0"`
+}
+
+type SetProductPricePayload struct {
+	Price Money `json:"price" validate:"required,gt=0"`
+}
+
+// Currency Store interface
+type CurrencyStore interface {
+	GetExchangeRates() ([]ExchangeRate, error)
+	GetExchangeRate(baseCurrency, quoteCurrency string) (*ExchangeRate, error)
+	SetExchangeRate(payload SetExchangeRatePayload) (*ExchangeRate, error)
+	DeleteExchangeRate(baseCurrency, quoteCurrency string) error
+	GetProductPrices(productIDs []int, currency string) (map[int]Money, error)
+	SetProductPrice(productID int, price Money) error
+	DeleteProductPrice(productID int, currency string) error
+}
+
+// CurrencyConverter converts prices between the supported currencies
+type CurrencyConverter interface {
+	GetRate(from, to string) (Rate, error)
+	Convert(amount Money, to string) (Money, error)
+	PriceProducts(products []Product, currency string) ([]Product, error)
+}
+
+// Payment types
+type PaymentStatus string
+
+const (
+	PaymentStatusPending   PaymentStatus = "pending"
+	PaymentStatusSucceeded PaymentStatus = "succeeded"
+	PaymentStatusFailed    PaymentStatus = "failed"
+	PaymentStatusExpired   PaymentStatus = "expired"
+)
+
+// Payment is one payment attempt for an order
+type Payment struct {
+	ID                int           `json:"id"`
+	OrderID           int           `json:"orderId"`
+	Provider          string        `json:"provider"`
+	ProviderPaymentID string        `json:"providerPaymentId"`
+	Amount            Money         `json:"amount"`
+	Status            PaymentStatus `json:"status"`
+	FailureReason     *string       `json:"failureReason,omitempty"`
+	CreatedAt         time.Time     `json:"createdAt"`
+	UpdatedAt         time.Time     `json:"updatedAt"`
+}
+
+type PayOrderPayload struct {
+	PaymentMethod string `json:"paymentMethod" validate:"required,max=255"` // provider token, e.g. "tok_visa"
+}
+
+// PaymentIntent is the provider side state of a payment
+type PaymentIntent struct {
+	ID            string
+	Status        PaymentIntentStatus
+	Amount        Money
+	FailureReason string
+}
+
+type PaymentIntentStatus string
+
+const (
+	IntentRequiresCapture PaymentIntentStatus = "requires_capture"
+	IntentProcessing      PaymentIntentStatus = "processing" // settled later through a webhook
+	IntentSucceeded       PaymentIntentStatus = "succeeded"
+	IntentFailed          PaymentIntentStatus = "failed"
+	IntentExpired         PaymentIntentStatus = "expired"
+)
+
+// PaymentRefund is a refund issued by the provider
+type PaymentRefund struct {
+	ID     string
+	Amount Money
+}
+
+// PaymentEvent is a verified webhook notification from the provider
+type PaymentEvent struct {
+	IntentID      string
+	Status        PaymentIntentStatus
+	FailureReason string
+}
+
+// PaymentProvider is a payment gateway
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(orderID int, amount Money, paymentMethod string) (*PaymentIntent, error)
+	Capture(intentID string) (*PaymentIntent, error)
+	Refund(intentID string, amount Money) (*PaymentRefund, error)
+	ParseWebhook(payload []byte, signature string) (*PaymentEvent, error)
+}
+
+// Payment Store interface
+type PaymentStore interface {
+	CreatePayment(payment *Payment) error
+	UpdatePaymentStatus(paymentID int, status PaymentStatus, failureReason *string) (bool, error)
+	GetPaymentByProviderID(provider, providerPaymentID string) (*Payment, error)
+	GetPaymentsForOrder(orderID int) ([]Payment, error)
+}
+
+// Return (RMA) types
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "requested"
+	ReturnStatusApproved  ReturnStatus = "approved"
+	ReturnStatusRejected  ReturnStatus = "rejected"
+	ReturnStatusReceived  ReturnStatus = "received"
+	ReturnStatusRefunding ReturnStatus = "refunding" // claimed while the provider refunds it
+	ReturnStatusRefunded  ReturnStatus = "refunded"
+)
+
+type Return struct {
+	ID           int          `json:"id"`
+	OrderID      int          `json:"orderId"`
+	UserID       int          `json:"userId"`
+	Status       ReturnStatus `json:"status"`
+	Reason       string       `json:"reason"`
+	RefundAmount Money        `json:"refundAmount"` // sum of the lines
+	Items        []ReturnItem `json:"items"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+type ReturnItem struct {
+	ID           int    `json:"id"`
+	ReturnID     int    `json:"returnId"`
+	OrderItemID  int    `json:"orderItemId"`
+	ProductID    int    `json:"productId"`
+	Quantity     int    `json:"quantity"`
+	Restockable  bool   `json:"restockable"`
+	RefundAmount Money  `json:"refundAmount"`
+	UnitCost     *Money `json:"-"` // cost of the order line, restocked units go back at it
+}
+
+type ReturnItemPayload struct {
+	OrderItemID int `json:"orderItemId" validate:"required"`
+	Quantity    int `json:"quantity" validate:"required,min=1"`
+}
+
+type CreateReturnPayload struct {
+	Items  []ReturnItemPayload `json:"items" validate:"required,min=1,dive"`
+	Reason string              `json:"reason" validate:"required,max=1000"`
+}
+
+type ReceiveReturnItemPayload struct {
+	ReturnItemID int  `json:"returnItemId" validate:"required"`
+	Restockable  bool `json:"restockable"`
+}
+
+type ReceiveReturnPayload struct {
+	Items []ReceiveReturnItemPayload `json:"items" validate:"dive"` // Optional: lines not listed are restockable
+}
+
+type RefundReturnPayload struct {
+	Amount *Money `json:"amount,omitempty"` // Optional: defaults to the refund amount of the return
+}
+
+// Refund is money paid back to the customer for an order
+type Refund struct {
+	ID               int       `json:"id"`
+	OrderID          int       `json:"orderId"`
+	ReturnID         *int      `json:"returnId,omitempty"`
+	PaymentID        *int      `json:"paymentId,omitempty"`
+	Amount           Money     `json:"amount"`
+	ProviderRefundID string    `json:"providerRefundId"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// Return Store interface
+type ReturnStore interface {
+	CreateReturn(ret *Return) error
+	GetReturn(returnID int) (*Return, error)
+	GetReturns(status *ReturnStatus) ([]Return, error)
+	GetReturnsForOrder(orderID int) ([]Return, error)
+	GetReturnedQuantities(orderID int) (map[int]int, error)
+	UpdateReturnStatus(returnID int, fromStatus, toStatus ReturnStatus) error
+	MarkReturnReceived(returnID int, restockable map[int]bool) error
+	CreateRefund(refund *Refund) error
+	GetRefundsForOrder(orderID int) ([]Refund, error)
+}
+
+// InvoiceSeller is the business named on invoices
+type InvoiceSeller struct {
+	Name    string
+	Address string
+	TaxID   string // VAT or sales tax registration
+	Email   string
+}
+
+// Invoice is an invoice issued for an order. Its PDF is kept as issued, so an
+// invoice never changes whatever later happens to the order or the seller.
+type Invoice struct {
+	ID           int       `json:"id"`
+	OrderID      int       `json:"orderId"`
+	Number       string    `json:"number"` // gapless within the year it was issued
+	Currency     string    `json:"currency"`
+	Subtotal     Money     `json:"subtotal"`
+	Tax          Money     `json:"tax"`
+	ShippingCost Money     `json:"shippingCost"`
+	Total        Money     `json:"total"`
+	IssuedAt     time.Time `json:"issuedAt"`
+	PDF          []byte    `json:"-"`
+}
+
+// Invoice Store interface
+type InvoiceStore interface {
+	// IssueInvoice numbers the invoice and stores it with the PDF render makes
+	// of it. Fails with "invoice already issued" when the order has one.
+	IssueInvoice(invoice *Invoice, render func(Invoice) ([]byte, error)) error
+	GetInvoice(orderID int) (*Invoice, error)
+}
+
+// Supplier is a vendor purchase orders are placed with
+type Supplier struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Phone        string    `json:"phone"`
+	LeadTimeDays int       `json:"leadTimeDays"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type SupplierPayload struct {
+	Name         string `json:"name" validate:"required,max=255"`
+	Email        string `json:"email" validate:"omitempty,email"`
+	Phone        string `json:"phone" validate:"max=50"`
+	LeadTimeDays *int   `json:"leadTimeDays" validate:"omitempty,gte=0"` // Optional: defaults to 7 days
+}
+
+type PurchaseOrderStatus string
+
+const (
+	PurchaseOrderOpen              PurchaseOrderStatus = "OPEN"
+	PurchaseOrderPartiallyReceived PurchaseOrderStatus = "PARTIALLY_RECEIVED"
+	PurchaseOrderReceived          PurchaseOrderStatus = "RECEIVED"
+	PurchaseOrderCancelled         PurchaseOrderStatus = "CANCELLED"
+)
+
+// PurchaseOrder is stock ordered from a supplier for one warehouse
+type PurchaseOrder struct {
+	ID           int                 `json:"id"`
+	SupplierID   int                 `json:"supplierId"`
+	SupplierName string              `json:"supplierName"`
+	WarehouseID  int                 `json:"warehouseId"`
+	Status       PurchaseOrderStatus `json:"status"`
+	ExpectedAt   *time.Time          `json:"expectedAt,omitempty"`
+	Note         string              `json:"note"`
+	CreatedBy    int                 `json:"createdBy"`
+	CreatedAt    time.Time           `json:"createdAt"`
+	UpdatedAt    time.Time           `json:"updatedAt"`
+	Lines        []PurchaseOrderLine `json:"lines"`
+}
+
+type PurchaseOrderLine struct {
+	ID               int        `json:"id"`
+	ProductID        int        `json:"productId"`
+	QuantityOrdered  int        `json:"quantityOrdered"`
+	QuantityReceived int        `json:"quantityReceived"`
+	UnitCost         Money      `json:"unitCost"`
+	ExpectedAt       *time.Time `json:"expectedAt,omitempty"`
+}
+
+type PurchaseOrderLinePayload struct {
+	ProductID  int    `json:"productId" validate:"required"`
+	Quantity   int    `json:"quantity" validate:"required,gt=0"`
+	UnitCost   *Money `json:"unitCost"`                                            // Optional: in the base currency
+	ExpectedAt string `json:"expectedAt" validate:"omitempty,datetime=2006-01-02"` // Optional: defaults to the date of the order
+}
+
+type CreatePurchaseOrderPayload struct {
+	SupplierID  int                        `json:"supplierId" validate:"required"`
+	WarehouseID *int                       `json:"warehouseId"` // Optional: defaults to the default warehouse
+	ExpectedAt  string                     `json:"expectedAt" validate:"omitempty,datetime=2006-01-02"`
+	Note        string                     `json:"note" validate:"max=255"`
+	Lines       []PurchaseOrderLinePayload `json:"lines" validate:"required,min=1,dive"`
+}
+
+type ReceivePurchaseOrderLinePayload struct {
+	ProductID int    `json:"productId" validate:"required"`
+	Quantity  int    `json:"quantity" validate:"required,gt=0"`
+	LotNumber string `json:"lotNumber,omitempty" validate:"max=64"` // Optional: for stock tracked by lot
+	ExpiresAt string `json:"expiresAt,omitempty"`                   // Optional: YYYY-MM-DD, requires a lot number
+}
+
+type ReceivePurchaseOrderPayload struct {
+	Lines []ReceivePurchaseOrderLinePayload `json:"lines" validate:"required,min=1,dive"`
+}
+
+// IncomingStock is what open purchase orders still have to deliver for a product
+type IncomingStock struct {
+	ProductID      int        `json:"productId"`
+	ProductName    string     `json:"productName"`
+	Incoming       int        `json:"incoming"`
+	PurchaseOrders int        `json:"purchaseOrders"`
+	NextExpectedAt *time.Time `json:"nextExpectedAt,omitempty"`
+}
+
+// ProductVelocity is a product's recent sales next to its stock position
+type ProductVelocity struct {
+	ProductID    int    `json:"productId"`
+	ProductName  string `json:"productName"`
+	UnitsSold    int    `json:"unitsSold"`
+	Available    int    `json:"available"`
+	Incoming     int    `json:"incoming"`
+	LeadTimeDays int    `json:"leadTimeDays"`
+	SupplierID   *int   `json:"supplierId,omitempty"`
+}
+
+// ReorderSuggestion is how much of a product to order to cover demand until
+// the next review
+type ReorderSuggestion struct {
+	ProductVelocity
+	DailySales        float64 `json:"dailySales"`
+	SuggestedQuantity int     `json:"suggestedQuantity"`
+}
+
+// Purchase Order Store interface
+type PurchaseOrderStore interface {
+	GetSuppliers() ([]Supplier, error)
+	GetSupplier(supplierID int) (*Supplier, error)
+	CreateSupplier(supplier *Supplier) error
+	CreatePurchaseOrder(po *PurchaseOrder) error
+	GetPurchaseOrder(purchaseOrderID int) (*PurchaseOrder, error)
+	GetPurchaseOrders(statuses []PurchaseOrderStatus) ([]PurchaseOrder, error)
+	ReceivePurchaseOrder(purchaseOrderID int, lines []ReceivePurchaseOrderLinePayload) (*PurchaseOrder, error)
+	CancelPurchaseOrder(purchaseOrderID int) error
+	GetIncomingStock() ([]IncomingStock, error)
+	GetProductVelocity(since time.Time) ([]ProductVelocity, error)
+}
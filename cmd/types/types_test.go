@@ -0,0 +1,63 @@
+package types
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStockPolicyOrderable(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	limit := 5
+	release := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	released := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		policy   StockPolicy
+		inStock  int
+		backlog  int
+		expected int
+	}{
+		{"deny", StockPolicy{Policy: StockPolicyDeny}, 3, 0, 3},
+		{"no policy", StockPolicy{}, 3, 0, 3},
+		{"backorder with stock", StockPolicy{Policy: StockPolicyBackorder, Limit: &limit}, 3, 0, 8},
+		{"backorder with a backlog", StockPolicy{Policy: StockPolicyBackorder, Limit: &limit}, 0, 4, 1},
+		{"backorder over its limit", StockPolicy{Policy: StockPolicyBackorder, Limit: &limit}, 0, 7, 0},
+		{"pre-order", StockPolicy{Policy: StockPolicyPreorder, ReleaseDate: &release}, 0, 100, math.MaxInt},
+		{"pre-order with a limit", StockPolicy{Policy: StockPolicyPreorder, Limit: &limit, ReleaseDate: &release}, 0, 2, 3},
+		{"released pre-order", StockPolicy{Policy: StockPolicyPreorder, ReleaseDate: &released}, 2, 0, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.Orderable(test.inStock, test.backlog, now); got != test.expected {
+				t.Errorf("Expected %d orderable units, got %d", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestOrderAddressFormat(t *testing.T) {
+	company := "Acme"
+	empty := ""
+	phone := "+49 30 123"
+
+	address := OrderAddress{
+		FirstName:     "Jane",
+		LastName:      "Doe",
+		Company:       &company,
+		AddressLine1:  "1 Main St",
+		AddressLine2:  &empty,
+		City:          "Berlin",
+		StateProvince: "BE",
+		PostalCode:    "10115",
+		Country:       "Germany",
+		Phone:         &phone,
+	}
+
+	expected := "Jane Doe\nAcme\n1 Main St\nBerlin, BE 10115\nGermany\nPhone: +49 30 123"
+	if got := address.Format(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
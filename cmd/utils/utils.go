@@ -4,11 +4,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
 
+	"github.com/HollyEllmo/go_rest_tut/cmd/types"
 	"github.com/go-playground/validator/v10"
 )
 
-var Validate = validator.New()
+var Validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	// validate money by its minor units and rates by their value,
+	// so tags such as gt=0 and lt=1 keep working
+	v.RegisterCustomTypeFunc(func(field reflect.Value) any {
+		return field.Interface().(types.Money).Amount
+	}, types.Money{})
+	v.RegisterCustomTypeFunc(func(field reflect.Value) any {
+		return field.Interface().(types.Rate).Float64()
+	}, types.Rate(0))
+
+	return v
+}
 
 func ParseJSON(r *http.Request, payload any) error {
 	if r.Body == nil {